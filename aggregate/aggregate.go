@@ -0,0 +1,389 @@
+// package aggregate provides methods for grouping located records with identical or nearby coordinates in to
+// clusters, each of which is represented by a single GeoJSON feature.
+package aggregate
+
+import (
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/dates"
+	"github.com/aaronland/go-libraryofcongress-datajam/spatial"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"math"
+	"sort"
+	"sync"
+)
+
+// The modes used to group records in to clusters.
+const (
+	// MODE_COORDINATES groups records with identical coordinates.
+	MODE_COORDINATES string = "coordinates"
+	// MODE_DISTANCE groups records within a distance of the first record (ordered by ID) in each cluster.
+	MODE_DISTANCE string = "distance"
+	// MODE_GEOHASH groups records whose coordinates share a geohash.
+	MODE_GEOHASH string = "geohash"
+)
+
+// The default distance, in meters, used by MODE_DISTANCE.
+const DEFAULT_DISTANCE float64 = 100.0
+
+// The default geohash precision used by MODE_GEOHASH.
+const DEFAULT_PRECISION int = 7
+
+// The names of the properties assigned to cluster features.
+const (
+	COUNT_PROPERTY     string = "cluster:count"
+	IDS_PROPERTY       string = "cluster:ids"
+	INCEPTION_PROPERTY string = "cluster:inception"
+	CESSATION_PROPERTY string = "cluster:cessation"
+	UNDATED_PROPERTY   string = "cluster:undated"
+	LABEL_PROPERTY     string = "cluster:label"
+	THUMBNAIL_PROPERTY string = "cluster:thumbnail"
+	GEOHASH_PROPERTY   string = "cluster:geohash"
+)
+
+// Member is a located record to be assigned to a cluster.
+type Member struct {
+	// The record's ID.
+	Id string
+	// The record's coordinates.
+	Point orb.Point
+	// The record's title.
+	Title string
+	// The record's thumbnail image URL.
+	Thumbnail string
+	// The record's date, if it has one.
+	Date *dates.Date
+}
+
+// AggregatorOptions defines options for creating an Aggregator.
+type AggregatorOptions struct {
+	// The mode used to group records in to clusters.
+	Mode string
+	// The distance, in meters, used by MODE_DISTANCE.
+	Distance float64
+	// The geohash precision used by MODE_GEOHASH.
+	Precision int
+}
+
+// Aggregator collects located records and groups them in to clusters.
+type Aggregator struct {
+	options *AggregatorOptions
+	mu      *sync.Mutex
+	members []*Member
+}
+
+// cluster is a group of members. 'seed' is the location of its first member.
+type cluster struct {
+	key     string
+	seed    orb.Point
+	members []*Member
+}
+
+// gridCell is a cell in the grid used to find nearby clusters in MODE_DISTANCE.
+type gridCell struct {
+	row int64
+	col int64
+}
+
+// Modes returns the list of valid aggregation modes.
+func Modes() []string {
+	return []string{MODE_COORDINATES, MODE_DISTANCE, MODE_GEOHASH}
+}
+
+// Columns returns the names of the properties assigned to cluster features for 'mode', in the order they should
+// be written as CSV columns.
+func Columns(mode string) []string {
+
+	columns := []string{
+		COUNT_PROPERTY,
+		LABEL_PROPERTY,
+		IDS_PROPERTY,
+		INCEPTION_PROPERTY,
+		CESSATION_PROPERTY,
+		UNDATED_PROPERTY,
+		THUMBNAIL_PROPERTY,
+	}
+
+	if mode == MODE_GEOHASH {
+		columns = append(columns, GEOHASH_PROPERTY)
+	}
+
+	return columns
+}
+
+// NewAggregator returns a new Aggregator for 'opts'.
+func NewAggregator(opts *AggregatorOptions) (*Aggregator, error) {
+
+	switch opts.Mode {
+	case MODE_COORDINATES:
+		// pass
+	case MODE_DISTANCE:
+
+		if opts.Distance <= 0 {
+			return nil, fmt.Errorf("Invalid distance, %v", opts.Distance)
+		}
+
+	case MODE_GEOHASH:
+
+		if opts.Precision < 1 || opts.Precision > MAX_GEOHASH_PRECISION {
+			return nil, fmt.Errorf("Invalid geohash precision %d, precision must be between 1 and %d", opts.Precision, MAX_GEOHASH_PRECISION)
+		}
+
+	default:
+		return nil, fmt.Errorf("Invalid mode '%s'", opts.Mode)
+	}
+
+	a := &Aggregator{
+		options: opts,
+		mu:      new(sync.Mutex),
+		members: make([]*Member, 0),
+	}
+
+	return a, nil
+}
+
+// Add adds 'm' to 'a'. It is safe for concurrent use.
+func (a *Aggregator) Add(m *Member) {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.members = append(a.members, m)
+}
+
+// Count returns the number of records added to 'a'.
+func (a *Aggregator) Count() int {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.members)
+}
+
+// Features groups the records added to 'a' in to clusters and returns a point feature, located at the average
+// location of its members, for each one. Clusters are ordered by the number of members, largest first. Because
+// records are sorted by ID before they are grouped the results do not depend on the order they were added in.
+func (a *Aggregator) Features() []*geojson.Feature {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	sort.SliceStable(a.members, func(i int, j int) bool {
+
+		if a.members[i].Id != a.members[j].Id {
+			return a.members[i].Id < a.members[j].Id
+		}
+
+		if a.members[i].Point.Lat() != a.members[j].Point.Lat() {
+			return a.members[i].Point.Lat() < a.members[j].Point.Lat()
+		}
+
+		return a.members[i].Point.Lon() < a.members[j].Point.Lon()
+	})
+
+	var clusters []*cluster
+
+	switch a.options.Mode {
+	case MODE_DISTANCE:
+		clusters = a.byDistance()
+	case MODE_GEOHASH:
+		clusters = a.byKey(func(pt orb.Point) string {
+			return Geohash(pt, a.options.Precision)
+		})
+	default:
+		clusters = a.byKey(func(pt orb.Point) string {
+			return fmt.Sprintf("%v,%v", pt.Lat(), pt.Lon())
+		})
+	}
+
+	sort.SliceStable(clusters, func(i int, j int) bool {
+		return len(clusters[i].members) > len(clusters[j].members)
+	})
+
+	features := make([]*geojson.Feature, len(clusters))
+
+	for idx, c := range clusters {
+
+		f := c.feature()
+
+		if a.options.Mode == MODE_GEOHASH {
+			f.Properties[GEOHASH_PROPERTY] = c.key
+		}
+
+		features[idx] = f
+	}
+
+	return features
+}
+
+// byKey groups the members of 'a' by the key that 'key_func' derives from their coordinates.
+func (a *Aggregator) byKey(key_func func(orb.Point) string) []*cluster {
+
+	lookup := make(map[string]*cluster)
+	clusters := make([]*cluster, 0)
+
+	for _, m := range a.members {
+
+		k := key_func(m.Point)
+		c, exists := lookup[k]
+
+		if !exists {
+			c = &cluster{key: k, seed: m.Point}
+			lookup[k] = c
+			clusters = append(clusters, c)
+		}
+
+		c.members = append(c.members, m)
+	}
+
+	return clusters
+}
+
+// byDistance assigns each member of 'a' to the nearest cluster whose first member is within the aggregation
+// distance or, if there isn't one, to a new cluster. Clusters are indexed using a grid of cells whose height is
+// the aggregation distance so only clusters in neighbouring cells need to be compared. Distances are not
+// calculated across the antimeridian.
+func (a *Aggregator) byDistance() []*cluster {
+
+	distance := a.options.Distance
+
+	// The size of a grid cell in degrees (of latitude)
+	cell_size := distance / (orb.EarthRadius * math.Pi / 180.0)
+	max_cols := int64(math.Ceil(360.0 / cell_size))
+
+	grid := make(map[gridCell][]*cluster)
+	clusters := make([]*cluster, 0)
+
+	for _, m := range a.members {
+
+		row := int64(math.Floor(m.Point.Lat() / cell_size))
+		col := int64(math.Floor(m.Point.Lon() / cell_size))
+
+		// A degree of longitude gets shorter towards the poles so more columns need to be checked there. The
+		// great-circle distance between two points is at least 2/Pi of their difference in longitude multiplied
+		// by the cosine of the (absolute) highest latitude.
+
+		cos := math.Cos(math.Min(90.0, math.Abs(m.Point.Lat())+cell_size) * math.Pi / 180.0)
+		cols := max_cols
+
+		if cos > 0 {
+			cols = int64(math.Min(float64(max_cols), math.Ceil(math.Pi/(2.0*cos))))
+		}
+
+		var nearest *cluster
+		nearest_d := 0.0
+
+		for r := row - 1; r <= row+1; r++ {
+
+			for c := col - cols; c <= col+cols; c++ {
+
+				for _, candidate := range grid[gridCell{row: r, col: c}] {
+
+					d := spatial.Distance(candidate.seed, m.Point)
+
+					if d > distance {
+						continue
+					}
+
+					if nearest == nil || d < nearest_d {
+						nearest = candidate
+						nearest_d = d
+					}
+				}
+			}
+		}
+
+		if nearest == nil {
+			nearest = &cluster{seed: m.Point}
+			cell := gridCell{row: row, col: col}
+			grid[cell] = append(grid[cell], nearest)
+			clusters = append(clusters, nearest)
+		}
+
+		nearest.members = append(nearest.members, m)
+	}
+
+	return clusters
+}
+
+// feature returns the GeoJSON feature for 'c'. Its location is the average of its members' locations, calculated
+// relative to its seed so that members with identical coordinates are not subject to rounding errors. Its thumbnail
+// is the first thumbnail of its members (which are ordered by ID) and its date span is the earliest inception and
+// latest cessation date of its members.
+func (c *cluster) feature() *geojson.Feature {
+
+	sum_d_lon := 0.0
+	sum_d_lat := 0.0
+
+	ids := make([]string, 0, len(c.members))
+
+	inception := ""
+	cessation := ""
+	undated := 0
+
+	var representative *Member
+
+	for _, m := range c.members {
+
+		sum_d_lon += m.Point.Lon() - c.seed.Lon()
+		sum_d_lat += m.Point.Lat() - c.seed.Lat()
+
+		if m.Id != "" {
+			ids = append(ids, m.Id)
+		}
+
+		if m.Date == nil {
+			undated += 1
+		} else {
+
+			if inception == "" || m.Date.Inception < inception {
+				inception = m.Date.Inception
+			}
+
+			if cessation == "" || m.Date.Cessation > cessation {
+				cessation = m.Date.Cessation
+			}
+		}
+
+		if representative == nil && m.Thumbnail != "" {
+			representative = m
+		}
+	}
+
+	count := len(c.members)
+
+	pt := orb.Point{
+		c.seed.Lon() + sum_d_lon/float64(count),
+		c.seed.Lat() + sum_d_lat/float64(count),
+	}
+
+	props := geojson.Properties{
+		COUNT_PROPERTY:   count,
+		IDS_PROPERTY:     ids,
+		UNDATED_PROPERTY: undated,
+		LABEL_PROPERTY:   fmt.Sprintf("%d records", count),
+	}
+
+	if count == 1 {
+
+		props[LABEL_PROPERTY] = "1 record"
+
+		if c.members[0].Title != "" {
+			props[LABEL_PROPERTY] = c.members[0].Title
+		}
+	}
+
+	if inception != "" {
+		props[INCEPTION_PROPERTY] = inception
+		props[CESSATION_PROPERTY] = cessation
+	}
+
+	if representative != nil {
+		props[THUMBNAIL_PROPERTY] = representative.Thumbnail
+	}
+
+	f := geojson.NewFeature(pt)
+	f.Properties = props
+
+	return f
+}
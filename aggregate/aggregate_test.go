@@ -0,0 +1,281 @@
+package aggregate
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/dates"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestAggregator(t *testing.T, opts *AggregatorOptions, members ...*Member) *Aggregator {
+
+	t.Helper()
+
+	a, err := NewAggregator(opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create aggregator, %v", err)
+	}
+
+	for _, m := range members {
+		a.Add(m)
+	}
+
+	return a
+}
+
+// clusterIds returns the IDs of the members of each feature, joined by commas.
+func clusterIds(features []*geojson.Feature) []string {
+
+	clusters := make([]string, len(features))
+
+	for idx, f := range features {
+		clusters[idx] = strings.Join(f.Properties[IDS_PROPERTY].([]string), ",")
+	}
+
+	return clusters
+}
+
+func TestNewAggregator(t *testing.T) {
+
+	invalid := []*AggregatorOptions{
+		{Mode: "nearby"},
+		{Mode: MODE_DISTANCE},
+		{Mode: MODE_DISTANCE, Distance: -1},
+		{Mode: MODE_GEOHASH},
+		{Mode: MODE_GEOHASH, Precision: MAX_GEOHASH_PRECISION + 1},
+	}
+
+	for _, opts := range invalid {
+
+		_, err := NewAggregator(opts)
+
+		if err == nil {
+			t.Fatalf("Expected %v to be invalid", opts)
+		}
+	}
+}
+
+func TestClusterFeature(t *testing.T) {
+
+	a := newTestAggregator(t, &AggregatorOptions{Mode: MODE_COORDINATES},
+		&Member{Id: "e", Point: orb.Point{3, 3}},
+		&Member{Id: "c", Point: orb.Point{-77.0, 38.9}, Thumbnail: "c.jpg"},
+		&Member{Id: "a", Point: orb.Point{-77.0, 38.9}, Date: &dates.Date{Inception: "1900-01-01", Cessation: "1900-12-31"}},
+		&Member{Id: "d", Point: orb.Point{2, 2}, Title: "Lonely"},
+		&Member{Id: "b", Point: orb.Point{-77.0, 38.9}, Thumbnail: "b.jpg", Date: &dates.Date{Inception: "1890-01-01", Cessation: "1895-12-31"}},
+	)
+
+	if a.Count() != 5 {
+		t.Fatalf("Unexpected count %d", a.Count())
+	}
+
+	features := a.Features()
+
+	if !reflect.DeepEqual(clusterIds(features), []string{"a,b,c", "d", "e"}) {
+		t.Fatalf("Unexpected clusters %v", clusterIds(features))
+	}
+
+	f := features[0]
+
+	if !f.Geometry.(orb.Point).Equal(orb.Point{-77.0, 38.9}) {
+		t.Fatalf("Unexpected location %v", f.Geometry)
+	}
+
+	expected := geojson.Properties{
+		COUNT_PROPERTY:     3,
+		IDS_PROPERTY:       []string{"a", "b", "c"},
+		LABEL_PROPERTY:     "3 records",
+		INCEPTION_PROPERTY: "1890-01-01",
+		CESSATION_PROPERTY: "1900-12-31",
+		UNDATED_PROPERTY:   1,
+		THUMBNAIL_PROPERTY: "b.jpg",
+	}
+
+	if !reflect.DeepEqual(f.Properties, expected) {
+		t.Fatalf("Unexpected properties %v", f.Properties)
+	}
+
+	expected = geojson.Properties{
+		COUNT_PROPERTY:   1,
+		IDS_PROPERTY:     []string{"d"},
+		LABEL_PROPERTY:   "Lonely",
+		UNDATED_PROPERTY: 1,
+	}
+
+	if !reflect.DeepEqual(features[1].Properties, expected) {
+		t.Fatalf("Unexpected properties %v", features[1].Properties)
+	}
+
+	if features[2].Properties[LABEL_PROPERTY] != "1 record" {
+		t.Fatalf("Unexpected label %v", features[2].Properties[LABEL_PROPERTY])
+	}
+
+	// The location of a cluster is the average of its members' locations
+
+	a = newTestAggregator(t, &AggregatorOptions{Mode: MODE_DISTANCE, Distance: DEFAULT_DISTANCE},
+		&Member{Id: "a", Point: orb.Point{10.0, 50.0}},
+		&Member{Id: "b", Point: orb.Point{10.0002, 50.0004}},
+	)
+
+	pt := a.Features()[0].Geometry.(orb.Point)
+
+	if fmt.Sprintf("%.6f,%.6f", pt.Lon(), pt.Lat()) != "10.000100,50.000200" {
+		t.Fatalf("Unexpected location %v", pt)
+	}
+}
+
+func TestGeohashClusters(t *testing.T) {
+
+	a := newTestAggregator(t, &AggregatorOptions{Mode: MODE_GEOHASH, Precision: 5},
+		&Member{Id: "a", Point: orb.Point{-5.6, 42.6}},
+		&Member{Id: "b", Point: orb.Point{-5.6001, 42.6001}},
+		&Member{Id: "c", Point: orb.Point{10.40744, 57.64911}},
+	)
+
+	features := a.Features()
+
+	if !reflect.DeepEqual(clusterIds(features), []string{"a,b", "c"}) {
+		t.Fatalf("Unexpected clusters %v", clusterIds(features))
+	}
+
+	if features[0].Properties[GEOHASH_PROPERTY] != "ezs42" || features[1].Properties[GEOHASH_PROPERTY] != "u4pru" {
+		t.Fatalf("Unexpected geohashes %v, %v", features[0].Properties[GEOHASH_PROPERTY], features[1].Properties[GEOHASH_PROPERTY])
+	}
+}
+
+func TestDistanceClusters(t *testing.T) {
+
+	tests := map[string]struct {
+		points   []orb.Point
+		expected []string
+	}{
+		"north pole": {
+			points:   []orb.Point{{0.0, 89.9999}, {179.0, 89.9999}, {-90.0, 89.9999}},
+			expected: []string{"0,1,2"},
+		},
+		"south pole": {
+			points:   []orb.Point{{0.0, -89.9999}, {179.0, -89.9999}},
+			expected: []string{"0,1"},
+		},
+		"near the pole but too far apart": {
+			points:   []orb.Point{{0.0, 89.9999}, {0.0, 89.998}},
+			expected: []string{"0", "1"},
+		},
+		"across the equator": {
+			points:   []orb.Point{{10.0, -0.0001}, {10.0, 0.0001}},
+			expected: []string{"0,1"},
+		},
+		"across the prime meridian": {
+			points:   []orb.Point{{-0.0001, 45.0}, {0.0001, 45.0}},
+			expected: []string{"0,1"},
+		},
+		"across several columns": {
+			points:   []orb.Point{{0.0, 60.0}, {0.0015, 60.0}},
+			expected: []string{"0,1"},
+		},
+		"too far apart": {
+			points:   []orb.Point{{0.0, 0.0}, {0.0, 0.01}},
+			expected: []string{"0", "1"},
+		},
+		"across the antimeridian": {
+			points:   []orb.Point{{179.9999, 0.0}, {-179.9999, 0.0}},
+			expected: []string{"0", "1"},
+		},
+		"nearest cluster": {
+			points:   []orb.Point{{0.0, 0.0}, {0.0015, 0.0}, {0.001, 0.0}},
+			expected: []string{"1,2", "0"},
+		},
+	}
+
+	for name, test := range tests {
+
+		a := newTestAggregator(t, &AggregatorOptions{Mode: MODE_DISTANCE, Distance: DEFAULT_DISTANCE})
+
+		for idx, pt := range test.points {
+			a.Add(&Member{Id: fmt.Sprintf("%d", idx), Point: pt})
+		}
+
+		clusters := clusterIds(a.Features())
+
+		if !reflect.DeepEqual(clusters, test.expected) {
+			t.Fatalf("Unexpected clusters for %s: %v, expected %v", name, clusters, test.expected)
+		}
+	}
+}
+
+func TestFeaturesOrder(t *testing.T) {
+
+	r := rand.New(rand.NewSource(1))
+
+	members := make([]*Member, 0)
+
+	for i := 0; i < 200; i++ {
+
+		pt := orb.Point{
+			-77.0 + r.Float64()*0.01,
+			38.9 + r.Float64()*0.01,
+		}
+
+		// Some records share coordinates with an earlier one
+		if i > 0 && i%5 == 0 {
+			pt = members[r.Intn(len(members))].Point
+		}
+
+		m := &Member{
+			Id:        fmt.Sprintf("%03d", i),
+			Point:     pt,
+			Thumbnail: fmt.Sprintf("%03d.jpg", i),
+		}
+
+		if i%3 == 0 {
+			year := 1860 + r.Intn(60)
+			m.Date = &dates.Date{Inception: fmt.Sprintf("%d-01-01", year), Cessation: fmt.Sprintf("%d-12-31", year)}
+		}
+
+		members = append(members, m)
+	}
+
+	modes := []*AggregatorOptions{
+		{Mode: MODE_COORDINATES},
+		{Mode: MODE_DISTANCE, Distance: 250},
+		{Mode: MODE_GEOHASH, Precision: 6},
+	}
+
+	for _, opts := range modes {
+
+		expected := ""
+
+		for i := 0; i < 5; i++ {
+
+			shuffled := make([]*Member, len(members))
+			copy(shuffled, members)
+
+			r.Shuffle(len(shuffled), func(i int, j int) {
+				shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+			})
+
+			a := newTestAggregator(t, opts, shuffled...)
+
+			enc, err := json.Marshal(a.Features())
+
+			if err != nil {
+				t.Fatalf("Failed to marshal features, %v", err)
+			}
+
+			if i == 0 {
+				expected = string(enc)
+				continue
+			}
+
+			if string(enc) != expected {
+				t.Fatalf("Features for %s depend on the order records were added in", opts.Mode)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package aggregate
+
+import (
+	"github.com/paulmach/orb"
+)
+
+// The alphabet used to encode geohashes.
+const geohash_alphabet string = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// The maximum supported geohash precision.
+const MAX_GEOHASH_PRECISION int = 12
+
+// Geohash returns the geohash of 'pt' with 'precision' characters.
+func Geohash(pt orb.Point, precision int) string {
+
+	min_lat, max_lat := -90.0, 90.0
+	min_lon, max_lon := -180.0, 180.0
+
+	hash := make([]byte, 0, precision)
+
+	bits := 0
+	ch := 0
+	even := true
+
+	for len(hash) < precision {
+
+		if even {
+
+			mid := (min_lon + max_lon) / 2.0
+
+			if pt.Lon() >= mid {
+				ch = ch<<1 | 1
+				min_lon = mid
+			} else {
+				ch = ch << 1
+				max_lon = mid
+			}
+
+		} else {
+
+			mid := (min_lat + max_lat) / 2.0
+
+			if pt.Lat() >= mid {
+				ch = ch<<1 | 1
+				min_lat = mid
+			} else {
+				ch = ch << 1
+				max_lat = mid
+			}
+		}
+
+		even = !even
+		bits += 1
+
+		if bits == 5 {
+			hash = append(hash, geohash_alphabet[ch])
+			bits = 0
+			ch = 0
+		}
+	}
+
+	return string(hash)
+}
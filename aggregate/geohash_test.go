@@ -0,0 +1,32 @@
+package aggregate
+
+import (
+	"github.com/paulmach/orb"
+	"testing"
+)
+
+func TestGeohash(t *testing.T) {
+
+	tests := []struct {
+		pt        orb.Point
+		precision int
+		expected  string
+	}{
+		{orb.Point{10.40744, 57.64911}, 11, "u4pruydqqvj"},
+		{orb.Point{-5.6, 42.6}, 5, "ezs42"},
+		{orb.Point{0.0, 0.0}, 8, "s0000000"},
+		{orb.Point{-0.000001, -0.000001}, 4, "7zzz"},
+		{orb.Point{-180.0, -90.0}, 6, "000000"},
+		{orb.Point{180.0, 90.0}, 6, "zzzzzz"},
+		{orb.Point{10.40744, 57.64911}, 1, "u"},
+	}
+
+	for _, test := range tests {
+
+		hash := Geohash(test.pt, test.precision)
+
+		if hash != test.expected {
+			t.Fatalf("Unexpected geohash for %v (%d): %s, expected %s", test.pt, test.precision, hash, test.expected)
+		}
+	}
+}
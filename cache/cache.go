@@ -0,0 +1,740 @@
+// package cache provides a GoCloud bucket wrapper that mirrors objects read from a (remote) bucket in to a local directory.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/driver"
+	"gocloud.dev/gcerrors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The default number of objects to request per page when listing the source bucket.
+const DEFAULT_PAGE_SIZE int = 1000
+
+// CachingBucketOptions defines options for creating a new caching bucket.
+type CachingBucketOptions struct {
+	// The local directory where cached objects are stored.
+	Root string
+	// The maximum number of bytes of objects to keep in the cache. Least recently used objects are evicted
+	// when this limit is exceeded. Objects larger than this limit are never cached. If 0 there is no limit.
+	MaxBytes int64
+	// If true the size and ETag of a cached object are compared with the source bucket before the cached copy
+	// is used. If the source bucket can not be reached the cached copy is used regardless.
+	Validate bool
+}
+
+// entry is the metadata stored alongside each cached object.
+type entry struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ETag        string    `json:"etag,omitempty"`
+	ModTime     time.Time `json:"mod_time"`
+	ContentType string    `json:"content_type,omitempty"`
+	hash        string
+	atime       time.Time
+}
+
+// listing is a cached page of results from listing the source bucket.
+type listing struct {
+	Objects       []*listObject `json:"objects"`
+	NextPageToken []byte        `json:"next_page_token,omitempty"`
+}
+
+type listObject struct {
+	Key     string    `json:"key"`
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+	MD5     []byte    `json:"md5,omitempty"`
+	IsDir   bool      `json:"is_dir,omitempty"`
+}
+
+type cachingBucket struct {
+	source  *blob.Bucket
+	options *CachingBucketOptions
+	objects string
+	lists   string
+	mu      *sync.Mutex
+	entries map[string]*entry
+	total   int64
+}
+
+// NewCachingBucket returns a new *blob.Bucket that reads objects from 'source' and stores copies of them in 'opts.Root'.
+// Subsequent reads are served from the local copy. Listings of 'source' are cached as well so that the bucket can be
+// walked without a network connection once it has been read in full. Writes, copies and deletes are passed through
+// to 'source' and invalidate any cached copies.
+func NewCachingBucket(ctx context.Context, source *blob.Bucket, opts *CachingBucketOptions) (*blob.Bucket, error) {
+
+	b, err := newCachingBucket(ctx, source, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return blob.NewBucket(b), nil
+}
+
+func newCachingBucket(ctx context.Context, source *blob.Bucket, opts *CachingBucketOptions) (*cachingBucket, error) {
+
+	if opts.Root == "" {
+		return nil, fmt.Errorf("Missing cache root")
+	}
+
+	b := &cachingBucket{
+		source:  source,
+		options: opts,
+		objects: filepath.Join(opts.Root, "objects"),
+		lists:   filepath.Join(opts.Root, "lists"),
+		mu:      new(sync.Mutex),
+		entries: make(map[string]*entry),
+	}
+
+	for _, dir := range []string{b.objects, b.lists} {
+
+		err := os.MkdirAll(dir, 0755)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create cache directory %s, %w", dir, err)
+		}
+	}
+
+	err := b.loadEntries()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *cachingBucket) loadEntries() error {
+
+	paths, err := filepath.Glob(filepath.Join(b.objects, "*.json"))
+
+	if err != nil {
+		return fmt.Errorf("Failed to list cache entries, %w", err)
+	}
+
+	for _, meta_path := range paths {
+
+		body, err := os.ReadFile(meta_path)
+
+		if err != nil {
+			continue
+		}
+
+		var e *entry
+
+		err = json.Unmarshal(body, &e)
+
+		if err != nil || e == nil {
+			continue
+		}
+
+		e.hash = hashKey(e.Key)
+
+		info, err := os.Stat(b.dataPath(e.hash))
+
+		if err != nil || info.Size() != e.Size {
+			b.removeFiles(e.hash)
+			continue
+		}
+
+		e.atime = info.ModTime()
+
+		b.entries[e.Key] = e
+		b.total += e.Size
+	}
+
+	b.evict("")
+	return nil
+}
+
+func (b *cachingBucket) ErrorCode(err error) gcerrors.ErrorCode {
+
+	if errors.Is(err, os.ErrNotExist) {
+		return gcerrors.NotFound
+	}
+
+	return gcerrors.Code(err)
+}
+
+func (b *cachingBucket) As(i interface{}) bool {
+	return false
+}
+
+func (b *cachingBucket) ErrorAs(err error, i interface{}) bool {
+	return b.source.ErrorAs(err, i)
+}
+
+func (b *cachingBucket) Attributes(ctx context.Context, key string) (*driver.Attributes, error) {
+
+	attrs, err := b.source.Attributes(ctx, key)
+
+	if err == nil {
+
+		d_attrs := &driver.Attributes{
+			CacheControl:       attrs.CacheControl,
+			ContentDisposition: attrs.ContentDisposition,
+			ContentEncoding:    attrs.ContentEncoding,
+			ContentLanguage:    attrs.ContentLanguage,
+			ContentType:        attrs.ContentType,
+			Metadata:           attrs.Metadata,
+			CreateTime:         attrs.CreateTime,
+			ModTime:            attrs.ModTime,
+			Size:               attrs.Size,
+			MD5:                attrs.MD5,
+			ETag:               attrs.ETag,
+		}
+
+		return d_attrs, nil
+	}
+
+	if !isUnavailable(err) {
+		return nil, err
+	}
+
+	e, ok := b.lookup(key)
+
+	if !ok {
+		return nil, err
+	}
+
+	d_attrs := &driver.Attributes{
+		ContentType: e.ContentType,
+		ModTime:     e.ModTime,
+		Size:        e.Size,
+		ETag:        e.ETag,
+	}
+
+	return d_attrs, nil
+}
+
+func (b *cachingBucket) ListPaged(ctx context.Context, opts *driver.ListOptions) (*driver.ListPage, error) {
+
+	page_size := opts.PageSize
+
+	if page_size <= 0 {
+		page_size = DEFAULT_PAGE_SIZE
+	}
+
+	token := opts.PageToken
+
+	if len(token) == 0 {
+		token = blob.FirstPageToken
+	}
+
+	list_key := fmt.Sprintf("%s#%s#%x#%d", opts.Prefix, opts.Delimiter, opts.PageToken, page_size)
+	list_path := filepath.Join(b.lists, hashKey(list_key)+".json")
+
+	list_opts := &blob.ListOptions{
+		Prefix:     opts.Prefix,
+		Delimiter:  opts.Delimiter,
+		BeforeList: opts.BeforeList,
+	}
+
+	objects, next, err := b.source.ListPage(ctx, token, page_size, list_opts)
+
+	if err != nil && err != io.EOF {
+
+		if !isUnavailable(err) {
+			return nil, err
+		}
+
+		body, read_err := os.ReadFile(list_path)
+
+		if read_err != nil {
+			return nil, err
+		}
+
+		var l *listing
+
+		read_err = json.Unmarshal(body, &l)
+
+		if read_err != nil || l == nil {
+			return nil, err
+		}
+
+		return l.page(), nil
+	}
+
+	l := &listing{
+		Objects:       make([]*listObject, len(objects)),
+		NextPageToken: next,
+	}
+
+	for idx, obj := range objects {
+
+		l.Objects[idx] = &listObject{
+			Key:     obj.Key,
+			ModTime: obj.ModTime,
+			Size:    obj.Size,
+			MD5:     obj.MD5,
+			IsDir:   obj.IsDir,
+		}
+	}
+
+	enc_l, err := json.Marshal(l)
+
+	if err == nil {
+		writeFileAtomic(list_path, enc_l)
+	}
+
+	return l.page(), nil
+}
+
+func (l *listing) page() *driver.ListPage {
+
+	page := &driver.ListPage{
+		Objects:       make([]*driver.ListObject, len(l.Objects)),
+		NextPageToken: l.NextPageToken,
+	}
+
+	for idx, obj := range l.Objects {
+
+		page.Objects[idx] = &driver.ListObject{
+			Key:     obj.Key,
+			ModTime: obj.ModTime,
+			Size:    obj.Size,
+			MD5:     obj.MD5,
+			IsDir:   obj.IsDir,
+		}
+	}
+
+	return page
+}
+
+func (b *cachingBucket) NewRangeReader(ctx context.Context, key string, offset, length int64, opts *driver.ReaderOptions) (driver.Reader, error) {
+
+	e, ok := b.lookup(key)
+
+	if ok && b.options.Validate {
+
+		attrs, err := b.source.Attributes(ctx, key)
+
+		switch {
+		case err == nil:
+
+			if attrs.Size != e.Size || (attrs.ETag != "" && e.ETag != "" && attrs.ETag != e.ETag) {
+				b.invalidate(key)
+				ok = false
+			}
+
+		case gcerrors.Code(err) == gcerrors.NotFound:
+			b.invalidate(key)
+			return nil, err
+
+		default:
+			// Source is unavailable; use the cached copy
+		}
+	}
+
+	if ok {
+
+		r, err := b.openCached(e, offset, length)
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return r, err
+		}
+
+		// The cached copy was evicted, by a concurrent fetch, after it was looked up so fetch it again
+
+		b.forget(e)
+	}
+
+	new_e, err := b.fetch(ctx, key, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if new_e != nil {
+
+		r, err := b.openCached(new_e, offset, length)
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return r, err
+		}
+
+		// Evicted again before it could be opened; fall back to reading from the source
+
+		b.forget(new_e)
+	}
+
+	// The object is too large to cache, or can not be kept in the cache long enough to be read, so read it
+	// directly from the source
+
+	r, err := b.source.NewRangeReader(ctx, key, offset, length, readerOptions(opts))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &sourceReader{r}, nil
+}
+
+func (b *cachingBucket) NewTypedWriter(ctx context.Context, key string, content_type string, opts *driver.WriterOptions) (driver.Writer, error) {
+
+	b.invalidate(key)
+
+	wr_opts := &blob.WriterOptions{
+		BufferSize:         opts.BufferSize,
+		MaxConcurrency:     opts.MaxConcurrency,
+		CacheControl:       opts.CacheControl,
+		ContentDisposition: opts.ContentDisposition,
+		ContentEncoding:    opts.ContentEncoding,
+		ContentLanguage:    opts.ContentLanguage,
+		ContentType:        content_type,
+		ContentMD5:         opts.ContentMD5,
+		Metadata:           opts.Metadata,
+		BeforeWrite:        opts.BeforeWrite,
+	}
+
+	return b.source.NewWriter(ctx, key, wr_opts)
+}
+
+func (b *cachingBucket) Copy(ctx context.Context, dst_key string, src_key string, opts *driver.CopyOptions) error {
+
+	b.invalidate(dst_key)
+
+	copy_opts := &blob.CopyOptions{
+		BeforeCopy: opts.BeforeCopy,
+	}
+
+	return b.source.Copy(ctx, dst_key, src_key, copy_opts)
+}
+
+func (b *cachingBucket) Delete(ctx context.Context, key string) error {
+	b.invalidate(key)
+	return b.source.Delete(ctx, key)
+}
+
+func (b *cachingBucket) SignedURL(ctx context.Context, key string, opts *driver.SignedURLOptions) (string, error) {
+
+	url_opts := &blob.SignedURLOptions{
+		Expiry:                   opts.Expiry,
+		Method:                   opts.Method,
+		ContentType:              opts.ContentType,
+		EnforceAbsentContentType: opts.EnforceAbsentContentType,
+		BeforeSign:               opts.BeforeSign,
+	}
+
+	return b.source.SignedURL(ctx, key, url_opts)
+}
+
+func (b *cachingBucket) Close() error {
+	return b.source.Close()
+}
+
+// fetch copies 'key' from the source bucket in to the cache. It returns nil (and no error) if the object is
+// larger than the cache's maximum size.
+func (b *cachingBucket) fetch(ctx context.Context, key string, opts *driver.ReaderOptions) (*entry, error) {
+
+	r, err := b.source.NewReader(ctx, key, readerOptions(opts))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	if b.options.MaxBytes > 0 && r.Size() > b.options.MaxBytes {
+		return nil, nil
+	}
+
+	e := &entry{
+		Key:         key,
+		Size:        r.Size(),
+		ModTime:     r.ModTime(),
+		ContentType: r.ContentType(),
+		hash:        hashKey(key),
+		atime:       time.Now(),
+	}
+
+	attrs, err := b.source.Attributes(ctx, key)
+
+	if err == nil {
+		e.ETag = attrs.ETag
+	}
+
+	tmp, err := os.CreateTemp(b.objects, "tmp-*")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create temporary file, %w", err)
+	}
+
+	tmp_path := tmp.Name()
+
+	defer os.Remove(tmp_path)
+
+	n, err := io.Copy(tmp, r)
+
+	if err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("Failed to copy %s to cache, %w", key, err)
+	}
+
+	err = tmp.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to close temporary file, %w", err)
+	}
+
+	e.Size = n
+
+	enc_e, err := json.Marshal(e)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal cache entry for %s, %w", key, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err = os.Rename(tmp_path, b.dataPath(e.hash))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to store %s in cache, %w", key, err)
+	}
+
+	err = writeFileAtomic(b.metaPath(e.hash), enc_e)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to store metadata for %s in cache, %w", key, err)
+	}
+
+	old, ok := b.entries[key]
+
+	if ok {
+		b.total -= old.Size
+	}
+
+	b.entries[key] = e
+	b.total += e.Size
+
+	b.evict(key)
+	return e, nil
+}
+
+// evict removes the least recently used entries, other than 'keep', until the cache is within its size limit.
+// It must be called with b.mu held.
+func (b *cachingBucket) evict(keep string) {
+
+	if b.options.MaxBytes <= 0 || b.total <= b.options.MaxBytes {
+		return
+	}
+
+	candidates := make([]*entry, 0, len(b.entries))
+
+	for k, e := range b.entries {
+
+		if k != keep {
+			candidates = append(candidates, e)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].atime.Before(candidates[j].atime)
+	})
+
+	for _, e := range candidates {
+
+		if b.total <= b.options.MaxBytes {
+			break
+		}
+
+		b.removeFiles(e.hash)
+		delete(b.entries, e.Key)
+		b.total -= e.Size
+	}
+}
+
+func (b *cachingBucket) lookup(key string) (*entry, bool) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[key]
+	return e, ok
+}
+
+func (b *cachingBucket) invalidate(key string) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.entries[key]
+
+	if !ok {
+		return
+	}
+
+	b.removeFiles(e.hash)
+	delete(b.entries, key)
+	b.total -= e.Size
+}
+
+// forget removes 'e' from the cache's entries if it is still the current entry for its key, which it won't be if
+// the key has since been fetched again.
+func (b *cachingBucket) forget(e *entry) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current, ok := b.entries[e.Key]
+
+	if !ok || current != e {
+		return
+	}
+
+	b.removeFiles(e.hash)
+	delete(b.entries, e.Key)
+	b.total -= e.Size
+}
+
+func (b *cachingBucket) openCached(e *entry, offset int64, length int64) (driver.Reader, error) {
+
+	data_path := b.dataPath(e.hash)
+
+	fh, err := os.Open(data_path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	b.mu.Lock()
+	e.atime = now
+	b.mu.Unlock()
+
+	// Record the access time on disk so that LRU ordering survives restarts
+	os.Chtimes(data_path, now, now)
+
+	if offset > 0 {
+
+		_, err := fh.Seek(offset, io.SeekStart)
+
+		if err != nil {
+			fh.Close()
+			return nil, err
+		}
+	}
+
+	var r io.Reader = fh
+
+	if length >= 0 {
+		r = io.LimitReader(fh, length)
+	}
+
+	cr := &cachedReader{
+		Reader: r,
+		fh:     fh,
+		attrs: &driver.ReaderAttributes{
+			ContentType: e.ContentType,
+			ModTime:     e.ModTime,
+			Size:        e.Size,
+		},
+	}
+
+	return cr, nil
+}
+
+func (b *cachingBucket) removeFiles(hash string) {
+	os.Remove(b.dataPath(hash))
+	os.Remove(b.metaPath(hash))
+}
+
+func (b *cachingBucket) dataPath(hash string) string {
+	return filepath.Join(b.objects, hash)
+}
+
+func (b *cachingBucket) metaPath(hash string) string {
+	return filepath.Join(b.objects, hash+".json")
+}
+
+// cachedReader is a driver.Reader for an object stored in the cache.
+type cachedReader struct {
+	io.Reader
+	fh    *os.File
+	attrs *driver.ReaderAttributes
+}
+
+func (r *cachedReader) Close() error {
+	return r.fh.Close()
+}
+
+func (r *cachedReader) Attributes() *driver.ReaderAttributes {
+	return r.attrs
+}
+
+func (r *cachedReader) As(i interface{}) bool {
+	return false
+}
+
+// sourceReader is a driver.Reader for an object read directly from the source bucket.
+type sourceReader struct {
+	*blob.Reader
+}
+
+func (r *sourceReader) Attributes() *driver.ReaderAttributes {
+
+	attrs := &driver.ReaderAttributes{
+		ContentType: r.ContentType(),
+		ModTime:     r.ModTime(),
+		Size:        r.Size(),
+	}
+
+	return attrs
+}
+
+func readerOptions(opts *driver.ReaderOptions) *blob.ReaderOptions {
+
+	if opts == nil {
+		return nil
+	}
+
+	return &blob.ReaderOptions{
+		BeforeRead: opts.BeforeRead,
+	}
+}
+
+// isUnavailable returns true if 'err' suggests the source bucket could not be reached rather than the request
+// being invalid or the object not existing.
+func isUnavailable(err error) bool {
+
+	switch gcerrors.Code(err) {
+	case gcerrors.NotFound, gcerrors.InvalidArgument, gcerrors.PermissionDenied, gcerrors.FailedPrecondition:
+		return false
+	default:
+		return !errors.Is(err, context.Canceled)
+	}
+}
+
+func hashKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+func writeFileAtomic(path string, body []byte) error {
+
+	tmp := path + ".tmp"
+
+	err := os.WriteFile(tmp, body, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,530 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/driver"
+	"gocloud.dev/blob/memblob"
+	"gocloud.dev/gcerrors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errOffline = errors.New("Source is offline")
+
+// testSource is a driver.Bucket wrapping an in-memory bucket that counts reads and can be taken "offline".
+type testSource struct {
+	bucket  *blob.Bucket
+	offline int32
+	reads   int64
+}
+
+func (s *testSource) setOffline(offline bool) {
+
+	v := int32(0)
+
+	if offline {
+		v = 1
+	}
+
+	atomic.StoreInt32(&s.offline, v)
+}
+
+func (s *testSource) isOffline() bool {
+	return atomic.LoadInt32(&s.offline) == 1
+}
+
+func (s *testSource) ErrorCode(err error) gcerrors.ErrorCode {
+
+	if errors.Is(err, errOffline) {
+		return gcerrors.Internal
+	}
+
+	return gcerrors.Code(err)
+}
+
+func (s *testSource) As(i interface{}) bool {
+	return false
+}
+
+func (s *testSource) ErrorAs(err error, i interface{}) bool {
+	return false
+}
+
+func (s *testSource) Attributes(ctx context.Context, key string) (*driver.Attributes, error) {
+
+	if s.isOffline() {
+		return nil, errOffline
+	}
+
+	attrs, err := s.bucket.Attributes(ctx, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d_attrs := &driver.Attributes{
+		ContentType: attrs.ContentType,
+		ModTime:     attrs.ModTime,
+		Size:        attrs.Size,
+		MD5:         attrs.MD5,
+		ETag:        attrs.ETag,
+	}
+
+	return d_attrs, nil
+}
+
+func (s *testSource) ListPaged(ctx context.Context, opts *driver.ListOptions) (*driver.ListPage, error) {
+
+	if s.isOffline() {
+		return nil, errOffline
+	}
+
+	token := opts.PageToken
+
+	if len(token) == 0 {
+		token = blob.FirstPageToken
+	}
+
+	list_opts := &blob.ListOptions{
+		Prefix:    opts.Prefix,
+		Delimiter: opts.Delimiter,
+	}
+
+	objects, next, err := s.bucket.ListPage(ctx, token, opts.PageSize, list_opts)
+
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	page := &driver.ListPage{
+		Objects:       make([]*driver.ListObject, len(objects)),
+		NextPageToken: next,
+	}
+
+	for idx, obj := range objects {
+		page.Objects[idx] = &driver.ListObject{Key: obj.Key, ModTime: obj.ModTime, Size: obj.Size, MD5: obj.MD5, IsDir: obj.IsDir}
+	}
+
+	return page, nil
+}
+
+func (s *testSource) NewRangeReader(ctx context.Context, key string, offset, length int64, opts *driver.ReaderOptions) (driver.Reader, error) {
+
+	if s.isOffline() {
+		return nil, errOffline
+	}
+
+	r, err := s.bucket.NewRangeReader(ctx, key, offset, length, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&s.reads, 1)
+	return &sourceReader{r}, nil
+}
+
+func (s *testSource) NewTypedWriter(ctx context.Context, key string, content_type string, opts *driver.WriterOptions) (driver.Writer, error) {
+	return s.bucket.NewWriter(ctx, key, &blob.WriterOptions{ContentType: content_type})
+}
+
+func (s *testSource) Copy(ctx context.Context, dst_key string, src_key string, opts *driver.CopyOptions) error {
+	return s.bucket.Copy(ctx, dst_key, src_key, nil)
+}
+
+func (s *testSource) Delete(ctx context.Context, key string) error {
+	return s.bucket.Delete(ctx, key)
+}
+
+func (s *testSource) SignedURL(ctx context.Context, key string, opts *driver.SignedURLOptions) (string, error) {
+	return "", errors.New("Not implemented")
+}
+
+func (s *testSource) Close() error {
+	return s.bucket.Close()
+}
+
+// newTestCache returns a testSource containing 'objects' and a cachingBucket, rooted in 'root', that reads from it.
+func newTestCache(t *testing.T, root string, objects map[string]string, opts *CachingBucketOptions) (*testSource, *cachingBucket) {
+
+	t.Helper()
+
+	ctx := context.Background()
+
+	src := &testSource{
+		bucket: memblob.OpenBucket(nil),
+	}
+
+	for k, v := range objects {
+
+		err := src.bucket.WriteAll(ctx, k, []byte(v), nil)
+
+		if err != nil {
+			t.Fatalf("Failed to write %s, %v", k, err)
+		}
+	}
+
+	opts.Root = root
+
+	b, err := newCachingBucket(ctx, blob.NewBucket(src), opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create caching bucket, %v", err)
+	}
+
+	return src, b
+}
+
+func readCached(t *testing.T, b *cachingBucket, key string) string {
+
+	t.Helper()
+
+	body, err := blob.NewBucket(b).ReadAll(context.Background(), key)
+
+	if err != nil {
+		t.Fatalf("Failed to read %s, %v", key, err)
+	}
+
+	return string(body)
+}
+
+// cachedKeys returns the sorted keys of the entries in 'b', checking that the sum of their sizes matches the
+// bucket's byte count and that each entry has a data file of the right size.
+func cachedKeys(t *testing.T, b *cachingBucket) []string {
+
+	t.Helper()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	keys := make([]string, 0)
+	total := int64(0)
+
+	for k, e := range b.entries {
+
+		info, err := os.Stat(b.dataPath(e.hash))
+
+		if err != nil || info.Size() != e.Size {
+			t.Fatalf("Missing or incomplete data file for %s", k)
+		}
+
+		keys = append(keys, k)
+		total += e.Size
+	}
+
+	if total != b.total {
+		t.Fatalf("Cache reports %d bytes but entries total %d", b.total, total)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func TestCachingBucketReads(t *testing.T) {
+
+	objects := map[string]string{
+		"a.jsonl": "aaaaaaaaaa",
+		"b.jsonl": "bbbbbbbbbbbbbbbbbbbb",
+	}
+
+	src, b := newTestCache(t, t.TempDir(), objects, &CachingBucketOptions{})
+
+	for i := 0; i < 3; i++ {
+
+		for k, v := range objects {
+
+			if readCached(t, b, k) != v {
+				t.Fatalf("Unexpected body for %s", k)
+			}
+		}
+	}
+
+	if atomic.LoadInt64(&src.reads) != 2 {
+		t.Fatalf("Expected 2 reads from the source, got %d", src.reads)
+	}
+
+	if strings.Join(cachedKeys(t, b), ",") != "a.jsonl,b.jsonl" || b.total != 30 {
+		t.Fatalf("Unexpected cache contents, %d bytes", b.total)
+	}
+
+	// Range reads are served from the cache
+
+	r, err := blob.NewBucket(b).NewRangeReader(context.Background(), "b.jsonl", 5, 3, nil)
+
+	if err != nil {
+		t.Fatalf("Failed to create range reader, %v", err)
+	}
+
+	body, _ := io.ReadAll(r)
+	r.Close()
+
+	if string(body) != "bbb" || atomic.LoadInt64(&src.reads) != 2 {
+		t.Fatalf("Unexpected range read '%s'", body)
+	}
+
+	// Writes through the caching bucket invalidate cached copies
+
+	err = blob.NewBucket(b).WriteAll(context.Background(), "a.jsonl", []byte("updated"), nil)
+
+	if err != nil {
+		t.Fatalf("Failed to write a.jsonl, %v", err)
+	}
+
+	if readCached(t, b, "a.jsonl") != "updated" || b.total != 27 {
+		t.Fatalf("Expected write to invalidate cached copy")
+	}
+}
+
+func TestCachingBucketEviction(t *testing.T) {
+
+	objects := map[string]string{
+		"a": "aaaaaaaaaa",
+		"b": "bbbbbbbbbb",
+		"c": "cccccccccc",
+		"d": "dddddddddd",
+		"e": "eeeeeeeeeeeeeeeeeeeeeeeeeeeeee",
+	}
+
+	root := t.TempDir()
+	src, b := newTestCache(t, root, objects, &CachingBucketOptions{MaxBytes: 25})
+
+	for _, k := range []string{"a", "b", "a"} {
+		readCached(t, b, k)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// "b" is the least recently used object
+
+	readCached(t, b, "c")
+
+	if strings.Join(cachedKeys(t, b), ",") != "a,c" || b.total != 20 {
+		t.Fatalf("Expected b to be evicted, got %v", cachedKeys(t, b))
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	readCached(t, b, "d")
+
+	if strings.Join(cachedKeys(t, b), ",") != "c,d" {
+		t.Fatalf("Expected a to be evicted, got %v", cachedKeys(t, b))
+	}
+
+	// Objects larger than the cache are read from the source every time and never cached
+
+	for i := 0; i < 2; i++ {
+
+		reads := atomic.LoadInt64(&src.reads)
+
+		if readCached(t, b, "e") != objects["e"] {
+			t.Fatalf("Unexpected body for e")
+		}
+
+		if atomic.LoadInt64(&src.reads) == reads {
+			t.Fatalf("Expected large object to be read from the source")
+		}
+	}
+
+	if strings.Join(cachedKeys(t, b), ",") != "c,d" || b.total != 20 {
+		t.Fatalf("Expected large object to bypass the cache")
+	}
+
+	// Entries, and their byte count, are reloaded from disk and a smaller limit evicts the least recently used
+
+	_, reloaded := newTestCache(t, root, objects, &CachingBucketOptions{MaxBytes: 15})
+
+	if strings.Join(cachedKeys(t, reloaded), ",") != "d" || reloaded.total != 10 {
+		t.Fatalf("Unexpected reloaded cache %v", cachedKeys(t, reloaded))
+	}
+}
+
+func TestCachingBucketValidate(t *testing.T) {
+
+	ctx := context.Background()
+
+	objects := map[string]string{
+		"a": "original",
+		"b": "original",
+	}
+
+	for _, validate := range []bool{false, true} {
+
+		src, b := newTestCache(t, t.TempDir(), objects, &CachingBucketOptions{Validate: validate})
+
+		readCached(t, b, "a")
+		readCached(t, b, "b")
+
+		// Update the source directly, bypassing the caching bucket
+
+		err := src.bucket.WriteAll(ctx, "a", []byte("changed, and longer"), nil)
+
+		if err != nil {
+			t.Fatalf("Failed to update a, %v", err)
+		}
+
+		err = src.bucket.Delete(ctx, "b")
+
+		if err != nil {
+			t.Fatalf("Failed to delete b, %v", err)
+		}
+
+		if !validate {
+
+			if readCached(t, b, "a") != "original" || readCached(t, b, "b") != "original" {
+				t.Fatalf("Expected cached copies to be used without validation")
+			}
+
+			continue
+		}
+
+		if readCached(t, b, "a") != "changed, and longer" {
+			t.Fatalf("Expected stale copy of a to be replaced")
+		}
+
+		_, err = blob.NewBucket(b).ReadAll(ctx, "b")
+
+		if gcerrors.Code(err) != gcerrors.NotFound {
+			t.Fatalf("Expected NotFound for b, got %v", err)
+		}
+
+		if strings.Join(cachedKeys(t, b), ",") != "a" || b.total != int64(len("changed, and longer")) {
+			t.Fatalf("Expected b to be invalidated, got %v", cachedKeys(t, b))
+		}
+
+		// If the source can not be reached the cached copy is used regardless
+
+		src.setOffline(true)
+
+		if readCached(t, b, "a") != "changed, and longer" {
+			t.Fatalf("Expected cached copy to be used while offline")
+		}
+	}
+}
+
+func TestCachingBucketOffline(t *testing.T) {
+
+	ctx := context.Background()
+
+	objects := map[string]string{
+		"data/1.jsonl":  "one",
+		"data/2.jsonl":  "two",
+		"data/3.jsonl":  "three",
+		"other/4.jsonl": "four",
+	}
+
+	src, b := newTestCache(t, t.TempDir(), objects, &CachingBucketOptions{})
+
+	list := func() ([]string, error) {
+
+		keys := make([]string, 0)
+		iter := blob.NewBucket(b).List(&blob.ListOptions{Prefix: "data/"})
+
+		for {
+
+			obj, err := iter.Next(ctx)
+
+			if err == io.EOF {
+				return keys, nil
+			}
+
+			if err != nil {
+				return nil, err
+			}
+
+			keys = append(keys, obj.Key)
+		}
+	}
+
+	online, err := list()
+
+	if err != nil {
+		t.Fatalf("Failed to list bucket, %v", err)
+	}
+
+	readCached(t, b, "data/1.jsonl")
+	readCached(t, b, "data/2.jsonl")
+
+	src.setOffline(true)
+
+	offline, err := list()
+
+	if err != nil {
+		t.Fatalf("Failed to list bucket offline, %v", err)
+	}
+
+	if strings.Join(online, ",") != "data/1.jsonl,data/2.jsonl,data/3.jsonl" || strings.Join(offline, ",") != strings.Join(online, ",") {
+		t.Fatalf("Unexpected listings %v and %v", online, offline)
+	}
+
+	if readCached(t, b, "data/2.jsonl") != "two" {
+		t.Fatalf("Expected cached object to be readable offline")
+	}
+
+	attrs, err := blob.NewBucket(b).Attributes(ctx, "data/1.jsonl")
+
+	if err != nil || attrs.Size != 3 {
+		t.Fatalf("Expected cached attributes offline, %v", err)
+	}
+
+	_, err = blob.NewBucket(b).ReadAll(ctx, "data/3.jsonl")
+
+	if !errors.Is(err, errOffline) {
+		t.Fatalf("Expected uncached object to be unavailable offline, got %v", err)
+	}
+
+	// Listings that were never made online can not be served
+
+	iter := blob.NewBucket(b).List(&blob.ListOptions{Prefix: "other/"})
+	_, err = iter.Next(ctx)
+
+	if !errors.Is(err, errOffline) {
+		t.Fatalf("Expected unknown listing to be unavailable offline, got %v", err)
+	}
+}
+
+func TestCachingBucketEvictedRefetch(t *testing.T) {
+
+	objects := map[string]string{
+		"a": "aaaaaaaaaa",
+	}
+
+	src, b := newTestCache(t, t.TempDir(), objects, &CachingBucketOptions{})
+
+	readCached(t, b, "a")
+
+	// Simulate the data file being evicted, by another fetch, between the entry being looked up and opened
+
+	e, _ := b.lookup("a")
+	os.Remove(b.dataPath(e.hash))
+
+	if readCached(t, b, "a") != objects["a"] {
+		t.Fatalf("Unexpected body for a")
+	}
+
+	if atomic.LoadInt64(&src.reads) != 2 {
+		t.Fatalf("Expected evicted object to be fetched again, got %d reads", src.reads)
+	}
+
+	current, ok := b.lookup("a")
+
+	if !ok || current == e {
+		t.Fatalf("Expected a new cache entry for a")
+	}
+
+	if strings.Join(cachedKeys(t, b), ",") != "a" || b.total != 10 {
+		t.Fatalf("Unexpected cache contents after refetch, %d bytes", b.total)
+	}
+
+	// A stale entry whose key has been fetched again is not forgotten
+
+	b.forget(e)
+
+	if _, ok := b.lookup("a"); !ok {
+		t.Fatalf("Expected current entry to be kept")
+	}
+}
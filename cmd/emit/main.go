@@ -1,14 +1,19 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	_ "encoding/json"
 	"flag"
 	"fmt"
 	"github.com/aaronland/go-json-query"
 	jw "github.com/aaronland/go-jsonl/walk"
 	"github.com/aaronland/go-libraryofcongress-datajam"
+	"github.com/aaronland/go-libraryofcongress-datajam/dates"
+	"github.com/aaronland/go-libraryofcongress-datajam/expr"
+	"github.com/aaronland/go-libraryofcongress-datajam/output"
+	proj "github.com/aaronland/go-libraryofcongress-datajam/projection"
+	"github.com/aaronland/go-libraryofcongress-datajam/record"
+	"github.com/aaronland/go-libraryofcongress-datajam/shards"
+	"github.com/aaronland/go-libraryofcongress-datajam/spatial"
 	"github.com/aaronland/go-libraryofcongress-datajam/walk"
 	_ "gocloud.dev/blob/fileblob"
 	_ "gocloud.dev/blob/s3blob"
@@ -17,16 +22,18 @@ import (
 	"log"
 	"os"
 	"strings"
-	"sync"
-	"sync/atomic"
 	"time"
 )
 
 func main() {
 
-	bucket_uri := flag.String("bucket-uri", "", "A valid GoCloud bucket URI. Valid schemes are: file://, s3:// and loc:// which is signals that data should be retrieved from the Library Of Congress's '...' S3 bucket.")
+	bucket_uri := flag.String("bucket-uri", "", "A valid GoCloud bucket URI. Valid schemes are: file://, s3:// and loc://{DATASET}/ which signals that data should be retrieved from a Library Of Congress dataset defined in the DATAJAM_DATASETS registry (see list-datasets).")
 	workers := flag.Int("workers", 10, "The maximum number of concurrent workers. This is used to prevent filehandle exhaustion.")
 
+	checkpoint_uri := flag.String("checkpoint", "", "An optional local path or GoCloud bucket URI (with a filename) where walk progress is periodically recorded. For example: file:///tmp/checkpoint.json")
+	checkpoint_interval := flag.Duration("checkpoint-interval", walk.DEFAULT_CHECKPOINT_INTERVAL, "The minimum interval between writes of the -checkpoint file.")
+	resume := flag.Bool("resume", false, "Resume a previous walk, skipping files and lines already recorded in the -checkpoint file.")
+
 	to_stdout := flag.Bool("stdout", true, "Emit to STDOUT")
 	to_devnull := flag.Bool("null", false, "Emit to /dev/null")
 
@@ -34,18 +41,38 @@ func main() {
 	validate_json := flag.Bool("validate-json", false, "Ensure each record is valid JSON.")
 	format_json := flag.Bool("format-json", false, "Format JSON output for each record.")
 
-	// as_oembed := flag.Bool("oembed", false, "Emit results as OEmbed records")
+	as_oembed := flag.Bool("oembed", false, "Emit results as OEmbed records")
+
+	var project_fields proj.FieldFlags
+	flag.Var(&project_fields, "project", "One or more {PATH} or {NAME}={PATH} (gjson) paths used to emit slimmed-down records containing only those properties. Multiple paths may be separated by commas. If -oembed is true paths are applied to the oEmbed records.")
+	project_omit_empty := flag.Bool("project-omit-empty", false, "Omit projected properties with no value rather than assigning them a null value.")
+
+	as_csv := flag.Bool("csv", false, "Emit records as CSV rows using the columns defined by the -column flags.")
+	as_tsv := flag.Bool("tsv", false, "Emit records as tab-separated rows using the columns defined by the -column flags.")
+
+	var column_fields proj.FieldFlags
+	flag.Var(&column_fields, "column", "One or more {NAME}={PATH} (gjson) paths defining the columns to emit when -csv or -tsv is true. Multiple columns may be separated by commas. If {NAME} is omitted the path is used as the column name.")
+	array_separator := flag.String("array-separator", ";", "The string used to join array values, and flattened object values, in -csv or -tsv output.")
 
 	stats := flag.Bool("stats", false, "Display timings and statistics.")
 
-	var queries query.QueryFlags
-	flag.Var(&queries, "query", "One or more {PATH}={REGEXP} parameters for filtering records.")
+	var queries expr.ExpressionFlags
+	flag.Var(&queries, "query", "One or more query expressions for filtering records. In addition to {PATH}={REGEXP} expressions negation (!=), comparisons (==, <, <=, >, >=), exists({PATH}), missing({PATH}), count({PATH}) and parenthesised AND, OR and NOT expressions are supported.")
 
 	valid_modes := strings.Join([]string{query.QUERYSET_MODE_ALL, query.QUERYSET_MODE_ANY}, ", ")
 	desc_modes := fmt.Sprintf("Specify how query filtering should be evaluated. Valid modes are: %s", valid_modes)
 
 	query_mode := flag.String("query-mode", query.QUERYSET_MODE_ALL, desc_modes)
 
+	bbox := flag.String("bbox", "", "Only include records whose coordinates are inside a {MINLON},{MINLAT},{MAXLON},{MAXLAT} bounding box.")
+	near := flag.String("near", "", "Only include records whose coordinates are within {RADIUS} meters of a point, defined as {LAT},{LON},{RADIUS}.")
+	polygon := flag.String("polygon", "", "Only include records whose coordinates are inside the Polygon or MultiPolygon geometries in a GeoJSON file.")
+	include_missing_coords := flag.Bool("include-missing-coordinates", false, "Include records without coordinates when -bbox, -near or -polygon are set.")
+
+	date_range := flag.String("date-range", "", "Only include records whose dates overlap a {START}/{END} range of dates, where {START} and {END} are dates like \"1861\", \"1861-04\" or \"1861-04-12\" or \"..\" for an open range.")
+	include_undated := flag.Bool("include-undated", false, "Include records without a valid date when -date-range is set.")
+	derive_dates := flag.Bool("derive-dates", false, "Append \"edtf:date\", \"edtf:inception\" and \"edtf:cessation\" properties, derived from each record's date, to emitted records.")
+
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage:\n")
 		fmt.Fprintf(os.Stderr, "  %s [options] [path1 path2 ... pathN]\n\n", os.Args[0])
@@ -55,150 +82,176 @@ func main() {
 
 	flag.Parse()
 
-	ctx := context.Background()
-
-	ctx, bucket, err := datajam.OpenBucket(ctx, *bucket_uri)
+	query_expr, err := expr.Combine(*query_mode, queries...)
 
 	if err != nil {
-		log.Fatalf("Failed to open bucket, %v", err)
+		log.Fatalf("Invalid -query flags, %v", err)
 	}
 
-	defer bucket.Close()
+	spatial_opts := &spatial.FilterOptions{
+		BoundingBox:    *bbox,
+		PointRadius:    *near,
+		PolygonPath:    *polygon,
+		IncludeMissing: *include_missing_coords,
+	}
 
-	writers := make([]io.Writer, 0)
+	spatial_expr, err := spatial.NewFilter(spatial_opts)
 
-	if *to_stdout {
-		writers = append(writers, os.Stdout)
+	if err != nil {
+		log.Fatalf("Invalid spatial filter, %v", err)
 	}
 
-	if *to_devnull {
-		writers = append(writers, ioutil.Discard)
-	}
+	query_expr = expr.All(query_expr, spatial_expr)
 
-	if len(writers) == 0 {
-		log.Fatal("Nothing to write to.")
+	if *date_range != "" {
+
+		date_expr, err := dates.NewRangeFilter(*date_range, *include_undated)
+
+		if err != nil {
+			log.Fatalf("Invalid -date-range flag, %v", err)
+		}
+
+		query_expr = expr.All(query_expr, date_expr)
 	}
 
-	wr := io.MultiWriter(writers...)
+	ctx := context.Background()
 
-	count := uint32(0)
+	ctx, bucket, err := datajam.OpenBucket(ctx, *bucket_uri)
 
-	if *stats {
+	if err != nil {
+		log.Fatalf("Failed to open bucket, %v", err)
+	}
 
-		t1 := time.Now()
+	defer bucket.Close()
 
-		defer func() {
+	var checkpoint *walk.Checkpoint
 
-			final_count := atomic.LoadUint32(&count)
-			log.Printf("Processed %d records in %v\n", final_count, time.Since(t1))
-		}()
+	if *resume && *checkpoint_uri == "" {
+		log.Fatalf("-resume requires a -checkpoint flag")
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	if *checkpoint_uri != "" {
 
-	mu := new(sync.RWMutex)
+		cp, err := walk.NewCheckpoint(ctx, *checkpoint_uri, *resume)
 
-	write := func(ctx context.Context, records ...[]byte) error {
+		if err != nil {
+			log.Fatalf("Failed to create checkpoint, %v", err)
+		}
+
+		cp.Interval = *checkpoint_interval
+		checkpoint = cp
 
-		mu.Lock()
-		defer mu.Unlock()
+		defer func() {
 
-		for _, body := range records {
+			err := cp.Close()
 
-			select {
-			case <-ctx.Done():
-				return nil
-			default:
-				// pass
+			if err != nil {
+				log.Printf("Failed to close checkpoint, %v", err)
 			}
+		}()
+	}
 
-			body = bytes.TrimSpace(body)
+	var projection *proj.Projection
 
-			new_count := atomic.AddUint32(&count, 1)
+	if len(project_fields) > 0 {
 
-			if *as_json && new_count > 1 {
-				wr.Write([]byte(","))
-			}
+		p, err := proj.NewProjection(project_fields)
 
-			wr.Write(body)
-			wr.Write([]byte("\n"))
+		if err != nil {
+			log.Fatalf("Invalid -project flags, %v", err)
 		}
 
-		return nil
+		p.OmitEmpty = *project_omit_empty
+		projection = p
 	}
 
-	cb := func(ctx context.Context, rec *jw.WalkRecord, err error) error {
+	writers := make([]io.Writer, 0)
 
-		if err != nil {
+	if *to_stdout {
+		writers = append(writers, os.Stdout)
+	}
 
-			if jw.IsEOFError(err) {
-				return nil
-			}
+	if *to_devnull {
+		writers = append(writers, ioutil.Discard)
+	}
 
-			log.Println(err)
-			return err
-		}
+	if len(writers) == 0 {
+		log.Fatal("Nothing to write to.")
+	}
 
-		records := make([][]byte, 0)
+	wr := io.MultiWriter(writers...)
 
-		/*
-			if *as_oembed {
+	out_opts := &output.WriterOptions{
+		JSON:           *as_json,
+		FormatJSON:     *format_json,
+		OEmbed:         *as_oembed,
+		DeriveDates:    *derive_dates,
+		Projection:     projection,
+		CSV:            *as_csv,
+		TSV:            *as_tsv,
+		ArraySeparator: *array_separator,
+	}
 
-			var object map[string]interface{}
-				err = json.Unmarshal(rec.Body, &object)
+	if len(column_fields) > 0 {
 
-				if err != nil {
-					log.Println(err)
-					return err
-				}
+		columns, err := proj.NewProjection(column_fields)
 
-				if *as_oembed {
+		if err != nil {
+			log.Fatalf("Invalid -column flags, %v", err)
+		}
 
-					oembed_records, err := oembed.OEmbedRecordsFromOpenAccessRecord(object)
+		out_opts.Columns = columns
+	}
 
-					if err != nil {
-						// log.Printf("Unable to construct oembed records from object '%s': %v\n", object.Id, err)
-						return nil
-					}
+	err = out_opts.Validate()
 
-					for _, o_rec := range oembed_records {
+	if err != nil {
+		log.Fatalf("Invalid output flags, %v", err)
+	}
 
-						body, err := json.Marshal(o_rec)
+	out, err := output.NewWriter(wr, out_opts)
 
-						if err != nil {
-							return err
-						}
+	if err != nil {
+		log.Fatalf("Failed to create output writer, %v", err)
+	}
 
-						records = append(records, body)
-					}
+	if *stats {
 
-				} else {
-					records = append(records, rec.Body)
-				}
+		t1 := time.Now()
 
-				records = append(records, rec.Body)
+		defer func() {
+			log.Printf("Processed %d records in %v\n", out.Count(), time.Since(t1))
+		}()
+	}
 
-			} else {
-				records = append(records, rec.Body)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cb := func(ctx context.Context, rec *record.Record, err error) error {
+
+		if err != nil {
+
+			if jw.IsEOFError(err) {
+				return nil
 			}
 
-		*/
+			if walk.IsDecodeError(err) {
+				log.Printf("Skipping record, %v", err)
+				return nil
+			}
 
-		records = append(records, rec.Body)
+			log.Println(err)
+			return err
+		}
 
-		return write(ctx, records...)
+		return out.Write(ctx, rec)
 	}
 
 	uris := flag.Args()
 
-	if *as_json {
-		wr.Write([]byte("["))
-	}
-
 	filter_func := func(ctx context.Context, uri string) bool {
 		// Skip things like index.txt' or errant 'fileblob*' records
-		return true
+		return !shards.IsManifest(uri)
 	}
 
 	for _, uri := range uris {
@@ -206,21 +259,12 @@ func main() {
 		opts := &walk.WalkOptions{
 			URI:          uri,
 			Workers:      *workers,
-			FormatJSON:   *format_json,
 			ValidateJSON: *validate_json,
-			Callback:     cb,
-			IsBzip:       false,
+			Callback:     walk.LibraryOfCongressRecordCallback(cb),
+			Compression:  datajam.CompressionFromContext(ctx),
 			Filter:       filter_func,
-		}
-
-		if len(queries) > 0 {
-
-			qs := &query.QuerySet{
-				Queries: queries,
-				Mode:    *query_mode,
-			}
-
-			opts.QuerySet = qs
+			Expression:   query_expr,
+			Checkpoint:   checkpoint,
 		}
 
 		err := walk.WalkBucket(ctx, opts, bucket)
@@ -230,8 +274,9 @@ func main() {
 		}
 	}
 
-	if *as_json {
-		wr.Write([]byte("]"))
-	}
+	err = out.Close()
 
+	if err != nil {
+		log.Fatalf("Failed to close output writer, %v", err)
+	}
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/geotag"
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/s3blob"
+	"log"
+	"os"
+)
+
+func main() {
+
+	store_uri := flag.String("store-uri", "", "A geotag store URI. Valid schemes are: sqlite:// or any GoCloud bucket URI, for example file:///usr/local/data/geotags.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Export the geotags in a store as a GeoJSON FeatureCollection.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *store_uri == "" {
+		log.Fatalf("Missing -store-uri flag")
+	}
+
+	ctx := context.Background()
+
+	store, err := geotag.NewStore(ctx, *store_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to create geotag store, %v", err)
+	}
+
+	defer store.Close()
+
+	err = geotag.WriteFeatureCollection(ctx, store, os.Stdout)
+
+	if err != nil {
+		log.Fatalf("Failed to export geotags, %v", err)
+	}
+}
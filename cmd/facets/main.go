@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-json-query"
+	jw "github.com/aaronland/go-jsonl/walk"
+	"github.com/aaronland/go-libraryofcongress-datajam"
+	"github.com/aaronland/go-libraryofcongress-datajam/expr"
+	"github.com/aaronland/go-libraryofcongress-datajam/facets"
+	proj "github.com/aaronland/go-libraryofcongress-datajam/projection"
+	"github.com/aaronland/go-libraryofcongress-datajam/shards"
+	"github.com/aaronland/go-libraryofcongress-datajam/walk"
+	"github.com/sfomuseum/go-csvdict"
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/s3blob"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func main() {
+
+	bucket_uri := flag.String("bucket-uri", "", "A valid GoCloud bucket URI. Valid schemes are: file://, s3:// and loc://{DATASET}/ which signals that data should be retrieved from a Library Of Congress dataset defined in the DATAJAM_DATASETS registry (see list-datasets).")
+	workers := flag.Int("workers", 10, "The maximum number of concurrent workers. This is used to prevent filehandle exhaustion.")
+
+	var facet_fields proj.FieldFlags
+	flag.Var(&facet_fields, "facet", "One or more {PATH} or {NAME}={PATH} (gjson) paths to count values for, for example \"subject\" or \"format=original_format\". Multiple paths may be separated by commas.")
+
+	top := flag.Int("top", 25, "The maximum number of values to report for each facet. If 0 all values are reported.")
+	min_count := flag.Int64("min-count", 1, "The minimum number of records a value must occur in to be reported.")
+
+	format := flag.String("format", "json", "The output format. Valid formats are: json, csv.")
+
+	var queries expr.ExpressionFlags
+	flag.Var(&queries, "query", "One or more query expressions for filtering records. In addition to {PATH}={REGEXP} expressions negation (!=), comparisons (==, <, <=, >, >=), exists({PATH}), missing({PATH}), count({PATH}) and parenthesised AND, OR and NOT expressions are supported.")
+
+	valid_modes := strings.Join([]string{query.QUERYSET_MODE_ALL, query.QUERYSET_MODE_ANY}, ", ")
+	desc_modes := fmt.Sprintf("Specify how query filtering should be evaluated. Valid modes are: %s", valid_modes)
+
+	query_mode := flag.String("query-mode", query.QUERYSET_MODE_ALL, desc_modes)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Count the values of one or more properties across a set of records.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s [options] [path1 path2 ... pathN]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	query_expr, err := expr.Combine(*query_mode, queries...)
+
+	if err != nil {
+		log.Fatalf("Invalid -query flags, %v", err)
+	}
+
+	switch *format {
+	case "json", "csv":
+		// pass
+	default:
+		log.Fatalf("Invalid -format flag")
+	}
+
+	f, err := facets.NewFacets(facet_fields...)
+
+	if err != nil {
+		log.Fatalf("Invalid -facet flags, %v", err)
+	}
+
+	ctx := context.Background()
+
+	ctx, bucket, err := datajam.OpenBucket(ctx, *bucket_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open bucket, %v", err)
+	}
+
+	defer bucket.Close()
+
+	cb := func(ctx context.Context, rec *jw.WalkRecord, err error) error {
+
+		if err != nil {
+
+			if jw.IsEOFError(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		f.Add(rec.Body)
+		return nil
+	}
+
+	filter_func := func(ctx context.Context, uri string) bool {
+		return !shards.IsManifest(uri)
+	}
+
+	for _, uri := range flag.Args() {
+
+		opts := &walk.WalkOptions{
+			URI:         uri,
+			Workers:     *workers,
+			Callback:    cb,
+			Compression: datajam.CompressionFromContext(ctx),
+			Filter:      filter_func,
+			Expression:  query_expr,
+		}
+
+		err := walk.WalkBucket(ctx, opts, bucket)
+
+		if err != nil {
+			log.Fatalf("Failed to crawl %s, %v", uri, err)
+		}
+	}
+
+	results_opts := &facets.ResultsOptions{
+		Top:      *top,
+		MinCount: *min_count,
+	}
+
+	results := f.Results(results_opts)
+
+	switch *format {
+	case "csv":
+		err = writeCSV(os.Stdout, results)
+	default:
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		err = enc.Encode(results)
+	}
+
+	if err != nil {
+		log.Fatalf("Failed to write facets, %v", err)
+	}
+}
+
+// writeCSV writes one row for each value of each facet in 'results' to 'wr'.
+func writeCSV(wr io.Writer, results *facets.Results) error {
+
+	fieldnames := []string{"facet", "value", "count"}
+
+	csv_wr, err := csvdict.NewWriter(wr, fieldnames)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create CSV writer, %w", err)
+	}
+
+	err = csv_wr.WriteHeader()
+
+	if err != nil {
+		return fmt.Errorf("Failed to write header, %w", err)
+	}
+
+	for _, f := range results.Facets {
+
+		for _, v := range f.Values {
+
+			out := map[string]string{
+				"facet": f.Name,
+				"value": v.Value,
+				"count": strconv.FormatInt(v.Count, 10),
+			}
+
+			err := csv_wr.WriteRow(out)
+
+			if err != nil {
+				return fmt.Errorf("Failed to write row, %w", err)
+			}
+		}
+	}
+
+	csv_wr.Flush()
+	return csv_wr.Error()
+}
@@ -3,15 +3,22 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/aaronland/go-json-query"
 	jw "github.com/aaronland/go-jsonl/walk"
 	"github.com/aaronland/go-libraryofcongress-datajam"
+	"github.com/aaronland/go-libraryofcongress-datajam/aggregate"
+	"github.com/aaronland/go-libraryofcongress-datajam/dates"
+	"github.com/aaronland/go-libraryofcongress-datajam/expr"
+	"github.com/aaronland/go-libraryofcongress-datajam/features"
+	proj "github.com/aaronland/go-libraryofcongress-datajam/projection"
+	"github.com/aaronland/go-libraryofcongress-datajam/record"
+	"github.com/aaronland/go-libraryofcongress-datajam/shards"
+	"github.com/aaronland/go-libraryofcongress-datajam/spatial"
 	"github.com/aaronland/go-libraryofcongress-datajam/walk"
-	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
-	"github.com/tidwall/gjson"
 	_ "gocloud.dev/blob/fileblob"
 	_ "gocloud.dev/blob/s3blob"
 	"io"
@@ -23,22 +30,72 @@ import (
 	"sync/atomic"
 )
 
+// The names of the feature properties used to record how a feature's coordinates were derived.
+const (
+	SOURCE_PROPERTY   string = "coordinates:source"
+	WARNINGS_PROPERTY string = "coordinates:warnings"
+)
+
+// reject is a record whose coordinates could not be used, written to the -rejects file.
+type reject struct {
+	Id     string          `json:"id"`
+	Error  string          `json:"error"`
+	Record json.RawMessage `json:"record"`
+}
+
 func main() {
 
-	bucket_uri := flag.String("bucket-uri", "", "A valid GoCloud bucket URI. Valid schemes are: file://, s3:// and loc:// which is signals that data should be retrieved from the Library Of Congress's '...' S3 bucket.")
+	bucket_uri := flag.String("bucket-uri", "", "A valid GoCloud bucket URI. Valid schemes are: file://, s3:// and loc://{DATASET}/ which signals that data should be retrieved from a Library Of Congress dataset defined in the DATAJAM_DATASETS registry (see list-datasets).")
 	workers := flag.Int("workers", 10, "The maximum number of concurrent workers. This is used to prevent filehandle exhaustion.")
 
+	checkpoint_uri := flag.String("checkpoint", "", "An optional local path or GoCloud bucket URI (with a filename) where walk progress is periodically recorded. For example: file:///tmp/checkpoint.json")
+	checkpoint_interval := flag.Duration("checkpoint-interval", walk.DEFAULT_CHECKPOINT_INTERVAL, "The minimum interval between writes of the -checkpoint file.")
+	resume := flag.Bool("resume", false, "Resume a previous walk, skipping files and lines already recorded in the -checkpoint file.")
+
 	to_stdout := flag.Bool("stdout", true, "Emit to STDOUT")
 	to_devnull := flag.Bool("null", false, "Emit to /dev/null")
 
-	var queries query.QueryFlags
-	flag.Var(&queries, "query", "One or more {PATH}={REGEXP} parameters for filtering records.")
+	var queries expr.ExpressionFlags
+	flag.Var(&queries, "query", "One or more query expressions for filtering records. In addition to {PATH}={REGEXP} expressions negation (!=), comparisons (==, <, <=, >, >=), exists({PATH}), missing({PATH}), count({PATH}) and parenthesised AND, OR and NOT expressions are supported.")
 
 	valid_modes := strings.Join([]string{query.QUERYSET_MODE_ALL, query.QUERYSET_MODE_ANY}, ", ")
 	desc_modes := fmt.Sprintf("Specify how query filtering should be evaluated. Valid modes are: %s", valid_modes)
 
 	query_mode := flag.String("query-mode", query.QUERYSET_MODE_ALL, desc_modes)
 
+	bbox := flag.String("bbox", "", "Only include records whose coordinates are inside a {MINLON},{MINLAT},{MAXLON},{MAXLAT} bounding box.")
+	near := flag.String("near", "", "Only include records whose coordinates are within {RADIUS} meters of a point, defined as {LAT},{LON},{RADIUS}.")
+	polygon := flag.String("polygon", "", "Only include records whose coordinates are inside the Polygon or MultiPolygon geometries in a GeoJSON file.")
+	include_missing_coords := flag.Bool("include-missing-coordinates", false, "Include records without coordinates when -bbox, -near or -polygon are set.")
+
+	date_range := flag.String("date-range", "", "Only include records whose dates overlap a {START}/{END} range of dates, where {START} and {END} are dates like \"1861\", \"1861-04\" or \"1861-04-12\" or \"..\" for an open range.")
+	include_undated := flag.Bool("include-undated", false, "Include records without a valid date when -date-range is set.")
+
+	var property_fields proj.FieldFlags
+	flag.Var(&property_fields, "property", "One or more {PATH} or {NAME}={PATH} (gjson) paths to include as feature properties. Multiple paths may be separated by commas. If empty all of a record's properties are included.")
+	property_omit_empty := flag.Bool("property-omit-empty", false, "Omit -property properties with no value rather than assigning them a null value.")
+	property_prefix := flag.String("property-prefix", "", "An optional prefix (namespace) to add to the name of every feature property, for example \"loc:\".")
+	with_thumbnail := flag.Bool("thumbnail", false, "Include the record's 'item.thumb_gallery' image URL as a \"thumbnail\" feature property.")
+
+	valid_formats := strings.Join(features.Formats(), ", ")
+	desc_formats := fmt.Sprintf("The format to write features in. Valid formats are: %s", valid_formats)
+
+	format := flag.String("format", features.FORMAT_GEOJSON, desc_formats)
+	name := flag.String("name", "", "An optional name for the document or layer being written. This is used by the fgb, gpx and kml formats.")
+	name_property := flag.String("name-property", features.DEFAULT_NAME_PROPERTY, "The (unprefixed) feature property used to label KML placemarks and GPX waypoints.")
+	image_property := flag.String("image-property", features.DEFAULT_IMAGE_PROPERTY, "The (unprefixed) feature property containing an image URL to display in KML balloons and to link to from GPX waypoints.")
+	link_property := flag.String("link-property", features.DEFAULT_LINK_PROPERTY, "The (unprefixed) feature property containing a URL to link to from KML balloons and GPX waypoints.")
+	array_separator := flag.String("array-separator", features.DEFAULT_ARRAY_SEPARATOR, "The string used to join array values, and flattened object values, in csv output.")
+
+	valid_aggregate := strings.Join(aggregate.Modes(), ", ")
+	desc_aggregate := fmt.Sprintf("Group records with identical or nearby coordinates in to clusters and emit one feature per cluster, with its count, item IDs, date span and a representative thumbnail, rather than one feature per record. Valid modes are: %s", valid_aggregate)
+
+	aggregate_mode := flag.String("aggregate", "", desc_aggregate)
+	aggregate_distance := flag.Float64("aggregate-distance", aggregate.DEFAULT_DISTANCE, "The distance, in meters, within which records are grouped when -aggregate is 'distance'.")
+	aggregate_precision := flag.Int("aggregate-precision", aggregate.DEFAULT_PRECISION, fmt.Sprintf("The geohash precision used to group records when -aggregate is 'geohash'. Valid precisions are 1 to %d.", aggregate.MAX_GEOHASH_PRECISION))
+
+	rejects_path := flag.String("rejects", "", "An optional path to a file where records whose coordinates can not be used are written, as line-separated JSON, along with the reason they were rejected. Records without any coordinates are not considered rejects.")
+
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage:\n")
 		fmt.Fprintf(os.Stderr, "  %s [options] [path1 path2 ... pathN]\n\n", os.Args[0])
@@ -48,6 +105,38 @@ func main() {
 
 	flag.Parse()
 
+	query_expr, err := expr.Combine(*query_mode, queries...)
+
+	if err != nil {
+		log.Fatalf("Invalid -query flags, %v", err)
+	}
+
+	spatial_opts := &spatial.FilterOptions{
+		BoundingBox:    *bbox,
+		PointRadius:    *near,
+		PolygonPath:    *polygon,
+		IncludeMissing: *include_missing_coords,
+	}
+
+	spatial_expr, err := spatial.NewFilter(spatial_opts)
+
+	if err != nil {
+		log.Fatalf("Invalid spatial filter, %v", err)
+	}
+
+	query_expr = expr.All(query_expr, spatial_expr)
+
+	if *date_range != "" {
+
+		date_expr, err := dates.NewRangeFilter(*date_range, *include_undated)
+
+		if err != nil {
+			log.Fatalf("Invalid -date-range flag, %v", err)
+		}
+
+		query_expr = expr.All(query_expr, date_expr)
+	}
+
 	ctx := context.Background()
 
 	ctx, bucket, err := datajam.OpenBucket(ctx, *bucket_uri)
@@ -74,16 +163,154 @@ func main() {
 
 	wr := io.MultiWriter(writers...)
 
-	queries.Set("latlong=.*")
+	var projection *proj.Projection
+
+	if len(property_fields) > 0 {
+
+		p, err := proj.NewProjection(property_fields)
+
+		if err != nil {
+			log.Fatalf("Invalid -property flags, %v", err)
+		}
+
+		p.OmitEmpty = *property_omit_empty
+		projection = p
+	}
+
+	var aggregator *aggregate.Aggregator
+
+	if *aggregate_mode != "" {
+
+		if len(property_fields) > 0 {
+			log.Fatalf("-property flags can not be used with the -aggregate flag")
+		}
+
+		agg_opts := &aggregate.AggregatorOptions{
+			Mode:      *aggregate_mode,
+			Distance:  *aggregate_distance,
+			Precision: *aggregate_precision,
+		}
+
+		a, err := aggregate.NewAggregator(agg_opts)
+
+		if err != nil {
+			log.Fatalf("Invalid -aggregate flags, %v", err)
+		}
+
+		aggregator = a
+	}
+
+	var rejects_wr io.Writer
+
+	if *rejects_path != "" {
+
+		fh, err := os.Create(*rejects_path)
+
+		if err != nil {
+			log.Fatalf("Failed to create rejects file, %v", err)
+		}
+
+		defer func() {
+
+			err := fh.Close()
+
+			if err != nil {
+				log.Printf("Failed to close rejects file, %v", err)
+			}
+		}()
+
+		rejects_wr = fh
+	}
+
+	enc_opts := &features.EncoderOptions{
+		Name:           *name,
+		NameProperty:   *property_prefix + *name_property,
+		ImageProperty:  *property_prefix + *image_property,
+		LinkProperty:   *property_prefix + *link_property,
+		ArraySeparator: *array_separator,
+	}
+
+	// If the properties are known in advance, use them as CSV columns rather than those of the first feature
+
+	if projection != nil {
+
+		columns := make([]string, 0)
+
+		for _, c := range projection.Columns() {
+			columns = append(columns, *property_prefix+c)
+		}
+
+		if *with_thumbnail {
+			columns = append(columns, *property_prefix+"thumbnail")
+		}
+
+		enc_opts.Columns = append(columns, SOURCE_PROPERTY, WARNINGS_PROPERTY)
+	}
+
+	// Cluster features have their own, fixed, set of properties
+
+	if aggregator != nil {
+		enc_opts.NameProperty = aggregate.LABEL_PROPERTY
+		enc_opts.ImageProperty = aggregate.THUMBNAIL_PROPERTY
+		enc_opts.Columns = aggregate.Columns(*aggregate_mode)
+	}
+
+	enc, err := features.NewEncoder(*format, wr, enc_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create encoder, %v", err)
+	}
+
+	var checkpoint *walk.Checkpoint
+
+	if *resume && *checkpoint_uri == "" {
+		log.Fatalf("-resume requires a -checkpoint flag")
+	}
+
+	if *checkpoint_uri != "" {
+
+		// Records are marked as done as soon as they are encoded so if nothing is written until the encoder is
+		// closed a failed walk would leave a checkpoint for output that does not exist
+
+		if aggregator != nil {
+			log.Fatalf("-checkpoint can not be used with the -aggregate flag since clusters are not written until every record has been read")
+		}
+
+		if enc.Buffered() {
+			log.Fatalf("-checkpoint can not be used with buffered output (the fgb format, or the csv format without -property flags) since nothing is written until every record has been read")
+		}
+
+		cp, err := walk.NewCheckpoint(ctx, *checkpoint_uri, *resume)
+
+		if err != nil {
+			log.Fatalf("Failed to create checkpoint, %v", err)
+		}
+
+		cp.Interval = *checkpoint_interval
+		checkpoint = cp
+
+		defer func() {
+
+			err := cp.Close()
+
+			if err != nil {
+				log.Printf("Failed to close checkpoint, %v", err)
+			}
+		}()
+	}
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	count := int64(0)
+	rejects_count := int64(0)
 
-	mu := new(sync.RWMutex)
+	mu := new(sync.Mutex)
 
-	cb := func(ctx context.Context, rec *jw.WalkRecord, err error) error {
+	// Coordinates are derived from a record's original JSON, rather than its (decoded) LatLong and LonLat fields,
+	// because spatial.Locate needs to see malformed coordinate properties, which record.Record discards, in order
+	// to report them in the -rejects file.
+
+	cb := func(ctx context.Context, rec *record.Record, err error) error {
 
 		if err != nil {
 
@@ -91,55 +318,123 @@ func main() {
 				return nil
 			}
 
+			if walk.IsDecodeError(err) {
+				log.Printf("Skipping record, %v", err)
+				return nil
+			}
+
 			log.Println(err)
 			return err
 		}
 
-		coords_rsp := gjson.GetBytes(rec.Body, "latlong")
+		body := rec.Body()
+		id := rec.ItemId()
+
+		loc, err := spatial.Locate(body)
+
+		if err != nil {
+
+			if errors.Is(err, spatial.ErrNoCoordinates) {
+				return nil
+			}
+
+			atomic.AddInt64(&rejects_count, 1)
+
+			if rejects_wr == nil {
+				return nil
+			}
+
+			enc_r, err := json.Marshal(&reject{Id: id, Error: err.Error(), Record: body})
+
+			if err != nil {
+				return fmt.Errorf("Failed to marshal reject for %s, %w", id, err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			_, err = rejects_wr.Write(append(enc_r, '\n'))
+
+			if err != nil {
+				return fmt.Errorf("Failed to write reject for %s, %w", id, err)
+			}
+
+			return nil
+		}
+
+		if aggregator != nil {
 
-		if !coords_rsp.Exists() {
+			m := &aggregate.Member{
+				Id:        id,
+				Point:     loc.Point,
+				Title:     rec.Title.String(),
+				Thumbnail: rec.Thumbnail(),
+			}
+
+			d, ok := dates.FromJSON(body)
+
+			if ok {
+				m.Date = d
+			}
+
+			aggregator.Add(m)
 			return nil
 		}
 
+		props_body := body
+
+		if projection != nil {
+
+			p_body, err := projection.Project(body)
+
+			if err != nil {
+				return fmt.Errorf("Failed to project record %s, %w", id, err)
+			}
+
+			props_body = p_body
+		}
+
 		var props geojson.Properties
 
-		err = json.Unmarshal(rec.Body, &props)
+		err = json.Unmarshal(props_body, &props)
 
 		if err != nil {
 			return fmt.Errorf("Failed to unmarshal properties from body, %w", err)
 		}
 
-		coords := coords_rsp.Array()
+		if *with_thumbnail {
 
-		lat_rsp := coords[0]
-		lon_rsp := coords[1]
+			thumb := rec.Thumbnail()
 
-		lat := lat_rsp.Float()
-		lon := lon_rsp.Float()
+			if thumb != "" {
+				props["thumbnail"] = thumb
+			}
+		}
 
-		pt := orb.Point{lon, lat}
-		f := geojson.NewFeature(pt)
-		f.Properties = props
+		if *property_prefix != "" {
 
-		enc_f, err := f.MarshalJSON()
+			prefixed := make(geojson.Properties, len(props))
 
-		if err != nil {
-			return fmt.Errorf("Failed to marshal GeoJSON, %w", err)
-		}
+			for k, v := range props {
+				prefixed[*property_prefix+k] = v
+			}
 
-		mu.Lock()
-		defer mu.Unlock()
+			props = prefixed
+		}
 
-		new_count := atomic.AddInt64(&count, 1)
+		props[SOURCE_PROPERTY] = loc.Source
 
-		if new_count > 1 {
-			wr.Write([]byte(","))
+		if len(loc.Warnings) > 0 {
+			props[WARNINGS_PROPERTY] = loc.Warnings
 		}
 
-		_, err = wr.Write(enc_f)
+		f := geojson.NewFeature(loc.Point)
+		f.Properties = props
+
+		err = enc.Encode(f)
 
 		if err != nil {
-			return fmt.Errorf("Failed to write feature, %w", err)
+			return fmt.Errorf("Failed to encode feature for %s, %w", id, err)
 		}
 
 		return nil
@@ -147,31 +442,21 @@ func main() {
 
 	uris := flag.Args()
 
-	wr.Write([]byte(`{"type":"FeatureCollection", "features": [`))
-
 	filter_func := func(ctx context.Context, uri string) bool {
 		// Skip things like index.txt' or errant 'fileblob*' records
-		return true
+		return !shards.IsManifest(uri)
 	}
 
 	for _, uri := range uris {
 
 		opts := &walk.WalkOptions{
-			URI:      uri,
-			Workers:  *workers,
-			Callback: cb,
-			IsBzip:   false,
-			Filter:   filter_func,
-		}
-
-		if len(queries) > 0 {
-
-			qs := &query.QuerySet{
-				Queries: queries,
-				Mode:    *query_mode,
-			}
-
-			opts.QuerySet = qs
+			URI:         uri,
+			Workers:     *workers,
+			Callback:    walk.LibraryOfCongressRecordCallback(cb),
+			Compression: datajam.CompressionFromContext(ctx),
+			Filter:      filter_func,
+			Expression:  query_expr,
+			Checkpoint:  checkpoint,
 		}
 
 		err := walk.WalkBucket(ctx, opts, bucket)
@@ -181,5 +466,29 @@ func main() {
 		}
 	}
 
-	wr.Write([]byte("]}"))
+	if aggregator != nil {
+
+		clusters := aggregator.Features()
+
+		for _, f := range clusters {
+
+			err := enc.Encode(f)
+
+			if err != nil {
+				log.Fatalf("Failed to encode cluster, %v", err)
+			}
+		}
+
+		log.Printf("Aggregated %d records in to %d clusters", aggregator.Count(), len(clusters))
+	}
+
+	err = enc.Close()
+
+	if err != nil {
+		log.Fatalf("Failed to close encoder, %v", err)
+	}
+
+	if rejects_count > 0 {
+		log.Printf("Rejected %d records with unusable coordinates", rejects_count)
+	}
 }
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-json-query"
+	jw "github.com/aaronland/go-jsonl/walk"
+	"github.com/aaronland/go-libraryofcongress-datajam"
+	"github.com/aaronland/go-libraryofcongress-datajam/expr"
+	"github.com/aaronland/go-libraryofcongress-datajam/geotag"
+	"github.com/aaronland/go-libraryofcongress-datajam/geotag/www"
+	"github.com/aaronland/go-libraryofcongress-datajam/shards"
+	"github.com/aaronland/go-libraryofcongress-datajam/sqlite"
+	"github.com/aaronland/go-libraryofcongress-datajam/walk"
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/s3blob"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+
+	server_uri := flag.String("server-uri", "http://localhost:8080", "The address the server should listen on.")
+
+	bucket_uri := flag.String("bucket-uri", "", "A valid GoCloud bucket URI. Valid schemes are: file://, s3:// and loc://{DATASET}/ which signals that data should be retrieved from a Library Of Congress dataset defined in the DATAJAM_DATASETS registry (see list-datasets).")
+	workers := flag.Int("workers", 10, "The maximum number of concurrent workers. This is used to prevent filehandle exhaustion.")
+
+	database := flag.String("database", "", "The path to a SQLite database created by the index-sqlite tool to read records from, instead of walking -bucket-uri.")
+
+	store_uri := flag.String("store-uri", "", "A geotag store URI. Valid schemes are: sqlite://{PATH} for a SQLite database or any GoCloud bucket URI, for example file:///usr/local/data/geotags. If empty geotags are stored in a \"geotags\" folder in the current working directory.")
+
+	tile_url := flag.String("tile-url", "", "An optional {z}/{x}/{y} tile URL template for the basemap. If empty, and -tiles-dir is not set, no basemap is displayed.")
+	tiles_dir := flag.String("tiles-dir", "", "An optional local folder of {z}/{x}/{y}.png tiles to serve as the basemap.")
+
+	longitude := flag.Float64("longitude", -98.5795, "The initial longitude of the map.")
+	latitude := flag.Float64("latitude", 39.8283, "The initial latitude of the map.")
+	zoom := flag.Int("zoom", 4, "The initial zoom level of the map.")
+
+	var queries expr.ExpressionFlags
+	flag.Var(&queries, "query", "One or more query expressions for filtering records. In addition to {PATH}={REGEXP} expressions negation (!=), comparisons (==, <, <=, >, >=), exists({PATH}), missing({PATH}), count({PATH}) and parenthesised AND, OR and NOT expressions are supported.")
+
+	valid_modes := strings.Join([]string{query.QUERYSET_MODE_ALL, query.QUERYSET_MODE_ANY}, ", ")
+	desc_modes := fmt.Sprintf("Specify how query filtering should be evaluated. Valid modes are: %s", valid_modes)
+
+	query_mode := flag.String("query-mode", query.QUERYSET_MODE_ALL, desc_modes)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Start a web application for geotagging records without coordinates.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s [options] [path1 path2 ... pathN]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	query_expr, err := expr.Combine(*query_mode, queries...)
+
+	if err != nil {
+		log.Fatalf("Invalid -query flags, %v", err)
+	}
+
+	ctx := context.Background()
+
+	records := www.NewRecords()
+
+	if *database != "" {
+
+		idx, err := sqlite.OpenIndex(ctx, *database)
+
+		if err != nil {
+			log.Fatalf("Failed to open index, %v", err)
+		}
+
+		search_opts := &sqlite.SearchOptions{
+			MissingCoordinates: true,
+			Expression:         query_expr,
+		}
+
+		cb := func(ctx context.Context, body []byte) error {
+			records.Add(body)
+			return nil
+		}
+
+		err = idx.Search(ctx, search_opts, cb)
+
+		if err != nil {
+			log.Fatalf("Failed to search index, %v", err)
+		}
+
+		idx.Close()
+
+	} else {
+
+		ctx, bucket, err := datajam.OpenBucket(ctx, *bucket_uri)
+
+		if err != nil {
+			log.Fatalf("Failed to open bucket, %v", err)
+		}
+
+		cb := func(ctx context.Context, rec *jw.WalkRecord, err error) error {
+
+			if err != nil {
+
+				if jw.IsEOFError(err) {
+					return nil
+				}
+
+				return err
+			}
+
+			records.Add(rec.Body)
+			return nil
+		}
+
+		filter_func := func(ctx context.Context, uri string) bool {
+			return !shards.IsManifest(uri)
+		}
+
+		for _, uri := range flag.Args() {
+
+			opts := &walk.WalkOptions{
+				URI:         uri,
+				Workers:     *workers,
+				Callback:    cb,
+				Compression: datajam.CompressionFromContext(ctx),
+				Filter:      filter_func,
+				Expression:  query_expr,
+			}
+
+			err := walk.WalkBucket(ctx, opts, bucket)
+
+			if err != nil {
+				log.Fatalf("Failed to crawl %s, %v", uri, err)
+			}
+		}
+
+		bucket.Close()
+	}
+
+	records.Sort()
+
+	log.Printf("Loaded %d records without coordinates\n", records.Count())
+
+	if *store_uri == "" {
+
+		root, err := filepath.Abs("geotags")
+
+		if err != nil {
+			log.Fatalf("Failed to derive path for geotags, %v", err)
+		}
+
+		err = os.MkdirAll(root, 0755)
+
+		if err != nil {
+			log.Fatalf("Failed to create %s, %v", root, err)
+		}
+
+		*store_uri = "file://" + filepath.ToSlash(root)
+	}
+
+	store, err := geotag.NewStore(ctx, *store_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to create geotag store, %v", err)
+	}
+
+	defer store.Close()
+
+	handler_opts := &www.HandlerOptions{
+		Records:   records,
+		Store:     store,
+		TileURL:   *tile_url,
+		Longitude: *longitude,
+		Latitude:  *latitude,
+		Zoom:      *zoom,
+	}
+
+	if *tiles_dir != "" && *tile_url == "" {
+		handler_opts.TileURL = "tiles/{z}/{x}/{y}.png"
+	}
+
+	handler, err := www.NewHandler(ctx, handler_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create handler, %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", handler)
+
+	if *tiles_dir != "" {
+		mux.Handle("/tiles/", http.StripPrefix("/tiles/", http.FileServer(http.Dir(*tiles_dir))))
+	}
+
+	u, err := url.Parse(*server_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to parse -server-uri, %v", err)
+	}
+
+	log.Printf("Listening for requests on %s\n", *server_uri)
+
+	err = http.ListenAndServe(u.Host, mux)
+
+	if err != nil {
+		log.Fatalf("Failed to serve requests, %v", err)
+	}
+}
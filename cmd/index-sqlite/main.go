@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-json-query"
+	jw "github.com/aaronland/go-jsonl/walk"
+	"github.com/aaronland/go-libraryofcongress-datajam"
+	"github.com/aaronland/go-libraryofcongress-datajam/expr"
+	"github.com/aaronland/go-libraryofcongress-datajam/shards"
+	"github.com/aaronland/go-libraryofcongress-datajam/sqlite"
+	"github.com/aaronland/go-libraryofcongress-datajam/walk"
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/s3blob"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+func main() {
+
+	bucket_uri := flag.String("bucket-uri", "", "A valid GoCloud bucket URI. Valid schemes are: file://, s3:// and loc://{DATASET}/ which signals that data should be retrieved from a Library Of Congress dataset defined in the DATAJAM_DATASETS registry (see list-datasets).")
+	workers := flag.Int("workers", 10, "The maximum number of concurrent workers. This is used to prevent filehandle exhaustion.")
+
+	database := flag.String("database", "", "The path to the SQLite database to create, or update.")
+	batch_size := flag.Int("batch-size", sqlite.DEFAULT_BATCH_SIZE, "The number of records to add to the database in a single transaction.")
+
+	var queries expr.ExpressionFlags
+	flag.Var(&queries, "query", "One or more query expressions for filtering records. In addition to {PATH}={REGEXP} expressions negation (!=), comparisons (==, <, <=, >, >=), exists({PATH}), missing({PATH}), count({PATH}) and parenthesised AND, OR and NOT expressions are supported.")
+
+	valid_modes := strings.Join([]string{query.QUERYSET_MODE_ALL, query.QUERYSET_MODE_ANY}, ", ")
+	desc_modes := fmt.Sprintf("Specify how query filtering should be evaluated. Valid modes are: %s", valid_modes)
+
+	query_mode := flag.String("query-mode", query.QUERYSET_MODE_ALL, desc_modes)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Index records in a SQLite database for use with the search tool.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s [options] [path1 path2 ... pathN]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	query_expr, err := expr.Combine(*query_mode, queries...)
+
+	if err != nil {
+		log.Fatalf("Invalid -query flags, %v", err)
+	}
+
+	if *database == "" {
+		log.Fatalf("Missing -database flag")
+	}
+
+	ctx := context.Background()
+
+	ctx, bucket, err := datajam.OpenBucket(ctx, *bucket_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open bucket, %v", err)
+	}
+
+	defer bucket.Close()
+
+	idx, err := sqlite.NewIndex(ctx, *database)
+
+	if err != nil {
+		log.Fatalf("Failed to create index, %v", err)
+	}
+
+	idx.BatchSize = *batch_size
+
+	count := int64(0)
+	skipped := int64(0)
+	t1 := time.Now()
+
+	cb := func(ctx context.Context, rec *jw.WalkRecord, err error) error {
+
+		if err != nil {
+
+			if jw.IsEOFError(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		err = idx.Add(ctx, rec.Body)
+
+		if errors.Is(err, sqlite.ErrMissingID) {
+			log.Printf("Skipping record at %s line %d, %v", rec.Path, rec.LineNumber, err)
+			atomic.AddInt64(&skipped, 1)
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("Failed to index record at %s line %d, %w", rec.Path, rec.LineNumber, err)
+		}
+
+		atomic.AddInt64(&count, 1)
+		return nil
+	}
+
+	filter_func := func(ctx context.Context, uri string) bool {
+		return !shards.IsManifest(uri)
+	}
+
+	for _, uri := range flag.Args() {
+
+		opts := &walk.WalkOptions{
+			URI:         uri,
+			Workers:     *workers,
+			Callback:    cb,
+			Compression: datajam.CompressionFromContext(ctx),
+			Filter:      filter_func,
+			Expression:  query_expr,
+		}
+
+		err := walk.WalkBucket(ctx, opts, bucket)
+
+		if err != nil {
+			idx.Close()
+			log.Fatalf("Failed to crawl %s, %v", uri, err)
+		}
+	}
+
+	err = idx.Close()
+
+	if err != nil {
+		log.Fatalf("Failed to close index, %v", err)
+	}
+
+	log.Printf("Indexed %d records (skipped %d records) in %v\n", atomic.LoadInt64(&count), atomic.LoadInt64(&skipped), time.Since(t1))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam"
+	"log"
+	"os"
+	"text/tabwriter"
+)
+
+func main() {
+
+	registry_path := flag.String("registry", "", "The path to a dataset registry file. If empty the registry defined by the DATAJAM_DATASETS environment variable, or the user's go-libraryofcongress-datajam/datasets.json configuration file, is used.")
+	as_json := flag.Bool("json", false, "Emit the registry as JSON.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "List the Library of Congress datasets that can be referenced by loc:// URIs.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	var registry *datajam.Registry
+	var err error
+
+	if *registry_path != "" {
+		registry, err = datajam.LoadRegistry(*registry_path)
+	} else {
+		registry, err = datajam.DefaultRegistry()
+	}
+
+	if err != nil {
+		log.Fatalf("Failed to load dataset registry, %v", err)
+	}
+
+	if *as_json {
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		err := enc.Encode(registry)
+
+		if err != nil {
+			log.Fatalf("Failed to encode dataset registry, %v", err)
+		}
+
+		return
+	}
+
+	datasets := registry.List()
+
+	if len(datasets) == 0 {
+		log.Printf("No datasets configured. Set the %s environment variable to define some.", datajam.DATASETS_ENV)
+		return
+	}
+
+	default_name := registry.Default
+
+	if default_name == "" && len(datasets) == 1 {
+		default_name = datasets[0].Name
+	}
+
+	wr := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(wr, "NAME\tURI\tREGION\tCOMPRESSION\tDESCRIPTION")
+
+	for _, d := range datasets {
+
+		name := d.Name
+
+		if name == default_name {
+			name = name + " (default)"
+		}
+
+		fmt.Fprintf(wr, "%s\t%s\t%s\t%s\t%s\n", name, d.URI(), d.Region, d.Compression, d.Description)
+	}
+
+	err = wr.Flush()
+
+	if err != nil {
+		log.Fatalf("Failed to write datasets, %v", err)
+	}
+}
@@ -1,43 +1,277 @@
 package main
 
 import (
-	"encoding/json"
+	"bufio"
+	"context"
 	"flag"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam"
+	"github.com/aaronland/go-libraryofcongress-datajam/compression"
+	"github.com/aaronland/go-libraryofcongress-datajam/metadata"
+	"github.com/aaronland/go-libraryofcongress-datajam/shards"
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/s3blob"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 )
 
 func main() {
 
+	source_bucket_uri := flag.String("source-bucket-uri", "", "A valid GoCloud bucket URI to read metadata.json files from. Valid schemes are: file://, s3:// and loc://. If empty then each path is treated as a local file.")
+	target_bucket_uri := flag.String("target-bucket-uri", "", "A valid GoCloud bucket URI to write line-separated JSON to. If empty then data is written to STDOUT.")
+	target := flag.String("target", "metadata.jsonl", "The name of the file to write in the target bucket. Files ending in '.gz' will be gzip compressed and files ending in '.bz2' will be bzip2 compressed.")
+
+	shard_by := flag.String("shard-by", "", "Split output in to multiple files (shards) written to the target bucket. Valid options are: count, size, hash. If empty output is not sharded.")
+	shard_prefix := flag.String("shard-prefix", "metadata", "The prefix used to name each shard. Shards are named {PREFIX}-{NUMBER}.jsonl{COMPRESSION_EXTENSION}.")
+	shard_max_records := flag.Int64("shard-max-records", 100000, "The maximum number of records per shard when -shard-by is 'count'.")
+	shard_max_bytes := flag.Int64("shard-max-bytes", 100*1024*1024, "The maximum number of (uncompressed) bytes per shard when -shard-by is 'size'.")
+	shard_count := flag.Int("shards", 10, fmt.Sprintf("The number of shards to create when -shard-by is 'hash', up to %d. Every shard is kept open, with its own compression and upload buffers, until all the records have been written.", shards.MAX_HASH_SHARDS))
+	shard_hash_path := flag.String("shard-hash-path", shards.DEFAULT_HASH_PATH, "A valid tidwall/gjson path whose value is used to assign records to shards when -shard-by is 'hash'.")
+	shard_compression := flag.String("compression", "", "The compression scheme to apply to each shard. Valid options are: gzip, bzip2. If empty shards are not compressed.")
+
+	key_property := flag.String("key-property", metadata.DEFAULT_KEY_PROPERTY, "The name of the property used to store each record's original key. If empty the key is not recorded.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Convert Library of Congress metadata.json files in to line-separated JSON.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s [options] [path1 path2 ... pathN]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Paths ending in '.gz' or '.bz2' will be decompressed automatically.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
 	flag.Parse()
 
-	for _, path := range flag.Args() {
+	ctx := context.Background()
+
+	opts := &metadata.WalkOptions{
+		KeyProperty: *key_property,
+	}
+
+	paths := flag.Args()
+
+	if *shard_by != "" {
+
+		if *target_bucket_uri == "" {
+			log.Fatalf("Sharded output requires a -target-bucket-uri flag")
+		}
 
-		r, err := os.Open(path)
+		_, target_bucket, err := datajam.OpenBucket(ctx, *target_bucket_uri)
 
 		if err != nil {
-			log.Fatalf("Failed to open %s, %w", path, err)
+			log.Fatalf("Failed to open target bucket, %v", err)
 		}
 
-		defer r.Close()
+		defer target_bucket.Close()
 
-		var data map[string]interface{}
+		shard_opts := &shards.ShardWriterOptions{
+			Bucket:      target_bucket,
+			Prefix:      *shard_prefix,
+			Compression: *shard_compression,
+			Strategy:    *shard_by,
+			MaxRecords:  *shard_max_records,
+			MaxBytes:    *shard_max_bytes,
+			Shards:      *shard_count,
+			HashPath:    *shard_hash_path,
+		}
 
-		dec := json.NewDecoder(r)
-		err = dec.Decode(&data)
+		shard_wr, err := shards.NewShardWriter(ctx, shard_opts)
 
 		if err != nil {
-			log.Fatalf("Failed to decode data, %w", err)
+			log.Fatalf("Failed to create shard writer, %v", err)
+		}
+
+		cb := func(ctx context.Context, key string, body []byte) error {
+			return shard_wr.Write(ctx, body)
 		}
 
-		for id, details := range data {
+		for _, path := range paths {
 
-			enc := json.NewEncoder(os.Stdout)
-			err := enc.Encode(details)
+			err := convert(ctx, *source_bucket_uri, path, opts, cb)
 
 			if err != nil {
-				log.Fatalf("Failed to encode ID %s, %w", id, err)
+
+				err = fmt.Errorf("Failed to convert %s, %w", path, err)
+
+				// Close the shards written so far and record the failure in the manifest
+
+				_, abort_err := shard_wr.Abort(ctx, err)
+
+				if abort_err != nil {
+					log.Printf("Failed to abort shard writer, %v", abort_err)
+				}
+
+				target_bucket.Close()
+				log.Fatal(err)
 			}
 		}
+
+		m, err := shard_wr.Close(ctx)
+
+		if err != nil {
+			log.Fatalf("Failed to close shard writer, %v", err)
+		}
+
+		log.Printf("Wrote %d records to %d shards\n", m.Records, len(m.Shards))
+		return
+	}
+
+	if *target_bucket_uri == "" {
+
+		err := writeJSONL(ctx, os.Stdout, *source_bucket_uri, paths, opts)
+
+		if err != nil {
+			log.Fatalf("Failed to write records, %v", err)
+		}
+
+		return
+	}
+
+	err := writeTarget(ctx, *target_bucket_uri, *target, *source_bucket_uri, paths, opts)
+
+	if err != nil {
+		log.Fatalf("Failed to write %s, %v", *target, err)
 	}
 }
+
+// writeTarget converts 'paths' to line-separated JSON written to 'target' in the bucket 'target_bucket_uri'. Errors
+// closing 'target' are returned since the data is not guaranteed to have been written until it has been closed. If an
+// error occurs nothing is written.
+func writeTarget(ctx context.Context, target_bucket_uri string, target string, source_bucket_uri string, paths []string, opts *metadata.WalkOptions) (err error) {
+
+	_, target_bucket, err := datajam.OpenBucket(ctx, target_bucket_uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to open target bucket, %w", err)
+	}
+
+	defer target_bucket.Close()
+
+	wr_ctx, wr_cancel := context.WithCancel(ctx)
+	defer wr_cancel()
+
+	bucket_wr, err := target_bucket.NewWriter(wr_ctx, target, nil)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create writer, %w", err)
+	}
+
+	defer func() {
+
+		// Cancelling the writer's context before it is closed discards the (partial) output
+
+		if err != nil {
+			wr_cancel()
+		}
+
+		close_err := bucket_wr.Close()
+
+		if close_err != nil && err == nil {
+			err = fmt.Errorf("Failed to close writer, %w", close_err)
+		}
+	}()
+
+	compressed_wr, err := compression.NewWriter(target, bucket_wr)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create compressed writer, %w", err)
+	}
+
+	// Deferred functions run in reverse order so the compressed writer is closed (flushed) before the bucket writer
+
+	defer func() {
+
+		close_err := compressed_wr.Close()
+
+		if close_err != nil && err == nil {
+			err = fmt.Errorf("Failed to close compressed writer, %w", close_err)
+		}
+	}()
+
+	return writeJSONL(ctx, compressed_wr, source_bucket_uri, paths, opts)
+}
+
+// writeJSONL converts 'paths' to line-separated JSON written to 'wr'.
+func writeJSONL(ctx context.Context, wr io.Writer, source_bucket_uri string, paths []string, opts *metadata.WalkOptions) error {
+
+	buf_wr := bufio.NewWriter(wr)
+
+	cb := func(ctx context.Context, key string, body []byte) error {
+
+		_, err := buf_wr.Write(append(body, '\n'))
+
+		if err != nil {
+			return fmt.Errorf("Failed to write record for key %s, %w", key, err)
+		}
+
+		return nil
+	}
+
+	for _, path := range paths {
+
+		err := convert(ctx, source_bucket_uri, path, opts, cb)
+
+		if err != nil {
+			return fmt.Errorf("Failed to convert %s, %w", path, err)
+		}
+	}
+
+	err := buf_wr.Flush()
+
+	if err != nil {
+		return fmt.Errorf("Failed to flush output, %w", err)
+	}
+
+	return nil
+}
+
+func convert(ctx context.Context, bucket_uri string, path string, opts *metadata.WalkOptions, cb metadata.WalkCallbackFunc) error {
+
+	if bucket_uri == "" {
+
+		abs_path, err := filepath.Abs(path)
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive absolute path, %w", err)
+		}
+
+		bucket_uri = fmt.Sprintf("file://%s", filepath.Dir(abs_path))
+		path = filepath.Base(abs_path)
+	}
+
+	ctx, bucket, err := datajam.OpenBucket(ctx, bucket_uri)
+
+	if err != nil {
+		return fmt.Errorf("Failed to open bucket, %w", err)
+	}
+
+	defer bucket.Close()
+
+	fh, err := bucket.NewReader(ctx, path, nil)
+
+	if err != nil {
+		return fmt.Errorf("Failed to open %s, %w", path, err)
+	}
+
+	defer fh.Close()
+
+	// Prefer the compression scheme of a registered dataset over the file extension
+
+	c := datajam.CompressionFromContext(ctx)
+
+	if c == "" {
+		c = compression.FromPath(path)
+	}
+
+	r, err := compression.NewReaderWithCompression(c, fh)
+
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	return metadata.Walk(ctx, r, opts, cb)
+}
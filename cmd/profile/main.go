@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-json-query"
+	jw "github.com/aaronland/go-jsonl/walk"
+	"github.com/aaronland/go-libraryofcongress-datajam"
+	"github.com/aaronland/go-libraryofcongress-datajam/expr"
+	"github.com/aaronland/go-libraryofcongress-datajam/profile"
+	"github.com/aaronland/go-libraryofcongress-datajam/shards"
+	"github.com/aaronland/go-libraryofcongress-datajam/walk"
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/s3blob"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+func main() {
+
+	bucket_uri := flag.String("bucket-uri", "", "A valid GoCloud bucket URI. Valid schemes are: file://, s3:// and loc://{DATASET}/ which signals that data should be retrieved from a Library Of Congress dataset defined in the DATAJAM_DATASETS registry (see list-datasets).")
+	workers := flag.Int("workers", 10, "The maximum number of concurrent workers. This is used to prevent filehandle exhaustion.")
+
+	top := flag.Int("top", profile.DEFAULT_TOP, "The number of most common values to report for each path.")
+	examples := flag.Int("examples", profile.DEFAULT_EXAMPLES, "The number of example record IDs to report for each path.")
+	max_values := flag.Int("max-values", profile.DEFAULT_MAX_VALUES, "The maximum number of distinct values to count for each path. Beyond this top values are approximate and cardinality is estimated.")
+	id_path := flag.String("id-path", profile.DEFAULT_ID_PATH, "The (gjson) path used to derive the ID of each record.")
+	min_coverage := flag.Float64("min-coverage", 0.0, "Only report paths present in at least this fraction (0.0 - 1.0) of records.")
+
+	format := flag.String("format", "table", "The output format. Valid formats are: json, table.")
+
+	var queries expr.ExpressionFlags
+	flag.Var(&queries, "query", "One or more query expressions for filtering records. In addition to {PATH}={REGEXP} expressions negation (!=), comparisons (==, <, <=, >, >=), exists({PATH}), missing({PATH}), count({PATH}) and parenthesised AND, OR and NOT expressions are supported.")
+
+	valid_modes := strings.Join([]string{query.QUERYSET_MODE_ALL, query.QUERYSET_MODE_ANY}, ", ")
+	desc_modes := fmt.Sprintf("Specify how query filtering should be evaluated. Valid modes are: %s", valid_modes)
+
+	query_mode := flag.String("query-mode", query.QUERYSET_MODE_ALL, desc_modes)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Report the coverage, types, cardinality and most common values of every property in a set of records.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s [options] [path1 path2 ... pathN]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	query_expr, err := expr.Combine(*query_mode, queries...)
+
+	if err != nil {
+		log.Fatalf("Invalid -query flags, %v", err)
+	}
+
+	switch *format {
+	case "json", "table":
+		// pass
+	default:
+		log.Fatalf("Invalid -format flag")
+	}
+
+	ctx := context.Background()
+
+	ctx, bucket, err := datajam.OpenBucket(ctx, *bucket_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open bucket, %v", err)
+	}
+
+	defer bucket.Close()
+
+	p_opts := &profile.ProfileOptions{
+		Top:       *top,
+		Examples:  *examples,
+		MaxValues: *max_values,
+		IDPath:    *id_path,
+	}
+
+	p := profile.NewProfile(p_opts)
+
+	cb := func(ctx context.Context, rec *jw.WalkRecord, err error) error {
+
+		if err != nil {
+
+			if jw.IsEOFError(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		p.Add(rec.Body)
+		return nil
+	}
+
+	filter_func := func(ctx context.Context, uri string) bool {
+		return !shards.IsManifest(uri)
+	}
+
+	for _, uri := range flag.Args() {
+
+		opts := &walk.WalkOptions{
+			URI:         uri,
+			Workers:     *workers,
+			Callback:    cb,
+			Compression: datajam.CompressionFromContext(ctx),
+			Filter:      filter_func,
+			Expression:  query_expr,
+		}
+
+		err := walk.WalkBucket(ctx, opts, bucket)
+
+		if err != nil {
+			log.Fatalf("Failed to crawl %s, %v", uri, err)
+		}
+	}
+
+	report := p.Report()
+
+	paths := make([]*profile.PathReport, 0, len(report.Paths))
+
+	for _, pr := range report.Paths {
+
+		if pr.Coverage >= *min_coverage {
+			paths = append(paths, pr)
+		}
+	}
+
+	report.Paths = paths
+
+	switch *format {
+	case "json":
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		err = enc.Encode(report)
+
+	default:
+		err = writeTable(os.Stdout, report)
+	}
+
+	if err != nil {
+		log.Fatalf("Failed to write profile, %v", err)
+	}
+}
+
+// writeTable writes a human-readable summary of 'report' to 'wr'.
+func writeTable(wr io.Writer, report *profile.Report) error {
+
+	tw := tabwriter.NewWriter(wr, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "%d records\n\n", report.Records)
+	fmt.Fprintln(tw, "PATH\tRECORDS\tCOVERAGE\tTYPES\tCARDINALITY\tTOP VALUES")
+
+	for _, pr := range report.Paths {
+
+		types := make([]string, 0, len(pr.Types))
+
+		for t, count := range pr.Types {
+			types = append(types, fmt.Sprintf("%s:%d", t, count))
+		}
+
+		sort.Strings(types)
+
+		cardinality := fmt.Sprintf("%d", pr.Cardinality)
+
+		if pr.CardinalityEstimated {
+			cardinality = "~" + cardinality
+		}
+
+		values := make([]string, 0, 3)
+
+		for idx, v := range pr.TopValues {
+
+			if idx == 3 {
+				break
+			}
+
+			str_v := v.Value
+
+			if utf8.RuneCountInString(str_v) > 30 {
+				str_v = string([]rune(str_v)[:30]) + "…"
+			}
+
+			values = append(values, fmt.Sprintf("%q (%d)", str_v, v.Count))
+		}
+
+		fmt.Fprintf(tw, "%s\t%d\t%.1f%%\t%s\t%s\t%s\n", pr.Path, pr.Records, pr.Coverage*100.0, strings.Join(types, ","), cardinality, strings.Join(values, ", "))
+	}
+
+	return tw.Flush()
+}
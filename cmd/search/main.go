@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-json-query"
+	"github.com/aaronland/go-libraryofcongress-datajam/expr"
+	"github.com/aaronland/go-libraryofcongress-datajam/output"
+	proj "github.com/aaronland/go-libraryofcongress-datajam/projection"
+	"github.com/aaronland/go-libraryofcongress-datajam/record"
+	"github.com/aaronland/go-libraryofcongress-datajam/sqlite"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+func main() {
+
+	database := flag.String("database", "", "The path to a SQLite database created by the index-sqlite tool.")
+
+	text := flag.String("text", "", "An FTS5 full-text query matched against the title, notes, description and subjects of records. For example: \"library AND congress\" or \"title:bridge\".")
+	subject := flag.String("subject", "", "Only include records with this (exact) subject.")
+	contributor := flag.String("contributor", "", "Only include records with this (exact) contributor.")
+	location := flag.String("location", "", "Only include records with this (exact) location.")
+	place := flag.String("place", "", "Only include records with a place with this (exact) title.")
+	limit := flag.Int("limit", 0, "The maximum number of records to emit. If 0 all matching records are emitted.")
+
+	to_stdout := flag.Bool("stdout", true, "Emit to STDOUT")
+	to_devnull := flag.Bool("null", false, "Emit to /dev/null")
+
+	as_json := flag.Bool("json", false, "Emit a JSON list.")
+	format_json := flag.Bool("format-json", false, "Format JSON output for each record.")
+
+	as_oembed := flag.Bool("oembed", false, "Emit results as OEmbed records")
+
+	var project_fields proj.FieldFlags
+	flag.Var(&project_fields, "project", "One or more {PATH} or {NAME}={PATH} (gjson) paths used to emit slimmed-down records containing only those properties. Multiple paths may be separated by commas. If -oembed is true paths are applied to the oEmbed records.")
+	project_omit_empty := flag.Bool("project-omit-empty", false, "Omit projected properties with no value rather than assigning them a null value.")
+
+	as_csv := flag.Bool("csv", false, "Emit records as CSV rows using the columns defined by the -column flags.")
+	as_tsv := flag.Bool("tsv", false, "Emit records as tab-separated rows using the columns defined by the -column flags.")
+
+	var column_fields proj.FieldFlags
+	flag.Var(&column_fields, "column", "One or more {NAME}={PATH} (gjson) paths defining the columns to emit when -csv or -tsv is true. Multiple columns may be separated by commas. If {NAME} is omitted the path is used as the column name.")
+	array_separator := flag.String("array-separator", ";", "The string used to join array values, and flattened object values, in -csv or -tsv output.")
+
+	stats := flag.Bool("stats", false, "Display timings and statistics.")
+
+	derive_dates := flag.Bool("derive-dates", false, "Append \"edtf:date\", \"edtf:inception\" and \"edtf:cessation\" properties, derived from each record's date, to emitted records.")
+
+	var queries expr.ExpressionFlags
+	flag.Var(&queries, "query", "One or more query expressions for filtering records. In addition to {PATH}={REGEXP} expressions negation (!=), comparisons (==, <, <=, >, >=), exists({PATH}), missing({PATH}), count({PATH}) and parenthesised AND, OR and NOT expressions are supported.")
+
+	valid_modes := strings.Join([]string{query.QUERYSET_MODE_ALL, query.QUERYSET_MODE_ANY}, ", ")
+	desc_modes := fmt.Sprintf("Specify how query filtering should be evaluated. Valid modes are: %s", valid_modes)
+
+	query_mode := flag.String("query-mode", query.QUERYSET_MODE_ALL, desc_modes)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Search a SQLite database created by the index-sqlite tool and emit matching records.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	query_expr, err := expr.Combine(*query_mode, queries...)
+
+	if err != nil {
+		log.Fatalf("Invalid -query flags, %v", err)
+	}
+
+	if *database == "" {
+		log.Fatalf("Missing -database flag")
+	}
+
+	var projection *proj.Projection
+
+	if len(project_fields) > 0 {
+
+		p, err := proj.NewProjection(project_fields)
+
+		if err != nil {
+			log.Fatalf("Invalid -project flags, %v", err)
+		}
+
+		p.OmitEmpty = *project_omit_empty
+		projection = p
+	}
+
+	writers := make([]io.Writer, 0)
+
+	if *to_stdout {
+		writers = append(writers, os.Stdout)
+	}
+
+	if *to_devnull {
+		writers = append(writers, ioutil.Discard)
+	}
+
+	if len(writers) == 0 {
+		log.Fatal("Nothing to write to.")
+	}
+
+	wr := io.MultiWriter(writers...)
+
+	out_opts := &output.WriterOptions{
+		JSON:           *as_json,
+		FormatJSON:     *format_json,
+		OEmbed:         *as_oembed,
+		DeriveDates:    *derive_dates,
+		Projection:     projection,
+		CSV:            *as_csv,
+		TSV:            *as_tsv,
+		ArraySeparator: *array_separator,
+	}
+
+	if len(column_fields) > 0 {
+
+		columns, err := proj.NewProjection(column_fields)
+
+		if err != nil {
+			log.Fatalf("Invalid -column flags, %v", err)
+		}
+
+		out_opts.Columns = columns
+	}
+
+	err = out_opts.Validate()
+
+	if err != nil {
+		log.Fatalf("Invalid output flags, %v", err)
+	}
+
+	ctx := context.Background()
+
+	idx, err := sqlite.OpenIndex(ctx, *database)
+
+	if err != nil {
+		log.Fatalf("Failed to open index, %v", err)
+	}
+
+	defer idx.Close()
+
+	out, err := output.NewWriter(wr, out_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create output writer, %v", err)
+	}
+
+	if *stats {
+
+		t1 := time.Now()
+
+		defer func() {
+			log.Printf("Processed %d records in %v\n", out.Count(), time.Since(t1))
+		}()
+	}
+
+	cb := func(ctx context.Context, body []byte) error {
+
+		rec, err := record.Unmarshal(body)
+
+		if err != nil {
+			log.Printf("Skipping record, %v", err)
+			return nil
+		}
+
+		return out.Write(ctx, rec)
+	}
+
+	search_opts := &sqlite.SearchOptions{
+		Text:        *text,
+		Subject:     *subject,
+		Contributor: *contributor,
+		Location:    *location,
+		Place:       *place,
+		Expression:  query_expr,
+		Limit:       *limit,
+	}
+
+	err = idx.Search(ctx, search_opts, cb)
+
+	if err != nil {
+		log.Fatalf("Failed to search index, %v", err)
+	}
+
+	err = out.Close()
+
+	if err != nil {
+		log.Fatalf("Failed to close output writer, %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam"
+	"github.com/aaronland/go-libraryofcongress-datajam/mirror"
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/s3blob"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// prefixFlags is a flag.Value for collecting multiple -prefix flags.
+type prefixFlags []string
+
+func (p *prefixFlags) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *prefixFlags) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+func main() {
+
+	source_bucket_uri := flag.String("source-bucket-uri", "", "A valid GoCloud bucket URI to copy objects from. Valid schemes are: file://, s3:// and loc://{DATASET}/.")
+	target_bucket_uri := flag.String("target-bucket-uri", "", "A valid GoCloud bucket URI to copy objects to. For example: file:///usr/local/data/loc/")
+	workers := flag.Int("workers", 10, "The maximum number of objects to copy concurrently.")
+	dry_run := flag.Bool("dry-run", false, "List the objects that would be copied without copying them.")
+	report_path := flag.String("report", "-", "The path to write a JSON report of the sync to. If \"-\" the report is written to STDOUT. If empty no report is written.")
+	verbose := flag.Bool("verbose", false, "Log the outcome for each object.")
+
+	var prefixes prefixFlags
+	flag.Var(&prefixes, "prefix", "Zero or more prefixes to limit the objects copied. If empty every object in the source bucket is copied.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Copy new or changed objects from one bucket to another.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *source_bucket_uri == "" || *target_bucket_uri == "" {
+		log.Fatalf("Both -source-bucket-uri and -target-bucket-uri are required")
+	}
+
+	ctx := context.Background()
+
+	_, source, err := datajam.OpenBucket(ctx, *source_bucket_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open source bucket, %v", err)
+	}
+
+	defer source.Close()
+
+	_, target, err := datajam.OpenBucket(ctx, *target_bucket_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open target bucket, %v", err)
+	}
+
+	defer target.Close()
+
+	opts := &mirror.SyncOptions{
+		Prefixes: prefixes,
+		Workers:  *workers,
+		DryRun:   *dry_run,
+	}
+
+	if *verbose || *dry_run {
+
+		opts.Callback = func(ctx context.Context, obj *mirror.ObjectReport) {
+
+			switch obj.Action {
+			case mirror.ACTION_ERROR:
+				log.Printf("%s %s: %s\n", obj.Action, obj.Key, obj.Error)
+			case mirror.ACTION_COPY:
+				log.Printf("%s %s (%s, %d bytes)\n", obj.Action, obj.Key, obj.Reason, obj.Size)
+			default:
+
+				if *verbose {
+					log.Printf("%s %s\n", obj.Action, obj.Key)
+				}
+			}
+		}
+	}
+
+	report, sync_err := mirror.Sync(ctx, source, target, opts)
+
+	if *report_path != "" {
+
+		var wr io.Writer = os.Stdout
+
+		if *report_path != "-" {
+
+			fh, err := os.Create(*report_path)
+
+			if err != nil {
+				log.Fatalf("Failed to create report %s, %v", *report_path, err)
+			}
+
+			defer fh.Close()
+			wr = fh
+		}
+
+		enc := json.NewEncoder(wr)
+		enc.SetIndent("", "  ")
+
+		err := enc.Encode(report)
+
+		if err != nil {
+			log.Fatalf("Failed to write report, %v", err)
+		}
+	}
+
+	if sync_err != nil {
+		log.Fatalf("Failed to sync buckets, %v", sync_err)
+	}
+
+	log.Printf("Copied %d objects (%d bytes), skipped %d, failed %d\n", report.Copied, report.Bytes, report.Skipped, report.Failed)
+
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/aaronland/go-json-query"
+	jw "github.com/aaronland/go-jsonl/walk"
+	"github.com/aaronland/go-libraryofcongress-datajam"
+	"github.com/aaronland/go-libraryofcongress-datajam/dates"
+	"github.com/aaronland/go-libraryofcongress-datajam/expr"
+	proj "github.com/aaronland/go-libraryofcongress-datajam/projection"
+	"github.com/aaronland/go-libraryofcongress-datajam/record"
+	"github.com/aaronland/go-libraryofcongress-datajam/shards"
+	"github.com/aaronland/go-libraryofcongress-datajam/spatial"
+	"github.com/aaronland/go-libraryofcongress-datajam/tiles"
+	"github.com/aaronland/go-libraryofcongress-datajam/walk"
+	"github.com/paulmach/orb/maptile"
+	"gocloud.dev/blob"
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/s3blob"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// The properties assigned to each point if no -property flags are specified.
+const DEFAULT_PROPERTIES string = "id=item.id,title,date,url"
+
+// The content type of Mapbox Vector Tiles written to a bucket.
+const MVT_CONTENT_TYPE string = "application/vnd.mapbox-vector-tile"
+
+func main() {
+
+	bucket_uri := flag.String("bucket-uri", "", "A valid GoCloud bucket URI. Valid schemes are: file://, s3:// and loc://{DATASET}/ which signals that data should be retrieved from a Library Of Congress dataset defined in the DATAJAM_DATASETS registry (see list-datasets).")
+	workers := flag.Int("workers", 10, "The maximum number of concurrent workers. This is used to prevent filehandle exhaustion.")
+
+	var queries expr.ExpressionFlags
+	flag.Var(&queries, "query", "One or more query expressions for filtering records. In addition to {PATH}={REGEXP} expressions negation (!=), comparisons (==, <, <=, >, >=), exists({PATH}), missing({PATH}), count({PATH}) and parenthesised AND, OR and NOT expressions are supported.")
+
+	valid_modes := strings.Join([]string{query.QUERYSET_MODE_ALL, query.QUERYSET_MODE_ANY}, ", ")
+	desc_modes := fmt.Sprintf("Specify how query filtering should be evaluated. Valid modes are: %s", valid_modes)
+
+	query_mode := flag.String("query-mode", query.QUERYSET_MODE_ALL, desc_modes)
+
+	bbox := flag.String("bbox", "", "Only include records whose coordinates are inside a {MINLON},{MINLAT},{MAXLON},{MAXLAT} bounding box.")
+	near := flag.String("near", "", "Only include records whose coordinates are within {RADIUS} meters of a point, defined as {LAT},{LON},{RADIUS}.")
+	polygon := flag.String("polygon", "", "Only include records whose coordinates are inside the Polygon or MultiPolygon geometries in a GeoJSON file.")
+
+	date_range := flag.String("date-range", "", "Only include records whose dates overlap a {START}/{END} range of dates, where {START} and {END} are dates like \"1861\", \"1861-04\" or \"1861-04-12\" or \"..\" for an open range.")
+	include_undated := flag.Bool("include-undated", false, "Include records without a valid date when -date-range is set.")
+
+	var property_fields proj.FieldFlags
+	flag.Var(&property_fields, "property", fmt.Sprintf("One or more {PATH} or {NAME}={PATH} (gjson) paths to include as point properties. Multiple paths may be separated by commas. If empty the following properties are included: %s", DEFAULT_PROPERTIES))
+	with_thumbnail := flag.Bool("thumbnail", false, "Include the record's 'item.thumb_gallery' image URL as a \"thumbnail\" point property.")
+
+	min_zoom := flag.Int("min-zoom", tiles.DEFAULT_MIN_ZOOM, "The minimum zoom level to generate tiles for.")
+	max_zoom := flag.Int("max-zoom", tiles.DEFAULT_MAX_ZOOM, fmt.Sprintf("The maximum zoom level to generate tiles for. The largest valid zoom level is %d.", tiles.MAX_ZOOM))
+	cluster_max_zoom := flag.Int("cluster-max-zoom", tiles.DEFAULT_CLUSTER_MAX_ZOOM, "The maximum zoom level at which points are clustered. Use -1 to disable clustering.")
+	cluster_radius := flag.Float64("cluster-radius", tiles.DEFAULT_CLUSTER_RADIUS, "The radius, in (256 pixel tile) pixels, within which points are clustered.")
+	layer := flag.String("layer", tiles.DEFAULT_LAYER, "The name of the layer in each tile.")
+	extent := flag.Uint("extent", uint(tiles.DEFAULT_EXTENT), "The size of each tile in tile coordinates.")
+	buffer := flag.Uint("buffer", uint(tiles.DEFAULT_BUFFER), "The number of tile coordinates beyond the edges of a tile within which points are also included.")
+	name := flag.String("name", "", "An optional name for the tileset, recorded in its metadata.")
+
+	tiles_uri := flag.String("tiles-uri", "", "A valid GoCloud bucket URI where tiles are written as {Z}/{X}/{Y}.mvt files, along with a metadata.json file.")
+	pmtiles_path := flag.String("pmtiles", "", "A path where tiles are written as a single PMTiles archive.")
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Generate Mapbox Vector Tiles for records with coordinates.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage:\n")
+		fmt.Fprintf(os.Stderr, "  %s [options] [path1 path2 ... pathN]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Exactly one of the -tiles-uri or -pmtiles flags must be set.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if (*tiles_uri == "") == (*pmtiles_path == "") {
+		log.Fatalf("Exactly one of the -tiles-uri or -pmtiles flags must be set")
+	}
+
+	query_expr, err := expr.Combine(*query_mode, queries...)
+
+	if err != nil {
+		log.Fatalf("Invalid -query flags, %v", err)
+	}
+
+	spatial_opts := &spatial.FilterOptions{
+		BoundingBox: *bbox,
+		PointRadius: *near,
+		PolygonPath: *polygon,
+	}
+
+	spatial_expr, err := spatial.NewFilter(spatial_opts)
+
+	if err != nil {
+		log.Fatalf("Invalid spatial filter, %v", err)
+	}
+
+	query_expr = expr.All(query_expr, spatial_expr)
+
+	if *date_range != "" {
+
+		date_expr, err := dates.NewRangeFilter(*date_range, *include_undated)
+
+		if err != nil {
+			log.Fatalf("Invalid -date-range flag, %v", err)
+		}
+
+		query_expr = expr.All(query_expr, date_expr)
+	}
+
+	if len(property_fields) == 0 {
+
+		err := property_fields.Set(DEFAULT_PROPERTIES)
+
+		if err != nil {
+			log.Fatalf("Failed to assign default properties, %v", err)
+		}
+	}
+
+	projection, err := proj.NewProjection(property_fields)
+
+	if err != nil {
+		log.Fatalf("Invalid -property flags, %v", err)
+	}
+
+	projection.OmitEmpty = true
+
+	ts_opts := &tiles.TilesetOptions{
+		Layer:          *layer,
+		MinZoom:        *min_zoom,
+		MaxZoom:        *max_zoom,
+		ClusterMaxZoom: *cluster_max_zoom,
+		ClusterRadius:  *cluster_radius,
+		Extent:         uint32(*extent),
+		Buffer:         uint32(*buffer),
+	}
+
+	ts, err := tiles.NewTileset(ts_opts)
+
+	if err != nil {
+		log.Fatalf("Failed to create tileset, %v", err)
+	}
+
+	ctx := context.Background()
+
+	ctx, bucket, err := datajam.OpenBucket(ctx, *bucket_uri)
+
+	if err != nil {
+		log.Fatalf("Failed to open bucket, %v", err)
+	}
+
+	defer bucket.Close()
+
+	skipped := int64(0)
+
+	cb := func(ctx context.Context, rec *record.Record, err error) error {
+
+		if err != nil {
+
+			if jw.IsEOFError(err) {
+				return nil
+			}
+
+			if walk.IsDecodeError(err) {
+				log.Printf("Skipping record, %v", err)
+				return nil
+			}
+
+			log.Println(err)
+			return err
+		}
+
+		body := rec.Body()
+		id := rec.ItemId()
+
+		loc, err := spatial.Locate(body)
+
+		if err != nil {
+
+			if !errors.Is(err, spatial.ErrNoCoordinates) {
+				atomic.AddInt64(&skipped, 1)
+			}
+
+			return nil
+		}
+
+		p_body, err := projection.Project(body)
+
+		if err != nil {
+			return fmt.Errorf("Failed to project record %s, %w", id, err)
+		}
+
+		var props map[string]interface{}
+
+		err = json.Unmarshal(p_body, &props)
+
+		if err != nil {
+			return fmt.Errorf("Failed to unmarshal properties for %s, %w", id, err)
+		}
+
+		if *with_thumbnail {
+
+			thumb := rec.Thumbnail()
+
+			if thumb != "" {
+				props["thumbnail"] = thumb
+			}
+		}
+
+		ts.Add(loc.Point, props)
+		return nil
+	}
+
+	filter_func := func(ctx context.Context, uri string) bool {
+		// Skip things like index.txt' or errant 'fileblob*' records
+		return !shards.IsManifest(uri)
+	}
+
+	for _, uri := range flag.Args() {
+
+		opts := &walk.WalkOptions{
+			URI:         uri,
+			Workers:     *workers,
+			Callback:    walk.LibraryOfCongressRecordCallback(cb),
+			Compression: datajam.CompressionFromContext(ctx),
+			Filter:      filter_func,
+			Expression:  query_expr,
+		}
+
+		err := walk.WalkBucket(ctx, opts, bucket)
+
+		if err != nil {
+			log.Fatalf("Failed to crawl %s, %v", uri, err)
+		}
+	}
+
+	if skipped > 0 {
+		log.Printf("Skipped %d records with unusable coordinates", skipped)
+	}
+
+	// Use a new context since the walk's context may have been cancelled
+
+	gen_ctx := context.Background()
+
+	metadata := ts.Metadata(*name)
+	count := 0
+
+	if *pmtiles_path != "" {
+
+		fh, err := os.Create(*pmtiles_path)
+
+		if err != nil {
+			log.Fatalf("Failed to create %s, %v", *pmtiles_path, err)
+		}
+
+		pm_opts := &tiles.PMTilesOptions{
+			MinZoom:  *min_zoom,
+			MaxZoom:  *max_zoom,
+			Bound:    ts.Bound(),
+			Metadata: metadata,
+		}
+
+		pm_wr, err := tiles.NewPMTilesWriter(fh, pm_opts)
+
+		if err != nil {
+			log.Fatalf("Failed to create PMTiles writer, %v", err)
+		}
+
+		tile_cb := func(ctx context.Context, t maptile.Tile, body []byte) error {
+			count += 1
+			return pm_wr.WriteTile(t, body)
+		}
+
+		err = ts.Generate(gen_ctx, tile_cb)
+
+		if err != nil {
+			log.Fatalf("Failed to generate tiles, %v", err)
+		}
+
+		err = pm_wr.Close()
+
+		if err != nil {
+			log.Fatalf("Failed to close PMTiles writer, %v", err)
+		}
+
+		err = fh.Close()
+
+		if err != nil {
+			log.Fatalf("Failed to close %s, %v", *pmtiles_path, err)
+		}
+
+	} else {
+
+		_, tiles_bucket, err := datajam.OpenBucket(gen_ctx, *tiles_uri)
+
+		if err != nil {
+			log.Fatalf("Failed to open tiles bucket, %v", err)
+		}
+
+		defer tiles_bucket.Close()
+
+		wr_opts := &blob.WriterOptions{
+			ContentType: MVT_CONTENT_TYPE,
+		}
+
+		tile_cb := func(ctx context.Context, t maptile.Tile, body []byte) error {
+
+			k := fmt.Sprintf("%d/%d/%d.mvt", t.Z, t.X, t.Y)
+
+			err := tiles_bucket.WriteAll(ctx, k, body, wr_opts)
+
+			if err != nil {
+				return fmt.Errorf("Failed to write %s, %w", k, err)
+			}
+
+			count += 1
+			return nil
+		}
+
+		err = ts.Generate(gen_ctx, tile_cb)
+
+		if err != nil {
+			log.Fatalf("Failed to generate tiles, %v", err)
+		}
+
+		enc_meta, err := json.Marshal(metadata)
+
+		if err != nil {
+			log.Fatalf("Failed to marshal metadata, %v", err)
+		}
+
+		meta_opts := &blob.WriterOptions{
+			ContentType: "application/json",
+		}
+
+		err = tiles_bucket.WriteAll(gen_ctx, "metadata.json", enc_meta, meta_opts)
+
+		if err != nil {
+			log.Fatalf("Failed to write metadata.json, %v", err)
+		}
+	}
+
+	log.Printf("Wrote %d tiles for %d records", count, ts.Count())
+}
@@ -7,9 +7,12 @@ import (
 	"github.com/aaronland/go-json-query"
 	jw "github.com/aaronland/go-jsonl/walk"
 	"github.com/aaronland/go-libraryofcongress-datajam"
+	"github.com/aaronland/go-libraryofcongress-datajam/expr"
+	"github.com/aaronland/go-libraryofcongress-datajam/record"
+	"github.com/aaronland/go-libraryofcongress-datajam/shards"
+	"github.com/aaronland/go-libraryofcongress-datajam/spatial"
 	"github.com/aaronland/go-libraryofcongress-datajam/walk"
 	"github.com/sfomuseum/go-csvdict"
-	"github.com/tidwall/gjson"
 	_ "gocloud.dev/blob/fileblob"
 	_ "gocloud.dev/blob/s3blob"
 	"io"
@@ -22,20 +25,29 @@ import (
 
 func main() {
 
-	bucket_uri := flag.String("bucket-uri", "", "A valid GoCloud bucket URI. Valid schemes are: file://, s3:// and loc:// which is signals that data should be retrieved from the Library Of Congress's '...' S3 bucket.")
+	bucket_uri := flag.String("bucket-uri", "", "A valid GoCloud bucket URI. Valid schemes are: file://, s3:// and loc://{DATASET}/ which signals that data should be retrieved from a Library Of Congress dataset defined in the DATAJAM_DATASETS registry (see list-datasets).")
 	workers := flag.Int("workers", 10, "The maximum number of concurrent workers. This is used to prevent filehandle exhaustion.")
 
+	checkpoint_uri := flag.String("checkpoint", "", "An optional local path or GoCloud bucket URI (with a filename) where walk progress is periodically recorded. For example: file:///tmp/checkpoint.json")
+	checkpoint_interval := flag.Duration("checkpoint-interval", walk.DEFAULT_CHECKPOINT_INTERVAL, "The minimum interval between writes of the -checkpoint file.")
+	resume := flag.Bool("resume", false, "Resume a previous walk, skipping files and lines already recorded in the -checkpoint file.")
+
 	to_stdout := flag.Bool("stdout", true, "Emit to STDOUT")
 	to_devnull := flag.Bool("null", false, "Emit to /dev/null")
 
-	var queries query.QueryFlags
-	flag.Var(&queries, "query", "One or more {PATH}={REGEXP} parameters for filtering records.")
+	var queries expr.ExpressionFlags
+	flag.Var(&queries, "query", "One or more query expressions for filtering records. In addition to {PATH}={REGEXP} expressions negation (!=), comparisons (==, <, <=, >, >=), exists({PATH}), missing({PATH}), count({PATH}) and parenthesised AND, OR and NOT expressions are supported.")
 
 	valid_modes := strings.Join([]string{query.QUERYSET_MODE_ALL, query.QUERYSET_MODE_ANY}, ", ")
 	desc_modes := fmt.Sprintf("Specify how query filtering should be evaluated. Valid modes are: %s", valid_modes)
 
 	query_mode := flag.String("query-mode", query.QUERYSET_MODE_ALL, desc_modes)
 
+	bbox := flag.String("bbox", "", "Only include records whose coordinates are inside a {MINLON},{MINLAT},{MAXLON},{MAXLAT} bounding box.")
+	near := flag.String("near", "", "Only include records whose coordinates are within {RADIUS} meters of a point, defined as {LAT},{LON},{RADIUS}.")
+	polygon := flag.String("polygon", "", "Only include records whose coordinates are inside the Polygon or MultiPolygon geometries in a GeoJSON file.")
+	include_missing_coords := flag.Bool("include-missing-coordinates", false, "Include records without coordinates when -bbox, -near or -polygon are set.")
+
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage:\n")
 		fmt.Fprintf(os.Stderr, "  %s [options] [path1 path2 ... pathN]\n\n", os.Args[0])
@@ -45,6 +57,27 @@ func main() {
 
 	flag.Parse()
 
+	query_expr, err := expr.Combine(*query_mode, queries...)
+
+	if err != nil {
+		log.Fatalf("Invalid -query flags, %v", err)
+	}
+
+	spatial_opts := &spatial.FilterOptions{
+		BoundingBox:    *bbox,
+		PointRadius:    *near,
+		PolygonPath:    *polygon,
+		IncludeMissing: *include_missing_coords,
+	}
+
+	spatial_expr, err := spatial.NewFilter(spatial_opts)
+
+	if err != nil {
+		log.Fatalf("Invalid spatial filter, %v", err)
+	}
+
+	query_expr = expr.All(query_expr, spatial_expr)
+
 	ctx := context.Background()
 
 	ctx, bucket, err := datajam.OpenBucket(ctx, *bucket_uri)
@@ -55,6 +88,33 @@ func main() {
 
 	defer bucket.Close()
 
+	var checkpoint *walk.Checkpoint
+
+	if *resume && *checkpoint_uri == "" {
+		log.Fatalf("-resume requires a -checkpoint flag")
+	}
+
+	if *checkpoint_uri != "" {
+
+		cp, err := walk.NewCheckpoint(ctx, *checkpoint_uri, *resume)
+
+		if err != nil {
+			log.Fatalf("Failed to create checkpoint, %v", err)
+		}
+
+		cp.Interval = *checkpoint_interval
+		checkpoint = cp
+
+		defer func() {
+
+			err := cp.Close()
+
+			if err != nil {
+				log.Printf("Failed to close checkpoint, %v", err)
+			}
+		}()
+	}
+
 	writers := make([]io.Writer, 0)
 
 	if *to_stdout {
@@ -87,14 +147,14 @@ func main() {
 
 	// location is an array of names
 	// locations is an array of empty GeoJSON features
-	queries.Set("location=.*")
+	query_expr = expr.All(&expr.Count{Path: "location", Operator: expr.OP_GT, Value: 0}, query_expr)
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	mu := new(sync.RWMutex)
 
-	cb := func(ctx context.Context, rec *jw.WalkRecord, err error) error {
+	cb := func(ctx context.Context, rec *record.Record, err error) error {
 
 		if err != nil {
 
@@ -102,12 +162,16 @@ func main() {
 				return nil
 			}
 
+			if walk.IsDecodeError(err) {
+				log.Printf("Skipping record, %v", err)
+				return nil
+			}
+
 			log.Println(err)
 			return err
 		}
 
-		id_rsp := gjson.GetBytes(rec.Body, "item.id")
-		id := id_rsp.String()
+		id := rec.ItemId()
 
 		// At least with the sample set anything with a 'location' also has a 'latlong'
 
@@ -120,14 +184,8 @@ func main() {
 			}
 		*/
 
-		loc_rsp := gjson.GetBytes(rec.Body, "location")
-		locs := loc_rsp.Array()
-
-		locations := make([]string, len(locs))
-
-		for idx, r := range loc_rsp.Array() {
-			locations[idx] = r.String()
-		}
+		locations := make([]string, len(rec.Location))
+		copy(locations, rec.Location)
 
 		// This works for most of the cases but it is understood that some records
 		// have been encoded incorrectly
@@ -160,27 +218,19 @@ func main() {
 
 	filter_func := func(ctx context.Context, uri string) bool {
 		// Skip things like index.txt' or errant 'fileblob*' records
-		return true
+		return !shards.IsManifest(uri)
 	}
 
 	for _, uri := range uris {
 
 		opts := &walk.WalkOptions{
-			URI:      uri,
-			Workers:  *workers,
-			Callback: cb,
-			IsBzip:   false,
-			Filter:   filter_func,
-		}
-
-		if len(queries) > 0 {
-
-			qs := &query.QuerySet{
-				Queries: queries,
-				Mode:    *query_mode,
-			}
-
-			opts.QuerySet = qs
+			URI:         uri,
+			Workers:     *workers,
+			Callback:    walk.LibraryOfCongressRecordCallback(cb),
+			Compression: datajam.CompressionFromContext(ctx),
+			Filter:      filter_func,
+			Expression:  query_expr,
+			Checkpoint:  checkpoint,
 		}
 
 		err := walk.WalkBucket(ctx, opts, bucket)
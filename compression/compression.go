@@ -0,0 +1,114 @@
+// package compression provides methods for reading and writing compressed data based on filename extensions.
+package compression
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	dsnet_bzip2 "github.com/dsnet/compress/bzip2"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// NONE signals that data is not compressed.
+const NONE string = ""
+
+// GZIP signals that data is gzip compressed.
+const GZIP string = "gzip"
+
+// BZIP2 signals that data is bzip2 compressed.
+const BZIP2 string = "bzip2"
+
+// FromPath returns the compression scheme implied by the extension of 'path'.
+func FromPath(path string) string {
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz", ".gzip":
+		return GZIP
+	case ".bz2", ".bzip2":
+		return BZIP2
+	default:
+		return NONE
+	}
+}
+
+// NewReader returns an io.ReadCloser that decompresses 'r' according to the extension of 'path'.
+// Closing the returned reader does not close 'r'.
+func NewReader(path string, r io.Reader) (io.ReadCloser, error) {
+
+	rc, err := NewReaderWithCompression(FromPath(path), r)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create reader for %s, %w", path, err)
+	}
+
+	return rc, nil
+}
+
+// NewReaderWithCompression returns an io.ReadCloser that decompresses 'r' according to the compression scheme 'c'.
+// Closing the returned reader does not close 'r'.
+func NewReaderWithCompression(c string, r io.Reader) (io.ReadCloser, error) {
+
+	switch c {
+	case GZIP:
+
+		gr, err := gzip.NewReader(r)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create gzip reader, %w", err)
+		}
+
+		return gr, nil
+
+	case BZIP2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	default:
+		return io.NopCloser(r), nil
+	}
+}
+
+// Extension returns the filename extension, including the leading ".", for the compression scheme 'c'.
+func Extension(c string) string {
+
+	switch c {
+	case GZIP:
+		return ".gz"
+	case BZIP2:
+		return ".bz2"
+	default:
+		return ""
+	}
+}
+
+// NewWriter returns an io.WriteCloser that compresses data written to 'wr' according to the extension of 'path'.
+// Closing the returned writer flushes any compressed data but does not close 'wr'.
+func NewWriter(path string, wr io.Writer) (io.WriteCloser, error) {
+
+	switch FromPath(path) {
+	case GZIP:
+		return gzip.NewWriter(wr), nil
+	case BZIP2:
+
+		// The Go standard library only provides a bzip2 decompressor
+
+		bz_wr, err := dsnet_bzip2.NewWriter(wr, nil)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create bzip2 writer, %w", err)
+		}
+
+		return bz_wr, nil
+
+	default:
+		return nopWriteCloser{wr}, nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,73 @@
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+
+	r := rand.New(rand.NewSource(1))
+
+	random := make([]byte, 256*1024)
+	r.Read(random)
+
+	var records strings.Builder
+
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&records, `{"id":"loc-%d","title":"Record %d"}`+"\n", i, i)
+	}
+
+	inputs := map[string][]byte{
+		"empty":   {},
+		"records": []byte(records.String()),
+		"random":  random,
+		"runs":    bytes.Repeat([]byte("a"), 2*1024*1024),
+	}
+
+	for _, path := range []string{"metadata.jsonl", "metadata.jsonl.gz", "metadata.jsonl.bz2"} {
+
+		for label, data := range inputs {
+
+			var buf bytes.Buffer
+
+			wr, err := NewWriter(path, &buf)
+
+			if err != nil {
+				t.Fatalf("Failed to create writer for %s, %v", path, err)
+			}
+
+			_, err = wr.Write(data)
+
+			if err != nil {
+				t.Fatalf("Failed to write %s data to %s, %v", label, path, err)
+			}
+
+			err = wr.Close()
+
+			if err != nil {
+				t.Fatalf("Failed to close writer for %s, %v", path, err)
+			}
+
+			rd, err := NewReader(path, &buf)
+
+			if err != nil {
+				t.Fatalf("Failed to create reader for %s, %v", path, err)
+			}
+
+			out, err := io.ReadAll(rd)
+
+			if err != nil {
+				t.Fatalf("Failed to read %s data from %s, %v", label, path, err)
+			}
+
+			if !bytes.Equal(out, data) {
+				t.Fatalf("Round trip of %s data through %s returned %d bytes, expected %d", label, path, len(out), len(data))
+			}
+		}
+	}
+}
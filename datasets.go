@@ -0,0 +1,236 @@
+package datajam
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/compression"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DATASETS_ENV is the name of the environment variable used to define the default dataset registry. Its value
+// is either a JSON-encoded registry (see Registry) or the path to a file containing one.
+const DATASETS_ENV string = "DATAJAM_DATASETS"
+
+// DATASETS_FILENAME is the name of the file, in the user's configuration directory, used to define the default
+// dataset registry if the DATAJAM_DATASETS environment variable is not set.
+const DATASETS_FILENAME string = "go-libraryofcongress-datajam/datasets.json"
+
+// DATASET is the context key used to store the *Dataset resolved by OpenBucket.
+const DATASET string = "github.com/aaronland/go-libraryofcongress-datajam#dataset"
+
+// Dataset defines a named Library of Congress dataset stored in an S3 bucket.
+type Dataset struct {
+	// The name used to refer to the dataset in "loc://{NAME}/" URIs.
+	Name string `json:"name"`
+	// The name of the S3 bucket containing the dataset.
+	Bucket string `json:"bucket"`
+	// The AWS region of the S3 bucket.
+	Region string `json:"region"`
+	// The prefix, within the S3 bucket, of the dataset.
+	Prefix string `json:"prefix,omitempty"`
+	// A short description of the dataset.
+	Description string `json:"description,omitempty"`
+	// The compression scheme (see the compression package) of files in the dataset without a ".gz" or ".bz2" extension.
+	Compression string `json:"compression,omitempty"`
+}
+
+// URI returns the S3 URI of the dataset.
+func (d *Dataset) URI() string {
+	return fmt.Sprintf("s3://%s/%s", d.Bucket, strings.TrimLeft(d.Prefix, "/"))
+}
+
+// Registry is a collection of named datasets.
+type Registry struct {
+	// The name of the dataset used by "loc://" URIs that do not specify a dataset name. If empty and the
+	// registry contains a single dataset that dataset is used.
+	Default  string     `json:"default,omitempty"`
+	Datasets []*Dataset `json:"datasets"`
+}
+
+var default_registry *Registry
+var default_registry_err error
+var default_registry_once sync.Once
+
+// DefaultRegistry returns the registry defined by the DATAJAM_DATASETS environment variable or, if it is not set,
+// the "go-libraryofcongress-datajam/datasets.json" file in the user's configuration directory. If neither exist an
+// empty registry is returned. The registry is only loaded once.
+func DefaultRegistry() (*Registry, error) {
+
+	default_registry_once.Do(func() {
+		default_registry, default_registry_err = loadDefaultRegistry()
+	})
+
+	return default_registry, default_registry_err
+}
+
+func loadDefaultRegistry() (*Registry, error) {
+
+	v := strings.TrimSpace(os.Getenv(DATASETS_ENV))
+
+	if v != "" {
+
+		if strings.HasPrefix(v, "{") {
+			return ParseRegistry([]byte(v))
+		}
+
+		return LoadRegistry(v)
+	}
+
+	config_dir, err := os.UserConfigDir()
+
+	if err == nil {
+
+		path := filepath.Join(config_dir, filepath.FromSlash(DATASETS_FILENAME))
+
+		_, err := os.Stat(path)
+
+		if err == nil {
+			return LoadRegistry(path)
+		}
+	}
+
+	return &Registry{}, nil
+}
+
+// LoadRegistry reads a JSON-encoded registry from the file 'path'.
+func LoadRegistry(path string) (*Registry, error) {
+
+	body, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read dataset registry %s, %w", path, err)
+	}
+
+	r, err := ParseRegistry(body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse dataset registry %s, %w", path, err)
+	}
+
+	return r, nil
+}
+
+// ParseRegistry decodes a JSON-encoded registry and ensures that every dataset has a unique name, a bucket, a region
+// and a supported compression scheme.
+func ParseRegistry(body []byte) (*Registry, error) {
+
+	var r *Registry
+
+	err := json.Unmarshal(body, &r)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal dataset registry, %w", err)
+	}
+
+	if r == nil {
+		return &Registry{}, nil
+	}
+
+	seen := make(map[string]bool)
+
+	for idx, d := range r.Datasets {
+
+		if d == nil || d.Name == "" {
+			return nil, fmt.Errorf("Dataset at offset %d is missing a name", idx)
+		}
+
+		if seen[d.Name] {
+			return nil, fmt.Errorf("Duplicate dataset name '%s'", d.Name)
+		}
+
+		seen[d.Name] = true
+
+		if d.Bucket == "" || d.Region == "" {
+			return nil, fmt.Errorf("Dataset '%s' must define both a bucket and a region", d.Name)
+		}
+
+		switch d.Compression {
+		case compression.NONE, compression.GZIP, compression.BZIP2:
+			// pass
+		default:
+			return nil, fmt.Errorf("Dataset '%s' has an unsupported compression scheme '%s'", d.Name, d.Compression)
+		}
+	}
+
+	if r.Default != "" && !seen[r.Default] {
+		return nil, fmt.Errorf("Default dataset '%s' is not defined", r.Default)
+	}
+
+	return r, nil
+}
+
+// Get returns the dataset named 'name'. If 'name' is empty the registry's default dataset is returned.
+func (r *Registry) Get(name string) (*Dataset, error) {
+
+	if name == "" {
+
+		switch {
+		case r.Default != "":
+			name = r.Default
+		case len(r.Datasets) == 1:
+			return r.Datasets[0], nil
+		default:
+			return nil, fmt.Errorf("No default dataset defined")
+		}
+	}
+
+	for _, d := range r.Datasets {
+
+		if d.Name == name {
+			return d, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Unknown dataset '%s'", name)
+}
+
+// GetByBucket returns the first dataset stored in the S3 bucket 'bucket', and true, or false if there is none.
+func (r *Registry) GetByBucket(bucket string) (*Dataset, bool) {
+
+	for _, d := range r.Datasets {
+
+		if d.Bucket == bucket {
+			return d, true
+		}
+	}
+
+	return nil, false
+}
+
+// List returns the datasets in the registry sorted by name.
+func (r *Registry) List() []*Dataset {
+
+	datasets := make([]*Dataset, len(r.Datasets))
+	copy(datasets, r.Datasets)
+
+	sort.Slice(datasets, func(i, j int) bool {
+		return datasets[i].Name < datasets[j].Name
+	})
+
+	return datasets
+}
+
+// DatasetFromContext returns the *Dataset resolved by OpenBucket, and true, or false if the bucket was not a
+// registered dataset.
+func DatasetFromContext(ctx context.Context) (*Dataset, bool) {
+
+	d, ok := ctx.Value(DATASET).(*Dataset)
+	return d, ok && d != nil
+}
+
+// CompressionFromContext returns the compression scheme of the dataset resolved by OpenBucket, or "" if there is none.
+func CompressionFromContext(ctx context.Context) string {
+
+	d, ok := DatasetFromContext(ctx)
+
+	if !ok {
+		return ""
+	}
+
+	return d.Compression
+}
@@ -0,0 +1,460 @@
+// package dates provides methods for parsing the free-form dates found in Library of Congress records in to
+// Extended Date/Time Format (EDTF) values with inception and cessation bounds.
+package dates
+
+import (
+	"fmt"
+	"github.com/tidwall/gjson"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The layout used for inception and cessation dates.
+const DATE_LAYOUT string = "2006-01-02"
+
+// DATE_PATHS are the (gjson) paths, in order of preference, checked for dates in a Library of Congress record.
+var DATE_PATHS = []string{
+	"item.created_published_date",
+	"item.date",
+	"date",
+	"dates",
+	"item.sort_date",
+	"sort_date",
+}
+
+// Date is a date, or range of dates, derived from a Library of Congress date string.
+type Date struct {
+	// The original date string.
+	Raw string `json:"raw"`
+	// The Extended Date/Time Format representation of the date.
+	EDTF string `json:"edtf"`
+	// The earliest day (YYYY-MM-DD) the date may refer to.
+	Inception string `json:"inception"`
+	// The latest day (YYYY-MM-DD) the date may refer to.
+	Cessation string `json:"cessation"`
+	// True if the date was qualified as approximate (for example "ca. 1865").
+	Approximate bool `json:"approximate,omitempty"`
+	// True if the date was qualified as uncertain (for example "1865?").
+	Uncertain bool `json:"uncertain,omitempty"`
+	start     time.Time
+	end       time.Time
+}
+
+// atom is an individual date (a year, month, day, decade or century) found in a date string.
+type atom struct {
+	edtf  string
+	start time.Time
+	end   time.Time
+}
+
+// re_atoms matches, in order of preference: YYYY-MM-DD; YYYY-MM or YYYY-YY (a range of years); "YY--" (a century);
+// "YYY-" or "YYY0s" (a decade); "{MONTH} [DD,] YYYY"; "YYYY [{MONTH} [DD]]" and "MM/[DD/]YYYY".
+var re_atoms = regexp.MustCompile(`(\d{4})-(\d{2})-(\d{2})|(\d{4})-(\d{2})\b|(\d{2})--|(\d{3})-|(\d{3})0'?s\b|` +
+	`\b(jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?)\.?\s+(?:(\d{1,2}),?\s+)?(\d{4})\b|` +
+	`(\d{4})(?:\s+([a-z]+)\.?(?:\s+(\d{1,2})\b)?)?|` +
+	`\b(\d{1,2})/(?:(\d{1,2})/)?(\d{4})\b`)
+
+var re_approximate = regexp.MustCompile(`\b(ca\.?|circa|approximately|approx\.)\s*`)
+
+var months = map[string]time.Month{
+	"jan": time.January, "january": time.January,
+	"feb": time.February, "february": time.February,
+	"mar": time.March, "march": time.March,
+	"apr": time.April, "april": time.April,
+	"may": time.May,
+	"jun": time.June, "june": time.June,
+	"jul": time.July, "july": time.July,
+	"aug": time.August, "august": time.August,
+	"sep": time.September, "sept": time.September, "september": time.September,
+	"oct": time.October, "october": time.October,
+	"nov": time.November, "november": time.November,
+	"dec": time.December, "december": time.December,
+}
+
+// Parse parses a Library of Congress date string, for example "1898", "[1898]", "c1904.", "ca. 1860-1865",
+// "ca. 1861-65", "[between 1861 and 1865]", "[187-]", "1860s", "March 1865", "1900-05", "12/25/1901" or
+// "c1902 November 13.", in to a Date.
+// Strings containing more than one date are treated as a range from the earliest to the latest date. Days or
+// months which do not exist (for example "1916 Feb 30") are ignored and the date is parsed with a coarser precision.
+func Parse(str string) (*Date, error) {
+
+	s := strings.ToLower(strings.TrimSpace(str))
+
+	if s == "" {
+		return nil, fmt.Errorf("Empty date")
+	}
+
+	approximate := re_approximate.MatchString(s)
+	s = re_approximate.ReplaceAllString(s, "")
+
+	uncertain := strings.Contains(s, "?")
+
+	// Brackets signal a date supplied by a cataloguer and "c" a copyright date, neither of which change its value
+
+	s = strings.NewReplacer("[", " ", "]", " ", "?", " ").Replace(s)
+
+	atoms := make([]*atom, 0)
+
+	for _, m := range re_atoms.FindAllStringSubmatch(s, -1) {
+		atoms = append(atoms, parseAtoms(m, approximate)...)
+	}
+
+	if len(atoms) == 0 {
+		return nil, fmt.Errorf("Invalid date '%s', no dates found", str)
+	}
+
+	qualifier := ""
+
+	switch {
+	case approximate && uncertain:
+		qualifier = "%"
+	case approximate:
+		qualifier = "~"
+	case uncertain:
+		qualifier = "?"
+	}
+
+	first := atoms[0]
+	last := atoms[0]
+
+	for _, a := range atoms[1:] {
+
+		if a.start.Before(first.start) {
+			first = a
+		}
+
+		if a.end.After(last.end) {
+			last = a
+		}
+	}
+
+	d := &Date{
+		Raw:         str,
+		Approximate: approximate,
+		Uncertain:   uncertain,
+		start:       first.start,
+		end:         last.end,
+	}
+
+	if first == last {
+		d.EDTF = first.edtf + qualifier
+	} else {
+		d.EDTF = first.edtf + qualifier + "/" + last.edtf + qualifier
+	}
+
+	d.Inception = d.start.Format(DATE_LAYOUT)
+	d.Cessation = d.end.Format(DATE_LAYOUT)
+
+	return d, nil
+}
+
+// parseAtoms returns the atoms for a match of re_atoms. This is usually one atom but YYYY-YY ranges yield two.
+// 'approximate' signals that the date was qualified as approximate (for example "ca. 1910-11") which is a
+// range form, rather than a month, in Library of Congress records.
+func parseAtoms(m []string, approximate bool) []*atom {
+
+	switch {
+	case m[1] != "":
+		return []*atom{newDay(m[1], m[2], m[3])}
+	case m[4] != "":
+
+		// YYYY-NN is a month if NN can be a month, for example "1900-05", unless the date is approximate. Otherwise,
+		// for example "1861-65", it is a range of years if NN, as the last two digits of a year in the same
+		// century, follows YYYY.
+
+		month, _ := strconv.Atoi(m[5])
+
+		if month >= 1 && month <= 12 && !approximate {
+			return []*atom{newMonth(m[4], m[5])}
+		}
+
+		year, _ := strconv.Atoi(m[4])
+		end_year, _ := strconv.Atoi(m[5])
+		end_year += (year / 100) * 100
+
+		if end_year > year {
+			return []*atom{newYear(m[4]), newYear(strconv.Itoa(end_year))}
+		}
+
+		return []*atom{newMonth(m[4], m[5])}
+
+	case m[6] != "":
+
+		century, _ := strconv.Atoi(m[6])
+
+		a := &atom{
+			edtf:  m[6] + "XX",
+			start: time.Date(century*100, time.January, 1, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(century*100+99, time.December, 31, 0, 0, 0, 0, time.UTC),
+		}
+
+		return []*atom{a}
+
+	case m[7] != "" || m[8] != "":
+
+		str_decade := m[7] + m[8]
+		decade, _ := strconv.Atoi(str_decade)
+
+		a := &atom{
+			edtf:  str_decade + "X",
+			start: time.Date(decade*10, time.January, 1, 0, 0, 0, 0, time.UTC),
+			end:   time.Date(decade*10+9, time.December, 31, 0, 0, 0, 0, time.UTC),
+		}
+
+		return []*atom{a}
+
+	case m[9] != "":
+		return []*atom{monthDay(m[11], m[9], m[10])}
+	case m[15] != "":
+
+		// Numeric dates are month first, for example "12/25/1901"
+
+		str_month := zeroPad(m[15])
+
+		if m[16] != "" {
+			return []*atom{newDay(m[17], str_month, zeroPad(m[16]))}
+		}
+
+		return []*atom{newMonth(m[17], str_month)}
+
+	default:
+		return []*atom{monthDay(m[12], m[13], m[14])}
+	}
+}
+
+// monthDay returns the atom for 'str_year' and the (possibly empty) month name 'str_month' and day 'str_day'. If
+// 'str_month' is not the name of a month the atom is the year.
+func monthDay(str_year string, str_month string, str_day string) *atom {
+
+	month, ok := months[str_month]
+
+	if !ok {
+		return newYear(str_year)
+	}
+
+	str_month = fmt.Sprintf("%02d", int(month))
+
+	if str_day != "" {
+		return newDay(str_year, str_month, zeroPad(str_day))
+	}
+
+	return newMonth(str_year, str_month)
+}
+
+// zeroPad returns the one or two digit string 'str' as two digits.
+func zeroPad(str string) string {
+
+	if len(str) == 1 {
+		return "0" + str
+	}
+
+	return str
+}
+
+func newYear(str_year string) *atom {
+
+	year, _ := strconv.Atoi(str_year)
+
+	a := &atom{
+		edtf:  fmt.Sprintf("%04d", year),
+		start: time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC),
+		end:   time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC),
+	}
+
+	return a
+}
+
+// newMonth returns the atom for 'str_year' and 'str_month' or, if the month is not valid, for the year.
+func newMonth(str_year string, str_month string) *atom {
+
+	start, err := time.Parse("2006-01", str_year+"-"+str_month)
+
+	if err != nil {
+		return newYear(str_year)
+	}
+
+	a := &atom{
+		edtf:  start.Format("2006-01"),
+		start: start,
+		end:   start.AddDate(0, 1, -1),
+	}
+
+	return a
+}
+
+// newDay returns the atom for 'str_year', 'str_month' and 'str_day' or, if the day is not valid, for the month.
+func newDay(str_year string, str_month string, str_day string) *atom {
+
+	start, err := time.Parse(DATE_LAYOUT, str_year+"-"+str_month+"-"+str_day)
+
+	if err != nil {
+		return newMonth(str_year, str_month)
+	}
+
+	a := &atom{
+		edtf:  start.Format(DATE_LAYOUT),
+		start: start,
+		end:   start,
+	}
+
+	return a
+}
+
+// FromJSON returns the Date derived from the first property in DATE_PATHS of the JSON record 'body' that contains
+// a valid date, and true, or false if there are none.
+func FromJSON(body []byte) (*Date, bool) {
+	return FromJSONPaths(body, DATE_PATHS...)
+}
+
+// FromJSONPaths returns the Date derived from the first property in 'paths' of the JSON record 'body' that contains
+// a valid date, and true, or false if there are none.
+func FromJSONPaths(body []byte, paths ...string) (*Date, bool) {
+
+	for _, path := range paths {
+
+		rsp := gjson.GetBytes(body, path)
+
+		candidates := []gjson.Result{rsp}
+
+		if rsp.IsArray() {
+			candidates = rsp.Array()
+		}
+
+		for _, r := range candidates {
+
+			if r.Type != gjson.String && r.Type != gjson.Number {
+				continue
+			}
+
+			d, err := Parse(r.String())
+
+			if err == nil {
+				return d, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// Year returns the year of the inception date of 'd'.
+func (d *Date) Year() int {
+	return d.start.Year()
+}
+
+// Overlaps returns true if any part of 'd' falls between 'start' and 'end' (inclusive). A zero value for
+// 'start' or 'end' means that side of the range is open.
+func (d *Date) Overlaps(start time.Time, end time.Time) bool {
+
+	if !end.IsZero() && d.start.After(end) {
+		return false
+	}
+
+	if !start.IsZero() && d.end.Before(start) {
+		return false
+	}
+
+	return true
+}
+
+// Range is a range of dates between two days, inclusive.
+type Range struct {
+	Start time.Time
+	End   time.Time
+}
+
+// ParseRange parses a "{START}/{END}" string where {START} and {END} are any date understood by Parse or ".." to
+// signal an open range. The range starts at the inception of {START} and ends at the cessation of {END}. A single
+// date is treated as a range from its inception to its cessation. Dates may themselves contain a "/" (for example
+// "12/25/1901/1902") so the range is split on the only "/" which leaves a valid bound on either side.
+func ParseRange(str string) (*Range, error) {
+
+	var bounds [2]*Date
+
+	start, err := parseBound(str)
+
+	if err == nil {
+
+		bounds = [2]*Date{start, start}
+
+	} else {
+
+		found := 0
+
+		for idx, c := range str {
+
+			if c != '/' {
+				continue
+			}
+
+			start, err := parseBound(str[:idx])
+
+			if err != nil {
+				continue
+			}
+
+			end, err := parseBound(str[idx+1:])
+
+			if err != nil {
+				continue
+			}
+
+			bounds = [2]*Date{start, end}
+			found += 1
+		}
+
+		if found != 1 {
+			return nil, fmt.Errorf("Invalid date range '%s'", str)
+		}
+	}
+
+	r := &Range{}
+
+	if bounds[0] != nil {
+		r.Start = bounds[0].start
+	}
+
+	if bounds[1] != nil {
+		r.End = bounds[1].end
+	}
+
+	if !r.Start.IsZero() && !r.End.IsZero() && r.Start.After(r.End) {
+		return nil, fmt.Errorf("Invalid date range '%s', start is after end", str)
+	}
+
+	return r, nil
+}
+
+// parseBound parses one side of a range. It returns nil for an open bound ("" or "..") and an error if 'str' is
+// not a valid date or contains a "/" which is not part of a date, which signals that it spans both sides.
+func parseBound(str string) (*Date, error) {
+
+	str = strings.TrimSpace(str)
+
+	if str == "" || str == ".." {
+		return nil, nil
+	}
+
+	if strings.Contains(re_atoms.ReplaceAllString(strings.ToLower(str), ""), "/") {
+		return nil, fmt.Errorf("Invalid date '%s', contains a range separator", str)
+	}
+
+	return Parse(str)
+}
+
+// String returns the "{START}/{END}" representation of 'r'.
+func (r *Range) String() string {
+
+	bounds := []string{"..", ".."}
+
+	for idx, t := range []time.Time{r.Start, r.End} {
+
+		if !t.IsZero() {
+			bounds[idx] = t.Format(DATE_LAYOUT)
+		}
+	}
+
+	return strings.Join(bounds, "/")
+}
@@ -0,0 +1,116 @@
+package dates
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+
+	tests := []struct {
+		raw       string
+		edtf      string
+		inception string
+		cessation string
+	}{
+		{"1898", "1898", "1898-01-01", "1898-12-31"},
+		{"[1898]", "1898", "1898-01-01", "1898-12-31"},
+		{"c1904.", "1904", "1904-01-01", "1904-12-31"},
+		{"1865?", "1865?", "1865-01-01", "1865-12-31"},
+		{"ca. 1860-1865", "1860~/1865~", "1860-01-01", "1865-12-31"},
+		{"ca. 1861-65", "1861~/1865~", "1861-01-01", "1865-12-31"},
+		{"ca. 1910-11", "1910~/1911~", "1910-01-01", "1911-12-31"},
+		{"1861-65", "1861/1865", "1861-01-01", "1865-12-31"},
+		{"[between 1861 and 1865]", "1861/1865", "1861-01-01", "1865-12-31"},
+		{"between 1861 and 1865", "1861/1865", "1861-01-01", "1865-12-31"},
+		{"1900-05", "1900-05", "1900-05-01", "1900-05-31"},
+		{"1910-11", "1910-11", "1910-11-01", "1910-11-30"},
+		{"1861-04", "1861-04", "1861-04-01", "1861-04-30"},
+		{"1912-12", "1912-12", "1912-12-01", "1912-12-31"},
+		{"1901-13", "1901/1913", "1901-01-01", "1913-12-31"},
+		{"1865-04-14", "1865-04-14", "1865-04-14", "1865-04-14"},
+		{"12/25/1901", "1901-12-25", "1901-12-25", "1901-12-25"},
+		{"1/2/1901", "1901-01-02", "1901-01-02", "1901-01-02"},
+		{"3/1901", "1901-03", "1901-03-01", "1901-03-31"},
+		{"[187-]", "187X", "1870-01-01", "1879-12-31"},
+		{"1860s", "186X", "1860-01-01", "1869-12-31"},
+		{"[18--]", "18XX", "1800-01-01", "1899-12-31"},
+		{"March 1865", "1865-03", "1865-03-01", "1865-03-31"},
+		{"c1902 November 13.", "1902-11-13", "1902-11-13", "1902-11-13"},
+		{"1916 Feb 30", "1916-02", "1916-02-01", "1916-02-29"},
+		{"1916-02-30", "1916-02", "1916-02-01", "1916-02-29"},
+	}
+
+	for _, test := range tests {
+
+		d, err := Parse(test.raw)
+
+		if err != nil {
+			t.Fatalf("Failed to parse '%s', %v", test.raw, err)
+		}
+
+		if d.EDTF != test.edtf {
+			t.Fatalf("Unexpected EDTF for '%s': %s, expected %s", test.raw, d.EDTF, test.edtf)
+		}
+
+		if d.Inception != test.inception {
+			t.Fatalf("Unexpected inception for '%s': %s, expected %s", test.raw, d.Inception, test.inception)
+		}
+
+		if d.Cessation != test.cessation {
+			t.Fatalf("Unexpected cessation for '%s': %s, expected %s", test.raw, d.Cessation, test.cessation)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+
+	for _, raw := range []string{"", "   ", "undated", "n.d."} {
+
+		_, err := Parse(raw)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to fail to parse", raw)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+
+	tests := map[string]string{
+		"1861/1865":             "1861-01-01/1865-12-31",
+		"1900-05":               "1900-05-01/1900-05-31",
+		"../1865":               "../1865-12-31",
+		"1861/..":               "1861-01-01/..",
+		"1860s/1890":            "1860-01-01/1890-12-31",
+		"12/25/1901":            "1901-12-25/1901-12-25",
+		"12/25/1901/1902":       "1901-12-25/1902-12-31",
+		"1898/12/25/1901":       "1898-01-01/1901-12-25",
+		"12/25/1901/1/2/1902":   "1901-12-25/1902-01-02",
+		"12/1901/..":            "1901-12-01/..",
+		"12/25/1901/":           "1901-12-25/..",
+		"../12/25/1901":         "../1901-12-25",
+		"c1902 November 13./..": "1902-11-13/..",
+	}
+
+	for raw, expected := range tests {
+
+		r, err := ParseRange(raw)
+
+		if err != nil {
+			t.Fatalf("Failed to parse range '%s', %v", raw, err)
+		}
+
+		if r.String() != expected {
+			t.Fatalf("Unexpected range for '%s': %s, expected %s", raw, r.String(), expected)
+		}
+	}
+
+	for _, raw := range []string{"1865/1861", "1861/1863/1865", "1861/65", "1861/spring"} {
+
+		_, err := ParseRange(raw)
+
+		if err == nil {
+			t.Fatalf("Expected range '%s' to fail to parse", raw)
+		}
+	}
+}
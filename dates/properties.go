@@ -0,0 +1,110 @@
+package dates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// The name of the derived property containing the EDTF representation of a record's date.
+const PROPERTY_EDTF string = "edtf:date"
+
+// The name of the derived property containing the inception date (YYYY-MM-DD) of a record.
+const PROPERTY_INCEPTION string = "edtf:inception"
+
+// The name of the derived property containing the cessation date (YYYY-MM-DD) of a record.
+const PROPERTY_CESSATION string = "edtf:cessation"
+
+// AppendProperties returns a copy of the JSON record 'body' with the PROPERTY_EDTF, PROPERTY_INCEPTION and
+// PROPERTY_CESSATION properties appended to it. If no date can be derived from 'body' it is returned unchanged.
+func AppendProperties(body []byte) ([]byte, error) {
+
+	d, ok := FromJSON(body)
+
+	if !ok {
+		return body, nil
+	}
+
+	trimmed := bytes.TrimSpace(body)
+
+	if len(trimmed) < 2 || trimmed[0] != '{' || trimmed[len(trimmed)-1] != '}' {
+		return nil, fmt.Errorf("Record is not a JSON object")
+	}
+
+	props := [][2]string{
+		{PROPERTY_EDTF, d.EDTF},
+		{PROPERTY_INCEPTION, d.Inception},
+		{PROPERTY_CESSATION, d.Cessation},
+	}
+
+	var buf bytes.Buffer
+	buf.Write(bytes.TrimRight(trimmed[:len(trimmed)-1], " \t\r\n"))
+
+	is_empty := len(bytes.TrimSpace(trimmed[1:len(trimmed)-1])) == 0
+
+	for idx, p := range props {
+
+		enc_k, err := json.Marshal(p[0])
+
+		if err != nil {
+			return nil, err
+		}
+
+		enc_v, err := json.Marshal(p[1])
+
+		if err != nil {
+			return nil, err
+		}
+
+		if idx > 0 || !is_empty {
+			buf.WriteString(",")
+		}
+
+		buf.Write(enc_k)
+		buf.WriteString(":")
+		buf.Write(enc_v)
+	}
+
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// RangeFilter is an `expr.Expression` that is satisfied by records whose dates overlap a range of dates.
+type RangeFilter struct {
+	Range *Range
+	// If true records without a (valid) date satisfy the filter.
+	IncludeUndated bool
+}
+
+// NewRangeFilter returns a new RangeFilter for the range 'str' (see ParseRange).
+func NewRangeFilter(str string, include_undated bool) (*RangeFilter, error) {
+
+	r, err := ParseRange(str)
+
+	if err != nil {
+		return nil, err
+	}
+
+	f := &RangeFilter{
+		Range:          r,
+		IncludeUndated: include_undated,
+	}
+
+	return f, nil
+}
+
+// Matches returns true if the date derived from the JSON record 'body' overlaps the range of 'f'.
+func (f *RangeFilter) Matches(body []byte) bool {
+
+	d, ok := FromJSON(body)
+
+	if !ok {
+		return f.IncludeUndated
+	}
+
+	return d.Overlaps(f.Range.Start, f.Range.End)
+}
+
+func (f *RangeFilter) String() string {
+	return fmt.Sprintf("dates(%s)", f.Range.String())
+}
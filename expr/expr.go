@@ -0,0 +1,344 @@
+// package expr provides a small query language for filtering JSON records using boolean expressions of (gjson) path
+// comparisons, existence checks and array-cardinality tests.
+package expr
+
+import (
+	"fmt"
+	"github.com/tidwall/gjson"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Comparison operators.
+const (
+	// OP_MATCH tests whether any value matches a regular expression.
+	OP_MATCH string = "="
+	// OP_NOT_MATCH tests whether no value matches a regular expression.
+	OP_NOT_MATCH string = "!="
+	// OP_EQUALS tests whether any value is equal to a string or number.
+	OP_EQUALS string = "=="
+	OP_LT     string = "<"
+	OP_LTE    string = "<="
+	OP_GT     string = ">"
+	OP_GTE    string = ">="
+)
+
+// Expression is a node in a parsed query.
+type Expression interface {
+	// Matches returns true if the JSON record 'body' satisfies the expression.
+	Matches(body []byte) bool
+	// String returns the query representation of the expression.
+	String() string
+}
+
+// And is an Expression that is satisfied if all of its child expressions are satisfied.
+type And struct {
+	Expressions []Expression
+}
+
+func (e *And) Matches(body []byte) bool {
+
+	for _, child := range e.Expressions {
+
+		if !child.Matches(body) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e *And) String() string {
+	return joinExpressions(e.Expressions, " AND ")
+}
+
+// Or is an Expression that is satisfied if any of its child expressions are satisfied.
+type Or struct {
+	Expressions []Expression
+}
+
+func (e *Or) Matches(body []byte) bool {
+
+	for _, child := range e.Expressions {
+
+		if child.Matches(body) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *Or) String() string {
+	return joinExpressions(e.Expressions, " OR ")
+}
+
+// Not is an Expression that is satisfied if its child expression is not.
+type Not struct {
+	Expression Expression
+}
+
+func (e *Not) Matches(body []byte) bool {
+	return !e.Expression.Matches(body)
+}
+
+func (e *Not) String() string {
+	return fmt.Sprintf("NOT (%s)", e.Expression.String())
+}
+
+// Exists is an Expression that is satisfied if a path has a (non-null) value.
+type Exists struct {
+	Path string
+}
+
+func (e *Exists) Matches(body []byte) bool {
+	rsp := gjson.GetBytes(body, e.Path)
+	return rsp.Exists() && rsp.Type != gjson.Null
+}
+
+func (e *Exists) String() string {
+	return fmt.Sprintf("exists(%s)", e.Path)
+}
+
+// Count is an Expression that compares the number of values for a path with a number. Missing and null values
+// have a count of 0, arrays have a count equal to their length and all other values have a count of 1.
+type Count struct {
+	Path     string
+	Operator string
+	Value    float64
+}
+
+func (e *Count) Matches(body []byte) bool {
+
+	rsp := gjson.GetBytes(body, e.Path)
+
+	count := 0
+
+	switch {
+	case !rsp.Exists() || rsp.Type == gjson.Null:
+		// pass
+	case rsp.IsArray():
+		count = len(rsp.Array())
+	default:
+		count = 1
+	}
+
+	return compareNumbers(float64(count), e.Operator, e.Value)
+}
+
+func (e *Count) String() string {
+	return fmt.Sprintf("count(%s)%s%s", e.Path, e.Operator, strconv.FormatFloat(e.Value, 'f', -1, 64))
+}
+
+// Comparison is an Expression that compares the values for a path with a value. If the path has multiple values
+// (for example an array) the comparison is satisfied if any of those values satisfy it, except for OP_NOT_MATCH
+// which is only satisfied if none of the values match.
+type Comparison struct {
+	Path     string
+	Operator string
+	Value    string
+	re       *regexp.Regexp
+}
+
+// NewComparison returns a new Comparison instance, compiling 'value' as a regular expression if 'op' is
+// OP_MATCH or OP_NOT_MATCH.
+func NewComparison(path string, op string, value string) (*Comparison, error) {
+
+	c := &Comparison{
+		Path:     path,
+		Operator: op,
+		Value:    value,
+	}
+
+	switch op {
+	case OP_MATCH, OP_NOT_MATCH:
+
+		re, err := regexp.Compile(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid regular expression for %s, %w", path, err)
+		}
+
+		c.re = re
+
+	case OP_EQUALS, OP_LT, OP_LTE, OP_GT, OP_GTE:
+		// pass
+	default:
+		return nil, fmt.Errorf("Invalid operator '%s'", op)
+	}
+
+	return c, nil
+}
+
+func (e *Comparison) Matches(body []byte) bool {
+
+	rsp := gjson.GetBytes(body, e.Path)
+
+	if e.Operator == OP_NOT_MATCH {
+
+		for _, r := range values(rsp) {
+
+			if e.re.MatchString(r.String()) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	for _, r := range values(rsp) {
+
+		if e.matchesValue(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *Comparison) matchesValue(r gjson.Result) bool {
+
+	str_v := r.String()
+
+	switch e.Operator {
+	case OP_MATCH:
+		return e.re.MatchString(str_v)
+	case OP_EQUALS:
+
+		a, a_ok := parseNumber(str_v)
+		b, b_ok := parseNumber(e.Value)
+
+		if a_ok && b_ok {
+			return a == b
+		}
+
+		return str_v == e.Value
+
+	default:
+
+		a, a_ok := parseNumber(str_v)
+		b, b_ok := parseNumber(e.Value)
+
+		if a_ok && b_ok {
+			return compareNumbers(a, e.Operator, b)
+		}
+
+		t_a, a_ok := parseDate(str_v)
+		t_b, b_ok := parseDate(e.Value)
+
+		if a_ok && b_ok {
+			return compareNumbers(float64(t_a.Unix()), e.Operator, float64(t_b.Unix()))
+		}
+
+		return compareNumbers(float64(strings.Compare(str_v, e.Value)), e.Operator, 0)
+	}
+}
+
+func (e *Comparison) String() string {
+	return fmt.Sprintf("%s%s%s", e.Path, e.Operator, quoteValue(e.Value))
+}
+
+// values returns the individual values of 'rsp', expanding arrays and ignoring nulls.
+func values(rsp gjson.Result) []gjson.Result {
+
+	if !rsp.Exists() || rsp.Type == gjson.Null {
+		return nil
+	}
+
+	if !rsp.IsArray() {
+		return []gjson.Result{rsp}
+	}
+
+	results := make([]gjson.Result, 0)
+
+	for _, r := range rsp.Array() {
+
+		if r.Type != gjson.Null {
+			results = append(results, r)
+		}
+	}
+
+	return results
+}
+
+func compareNumbers(a float64, op string, b float64) bool {
+
+	switch op {
+	case OP_EQUALS:
+		return a == b
+	case OP_LT:
+		return a < b
+	case OP_LTE:
+		return a <= b
+	case OP_GT:
+		return a > b
+	case OP_GTE:
+		return a >= b
+	default:
+		return false
+	}
+}
+
+func parseNumber(str string) (float64, bool) {
+
+	v, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+
+	if err != nil {
+		return 0, false
+	}
+
+	return v, true
+}
+
+var date_layouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// parseDate parses 'str' as an RFC3339 timestamp or a YYYY, YYYY-MM or YYYY-MM-DD date.
+func parseDate(str string) (time.Time, bool) {
+
+	str = strings.TrimSpace(str)
+
+	for _, layout := range date_layouts {
+
+		t, err := time.Parse(layout, str)
+
+		if err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func joinExpressions(expressions []Expression, sep string) string {
+
+	parts := make([]string, len(expressions))
+
+	for idx, e := range expressions {
+
+		switch e.(type) {
+		case *And, *Or:
+			parts[idx] = "(" + e.String() + ")"
+		default:
+			parts[idx] = e.String()
+		}
+	}
+
+	return strings.Join(parts, sep)
+}
+
+func quoteValue(v string) string {
+
+	if v == "" || strings.ContainsAny(v, " \t\"()") {
+		return strconv.Quote(v)
+	}
+
+	return v
+}
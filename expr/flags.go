@@ -0,0 +1,81 @@
+package expr
+
+import (
+	"fmt"
+	"github.com/aaronland/go-json-query"
+	"strings"
+)
+
+// ExpressionFlags holds one or more Expression instances parsed from query strings. Plain {PATH}={REGEXP} strings,
+// as used by `query.QueryFlags`, are valid expressions.
+type ExpressionFlags []Expression
+
+// Return the string value of the set of Expression instances.
+func (m *ExpressionFlags) String() string {
+
+	parts := make([]string, len(*m))
+
+	for idx, e := range *m {
+		parts[idx] = e.String()
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Parse a query string and store it as one of a set of Expression instances.
+func (m *ExpressionFlags) Set(value string) error {
+
+	e, err := Parse(value)
+
+	if err != nil {
+		return fmt.Errorf("Invalid query '%s', %w", value, err)
+	}
+
+	*m = append(*m, e)
+	return nil
+}
+
+// Combine returns a single Expression for 'expressions' according to 'mode' which is either
+// `query.QUERYSET_MODE_ALL` or `query.QUERYSET_MODE_ANY`. It returns nil if 'expressions' is empty.
+func Combine(mode string, expressions ...Expression) (Expression, error) {
+
+	if mode != query.QUERYSET_MODE_ALL && mode != query.QUERYSET_MODE_ANY {
+		return nil, fmt.Errorf("Invalid query mode '%s'", mode)
+	}
+
+	switch len(expressions) {
+	case 0:
+		return nil, nil
+	case 1:
+		return expressions[0], nil
+	}
+
+	if mode == query.QUERYSET_MODE_ANY {
+		return &Or{Expressions: expressions}, nil
+	}
+
+	return &And{Expressions: expressions}, nil
+}
+
+// All returns an Expression that is satisfied if all of the non-nil expressions in 'expressions' are satisfied.
+// It returns nil if there are no non-nil expressions.
+func All(expressions ...Expression) Expression {
+
+	required := make([]Expression, 0)
+
+	for _, e := range expressions {
+
+		if e != nil {
+			required = append(required, e)
+		}
+	}
+
+	switch len(required) {
+	case 0:
+		return nil
+	case 1:
+		return required[0]
+	default:
+		return &And{Expressions: required}
+	}
+}
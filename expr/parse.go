@@ -0,0 +1,548 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Parse parses a query string in to an Expression. The grammar is:
+//
+//	expression := term ( ( "OR" | "||" ) term )*
+//	term       := unary ( ( "AND" | "&&" ) unary )*
+//	unary      := ( "NOT" | "!" ) unary | "(" expression ")" | predicate
+//	predicate  := "exists(" PATH ")" | "missing(" PATH ")" | "count(" PATH ")" OPERATOR NUMBER | PATH OPERATOR VALUE
+//
+// Where OPERATOR is one of "=" (regular expression match), "!=" (no regular expression match), "==", "<", "<=", ">"
+// or ">=" and VALUE is either a double-quoted string or the remainder of the input up to the next unbalanced ")" or
+// whitespace-delimited "&&" or "||". A whitespace-delimited "AND" or "OR" only ends a bare value if it is followed
+// by something that starts a predicate, so values like "WAR AND PEACE" are not split. Keywords are case-sensitive
+// so that values like "Black and white" in legacy {PATH}={REGEXP} expressions are not split on "and" or "or".
+func Parse(str string) (Expression, error) {
+
+	p := &parser{
+		input: str,
+	}
+
+	e, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+
+	if !p.done() {
+		return nil, fmt.Errorf("Unexpected input '%s' at offset %d", p.input[p.pos:], p.pos)
+	}
+
+	return e, nil
+}
+
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) peek() byte {
+
+	if p.done() {
+		return 0
+	}
+
+	return p.input[p.pos]
+}
+
+func (p *parser) skipSpace() {
+
+	for !p.done() && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos += 1
+	}
+}
+
+// consume advances past 'token' if the remaining input starts with it.
+func (p *parser) consume(token string) bool {
+
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+
+	return false
+}
+
+// consumeKeyword advances past 'keyword' if the remaining input starts with it followed by whitespace or "(".
+func (p *parser) consumeKeyword(keyword string) bool {
+
+	if !hasKeyword(p.input[p.pos:], keyword) {
+		return false
+	}
+
+	p.pos += len(keyword)
+	return true
+}
+
+func hasKeyword(str string, keyword string) bool {
+
+	if len(str) <= len(keyword) || str[0:len(keyword)] != keyword {
+		return false
+	}
+
+	next := rune(str[len(keyword)])
+	return unicode.IsSpace(next) || next == '('
+}
+
+func (p *parser) parseOr() (Expression, error) {
+
+	e, err := p.parseAnd()
+
+	if err != nil {
+		return nil, err
+	}
+
+	expressions := []Expression{e}
+
+	for {
+
+		p.skipSpace()
+
+		if !p.consumeKeyword("OR") && !p.consume("||") {
+			break
+		}
+
+		e, err := p.parseAnd()
+
+		if err != nil {
+			return nil, err
+		}
+
+		expressions = append(expressions, e)
+	}
+
+	if len(expressions) == 1 {
+		return expressions[0], nil
+	}
+
+	return &Or{Expressions: expressions}, nil
+}
+
+func (p *parser) parseAnd() (Expression, error) {
+
+	e, err := p.parseUnary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	expressions := []Expression{e}
+
+	for {
+
+		p.skipSpace()
+
+		if !p.consumeKeyword("AND") && !p.consume("&&") {
+			break
+		}
+
+		e, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		expressions = append(expressions, e)
+	}
+
+	if len(expressions) == 1 {
+		return expressions[0], nil
+	}
+
+	return &And{Expressions: expressions}, nil
+}
+
+func (p *parser) parseUnary() (Expression, error) {
+
+	p.skipSpace()
+
+	if p.done() {
+		return nil, fmt.Errorf("Unexpected end of input")
+	}
+
+	if p.consumeKeyword("NOT") || (p.peek() == '!' && !strings.HasPrefix(p.input[p.pos:], "!=") && p.consume("!")) {
+
+		e, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Not{Expression: e}, nil
+	}
+
+	if p.consume("(") {
+
+		e, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+
+		if !p.consume(")") {
+			return nil, fmt.Errorf("Missing closing parenthesis at offset %d", p.pos)
+		}
+
+		return e, nil
+	}
+
+	return p.parsePredicate()
+}
+
+func (p *parser) parsePredicate() (Expression, error) {
+
+	for _, fn := range []string{"exists", "missing", "count"} {
+
+		if !hasKeyword(p.input[p.pos:], fn) {
+			continue
+		}
+
+		start := p.pos
+		p.pos += len(fn)
+		p.skipSpace()
+
+		if !p.consume("(") {
+			p.pos = start
+			break
+		}
+
+		path, err := p.parseFunctionPath()
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch fn {
+		case "exists":
+			return &Exists{Path: path}, nil
+		case "missing":
+			return &Not{Expression: &Exists{Path: path}}, nil
+		default:
+
+			p.skipSpace()
+
+			op, err := p.parseOperator()
+
+			if err != nil {
+				return nil, err
+			}
+
+			if op == OP_MATCH {
+				op = OP_EQUALS
+			}
+
+			if op == OP_NOT_MATCH {
+				return nil, fmt.Errorf("Operator '!=' is not supported by count()")
+			}
+
+			p.skipSpace()
+
+			str_v, err := p.parseValue()
+
+			if err != nil {
+				return nil, err
+			}
+
+			v, ok := parseNumber(str_v)
+
+			if !ok {
+				return nil, fmt.Errorf("Invalid number '%s' for count(%s)", str_v, path)
+			}
+
+			c := &Count{
+				Path:     path,
+				Operator: op,
+				Value:    v,
+			}
+
+			return c, nil
+		}
+	}
+
+	path, err := p.parsePath()
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+
+	op, err := p.parseOperator()
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+
+	value, err := p.parseValue()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewComparison(path, op, value)
+}
+
+// parsePath reads a gjson path up to the first comparison operator, or whitespace, that is not nested inside
+// brackets, braces, parentheses or quotes.
+func (p *parser) parsePath() (string, error) {
+
+	start := p.pos
+	depth := 0
+
+	for !p.done() {
+
+		c := p.peek()
+
+		if c == '"' {
+
+			err := p.skipQuoted()
+
+			if err != nil {
+				return "", err
+			}
+
+			continue
+		}
+
+		if depth == 0 && (c == '=' || c == '<' || c == '>' || c == '!' || unicode.IsSpace(rune(c))) {
+			break
+		}
+
+		switch c {
+		case '(', '[', '{':
+			depth += 1
+		case ')', ']', '}':
+
+			if depth == 0 {
+				return "", fmt.Errorf("Unexpected '%c' at offset %d", c, p.pos)
+			}
+
+			depth -= 1
+		}
+
+		p.pos += 1
+	}
+
+	path := p.input[start:p.pos]
+
+	if path == "" {
+		return "", fmt.Errorf("Missing path at offset %d", start)
+	}
+
+	return path, nil
+}
+
+// parseFunctionPath reads a gjson path up to the (unbalanced) closing parenthesis of a function call.
+func (p *parser) parseFunctionPath() (string, error) {
+
+	start := p.pos
+	depth := 0
+
+	for !p.done() {
+
+		c := p.peek()
+
+		if c == '"' {
+
+			err := p.skipQuoted()
+
+			if err != nil {
+				return "", err
+			}
+
+			continue
+		}
+
+		if c == '(' {
+			depth += 1
+		}
+
+		if c == ')' {
+
+			if depth == 0 {
+
+				path := strings.TrimSpace(p.input[start:p.pos])
+				p.pos += 1
+
+				if path == "" {
+					return "", fmt.Errorf("Missing path at offset %d", start)
+				}
+
+				return path, nil
+			}
+
+			depth -= 1
+		}
+
+		p.pos += 1
+	}
+
+	return "", fmt.Errorf("Missing closing parenthesis for function at offset %d", start)
+}
+
+func (p *parser) parseOperator() (string, error) {
+
+	for _, op := range []string{OP_NOT_MATCH, OP_EQUALS, OP_LTE, OP_GTE, OP_MATCH, OP_LT, OP_GT} {
+
+		if p.consume(op) {
+			return op, nil
+		}
+	}
+
+	return "", fmt.Errorf("Missing operator at offset %d", p.pos)
+}
+
+// parseValue reads either a double-quoted string or a bare value up to the next unbalanced ")", a
+// whitespace-delimited "&&" or "||" or a whitespace-delimited "AND" or "OR" followed by a predicate.
+func (p *parser) parseValue() (string, error) {
+
+	if p.peek() == '"' {
+
+		start := p.pos
+
+		err := p.skipQuoted()
+
+		if err != nil {
+			return "", err
+		}
+
+		v, err := strconv.Unquote(p.input[start:p.pos])
+
+		if err != nil {
+			return "", fmt.Errorf("Invalid quoted string at offset %d, %w", start, err)
+		}
+
+		return v, nil
+	}
+
+	start := p.pos
+	depth := 0
+	in_class := false
+
+	for !p.done() {
+
+		c := p.peek()
+
+		if c == '\\' {
+			p.pos += 2
+			continue
+		}
+
+		if unicode.IsSpace(rune(c)) && depth == 0 {
+
+			rest := strings.TrimLeftFunc(p.input[p.pos:], unicode.IsSpace)
+
+			if rest == "" || strings.HasPrefix(rest, ")") || strings.HasPrefix(rest, "&&") || strings.HasPrefix(rest, "||") || endsValue(rest, "AND") || endsValue(rest, "OR") {
+				break
+			}
+		}
+
+		switch {
+		case in_class:
+
+			if c == ']' {
+				in_class = false
+			}
+
+		case c == '[':
+			in_class = true
+		case c == '(':
+			depth += 1
+		case c == ')':
+
+			if depth == 0 {
+				return strings.TrimRightFunc(p.input[start:p.pos], unicode.IsSpace), nil
+			}
+
+			depth -= 1
+		}
+
+		p.pos += 1
+	}
+
+	if p.pos > len(p.input) {
+		p.pos = len(p.input)
+	}
+
+	return strings.TrimRightFunc(p.input[start:p.pos], unicode.IsSpace), nil
+}
+
+// endsValue returns true if 'str' starts with 'keyword' followed by something that can start a predicate: "(",
+// "NOT", "!", a function call or a path followed by an operator.
+func endsValue(str string, keyword string) bool {
+
+	if !hasKeyword(str, keyword) {
+		return false
+	}
+
+	p := &parser{
+		input: str[len(keyword):],
+	}
+
+	p.skipSpace()
+
+	if p.done() {
+		return false
+	}
+
+	if p.peek() == '(' || hasKeyword(p.input[p.pos:], "NOT") || (p.peek() == '!' && !strings.HasPrefix(p.input[p.pos:], "!=")) {
+		return true
+	}
+
+	for _, fn := range []string{"exists", "missing", "count"} {
+
+		if hasKeyword(p.input[p.pos:], fn) && strings.HasPrefix(strings.TrimLeftFunc(p.input[p.pos+len(fn):], unicode.IsSpace), "(") {
+			return true
+		}
+	}
+
+	_, err := p.parsePath()
+
+	if err != nil {
+		return false
+	}
+
+	p.skipSpace()
+
+	_, err = p.parseOperator()
+	return err == nil
+}
+
+// skipQuoted advances past a double-quoted string, honouring backslash escapes.
+func (p *parser) skipQuoted() error {
+
+	start := p.pos
+	p.pos += 1
+
+	for !p.done() {
+
+		switch p.peek() {
+		case '\\':
+			p.pos += 2
+		case '"':
+			p.pos += 1
+			return nil
+		default:
+			p.pos += 1
+		}
+	}
+
+	return fmt.Errorf("Unterminated string at offset %d", start)
+}
@@ -0,0 +1,141 @@
+package expr
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+
+	tests := map[string]string{
+		// Precedence and parentheses
+		`a=1 OR b=2 AND c=3`:         `a=1 OR (b=2 AND c=3)`,
+		`a=1 AND b=2 OR c=3`:         `(a=1 AND b=2) OR c=3`,
+		`(a=1 OR b=2) AND c=3`:       `(a=1 OR b=2) AND c=3`,
+		`a=1 || b=2 && c=3`:          `a=1 OR (b=2 AND c=3)`,
+		`NOT a=1 AND b=2`:            `NOT (a=1) AND b=2`,
+		`!(a=1 OR b=2)`:              `NOT (a=1 OR b=2)`,
+		`((a=1))`:                    `a=1`,
+		`a=1 AND b=2 AND c=3`:        `a=1 AND b=2 AND c=3`,
+		`a=1 AND (b=2 OR NOT (c=3))`: `a=1 AND (b=2 OR NOT (c=3))`,
+		// Functions
+		`exists(item.title)`:                 `exists(item.title)`,
+		`missing(item.title)`:                `NOT (exists(item.title))`,
+		`count(item.subjects)>=2`:            `count(item.subjects)>=2`,
+		`count( item.subjects ) = 2`:         `count(item.subjects)==2`,
+		`exists(item.title) AND count(a)<1`:  `exists(item.title) AND count(a)<1`,
+		`exists(item.contributors.#(=="x"))`: `exists(item.contributors.#(=="x"))`,
+		// Operators
+		`a!=b`:   `a!=b`,
+		`a==b`:   `a==b`,
+		`a <= 2`: `a<=2`,
+		`a>2`:    `a>2`,
+		`a<2`:    `a<2`,
+		`a>=2`:   `a>=2`,
+		// Quoting
+		`item.title="WAR AND PEACE"`: `item.title="WAR AND PEACE"`,
+		`item.title="a \"b\" (c)"`:   `item.title="a \"b\" (c)"`,
+		`item.title==""`:             `item.title==""`,
+		`a="x" AND b=y`:              `a=x AND b=y`,
+		// Bare values
+		`item.title=WAR AND PEACE`:             `item.title="WAR AND PEACE"`,
+		`item.title=WAR AND PEACE AND b=1`:     `item.title="WAR AND PEACE" AND b=1`,
+		`item.title=WAR OR PEACE OR exists(b)`: `item.title="WAR OR PEACE" OR exists(b)`,
+		`item.title=WAR AND NOT b=1`:           `item.title=WAR AND NOT (b=1)`,
+		`item.title=WAR AND (b=1)`:             `item.title=WAR AND b=1`,
+		`(item.title=WAR AND PEACE)`:           `item.title="WAR AND PEACE"`,
+		`item.title=WAR AND PEACE=1`:           `item.title=WAR AND PEACE=1`,
+		// Legacy {PATH}={REGEXP} forms
+		`item.subjects=Black and white`: `item.subjects="Black and white"`,
+		`item.subjects=(?i)war`:         `item.subjects="(?i)war"`,
+		`item.subjects=^(war|peace)$`:   `item.subjects="^(war|peace)$"`,
+		`item.subjects=[()]`:            `item.subjects="[()]"`,
+		`item.subjects=\(war\)`:         `item.subjects="\\(war\\)"`,
+		`item.location.#(=="paris")=.*`: `item.location.#(=="paris")=.*`,
+	}
+
+	for q, expected := range tests {
+
+		e, err := Parse(q)
+
+		if err != nil {
+			t.Fatalf("Failed to parse '%s', %v", q, err)
+		}
+
+		if e.String() != expected {
+			t.Fatalf("Unexpected expression for '%s', got '%s' expected '%s'", q, e.String(), expected)
+		}
+
+		// The string representation of an expression should parse to the same expression
+
+		e2, err := Parse(e.String())
+
+		if err != nil {
+			t.Fatalf("Failed to parse '%s', %v", e.String(), err)
+		}
+
+		if e2.String() != e.String() {
+			t.Fatalf("Round trip of '%s' returned '%s'", e.String(), e2.String())
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+
+	tests := []string{
+		``,
+		`a`,
+		`a=1 &&`,
+		`a=1 ||`,
+		`a=1 AND (`,
+		`a=1 OR NOT (`,
+		`(a=1`,
+		`a=1)`,
+		`exists(a`,
+		`exists()`,
+		`count(a)=x`,
+		`count(a)!=1`,
+		`a="unterminated`,
+		`a=[`,
+		`=1`,
+		`NOT`,
+	}
+
+	for _, q := range tests {
+
+		_, err := Parse(q)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to fail", q)
+		}
+	}
+}
+
+func TestParseMatches(t *testing.T) {
+
+	body := []byte(`{"item":{"title":"WAR AND PEACE","subjects":["war","Black and white"],"date":"1869-01"}}`)
+
+	tests := map[string]bool{
+		`item.title=WAR AND PEACE`:                             true,
+		`item.title=WAR AND PEACE AND count(item.subjects)==2`: true,
+		`item.title=WAR AND PEACE AND count(item.subjects)>2`:  false,
+		`item.subjects=Black and white`:                        true,
+		`item.subjects!=^peace$`:                               true,
+		`item.subjects!=^war$`:                                 false,
+		`missing(item.notes) AND exists(item.date)`:            true,
+		`item.date<1870 AND item.date>=1869-01-01`:             true,
+		`NOT (item.title==x OR item.subjects==war)`:            false,
+	}
+
+	for q, expected := range tests {
+
+		e, err := Parse(q)
+
+		if err != nil {
+			t.Fatalf("Failed to parse '%s', %v", q, err)
+		}
+
+		if e.Matches(body) != expected {
+			t.Fatalf("Expected '%s' to return %t", q, expected)
+		}
+	}
+}
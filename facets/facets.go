@@ -0,0 +1,207 @@
+// package facets provides methods for counting the values of one or more properties across a set of Library of
+// Congress records.
+package facets
+
+import (
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/projection"
+	"github.com/tidwall/gjson"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Facets counts the values of one or more (gjson) paths across a set of JSON records. It is safe for concurrent use.
+type Facets struct {
+	fields  []*projection.Field
+	mu      *sync.Mutex
+	records int64
+	counts  []*facet
+}
+
+type facet struct {
+	records int64
+	values  map[string]int64
+}
+
+// ResultsOptions defines options for filtering the values returned by the Results method.
+type ResultsOptions struct {
+	// The maximum number of values to return for each facet. Zero means all values are returned.
+	Top int
+	// The minimum number of records a value must occur in to be returned.
+	MinCount int64
+}
+
+// Results is the output of a Facets instance.
+type Results struct {
+	Records int64    `json:"records"`
+	Facets  []*Facet `json:"facets"`
+}
+
+// Facet is the value counts for a single path.
+type Facet struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// The number of records with at least one value for the path.
+	Records int64 `json:"records"`
+	// The number of distinct values for the path, before Top and MinCount are applied.
+	Distinct int      `json:"distinct"`
+	Values   []*Value `json:"values"`
+}
+
+// Value is a value and the number of records it occurs in.
+type Value struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// NewFacets returns a new Facets instance for the paths in 'fields'. Facets are named using each field's alias.
+func NewFacets(fields ...*projection.Field) (*Facets, error) {
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("No facets defined")
+	}
+
+	seen := make(map[string]bool)
+
+	for _, f := range fields {
+
+		if seen[f.Alias] {
+			return nil, fmt.Errorf("Duplicate facet name '%s'", f.Alias)
+		}
+
+		seen[f.Alias] = true
+	}
+
+	counts := make([]*facet, len(fields))
+
+	for idx := range fields {
+		counts[idx] = &facet{
+			values: make(map[string]int64),
+		}
+	}
+
+	f := &Facets{
+		fields: fields,
+		mu:     new(sync.Mutex),
+		counts: counts,
+	}
+
+	return f, nil
+}
+
+// Add counts the values of each facet path in the JSON record 'body'. If a path resolves to an array each distinct
+// element is counted once.
+func (f *Facets) Add(body []byte) {
+
+	values := make([][]string, len(f.fields))
+
+	for idx, fl := range f.fields {
+		values[idx] = Values(body, fl.Path)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.records += 1
+
+	for idx, v := range values {
+
+		if len(v) == 0 {
+			continue
+		}
+
+		c := f.counts[idx]
+		c.records += 1
+
+		for _, str_v := range v {
+			c.values[str_v] += 1
+		}
+	}
+}
+
+// Values returns the distinct, non-empty values of 'path' in the JSON record 'body'. Strings are trimmed of
+// whitespace and objects are returned as JSON.
+func Values(body []byte, path string) []string {
+
+	rsp := gjson.GetBytes(body, path)
+
+	candidates := []gjson.Result{rsp}
+
+	if rsp.IsArray() {
+		candidates = rsp.Array()
+	}
+
+	values := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, r := range candidates {
+
+		if !r.Exists() || r.Type == gjson.Null {
+			continue
+		}
+
+		str_v := strings.TrimSpace(r.String())
+
+		if str_v == "" || seen[str_v] {
+			continue
+		}
+
+		seen[str_v] = true
+		values = append(values, str_v)
+	}
+
+	return values
+}
+
+// Results returns the value counts for each facet, in the order they were defined, with values sorted by count
+// (descending) and then value.
+func (f *Facets) Results(opts *ResultsOptions) *Results {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r := &Results{
+		Records: f.records,
+		Facets:  make([]*Facet, len(f.fields)),
+	}
+
+	for idx, fl := range f.fields {
+
+		c := f.counts[idx]
+
+		values := make([]*Value, 0)
+
+		for v, count := range c.values {
+
+			if count < opts.MinCount {
+				continue
+			}
+
+			values = append(values, &Value{Value: v, Count: count})
+		}
+
+		sort.Slice(values, func(i, j int) bool {
+
+			if values[i].Count != values[j].Count {
+				return values[i].Count > values[j].Count
+			}
+
+			return values[i].Value < values[j].Value
+		})
+
+		if opts.Top > 0 && len(values) > opts.Top {
+			values = values[:opts.Top]
+		}
+
+		r.Facets[idx] = &Facet{
+			Name:     fl.Alias,
+			Path:     fl.Path,
+			Records:  c.records,
+			Distinct: len(c.values),
+			Values:   values,
+		}
+	}
+
+	return r
+}
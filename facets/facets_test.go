@@ -0,0 +1,146 @@
+package facets
+
+import (
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/projection"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testRecords = []string{
+	`{"subject": ["domes", "capitols", "domes"], "date": "1865", "item": {"format": "photo"}}`,
+	`{"subject": ["capitols", " libraries "], "date": 1865, "item": {"format": "photo"}}`,
+	`{"subject": "domes", "date": "1870", "item": {"format": {"type": "print"}}}`,
+	`{"subject": ["", null, "bridges"], "date": null}`,
+	`{"subject": [], "date": "  "}`,
+}
+
+func newTestFacets(t *testing.T, fields string) *Facets {
+
+	t.Helper()
+
+	var flags projection.FieldFlags
+
+	err := flags.Set(fields)
+
+	if err != nil {
+		t.Fatalf("Failed to parse fields, %v", err)
+	}
+
+	f, err := NewFacets(flags...)
+
+	if err != nil {
+		t.Fatalf("Failed to create facets, %v", err)
+	}
+
+	for _, body := range testRecords {
+		f.Add([]byte(body))
+	}
+
+	return f
+}
+
+// valueCounts returns the values of 'f' as "{VALUE}:{COUNT}" strings.
+func valueCounts(f *Facet) string {
+
+	counts := make([]string, len(f.Values))
+
+	for idx, v := range f.Values {
+		counts[idx] = fmt.Sprintf("%s:%d", v.Value, v.Count)
+	}
+
+	return strings.Join(counts, ",")
+}
+
+func TestValues(t *testing.T) {
+
+	tests := map[string][]string{
+		"subject":     {"domes", "capitols"},
+		"date":        {"1865"},
+		"item.format": {"photo"},
+		"missing":     {},
+	}
+
+	for path, expected := range tests {
+
+		values := Values([]byte(testRecords[0]), path)
+
+		if !reflect.DeepEqual(values, expected) {
+			t.Fatalf("Unexpected values for %s: %v, expected %v", path, values, expected)
+		}
+	}
+
+	values := Values([]byte(testRecords[2]), "item.format")
+
+	if !reflect.DeepEqual(values, []string{`{"type": "print"}`}) {
+		t.Fatalf("Expected objects to be returned as JSON, got %v", values)
+	}
+}
+
+func TestResults(t *testing.T) {
+
+	f := newTestFacets(t, "subject,year=date,format=item.format")
+
+	r := f.Results(&ResultsOptions{})
+
+	if r.Records != int64(len(testRecords)) || len(r.Facets) != 3 {
+		t.Fatalf("Unexpected results, %d records and %d facets", r.Records, len(r.Facets))
+	}
+
+	// Array values are counted once per record; ties are ordered by value
+
+	subjects := r.Facets[0]
+
+	if subjects.Name != "subject" || subjects.Records != 4 || subjects.Distinct != 4 {
+		t.Fatalf("Unexpected subject facet, %d records and %d distinct values", subjects.Records, subjects.Distinct)
+	}
+
+	if valueCounts(subjects) != "capitols:2,domes:2,bridges:1,libraries:1" {
+		t.Fatalf("Unexpected subject values %s", valueCounts(subjects))
+	}
+
+	// Scalar values, where strings and numbers with the same text are the same value
+
+	years := r.Facets[1]
+
+	if years.Name != "year" || years.Path != "date" || years.Records != 3 || valueCounts(years) != "1865:2,1870:1" {
+		t.Fatalf("Unexpected year facet %s", valueCounts(years))
+	}
+
+	formats := r.Facets[2]
+
+	if formats.Records != 3 || valueCounts(formats) != `photo:2,{"type": "print"}:1` {
+		t.Fatalf("Unexpected format facet %s", valueCounts(formats))
+	}
+
+	r = f.Results(&ResultsOptions{Top: 3})
+
+	if valueCounts(r.Facets[0]) != "capitols:2,domes:2,bridges:1" || r.Facets[0].Distinct != 4 {
+		t.Fatalf("Unexpected top values %s", valueCounts(r.Facets[0]))
+	}
+
+	r = f.Results(&ResultsOptions{MinCount: 2})
+
+	if valueCounts(r.Facets[0]) != "capitols:2,domes:2" || valueCounts(r.Facets[1]) != "1865:2" {
+		t.Fatalf("Unexpected values with a minimum count %s", valueCounts(r.Facets[0]))
+	}
+}
+
+func TestNewFacetsErrors(t *testing.T) {
+
+	_, err := NewFacets()
+
+	if err == nil {
+		t.Fatalf("Expected facets without fields to be invalid")
+	}
+
+	var flags projection.FieldFlags
+	flags.Set("subject,subject=item.subjects")
+
+	_, err = NewFacets(flags...)
+
+	if err == nil {
+		t.Fatalf("Expected duplicate facet names to be invalid")
+	}
+}
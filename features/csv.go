@@ -0,0 +1,246 @@
+package features
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	proj "github.com/aaronland/go-libraryofcongress-datajam/projection"
+	"github.com/paulmach/orb/encoding/wkt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/sfomuseum/go-csvdict"
+	"github.com/tidwall/gjson"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// The name of the column containing the WKT representation of a feature's geometry in CSV output.
+const WKT_COLUMN string = "wkt"
+
+// CSVEncoder writes features as CSV rows with the geometry of each feature encoded as WKT.
+type CSVEncoder struct {
+	wr      io.Writer
+	csv_wr  *csvdict.Writer
+	columns []string
+	sep     string
+	mu      *sync.Mutex
+	tmp     *os.File
+	keys    map[string]bool
+}
+
+// NewCSVEncoder returns a new CSVEncoder that writes to 'wr'. If 'opts.Columns' is empty the columns are the
+// (sorted) union of the properties of every feature. Since these are not known until every feature has been seen
+// nothing is written until Close is called; in the meantime rows are written to a temporary file.
+func NewCSVEncoder(wr io.Writer, opts *EncoderOptions) *CSVEncoder {
+
+	enc := &CSVEncoder{
+		wr:      wr,
+		columns: opts.Columns,
+		sep:     opts.ArraySeparator,
+		mu:      new(sync.Mutex),
+		keys:    make(map[string]bool),
+	}
+
+	return enc
+}
+
+// Encode writes 'f' as a CSV row.
+func (enc *CSVEncoder) Encode(f *geojson.Feature) error {
+
+	row := make(map[string]string)
+	row[WKT_COLUMN] = wkt.MarshalString(f.Geometry)
+
+	for k, v := range f.Properties {
+
+		enc_v, err := json.Marshal(v)
+
+		if err != nil {
+			return fmt.Errorf("Failed to encode property '%s', %w", k, err)
+		}
+
+		row[k] = proj.CellValue(gjson.ParseBytes(enc_v), enc.sep)
+	}
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	if enc.Buffered() {
+		return enc.spool(row)
+	}
+
+	if enc.csv_wr == nil {
+
+		err := enc.writeHeader(enc.columns)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err := enc.csv_wr.WriteRow(row)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write CSV row, %w", err)
+	}
+
+	return nil
+}
+
+// Buffered returns true if no columns were specified, in which case rows are not written until Close is called.
+func (enc *CSVEncoder) Buffered() bool {
+	return len(enc.columns) == 0
+}
+
+// Close writes any rows held in the encoder's temporary file and flushes any buffered rows. If no features were
+// encoded, and columns were specified, a header is written.
+func (enc *CSVEncoder) Close() error {
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	if enc.Buffered() {
+
+		if enc.tmp == nil {
+			return nil
+		}
+
+		defer func() {
+			enc.tmp.Close()
+			os.Remove(enc.tmp.Name())
+		}()
+
+		columns := make([]string, 0, len(enc.keys))
+
+		for k := range enc.keys {
+			columns = append(columns, k)
+		}
+
+		sort.Strings(columns)
+
+		err := enc.writeHeader(columns)
+
+		if err != nil {
+			return err
+		}
+
+		err = enc.writeSpooled()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if enc.csv_wr == nil {
+
+		err := enc.writeHeader(enc.columns)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	enc.csv_wr.Flush()
+
+	err := enc.csv_wr.Error()
+
+	if err != nil {
+		return fmt.Errorf("Failed to flush CSV writer, %w", err)
+	}
+
+	return nil
+}
+
+// spool writes 'row' to the encoder's temporary file, creating it if necessary, and records its keys.
+func (enc *CSVEncoder) spool(row map[string]string) error {
+
+	if enc.tmp == nil {
+
+		tmp, err := os.CreateTemp("", "features-*.jsonl")
+
+		if err != nil {
+			return fmt.Errorf("Failed to create temporary file, %w", err)
+		}
+
+		enc.tmp = tmp
+	}
+
+	enc_row, err := json.Marshal(row)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal CSV row, %w", err)
+	}
+
+	_, err = enc.tmp.Write(append(enc_row, '\n'))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write row to temporary file, %w", err)
+	}
+
+	for k := range row {
+
+		if k != WKT_COLUMN {
+			enc.keys[k] = true
+		}
+	}
+
+	return nil
+}
+
+// writeSpooled writes the rows in the encoder's temporary file.
+func (enc *CSVEncoder) writeSpooled() error {
+
+	_, err := enc.tmp.Seek(0, io.SeekStart)
+
+	if err != nil {
+		return fmt.Errorf("Failed to rewind temporary file, %w", err)
+	}
+
+	scanner := bufio.NewScanner(enc.tmp)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+
+		var row map[string]string
+
+		err := json.Unmarshal(scanner.Bytes(), &row)
+
+		if err != nil {
+			return fmt.Errorf("Failed to unmarshal CSV row, %w", err)
+		}
+
+		err = enc.csv_wr.WriteRow(row)
+
+		if err != nil {
+			return fmt.Errorf("Failed to write CSV row, %w", err)
+		}
+	}
+
+	err = scanner.Err()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read temporary file, %w", err)
+	}
+
+	return nil
+}
+
+func (enc *CSVEncoder) writeHeader(columns []string) error {
+
+	fieldnames := append([]string{WKT_COLUMN}, columns...)
+
+	csv_wr, err := csvdict.NewWriter(enc.wr, fieldnames)
+
+	if err != nil {
+		return fmt.Errorf("Failed to create CSV writer, %w", err)
+	}
+
+	err = csv_wr.WriteHeader()
+
+	if err != nil {
+		return fmt.Errorf("Failed to write CSV header, %w", err)
+	}
+
+	enc.csv_wr = csv_wr
+	return nil
+}
@@ -0,0 +1,126 @@
+package features
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/paulmach/orb"
+	"reflect"
+	"testing"
+)
+
+// readCSV parses 'body' returning its header and a map of rows keyed by their "id" column.
+func readCSV(t *testing.T, body []byte) ([]string, map[string]map[string]string) {
+
+	t.Helper()
+
+	rows, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+
+	if err != nil {
+		t.Fatalf("Failed to parse CSV, %v", err)
+	}
+
+	if len(rows) == 0 {
+		t.Fatalf("CSV is missing a header")
+	}
+
+	header := rows[0]
+	records := make(map[string]map[string]string)
+
+	for _, r := range rows[1:] {
+
+		rec := make(map[string]string)
+
+		for idx, k := range header {
+			rec[k] = r[idx]
+		}
+
+		_, exists := records[rec["id"]]
+
+		if exists {
+			t.Fatalf("Row '%s' was written more than once", rec["id"])
+		}
+
+		records[rec["id"]] = rec
+	}
+
+	return header, records
+}
+
+func TestCSVEncoder(t *testing.T) {
+
+	features := testFeatures(50)
+
+	// Without any columns the union of all the properties, sorted, is used
+
+	body := encodeConcurrently(t, FORMAT_CSV, nil, features)
+	header, records := readCSV(t, body)
+
+	expected_header := []string{WKT_COLUMN, "count", "flag", "id", "subjects", "thumbnail", "title", "url"}
+
+	if !reflect.DeepEqual(header, expected_header) {
+		t.Fatalf("Unexpected header %v", header)
+	}
+
+	if len(records) != len(features) {
+		t.Fatalf("Expected %d rows, got %d", len(features), len(records))
+	}
+
+	for i, f := range features {
+
+		id := f.Properties["id"].(string)
+		rec, ok := records[id]
+
+		if !ok {
+			t.Fatalf("Missing row for %s", id)
+		}
+
+		pt := f.Geometry.(orb.Point)
+
+		if rec[WKT_COLUMN] != fmt.Sprintf("POINT(%s %s)", formatFloat(pt.Lon()), formatFloat(pt.Lat())) {
+			t.Fatalf("Unexpected WKT '%s' for %s", rec[WKT_COLUMN], id)
+		}
+
+		if rec["title"] != f.Properties["title"] || rec["subjects"] != fmt.Sprintf("a;b%d", i) || rec["count"] != fmt.Sprintf("%d", i) || rec["flag"] != fmt.Sprintf("%t", i%2 == 0) {
+			t.Fatalf("Unexpected row for %s, %v", id, rec)
+		}
+	}
+
+	// With explicit columns rows are written as they are encoded and other properties are ignored
+
+	body = encodeConcurrently(t, FORMAT_CSV, &EncoderOptions{Columns: []string{"id", "subjects", "missing"}, ArraySeparator: "|"}, features)
+	header, records = readCSV(t, body)
+
+	if !reflect.DeepEqual(header, []string{WKT_COLUMN, "id", "subjects", "missing"}) {
+		t.Fatalf("Unexpected header %v", header)
+	}
+
+	if len(records) != len(features) {
+		t.Fatalf("Expected %d rows, got %d", len(features), len(records))
+	}
+
+	for i := range features {
+
+		rec := records[fmt.Sprintf("loc-%d", i)]
+
+		if rec["subjects"] != fmt.Sprintf("a|b%d", i) || rec["missing"] != "" {
+			t.Fatalf("Unexpected row for loc-%d, %v", i, rec)
+		}
+	}
+}
+
+func TestCSVEncoderEmpty(t *testing.T) {
+
+	body := encodeConcurrently(t, FORMAT_CSV, nil, nil)
+
+	if len(body) != 0 {
+		t.Fatalf("Expected no output, got '%s'", body)
+	}
+
+	body = encodeConcurrently(t, FORMAT_CSV, &EncoderOptions{Columns: []string{"id"}}, nil)
+	header, records := readCSV(t, body)
+
+	if !reflect.DeepEqual(header, []string{WKT_COLUMN, "id"}) || len(records) != 0 {
+		t.Fatalf("Unexpected output '%s'", body)
+	}
+}
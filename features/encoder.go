@@ -0,0 +1,166 @@
+// package features provides encoders for writing streams of GeoJSON features in a variety of geospatial formats.
+package features
+
+import (
+	"fmt"
+	"github.com/paulmach/orb/geojson"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// A GeoJSON FeatureCollection.
+	FORMAT_GEOJSON string = "geojson"
+	// Newline-delimited GeoJSON features.
+	FORMAT_NDGEOJSON string = "ndgeojson"
+	// A FlatGeobuf file with a (packed Hilbert R-tree) spatial index.
+	FORMAT_FLATGEOBUF string = "fgb"
+	// A KML document of placemarks with HTML (image) balloons.
+	FORMAT_KML string = "kml"
+	// A GPX document of waypoints.
+	FORMAT_GPX string = "gpx"
+	// CSV with a WKT geometry column.
+	FORMAT_CSV string = "csv"
+)
+
+// The default value of EncoderOptions.NameProperty.
+const DEFAULT_NAME_PROPERTY string = "title"
+
+// The default value of EncoderOptions.ImageProperty.
+const DEFAULT_IMAGE_PROPERTY string = "thumbnail"
+
+// The default value of EncoderOptions.LinkProperty.
+const DEFAULT_LINK_PROPERTY string = "url"
+
+// The default value of EncoderOptions.ArraySeparator.
+const DEFAULT_ARRAY_SEPARATOR string = ";"
+
+// Encoder is the interface for writing a stream of features in a specific format. Implementations must be safe
+// for concurrent use.
+type Encoder interface {
+	// Encode writes a feature.
+	Encode(*geojson.Feature) error
+	// Buffered returns true if features are held until Close is called, rather than being written as they are
+	// encoded, because the format needs to see every feature first.
+	Buffered() bool
+	// Close writes any trailing (or, for buffered formats, all) data. It does not close the underlying writer.
+	Close() error
+}
+
+// EncoderOptions defines options for encoders. Not every option is used by every encoder.
+type EncoderOptions struct {
+	// The name of the document or layer being written.
+	Name string
+	// The feature property used to label features in KML and GPX documents.
+	NameProperty string
+	// The feature property containing an image URL to display in KML balloons and link to from GPX waypoints.
+	ImageProperty string
+	// The feature property containing a URL to link to from KML balloons and GPX waypoints.
+	LinkProperty string
+	// The property columns to include in CSV output. If empty the (sorted) union of the properties of every feature
+	// is used, which means nothing is written until the encoder is closed.
+	Columns []string
+	// The string used to join array values, and flattened object values, in CSV output.
+	ArraySeparator string
+}
+
+// Formats returns the list of formats supported by NewEncoder.
+func Formats() []string {
+
+	formats := []string{
+		FORMAT_GEOJSON,
+		FORMAT_NDGEOJSON,
+		FORMAT_FLATGEOBUF,
+		FORMAT_KML,
+		FORMAT_GPX,
+		FORMAT_CSV,
+	}
+
+	sort.Strings(formats)
+	return formats
+}
+
+// NewEncoder returns a new Encoder for 'format' that writes to 'wr'. If 'opts' is nil default options are used.
+func NewEncoder(format string, wr io.Writer, opts *EncoderOptions) (Encoder, error) {
+
+	if opts == nil {
+		opts = &EncoderOptions{}
+	}
+
+	if opts.NameProperty == "" {
+		opts.NameProperty = DEFAULT_NAME_PROPERTY
+	}
+
+	if opts.ImageProperty == "" {
+		opts.ImageProperty = DEFAULT_IMAGE_PROPERTY
+	}
+
+	if opts.LinkProperty == "" {
+		opts.LinkProperty = DEFAULT_LINK_PROPERTY
+	}
+
+	if opts.ArraySeparator == "" {
+		opts.ArraySeparator = DEFAULT_ARRAY_SEPARATOR
+	}
+
+	switch format {
+	case FORMAT_GEOJSON:
+		return NewGeoJSONEncoder(wr), nil
+	case FORMAT_NDGEOJSON:
+		return NewNDGeoJSONEncoder(wr), nil
+	case FORMAT_FLATGEOBUF:
+		return NewFlatGeobufEncoder(wr, opts)
+	case FORMAT_KML:
+		return NewKMLEncoder(wr, opts), nil
+	case FORMAT_GPX:
+		return NewGPXEncoder(wr, opts), nil
+	case FORMAT_CSV:
+		return NewCSVEncoder(wr, opts), nil
+	default:
+		return nil, fmt.Errorf("Unsupported format '%s'", format)
+	}
+}
+
+// propertyString returns the value of the property 'k' in 'props' as a string. If the value is a list the first
+// non-empty element is used. Missing and null values, and objects, are returned as empty strings.
+func propertyString(props geojson.Properties, k string) string {
+
+	switch v := props[k].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+
+		for _, el := range v {
+
+			str := propertyString(geojson.Properties{k: el}, k)
+
+			if str != "" {
+				return str
+			}
+		}
+
+		return ""
+
+	default:
+		return ""
+	}
+}
+
+// sortedKeys returns the keys of 'props' in alphabetical order.
+func sortedKeys(props geojson.Properties) []string {
+
+	keys := make([]string, 0, len(props))
+
+	for k := range props {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,81 @@
+package features
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"sync"
+	"testing"
+)
+
+// testFeatures returns 'count' point features, spread across a grid around Washington DC, each with "id",
+// "title", "url", "thumbnail", "count", "flag" and "subjects" properties.
+func testFeatures(count int) []*geojson.Feature {
+
+	features := make([]*geojson.Feature, count)
+
+	for i := 0; i < count; i++ {
+
+		pt := orb.Point{-77.5 + float64(i%37)*0.025, 38.5 + float64(i/37)*0.025}
+
+		f := geojson.NewFeature(pt)
+		f.Properties["id"] = fmt.Sprintf("loc-%d", i)
+		f.Properties["title"] = fmt.Sprintf("Record <%d> & \"friends\"", i)
+		f.Properties["url"] = fmt.Sprintf("https://www.loc.gov/item/%d/", i)
+		f.Properties["thumbnail"] = fmt.Sprintf("https://tile.loc.gov/image-services/%d.jpg", i)
+		f.Properties["count"] = float64(i)
+		f.Properties["flag"] = i%2 == 0
+		f.Properties["subjects"] = []interface{}{"a", fmt.Sprintf("b%d", i)}
+
+		features[i] = f
+	}
+
+	return features
+}
+
+// encodeConcurrently encodes 'features', from multiple goroutines, with a new encoder for 'format' and returns
+// the encoded bytes.
+func encodeConcurrently(t *testing.T, format string, opts *EncoderOptions, features []*geojson.Feature) []byte {
+
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	enc, err := NewEncoder(format, &buf, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create %s encoder, %v", format, err)
+	}
+
+	wg := new(sync.WaitGroup)
+	errors := make(chan error, len(features))
+
+	for _, f := range features {
+
+		wg.Add(1)
+
+		go func(f *geojson.Feature) {
+			defer wg.Done()
+			errors <- enc.Encode(f)
+		}(f)
+	}
+
+	wg.Wait()
+	close(errors)
+
+	for err := range errors {
+
+		if err != nil {
+			t.Fatalf("Failed to encode feature, %v", err)
+		}
+	}
+
+	err = enc.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to close %s encoder, %v", format, err)
+	}
+
+	return buf.Bytes()
+}
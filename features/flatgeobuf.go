@@ -0,0 +1,584 @@
+package features
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+)
+
+// The magic bytes at the start of a FlatGeobuf (version 3) file.
+var fgb_magic = []byte{0x66, 0x67, 0x62, 0x03, 0x66, 0x67, 0x62, 0x00}
+
+// The number of children of each node in the spatial index.
+const fgb_index_node_size int = 16
+
+// FlatGeobuf geometry types.
+const (
+	fgb_geometry_unknown         uint8 = 0
+	fgb_geometry_point           uint8 = 1
+	fgb_geometry_linestring      uint8 = 2
+	fgb_geometry_polygon         uint8 = 3
+	fgb_geometry_multipoint      uint8 = 4
+	fgb_geometry_multilinestring uint8 = 5
+	fgb_geometry_multipolygon    uint8 = 6
+)
+
+// FlatGeobuf column types.
+const (
+	fgb_column_bool   uint8 = 2
+	fgb_column_double uint8 = 10
+	fgb_column_string uint8 = 11
+	fgb_column_json   uint8 = 12
+)
+
+// fgbItem is a feature waiting to be written to a FlatGeobuf file.
+type fgbItem struct {
+	bound orb.Bound
+	// The offset and length of the feature's GeoJSON encoding in the encoder's temporary file.
+	offset int64
+	length int
+	// The offset of the feature relative to the start of the features section of the FlatGeobuf file.
+	feature_offset uint64
+}
+
+// FlatGeobufEncoder writes features as a FlatGeobuf file with a packed Hilbert R-tree spatial index. Because the
+// spatial index, and the schema of the feature properties, precede the features themselves nothing is written
+// until Close is called; in the meantime features are written to a temporary file. Property columns are derived
+// from the features: properties whose values are all strings, numbers or booleans are encoded as string, double or
+// bool columns respectively and everything else is encoded as JSON.
+type FlatGeobufEncoder struct {
+	wr            io.Writer
+	options       *EncoderOptions
+	mu            *sync.Mutex
+	tmp           *os.File
+	tmp_offset    int64
+	items         []*fgbItem
+	columns       map[string]uint8
+	geometry_type uint8
+}
+
+// NewFlatGeobufEncoder returns a new FlatGeobufEncoder that writes to 'wr'. The encoder's temporary file is created
+// when the first feature is encoded.
+func NewFlatGeobufEncoder(wr io.Writer, opts *EncoderOptions) (*FlatGeobufEncoder, error) {
+
+	enc := &FlatGeobufEncoder{
+		wr:            wr,
+		options:       opts,
+		mu:            new(sync.Mutex),
+		items:         make([]*fgbItem, 0),
+		columns:       make(map[string]uint8),
+		geometry_type: fgb_geometry_unknown,
+	}
+
+	return enc, nil
+}
+
+// Encode adds 'f' to the list of features to write when Close is called.
+func (enc *FlatGeobufEncoder) Encode(f *geojson.Feature) error {
+
+	if f.Geometry == nil {
+		return fmt.Errorf("Feature is missing a geometry")
+	}
+
+	geom_type := fgbGeometryType(f.Geometry)
+
+	if geom_type == fgb_geometry_unknown {
+		return fmt.Errorf("Unsupported geometry type for FlatGeobuf, %T", f.Geometry)
+	}
+
+	enc_f, err := f.MarshalJSON()
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal GeoJSON, %w", err)
+	}
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	if enc.tmp == nil {
+
+		tmp, err := os.CreateTemp("", "features-*.jsonl")
+
+		if err != nil {
+			return fmt.Errorf("Failed to create temporary file, %w", err)
+		}
+
+		enc.tmp = tmp
+	}
+
+	_, err = enc.tmp.Write(enc_f)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write feature to temporary file, %w", err)
+	}
+
+	i := &fgbItem{
+		bound:  f.Geometry.Bound(),
+		offset: enc.tmp_offset,
+		length: len(enc_f),
+	}
+
+	enc.items = append(enc.items, i)
+	enc.tmp_offset += int64(len(enc_f))
+
+	if len(enc.items) == 1 {
+		enc.geometry_type = geom_type
+	} else if enc.geometry_type != geom_type {
+		enc.geometry_type = fgb_geometry_unknown
+	}
+
+	for k, v := range f.Properties {
+
+		col_type, ok := fgbColumnType(v)
+
+		if !ok {
+			continue
+		}
+
+		current, exists := enc.columns[k]
+
+		if exists && current != col_type {
+			col_type = fgb_column_json
+		}
+
+		enc.columns[k] = col_type
+	}
+
+	return nil
+}
+
+// Buffered returns true since nothing is written until Close is called.
+func (enc *FlatGeobufEncoder) Buffered() bool {
+	return true
+}
+
+// Close writes the FlatGeobuf header, spatial index and features and removes the encoder's temporary files.
+func (enc *FlatGeobufEncoder) Close() error {
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	if enc.tmp != nil {
+
+		defer func() {
+			enc.tmp.Close()
+			os.Remove(enc.tmp.Name())
+		}()
+	}
+
+	columns := make([]string, 0, len(enc.columns))
+
+	for k := range enc.columns {
+		columns = append(columns, k)
+	}
+
+	sort.Strings(columns)
+
+	var extent orb.Bound
+
+	for idx, i := range enc.items {
+
+		if idx == 0 {
+			extent = i.bound
+		} else {
+			extent = extent.Union(i.bound)
+		}
+	}
+
+	hilbertSort(enc.items, extent)
+
+	// Encode the features, in index order, to a second temporary file in order to know their offsets
+
+	features_tmp, err := os.CreateTemp("", "features-*.fgb")
+
+	if err != nil {
+		return fmt.Errorf("Failed to create temporary file, %w", err)
+	}
+
+	defer func() {
+		features_tmp.Close()
+		os.Remove(features_tmp.Name())
+	}()
+
+	features_offset := uint64(0)
+
+	for _, i := range enc.items {
+
+		enc_f := make([]byte, i.length)
+
+		_, err := enc.tmp.ReadAt(enc_f, i.offset)
+
+		if err != nil {
+			return fmt.Errorf("Failed to read feature from temporary file, %w", err)
+		}
+
+		f, err := geojson.UnmarshalFeature(enc_f)
+
+		if err != nil {
+			return fmt.Errorf("Failed to unmarshal feature from temporary file, %w", err)
+		}
+
+		fgb_f, err := enc.encodeFeature(f, columns)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = features_tmp.Write(fgb_f)
+
+		if err != nil {
+			return fmt.Errorf("Failed to write feature to temporary file, %w", err)
+		}
+
+		i.feature_offset = features_offset
+		features_offset += uint64(len(fgb_f))
+	}
+
+	_, err = enc.wr.Write(fgb_magic)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write FlatGeobuf magic bytes, %w", err)
+	}
+
+	_, err = enc.wr.Write(enc.encodeHeader(columns, extent))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write FlatGeobuf header, %w", err)
+	}
+
+	if len(enc.items) > 0 {
+
+		nodes := packedRTree(enc.items, fgb_index_node_size)
+
+		_, err = enc.wr.Write(encodeRTree(nodes))
+
+		if err != nil {
+			return fmt.Errorf("Failed to write FlatGeobuf index, %w", err)
+		}
+	}
+
+	_, err = features_tmp.Seek(0, io.SeekStart)
+
+	if err != nil {
+		return fmt.Errorf("Failed to rewind temporary file, %w", err)
+	}
+
+	_, err = io.Copy(enc.wr, features_tmp)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write FlatGeobuf features, %w", err)
+	}
+
+	return nil
+}
+
+// encodeHeader returns the size-prefixed FlatGeobuf header for the features in 'enc'.
+func (enc *FlatGeobufEncoder) encodeHeader(columns []string, extent orb.Bound) []byte {
+
+	b := flatbuffers.NewBuilder(1024)
+
+	var name flatbuffers.UOffsetT
+
+	if enc.options.Name != "" {
+		name = b.CreateString(enc.options.Name)
+	}
+
+	col_offsets := make([]flatbuffers.UOffsetT, len(columns))
+
+	for idx, k := range columns {
+
+		col_name := b.CreateString(k)
+
+		b.StartObject(11)
+		b.PrependUOffsetTSlot(0, col_name, 0)
+		b.PrependByteSlot(1, enc.columns[k], 0)
+		col_offsets[idx] = b.EndObject()
+	}
+
+	b.StartVector(4, len(col_offsets), 4)
+
+	for idx := len(col_offsets) - 1; idx >= 0; idx-- {
+		b.PrependUOffsetT(col_offsets[idx])
+	}
+
+	cols := b.EndVector(len(col_offsets))
+
+	var envelope flatbuffers.UOffsetT
+
+	if len(enc.items) > 0 {
+
+		b.StartVector(8, 4, 8)
+		b.PrependFloat64(extent.Max.Y())
+		b.PrependFloat64(extent.Max.X())
+		b.PrependFloat64(extent.Min.Y())
+		b.PrependFloat64(extent.Min.X())
+		envelope = b.EndVector(4)
+	}
+
+	crs_org := b.CreateString("EPSG")
+
+	b.StartObject(6)
+	b.PrependUOffsetTSlot(0, crs_org, 0)
+	b.PrependInt32Slot(1, 4326, 0)
+	crs := b.EndObject()
+
+	node_size := uint16(fgb_index_node_size)
+
+	if len(enc.items) == 0 {
+		node_size = 0
+	}
+
+	b.StartObject(14)
+
+	if name != 0 {
+		b.PrependUOffsetTSlot(0, name, 0)
+	}
+
+	if envelope != 0 {
+		b.PrependUOffsetTSlot(1, envelope, 0)
+	}
+
+	b.PrependByteSlot(2, enc.geometry_type, 0)
+	b.PrependUOffsetTSlot(7, cols, 0)
+	b.PrependUint64Slot(8, uint64(len(enc.items)), 0)
+	b.PrependUint16Slot(9, node_size, 16)
+	b.PrependUOffsetTSlot(10, crs, 0)
+
+	b.Finish(b.EndObject())
+
+	return sizePrefixed(b.FinishedBytes())
+}
+
+// encodeFeature returns the size-prefixed FlatGeobuf encoding of 'f'.
+func (enc *FlatGeobufEncoder) encodeFeature(f *geojson.Feature, columns []string) ([]byte, error) {
+
+	props, err := enc.encodeProperties(f.Properties, columns)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := flatbuffers.NewBuilder(1024)
+
+	geom, err := fgbGeometry(b, f.Geometry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	enc_props := b.CreateByteVector(props)
+
+	b.StartObject(3)
+	b.PrependUOffsetTSlot(0, geom, 0)
+	b.PrependUOffsetTSlot(1, enc_props, 0)
+	b.Finish(b.EndObject())
+
+	return sizePrefixed(b.FinishedBytes()), nil
+}
+
+// encodeProperties returns the FlatGeobuf encoding of 'props': a sequence of (uint16) column indices followed
+// by their values. Null values are omitted.
+func (enc *FlatGeobufEncoder) encodeProperties(props geojson.Properties, columns []string) ([]byte, error) {
+
+	buf := make([]byte, 0)
+
+	for idx, k := range columns {
+
+		v, ok := props[k]
+
+		if !ok || v == nil {
+			continue
+		}
+
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(idx))
+
+		switch enc.columns[k] {
+		case fgb_column_bool:
+
+			if v.(bool) {
+				buf = append(buf, 1)
+			} else {
+				buf = append(buf, 0)
+			}
+
+		case fgb_column_double:
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v.(float64)))
+		case fgb_column_string:
+			str := v.(string)
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(len(str)))
+			buf = append(buf, str...)
+		default:
+
+			enc_v, err := json.Marshal(v)
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to encode property '%s', %w", k, err)
+			}
+
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(len(enc_v)))
+			buf = append(buf, enc_v...)
+		}
+	}
+
+	return buf, nil
+}
+
+// fgbGeometry adds the FlatGeobuf encoding of 'geom' to 'b' and returns its offset.
+func fgbGeometry(b *flatbuffers.Builder, geom orb.Geometry) (flatbuffers.UOffsetT, error) {
+
+	geom_type := fgbGeometryType(geom)
+
+	var parts flatbuffers.UOffsetT
+	var points []orb.Point
+	var ends []uint32
+
+	switch g := geom.(type) {
+	case orb.Point:
+		points = []orb.Point{g}
+	case orb.MultiPoint:
+		points = g
+	case orb.LineString:
+		points = g
+	case orb.MultiLineString:
+
+		for _, ls := range g {
+			points = append(points, ls...)
+			ends = append(ends, uint32(len(points)))
+		}
+
+	case orb.Polygon:
+
+		for _, r := range g {
+			points = append(points, r...)
+			ends = append(ends, uint32(len(points)))
+		}
+
+	case orb.MultiPolygon:
+
+		part_offsets := make([]flatbuffers.UOffsetT, len(g))
+
+		for idx, poly := range g {
+
+			p, err := fgbGeometry(b, poly)
+
+			if err != nil {
+				return 0, err
+			}
+
+			part_offsets[idx] = p
+		}
+
+		b.StartVector(4, len(part_offsets), 4)
+
+		for idx := len(part_offsets) - 1; idx >= 0; idx-- {
+			b.PrependUOffsetT(part_offsets[idx])
+		}
+
+		parts = b.EndVector(len(part_offsets))
+
+	default:
+		return 0, fmt.Errorf("Unsupported geometry type for FlatGeobuf, %T", geom)
+	}
+
+	var xy flatbuffers.UOffsetT
+	var enc_ends flatbuffers.UOffsetT
+
+	if len(points) > 0 {
+
+		b.StartVector(8, len(points)*2, 8)
+
+		for idx := len(points) - 1; idx >= 0; idx-- {
+			b.PrependFloat64(points[idx].Y())
+			b.PrependFloat64(points[idx].X())
+		}
+
+		xy = b.EndVector(len(points) * 2)
+	}
+
+	// Ends are only necessary when there is more than one part
+
+	if len(ends) > 1 {
+
+		b.StartVector(4, len(ends), 4)
+
+		for idx := len(ends) - 1; idx >= 0; idx-- {
+			b.PrependUint32(ends[idx])
+		}
+
+		enc_ends = b.EndVector(len(ends))
+	}
+
+	b.StartObject(8)
+
+	if enc_ends != 0 {
+		b.PrependUOffsetTSlot(0, enc_ends, 0)
+	}
+
+	if xy != 0 {
+		b.PrependUOffsetTSlot(1, xy, 0)
+	}
+
+	b.PrependByteSlot(6, geom_type, 0)
+
+	if parts != 0 {
+		b.PrependUOffsetTSlot(7, parts, 0)
+	}
+
+	return b.EndObject(), nil
+}
+
+// fgbGeometryType returns the FlatGeobuf geometry type for 'geom'.
+func fgbGeometryType(geom orb.Geometry) uint8 {
+
+	switch geom.(type) {
+	case orb.Point:
+		return fgb_geometry_point
+	case orb.LineString:
+		return fgb_geometry_linestring
+	case orb.Polygon:
+		return fgb_geometry_polygon
+	case orb.MultiPoint:
+		return fgb_geometry_multipoint
+	case orb.MultiLineString:
+		return fgb_geometry_multilinestring
+	case orb.MultiPolygon:
+		return fgb_geometry_multipolygon
+	default:
+		return fgb_geometry_unknown
+	}
+}
+
+// fgbColumnType returns the FlatGeobuf column type for the (JSON-decoded) value 'v' and a boolean indicating
+// whether a type could be determined, which is not the case for null values.
+func fgbColumnType(v interface{}) (uint8, bool) {
+
+	switch v.(type) {
+	case nil:
+		return 0, false
+	case bool:
+		return fgb_column_bool, true
+	case float64:
+		return fgb_column_double, true
+	case string:
+		return fgb_column_string, true
+	default:
+		return fgb_column_json, true
+	}
+}
+
+// sizePrefixed returns 'body' prefixed by its (uint32) length.
+func sizePrefixed(body []byte) []byte {
+
+	buf := make([]byte, 4, len(body)+4)
+	binary.LittleEndian.PutUint32(buf, uint32(len(body)))
+
+	return append(buf, body...)
+}
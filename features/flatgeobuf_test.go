@@ -0,0 +1,667 @@
+package features
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	flatbuffers "github.com/google/flatbuffers/go"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"math"
+	"testing"
+)
+
+// The tests in this file decode FlatGeobuf files using the generic flatbuffers.Table methods and the field
+// (slot) numbers defined in the FlatGeobuf schema (https://github.com/flatgeobuf/flatgeobuf/tree/master/src/fbs)
+// rather than any of the code used to write them.
+
+// fgbTable is a FlatBuffers table.
+type fgbTable struct {
+	flatbuffers.Table
+}
+
+func newFGBTable(buf []byte) *fgbTable {
+	return &fgbTable{flatbuffers.Table{Bytes: buf, Pos: flatbuffers.GetUOffsetT(buf)}}
+}
+
+// field returns the offset of the field in 'slot', relative to the start of the table, or 0 if it is not set.
+func (t *fgbTable) field(slot int) flatbuffers.UOffsetT {
+	return flatbuffers.UOffsetT(t.Offset(flatbuffers.VOffsetT(4 + 2*slot)))
+}
+
+func (t *fgbTable) str(slot int) string {
+
+	o := t.field(slot)
+
+	if o == 0 {
+		return ""
+	}
+
+	return t.String(o + t.Pos)
+}
+
+func (t *fgbTable) uint8(slot int, d uint8) uint8 {
+	return t.GetUint8Slot(flatbuffers.VOffsetT(4+2*slot), d)
+}
+
+func (t *fgbTable) uint16(slot int, d uint16) uint16 {
+	return t.GetUint16Slot(flatbuffers.VOffsetT(4+2*slot), d)
+}
+
+func (t *fgbTable) uint64(slot int, d uint64) uint64 {
+	return t.GetUint64Slot(flatbuffers.VOffsetT(4+2*slot), d)
+}
+
+func (t *fgbTable) int32(slot int, d int32) int32 {
+	return t.GetInt32Slot(flatbuffers.VOffsetT(4+2*slot), d)
+}
+
+func (t *fgbTable) bytes(slot int) []byte {
+
+	o := t.field(slot)
+
+	if o == 0 {
+		return nil
+	}
+
+	return t.ByteVector(o + t.Pos)
+}
+
+func (t *fgbTable) float64s(slot int) []float64 {
+
+	o := t.field(slot)
+
+	if o == 0 {
+		return nil
+	}
+
+	start := t.Vector(o)
+	values := make([]float64, t.VectorLen(o))
+
+	for idx := range values {
+		values[idx] = t.GetFloat64(start + flatbuffers.UOffsetT(idx*8))
+	}
+
+	return values
+}
+
+func (t *fgbTable) uint32s(slot int) []uint32 {
+
+	o := t.field(slot)
+
+	if o == 0 {
+		return nil
+	}
+
+	start := t.Vector(o)
+	values := make([]uint32, t.VectorLen(o))
+
+	for idx := range values {
+		values[idx] = t.GetUint32(start + flatbuffers.UOffsetT(idx*4))
+	}
+
+	return values
+}
+
+func (t *fgbTable) table(slot int) *fgbTable {
+
+	o := t.field(slot)
+
+	if o == 0 {
+		return nil
+	}
+
+	return &fgbTable{flatbuffers.Table{Bytes: t.Bytes, Pos: t.Indirect(o + t.Pos)}}
+}
+
+func (t *fgbTable) tables(slot int) []*fgbTable {
+
+	o := t.field(slot)
+
+	if o == 0 {
+		return nil
+	}
+
+	start := t.Vector(o)
+	tables := make([]*fgbTable, t.VectorLen(o))
+
+	for idx := range tables {
+		pos := t.Indirect(start + flatbuffers.UOffsetT(idx*4))
+		tables[idx] = &fgbTable{flatbuffers.Table{Bytes: t.Bytes, Pos: pos}}
+	}
+
+	return tables
+}
+
+type fgbColumn struct {
+	name     string
+	col_type uint8
+}
+
+type fgbNode struct {
+	bound  orb.Bound
+	offset uint64
+}
+
+type fgbFile struct {
+	name            string
+	envelope        []float64
+	geometry_type   uint8
+	columns         []*fgbColumn
+	features_count  uint64
+	index_node_size uint16
+	crs_org         string
+	crs_code        int32
+	nodes           []*fgbNode
+	// The offset of the features section from the start of the file.
+	features_start int
+	body           []byte
+}
+
+// decodeFGB decodes the magic bytes, header and spatial index of the FlatGeobuf file 'body'.
+func decodeFGB(body []byte) (*fgbFile, error) {
+
+	if len(body) < 12 || !bytes.Equal(body[0:3], []byte("fgb")) || body[4] != 'f' || body[5] != 'g' || body[6] != 'b' {
+		return nil, fmt.Errorf("Invalid magic bytes")
+	}
+
+	header_size := int(binary.LittleEndian.Uint32(body[8:12]))
+
+	if len(body) < 12+header_size {
+		return nil, fmt.Errorf("File is shorter than its header")
+	}
+
+	h := newFGBTable(body[12 : 12+header_size])
+
+	f := &fgbFile{
+		name:            h.str(0),
+		envelope:        h.float64s(1),
+		geometry_type:   h.uint8(2, 0),
+		features_count:  h.uint64(8, 0),
+		index_node_size: h.uint16(9, 16),
+		body:            body,
+	}
+
+	for _, c := range h.tables(7) {
+		f.columns = append(f.columns, &fgbColumn{name: c.str(0), col_type: c.uint8(1, 0)})
+	}
+
+	crs := h.table(10)
+
+	if crs != nil {
+		f.crs_org = crs.str(0)
+		f.crs_code = crs.int32(1, 0)
+	}
+
+	offset := 12 + header_size
+
+	if f.index_node_size > 0 && f.features_count > 0 {
+
+		// The number of nodes in a packed R-tree, as calculated by the reference implementations
+
+		n := int(f.features_count)
+		num_nodes := n
+
+		for {
+
+			n = (n + int(f.index_node_size) - 1) / int(f.index_node_size)
+			num_nodes += n
+
+			if n == 1 {
+				break
+			}
+		}
+
+		if len(body) < offset+num_nodes*40 {
+			return nil, fmt.Errorf("File is shorter than its index")
+		}
+
+		for idx := 0; idx < num_nodes; idx++ {
+
+			b := body[offset+idx*40:]
+
+			node := &fgbNode{
+				bound: orb.Bound{
+					Min: orb.Point{math.Float64frombits(binary.LittleEndian.Uint64(b[0:])), math.Float64frombits(binary.LittleEndian.Uint64(b[8:]))},
+					Max: orb.Point{math.Float64frombits(binary.LittleEndian.Uint64(b[16:])), math.Float64frombits(binary.LittleEndian.Uint64(b[24:]))},
+				},
+				offset: binary.LittleEndian.Uint64(b[32:]),
+			}
+
+			f.nodes = append(f.nodes, node)
+		}
+
+		offset += num_nodes * 40
+	}
+
+	f.features_start = offset
+	return f, nil
+}
+
+// feature decodes the feature at 'offset', relative to the start of the features section, returning the feature
+// and its size, including its size prefix.
+func (f *fgbFile) feature(offset uint64) (*geojson.Feature, int, error) {
+
+	start := f.features_start + int(offset)
+
+	if len(f.body) < start+4 {
+		return nil, 0, fmt.Errorf("Feature offset %d is out of range", offset)
+	}
+
+	size := int(binary.LittleEndian.Uint32(f.body[start:]))
+
+	if len(f.body) < start+4+size {
+		return nil, 0, fmt.Errorf("Feature at offset %d is truncated", offset)
+	}
+
+	t := newFGBTable(f.body[start+4 : start+4+size])
+
+	geom, err := fgbDecodeGeometry(t.table(0))
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	feature := geojson.NewFeature(geom)
+
+	props := t.bytes(1)
+
+	for len(props) > 0 {
+
+		if len(props) < 2 {
+			return nil, 0, fmt.Errorf("Truncated properties")
+		}
+
+		idx := int(binary.LittleEndian.Uint16(props))
+		props = props[2:]
+
+		if idx >= len(f.columns) {
+			return nil, 0, fmt.Errorf("Invalid column index %d", idx)
+		}
+
+		col := f.columns[idx]
+
+		switch col.col_type {
+		case 2:
+			feature.Properties[col.name] = props[0] == 1
+			props = props[1:]
+		case 10:
+			feature.Properties[col.name] = math.Float64frombits(binary.LittleEndian.Uint64(props))
+			props = props[8:]
+		case 11, 12:
+
+			length := int(binary.LittleEndian.Uint32(props))
+			v := props[4 : 4+length]
+
+			if col.col_type == 11 {
+				feature.Properties[col.name] = string(v)
+			} else {
+
+				var json_v interface{}
+
+				err := json.Unmarshal(v, &json_v)
+
+				if err != nil {
+					return nil, 0, fmt.Errorf("Invalid JSON value for %s, %w", col.name, err)
+				}
+
+				feature.Properties[col.name] = json_v
+			}
+
+			props = props[4+length:]
+
+		default:
+			return nil, 0, fmt.Errorf("Unexpected column type %d", col.col_type)
+		}
+	}
+
+	return feature, 4 + size, nil
+}
+
+func fgbDecodeGeometry(t *fgbTable) (orb.Geometry, error) {
+
+	if t == nil {
+		return nil, fmt.Errorf("Feature is missing a geometry")
+	}
+
+	xy := t.float64s(1)
+	ends := t.uint32s(0)
+
+	points := make([]orb.Point, len(xy)/2)
+
+	for idx := range points {
+		points[idx] = orb.Point{xy[idx*2], xy[idx*2+1]}
+	}
+
+	rings := func() [][]orb.Point {
+
+		if len(ends) == 0 {
+			return [][]orb.Point{points}
+		}
+
+		parts := make([][]orb.Point, 0)
+		start := uint32(0)
+
+		for _, end := range ends {
+			parts = append(parts, points[start:end])
+			start = end
+		}
+
+		return parts
+	}
+
+	switch t.uint8(6, 0) {
+	case 1:
+		return points[0], nil
+	case 2:
+		return orb.LineString(points), nil
+	case 3:
+
+		poly := orb.Polygon{}
+
+		for _, r := range rings() {
+			poly = append(poly, orb.Ring(r))
+		}
+
+		return poly, nil
+
+	case 4:
+		return orb.MultiPoint(points), nil
+	case 5:
+
+		mls := orb.MultiLineString{}
+
+		for _, ls := range rings() {
+			mls = append(mls, orb.LineString(ls))
+		}
+
+		return mls, nil
+
+	case 6:
+
+		mp := orb.MultiPolygon{}
+
+		for _, part := range t.tables(7) {
+
+			poly, err := fgbDecodeGeometry(part)
+
+			if err != nil {
+				return nil, err
+			}
+
+			mp = append(mp, poly.(orb.Polygon))
+		}
+
+		return mp, nil
+
+	default:
+		return nil, fmt.Errorf("Unexpected geometry type %d", t.uint8(6, 0))
+	}
+}
+
+// checkFGB decodes 'body' and checks that its header, spatial index and features match 'features'.
+func checkFGB(t *testing.T, body []byte, features []*geojson.Feature) {
+
+	t.Helper()
+
+	f, err := decodeFGB(body)
+
+	if err != nil {
+		t.Fatalf("Failed to decode FlatGeobuf file, %v", err)
+	}
+
+	if f.name != "test" {
+		t.Fatalf("Unexpected name '%s'", f.name)
+	}
+
+	if f.crs_org != "EPSG" || f.crs_code != 4326 {
+		t.Fatalf("Unexpected CRS %s:%d", f.crs_org, f.crs_code)
+	}
+
+	if f.features_count != uint64(len(features)) {
+		t.Fatalf("Unexpected feature count %d, expected %d", f.features_count, len(features))
+	}
+
+	if len(features) == 0 {
+
+		if f.index_node_size != 0 || len(f.nodes) != 0 {
+			t.Fatalf("Expected empty file to have no index")
+		}
+
+		if f.envelope != nil {
+			t.Fatalf("Expected empty file to have no envelope")
+		}
+
+		if f.features_start != len(body) {
+			t.Fatalf("Expected empty file to end after its header")
+		}
+
+		return
+	}
+
+	if f.index_node_size != 16 {
+		t.Fatalf("Unexpected index node size %d", f.index_node_size)
+	}
+
+	if f.geometry_type != 1 {
+		t.Fatalf("Unexpected geometry type %d", f.geometry_type)
+	}
+
+	extent := features[0].Geometry.Bound()
+
+	for _, feature := range features[1:] {
+		extent = extent.Union(feature.Geometry.Bound())
+	}
+
+	if len(f.envelope) != 4 || f.envelope[0] != extent.Min.X() || f.envelope[1] != extent.Min.Y() || f.envelope[2] != extent.Max.X() || f.envelope[3] != extent.Max.Y() {
+		t.Fatalf("Unexpected envelope %v, expected %v", f.envelope, extent)
+	}
+
+	if f.nodes[0].bound != extent {
+		t.Fatalf("Unexpected root node bounds %v, expected %v", f.nodes[0].bound, extent)
+	}
+
+	// Every non-leaf node should point to its first child and contain the bounds of all its children
+
+	leaves := f.nodes[len(f.nodes)-len(features):]
+	first_leaf := uint64(len(f.nodes) - len(features))
+
+	for idx, n := range f.nodes[:first_leaf] {
+
+		if n.offset <= uint64(idx) || n.offset >= uint64(len(f.nodes)) {
+			t.Fatalf("Node %d has an invalid child offset %d", idx, n.offset)
+		}
+
+		for c := n.offset; c < n.offset+16 && c < uint64(len(f.nodes)); c++ {
+
+			child := f.nodes[c]
+
+			if c != n.offset && c >= first_leaf != (n.offset >= first_leaf) {
+				break
+			}
+
+			if n.bound.Union(child.bound) != n.bound {
+				t.Fatalf("Node %d does not contain child %d", idx, c)
+			}
+		}
+	}
+
+	// The leaf nodes should point to consecutive features that, together, make up the features section
+
+	expected := make(map[string]*geojson.Feature)
+
+	for _, feature := range features {
+		expected[feature.Properties["id"].(string)] = feature
+	}
+
+	offset := uint64(0)
+
+	for idx, leaf := range leaves {
+
+		if leaf.offset != offset {
+			t.Fatalf("Leaf %d has offset %d, expected %d", idx, leaf.offset, offset)
+		}
+
+		decoded, size, err := f.feature(leaf.offset)
+
+		if err != nil {
+			t.Fatalf("Failed to decode feature %d, %v", idx, err)
+		}
+
+		offset += uint64(size)
+
+		id, _ := decoded.Properties["id"].(string)
+		original, ok := expected[id]
+
+		if !ok {
+			t.Fatalf("Feature %d has an unexpected, or repeated, ID '%s'", idx, id)
+		}
+
+		delete(expected, id)
+
+		if decoded.Geometry.Bound() != leaf.bound {
+			t.Fatalf("Feature %d does not match the bounds of its leaf node", idx)
+		}
+
+		if !orb.Equal(decoded.Geometry, original.Geometry) {
+			t.Fatalf("Feature %d has unexpected geometry %v, expected %v", idx, decoded.Geometry, original.Geometry)
+		}
+
+		enc_decoded, _ := json.Marshal(decoded.Properties)
+		enc_original, _ := json.Marshal(original.Properties)
+
+		if !bytes.Equal(enc_decoded, enc_original) {
+			t.Fatalf("Feature %d has unexpected properties %s, expected %s", idx, enc_decoded, enc_original)
+		}
+	}
+
+	if len(expected) != 0 {
+		t.Fatalf("%d features are missing from the index", len(expected))
+	}
+
+	if f.features_start+int(offset) != len(body) {
+		t.Fatalf("Features section has %d trailing bytes", len(body)-f.features_start-int(offset))
+	}
+}
+
+func TestFlatGeobufEncoder(t *testing.T) {
+
+	opts := &EncoderOptions{
+		Name: "test",
+	}
+
+	// 0 and 1 features are edge cases; 300 features means a three level index with a partially filled last node
+
+	for _, count := range []int{0, 1, 2, 16, 17, 300} {
+
+		features := testFeatures(count)
+		body := encodeConcurrently(t, FORMAT_FLATGEOBUF, opts, features)
+
+		checkFGB(t, body, features)
+	}
+}
+
+func TestFlatGeobufEncoderGeometries(t *testing.T) {
+
+	geometries := []orb.Geometry{
+		orb.LineString{{-77, 38}, {-76, 39}},
+		orb.Polygon{
+			{{-77, 38}, {-76, 38}, {-76, 39}, {-77, 38}},
+			{{-76.8, 38.2}, {-76.5, 38.2}, {-76.5, 38.5}, {-76.8, 38.2}},
+		},
+		orb.MultiPoint{{-77, 38}, {-76, 39}},
+		orb.MultiLineString{{{-77, 38}, {-76, 39}}, {{-75, 37}, {-74, 36}}},
+		orb.MultiPolygon{
+			{{{-77, 38}, {-76, 38}, {-76, 39}, {-77, 38}}},
+			{{{-75, 36}, {-74, 36}, {-74, 37}, {-75, 36}}},
+		},
+	}
+
+	features := make([]*geojson.Feature, len(geometries))
+
+	for idx, g := range geometries {
+		features[idx] = geojson.NewFeature(g)
+		features[idx].Properties["id"] = fmt.Sprintf("geom-%d", idx)
+	}
+
+	var buf bytes.Buffer
+
+	enc, err := NewEncoder(FORMAT_FLATGEOBUF, &buf, &EncoderOptions{Name: "test"})
+
+	if err != nil {
+		t.Fatalf("Failed to create encoder, %v", err)
+	}
+
+	for _, f := range features {
+
+		err := enc.Encode(f)
+
+		if err != nil {
+			t.Fatalf("Failed to encode feature, %v", err)
+		}
+	}
+
+	err = enc.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to close encoder, %v", err)
+	}
+
+	f, err := decodeFGB(buf.Bytes())
+
+	if err != nil {
+		t.Fatalf("Failed to decode FlatGeobuf file, %v", err)
+	}
+
+	// Mixed geometry types are signaled as "unknown"
+
+	if f.geometry_type != 0 {
+		t.Fatalf("Unexpected geometry type %d", f.geometry_type)
+	}
+
+	for idx, leaf := range f.nodes[len(f.nodes)-len(features):] {
+
+		decoded, _, err := f.feature(leaf.offset)
+
+		if err != nil {
+			t.Fatalf("Failed to decode feature %d, %v", idx, err)
+		}
+
+		id := decoded.Properties["id"].(string)
+
+		var original *geojson.Feature
+
+		for _, candidate := range features {
+
+			if candidate.Properties["id"] == id {
+				original = candidate
+			}
+		}
+
+		if original == nil || !orb.Equal(decoded.Geometry, original.Geometry) {
+			t.Fatalf("Feature %s has unexpected geometry %v", id, decoded.Geometry)
+		}
+	}
+}
+
+func TestFlatGeobufEncoderMissingGeometry(t *testing.T) {
+
+	enc, err := NewFlatGeobufEncoder(new(bytes.Buffer), &EncoderOptions{})
+
+	if err != nil {
+		t.Fatalf("Failed to create encoder, %v", err)
+	}
+
+	err = enc.Encode(&geojson.Feature{Type: "Feature", Properties: geojson.Properties{}})
+
+	if err == nil {
+		t.Fatalf("Expected feature without a geometry to fail")
+	}
+
+	err = enc.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to close encoder, %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package features
+
+import (
+	"fmt"
+	"github.com/paulmach/orb/geojson"
+	"io"
+	"sync"
+)
+
+// GeoJSONEncoder writes features as a GeoJSON FeatureCollection.
+type GeoJSONEncoder struct {
+	wr    io.Writer
+	mu    *sync.Mutex
+	count int64
+}
+
+// NewGeoJSONEncoder returns a new GeoJSONEncoder that writes to 'wr'.
+func NewGeoJSONEncoder(wr io.Writer) *GeoJSONEncoder {
+
+	enc := &GeoJSONEncoder{
+		wr: wr,
+		mu: new(sync.Mutex),
+	}
+
+	return enc
+}
+
+// Encode writes 'f' to the feature collection.
+func (enc *GeoJSONEncoder) Encode(f *geojson.Feature) error {
+
+	enc_f, err := f.MarshalJSON()
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal GeoJSON, %w", err)
+	}
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	if enc.count == 0 {
+		_, err = enc.wr.Write([]byte(`{"type":"FeatureCollection", "features": [`))
+	} else {
+		_, err = enc.wr.Write([]byte(","))
+	}
+
+	if err != nil {
+		return fmt.Errorf("Failed to write feature collection, %w", err)
+	}
+
+	_, err = enc.wr.Write(enc_f)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write feature, %w", err)
+	}
+
+	enc.count += 1
+	return nil
+}
+
+// Buffered returns false since features are written as they are encoded.
+func (enc *GeoJSONEncoder) Buffered() bool {
+	return false
+}
+
+// Close ends the feature collection.
+func (enc *GeoJSONEncoder) Close() error {
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	var err error
+
+	if enc.count == 0 {
+		_, err = enc.wr.Write([]byte(`{"type":"FeatureCollection", "features": []}`))
+	} else {
+		_, err = enc.wr.Write([]byte("]}"))
+	}
+
+	if err != nil {
+		return fmt.Errorf("Failed to write feature collection, %w", err)
+	}
+
+	return nil
+}
+
+// NDGeoJSONEncoder writes features as newline-delimited GeoJSON.
+type NDGeoJSONEncoder struct {
+	wr io.Writer
+	mu *sync.Mutex
+}
+
+// NewNDGeoJSONEncoder returns a new NDGeoJSONEncoder that writes to 'wr'.
+func NewNDGeoJSONEncoder(wr io.Writer) *NDGeoJSONEncoder {
+
+	enc := &NDGeoJSONEncoder{
+		wr: wr,
+		mu: new(sync.Mutex),
+	}
+
+	return enc
+}
+
+// Encode writes 'f' followed by a newline.
+func (enc *NDGeoJSONEncoder) Encode(f *geojson.Feature) error {
+
+	enc_f, err := f.MarshalJSON()
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal GeoJSON, %w", err)
+	}
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	_, err = enc.wr.Write(append(enc_f, '\n'))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write feature, %w", err)
+	}
+
+	return nil
+}
+
+// Buffered returns false since features are written as they are encoded.
+func (enc *NDGeoJSONEncoder) Buffered() bool {
+	return false
+}
+
+// Close is a no-op since newline-delimited GeoJSON has no trailing data.
+func (enc *NDGeoJSONEncoder) Close() error {
+	return nil
+}
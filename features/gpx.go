@@ -0,0 +1,183 @@
+package features
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"html"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+const gpx_header string = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="go-libraryofcongress-datajam" xmlns="http://www.topografix.com/GPX/1/1">
+`
+
+const gpx_footer string = `</gpx>
+`
+
+type gpxWaypoint struct {
+	XMLName xml.Name   `xml:"wpt"`
+	Lat     string     `xml:"lat,attr"`
+	Lon     string     `xml:"lon,attr"`
+	Name    string     `xml:"name,omitempty"`
+	Links   []*gpxLink `xml:"link"`
+}
+
+type gpxLink struct {
+	Href string `xml:"href,attr"`
+	Text string `xml:"text,omitempty"`
+	Type string `xml:"type,omitempty"`
+}
+
+// GPXEncoder writes features as GPX waypoints. Each waypoint is labeled using the EncoderOptions.NameProperty
+// property and links to the URLs defined by the EncoderOptions.LinkProperty and EncoderOptions.ImageProperty
+// properties. Features whose geometry is not a point are written using the center of their bounding box.
+type GPXEncoder struct {
+	wr      io.Writer
+	options *EncoderOptions
+	mu      *sync.Mutex
+	started bool
+}
+
+// NewGPXEncoder returns a new GPXEncoder that writes to 'wr'.
+func NewGPXEncoder(wr io.Writer, opts *EncoderOptions) *GPXEncoder {
+
+	enc := &GPXEncoder{
+		wr:      wr,
+		options: opts,
+		mu:      new(sync.Mutex),
+	}
+
+	return enc
+}
+
+// Encode writes 'f' as a GPX waypoint.
+func (enc *GPXEncoder) Encode(f *geojson.Feature) error {
+
+	if f.Geometry == nil {
+		return fmt.Errorf("Feature is missing a geometry")
+	}
+
+	pt, ok := f.Geometry.(orb.Point)
+
+	if !ok {
+		pt = f.Geometry.Bound().Center()
+	}
+
+	wpt := &gpxWaypoint{
+		Lat:   formatFloat(pt.Lat()),
+		Lon:   formatFloat(pt.Lon()),
+		Name:  propertyString(f.Properties, enc.options.NameProperty),
+		Links: make([]*gpxLink, 0),
+	}
+
+	link := propertyString(f.Properties, enc.options.LinkProperty)
+
+	if link != "" {
+		wpt.Links = append(wpt.Links, &gpxLink{Href: link, Text: wpt.Name})
+	}
+
+	image := propertyString(f.Properties, enc.options.ImageProperty)
+
+	if image != "" {
+		wpt.Links = append(wpt.Links, &gpxLink{Href: image, Text: enc.options.ImageProperty, Type: imageType(image)})
+	}
+
+	enc_wpt, err := xml.Marshal(wpt)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal GPX waypoint, %w", err)
+	}
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	err = enc.start()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = enc.wr.Write(append(enc_wpt, '\n'))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write GPX waypoint, %w", err)
+	}
+
+	return nil
+}
+
+// Buffered returns false since features are written as they are encoded.
+func (enc *GPXEncoder) Buffered() bool {
+	return false
+}
+
+// Close ends the GPX document.
+func (enc *GPXEncoder) Close() error {
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	err := enc.start()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = enc.wr.Write([]byte(gpx_footer))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write GPX document, %w", err)
+	}
+
+	return nil
+}
+
+func (enc *GPXEncoder) start() error {
+
+	if enc.started {
+		return nil
+	}
+
+	enc.started = true
+
+	var buf strings.Builder
+	buf.WriteString(gpx_header)
+
+	if enc.options.Name != "" {
+		buf.WriteString("<metadata><name>" + html.EscapeString(enc.options.Name) + "</name></metadata>\n")
+	}
+
+	_, err := enc.wr.Write([]byte(buf.String()))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write GPX document, %w", err)
+	}
+
+	return nil
+}
+
+// imageType returns the MIME type of the image at 'uri', derived from its extension, or an empty string if it can
+// not be determined.
+func imageType(uri string) string {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return ""
+	}
+
+	t := mime.TypeByExtension(path.Ext(u.Path))
+
+	if !strings.HasPrefix(t, "image/") {
+		return ""
+	}
+
+	return t
+}
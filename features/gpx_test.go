@@ -0,0 +1,97 @@
+package features
+
+import (
+	"encoding/xml"
+	"github.com/paulmach/orb"
+	"testing"
+)
+
+type gpxTestDocument struct {
+	XMLName  xml.Name `xml:"gpx"`
+	Metadata struct {
+		Name string `xml:"name"`
+	} `xml:"metadata"`
+	Waypoints []*gpxWaypoint `xml:"wpt"`
+}
+
+func TestGPXEncoder(t *testing.T) {
+
+	features := testFeatures(50)
+	body := encodeConcurrently(t, FORMAT_GPX, &EncoderOptions{Name: "Maps & more"}, features)
+
+	var doc gpxTestDocument
+
+	err := xml.Unmarshal(body, &doc)
+
+	if err != nil {
+		t.Fatalf("Failed to parse GPX document, %v", err)
+	}
+
+	if doc.Metadata.Name != "Maps & more" {
+		t.Fatalf("Unexpected document name '%s'", doc.Metadata.Name)
+	}
+
+	if len(doc.Waypoints) != len(features) {
+		t.Fatalf("Expected %d waypoints, got %d", len(features), len(doc.Waypoints))
+	}
+
+	// Waypoints don't have an ID so use the (unique) URL of each feature
+
+	expected := make(map[string]int)
+
+	for i, f := range features {
+		expected[f.Properties["url"].(string)] = i
+	}
+
+	for _, wpt := range doc.Waypoints {
+
+		if len(wpt.Links) != 2 {
+			t.Fatalf("Expected 2 links, got %d", len(wpt.Links))
+		}
+
+		i, ok := expected[wpt.Links[0].Href]
+
+		if !ok {
+			t.Fatalf("Unexpected, or repeated, waypoint '%s'", wpt.Links[0].Href)
+		}
+
+		delete(expected, wpt.Links[0].Href)
+
+		f := features[i]
+		pt := f.Geometry.(orb.Point)
+
+		if wpt.Name != f.Properties["title"] {
+			t.Fatalf("Unexpected name '%s' for waypoint %d", wpt.Name, i)
+		}
+
+		if wpt.Lat != formatFloat(pt.Lat()) || wpt.Lon != formatFloat(pt.Lon()) {
+			t.Fatalf("Unexpected coordinates (%s, %s) for waypoint %d", wpt.Lat, wpt.Lon, i)
+		}
+
+		img := wpt.Links[1]
+
+		if img.Href != f.Properties["thumbnail"] || img.Type != "image/jpeg" {
+			t.Fatalf("Unexpected image link %v for waypoint %d", img, i)
+		}
+	}
+}
+
+func TestImageType(t *testing.T) {
+
+	tests := map[string]string{
+		"https://tile.loc.gov/image.jpg":          "image/jpeg",
+		"https://tile.loc.gov/image.png#h=150":    "image/png",
+		"https://tile.loc.gov/image.gif?w=150":    "image/gif",
+		"https://www.loc.gov/item/2005691196/":    "",
+		"https://www.loc.gov/item/2005691196.pdf": "",
+	}
+
+	for uri, expected := range tests {
+
+		v := imageType(uri)
+
+		if v != expected {
+			t.Fatalf("Unexpected type '%s' for %s, expected '%s'", v, uri, expected)
+		}
+	}
+}
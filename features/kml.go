@@ -0,0 +1,318 @@
+package features
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	proj "github.com/aaronland/go-libraryofcongress-datajam/projection"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/tidwall/gjson"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const kml_header string = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+<Document>
+`
+
+const kml_footer string = `</Document>
+</kml>
+`
+
+type kmlPlacemark struct {
+	XMLName       xml.Name          `xml:"Placemark"`
+	Name          string            `xml:"name,omitempty"`
+	Description   *kmlCDATA         `xml:"description,omitempty"`
+	ExtendedData  *kmlExtendedData  `xml:"ExtendedData,omitempty"`
+	Point         *kmlPoint         `xml:"Point,omitempty"`
+	LineString    *kmlLineString    `xml:"LineString,omitempty"`
+	Polygon       *kmlPolygon       `xml:"Polygon,omitempty"`
+	MultiGeometry *kmlMultiGeometry `xml:"MultiGeometry,omitempty"`
+}
+
+type kmlCDATA struct {
+	Text string `xml:",cdata"`
+}
+
+type kmlExtendedData struct {
+	Data []*kmlData `xml:"Data"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlLineString struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlPolygon struct {
+	OuterBoundary *kmlBoundary   `xml:"outerBoundaryIs"`
+	InnerBoundary []*kmlBoundary `xml:"innerBoundaryIs"`
+}
+
+type kmlBoundary struct {
+	LinearRing *kmlLineString `xml:"LinearRing"`
+}
+
+type kmlMultiGeometry struct {
+	Points      []*kmlPoint      `xml:"Point"`
+	LineStrings []*kmlLineString `xml:"LineString"`
+	Polygons    []*kmlPolygon    `xml:"Polygon"`
+}
+
+// KMLEncoder writes features as KML placemarks. Each placemark is labeled using the EncoderOptions.NameProperty
+// property and has a description (balloon) containing the image, and link, defined by the EncoderOptions.ImageProperty
+// and EncoderOptions.LinkProperty properties. All of a feature's properties are included as extended data.
+type KMLEncoder struct {
+	wr      io.Writer
+	options *EncoderOptions
+	mu      *sync.Mutex
+	started bool
+}
+
+// NewKMLEncoder returns a new KMLEncoder that writes to 'wr'.
+func NewKMLEncoder(wr io.Writer, opts *EncoderOptions) *KMLEncoder {
+
+	enc := &KMLEncoder{
+		wr:      wr,
+		options: opts,
+		mu:      new(sync.Mutex),
+	}
+
+	return enc
+}
+
+// Encode writes 'f' as a KML placemark.
+func (enc *KMLEncoder) Encode(f *geojson.Feature) error {
+
+	pm := &kmlPlacemark{
+		Name: propertyString(f.Properties, enc.options.NameProperty),
+	}
+
+	err := setKMLGeometry(pm, f.Geometry)
+
+	if err != nil {
+		return err
+	}
+
+	balloon := enc.balloon(f.Properties)
+
+	if balloon != "" {
+		pm.Description = &kmlCDATA{Text: balloon}
+	}
+
+	if len(f.Properties) > 0 {
+
+		data := make([]*kmlData, 0)
+
+		for _, k := range sortedKeys(f.Properties) {
+
+			enc_v, err := json.Marshal(f.Properties[k])
+
+			if err != nil {
+				return fmt.Errorf("Failed to encode property '%s', %w", k, err)
+			}
+
+			data = append(data, &kmlData{Name: k, Value: proj.CellValue(gjson.ParseBytes(enc_v), DEFAULT_ARRAY_SEPARATOR)})
+		}
+
+		pm.ExtendedData = &kmlExtendedData{Data: data}
+	}
+
+	enc_pm, err := xml.Marshal(pm)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal KML placemark, %w", err)
+	}
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	err = enc.start()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = enc.wr.Write(append(enc_pm, '\n'))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write KML placemark, %w", err)
+	}
+
+	return nil
+}
+
+// Buffered returns false since features are written as they are encoded.
+func (enc *KMLEncoder) Buffered() bool {
+	return false
+}
+
+// Close ends the KML document.
+func (enc *KMLEncoder) Close() error {
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	err := enc.start()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = enc.wr.Write([]byte(kml_footer))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write KML document, %w", err)
+	}
+
+	return nil
+}
+
+func (enc *KMLEncoder) start() error {
+
+	if enc.started {
+		return nil
+	}
+
+	enc.started = true
+
+	var buf strings.Builder
+	buf.WriteString(kml_header)
+
+	if enc.options.Name != "" {
+		buf.WriteString("<name>" + html.EscapeString(enc.options.Name) + "</name>\n")
+	}
+
+	_, err := enc.wr.Write([]byte(buf.String()))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write KML document, %w", err)
+	}
+
+	return nil
+}
+
+// balloon returns the HTML used to describe a placemark derived from 'props'.
+func (enc *KMLEncoder) balloon(props geojson.Properties) string {
+
+	name := propertyString(props, enc.options.NameProperty)
+	image := propertyString(props, enc.options.ImageProperty)
+	link := propertyString(props, enc.options.LinkProperty)
+
+	parts := make([]string, 0)
+
+	if image != "" {
+
+		img := fmt.Sprintf(`<img src="%s" alt="%s" style="max-width:300px" />`, html.EscapeString(image), html.EscapeString(name))
+
+		if link != "" {
+			img = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(link), img)
+		}
+
+		parts = append(parts, img)
+	}
+
+	if link != "" {
+		parts = append(parts, fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(link), html.EscapeString(link)))
+	}
+
+	return strings.Join(parts, "<br />")
+}
+
+func setKMLGeometry(pm *kmlPlacemark, geom orb.Geometry) error {
+
+	switch g := geom.(type) {
+	case orb.Point:
+		pm.Point = kmlPointGeometry(g)
+	case orb.LineString:
+		pm.LineString = &kmlLineString{Coordinates: kmlCoordinates(g)}
+	case orb.Polygon:
+		pm.Polygon = kmlPolygonGeometry(g)
+	case orb.MultiPoint:
+
+		mg := &kmlMultiGeometry{}
+
+		for _, pt := range g {
+			mg.Points = append(mg.Points, kmlPointGeometry(pt))
+		}
+
+		pm.MultiGeometry = mg
+
+	case orb.MultiLineString:
+
+		mg := &kmlMultiGeometry{}
+
+		for _, ls := range g {
+			mg.LineStrings = append(mg.LineStrings, &kmlLineString{Coordinates: kmlCoordinates(ls)})
+		}
+
+		pm.MultiGeometry = mg
+
+	case orb.MultiPolygon:
+
+		mg := &kmlMultiGeometry{}
+
+		for _, poly := range g {
+			mg.Polygons = append(mg.Polygons, kmlPolygonGeometry(poly))
+		}
+
+		pm.MultiGeometry = mg
+
+	default:
+		return fmt.Errorf("Unsupported geometry type for KML, %T", geom)
+	}
+
+	return nil
+}
+
+func kmlPointGeometry(pt orb.Point) *kmlPoint {
+	return &kmlPoint{Coordinates: kmlCoordinates([]orb.Point{pt})}
+}
+
+func kmlPolygonGeometry(poly orb.Polygon) *kmlPolygon {
+
+	kp := &kmlPolygon{}
+
+	for idx, r := range poly {
+
+		b := &kmlBoundary{
+			LinearRing: &kmlLineString{Coordinates: kmlCoordinates(r)},
+		}
+
+		if idx == 0 {
+			kp.OuterBoundary = b
+		} else {
+			kp.InnerBoundary = append(kp.InnerBoundary, b)
+		}
+	}
+
+	return kp
+}
+
+// kmlCoordinates returns a KML coordinates string, a space-separated list of {LON},{LAT} tuples, for 'points'.
+func kmlCoordinates(points []orb.Point) string {
+
+	tuples := make([]string, len(points))
+
+	for idx, pt := range points {
+		tuples[idx] = formatFloat(pt.Lon()) + "," + formatFloat(pt.Lat())
+	}
+
+	return strings.Join(tuples, " ")
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
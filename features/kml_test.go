@@ -0,0 +1,101 @@
+package features
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/paulmach/orb"
+	"strings"
+	"testing"
+)
+
+type kmlTestDocument struct {
+	XMLName  xml.Name `xml:"kml"`
+	Document struct {
+		Name       string          `xml:"name"`
+		Placemarks []*kmlPlacemark `xml:"Placemark"`
+	} `xml:"Document"`
+}
+
+func TestKMLEncoder(t *testing.T) {
+
+	features := testFeatures(50)
+	body := encodeConcurrently(t, FORMAT_KML, &EncoderOptions{Name: "Maps & more"}, features)
+
+	var doc kmlTestDocument
+
+	err := xml.Unmarshal(body, &doc)
+
+	if err != nil {
+		t.Fatalf("Failed to parse KML document, %v", err)
+	}
+
+	if doc.Document.Name != "Maps & more" {
+		t.Fatalf("Unexpected document name '%s'", doc.Document.Name)
+	}
+
+	if len(doc.Document.Placemarks) != len(features) {
+		t.Fatalf("Expected %d placemarks, got %d", len(features), len(doc.Document.Placemarks))
+	}
+
+	seen := make(map[string]bool)
+
+	for _, pm := range doc.Document.Placemarks {
+
+		data := make(map[string]string)
+
+		for _, d := range pm.ExtendedData.Data {
+			data[d.Name] = d.Value
+		}
+
+		id := data["id"]
+
+		if seen[id] {
+			t.Fatalf("Placemark '%s' was written more than once", id)
+		}
+
+		seen[id] = true
+
+		var i int
+
+		_, err := fmt.Sscanf(id, "loc-%d", &i)
+
+		if err != nil || i < 0 || i >= len(features) {
+			t.Fatalf("Unexpected placemark ID '%s'", id)
+		}
+
+		f := features[i]
+
+		if pm.Name != f.Properties["title"] {
+			t.Fatalf("Unexpected name '%s' for %s", pm.Name, id)
+		}
+
+		if pm.Point == nil || pm.Point.Coordinates != kmlCoordinates([]orb.Point{f.Geometry.(orb.Point)}) {
+			t.Fatalf("Unexpected coordinates for %s", id)
+		}
+
+		if data["subjects"] != fmt.Sprintf("a;b%d", i) || data["count"] != fmt.Sprintf("%d", i) || data["flag"] != fmt.Sprintf("%t", i%2 == 0) {
+			t.Fatalf("Unexpected extended data for %s, %v", id, data)
+		}
+
+		if pm.Description == nil || !strings.Contains(pm.Description.Text, fmt.Sprintf(`<img src="%s"`, f.Properties["thumbnail"])) || !strings.Contains(pm.Description.Text, fmt.Sprintf(`<a href="%s">`, f.Properties["url"])) {
+			t.Fatalf("Unexpected description for %s", id)
+		}
+	}
+}
+
+func TestKMLEncoderEmpty(t *testing.T) {
+
+	body := encodeConcurrently(t, FORMAT_KML, nil, nil)
+
+	var doc kmlTestDocument
+
+	err := xml.Unmarshal(body, &doc)
+
+	if err != nil {
+		t.Fatalf("Failed to parse KML document, %v", err)
+	}
+
+	if len(doc.Document.Placemarks) != 0 {
+		t.Fatalf("Expected no placemarks")
+	}
+}
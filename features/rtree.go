@@ -0,0 +1,195 @@
+package features
+
+import (
+	"encoding/binary"
+	"github.com/paulmach/orb"
+	"math"
+	"sort"
+)
+
+// The size, in bytes, of a node in a packed Hilbert R-tree: four float64 bounds and a uint64 offset.
+const rtree_node_size int = 40
+
+// The maximum value of the (16-bit) coordinates used to derive Hilbert values.
+const hilbert_max float64 = float64((1 << 16) - 1)
+
+// rtreeNode is a node in a packed Hilbert R-tree. For leaf nodes 'offset' is the byte offset of a feature
+// relative to the start of the features section of a FlatGeobuf file and for all other nodes it is the index of
+// the node's first child.
+type rtreeNode struct {
+	bound  orb.Bound
+	offset uint64
+}
+
+// hilbertSort sorts 'items' by the Hilbert value of the center of their bounding boxes, relative to 'extent'.
+// The sort order (descending) matches the reference FlatGeobuf implementations.
+func hilbertSort(items []*fgbItem, extent orb.Bound) {
+
+	min_x := extent.Min.X()
+	min_y := extent.Min.Y()
+	width := extent.Max.X() - min_x
+	height := extent.Max.Y() - min_y
+
+	values := make(map[*fgbItem]uint32, len(items))
+
+	for _, i := range items {
+
+		var x uint32
+		var y uint32
+
+		if width != 0.0 {
+			x = uint32(math.Floor(hilbert_max * ((i.bound.Min.X()+i.bound.Max.X())/2.0 - min_x) / width))
+		}
+
+		if height != 0.0 {
+			y = uint32(math.Floor(hilbert_max * ((i.bound.Min.Y()+i.bound.Max.Y())/2.0 - min_y) / height))
+		}
+
+		values[i] = hilbert(x, y)
+	}
+
+	sort.SliceStable(items, func(a int, b int) bool {
+		return values[items[a]] > values[items[b]]
+	})
+}
+
+// levelBounds returns the [start, end) indices of each level of a packed R-tree, for 'num_items' leaf nodes and
+// a node size of 'node_size', starting with the leaf nodes. The root node is always at index 0.
+func levelBounds(num_items int, node_size int) [][2]int {
+
+	n := num_items
+	num_nodes := n
+
+	level_num_nodes := []int{n}
+
+	for {
+
+		n = (n + node_size - 1) / node_size
+		num_nodes += n
+		level_num_nodes = append(level_num_nodes, n)
+
+		if n == 1 {
+			break
+		}
+	}
+
+	bounds := make([][2]int, len(level_num_nodes))
+	n = num_nodes
+
+	for idx, size := range level_num_nodes {
+		bounds[idx] = [2]int{n - size, n}
+		n -= size
+	}
+
+	return bounds
+}
+
+// packedRTree returns the nodes of a packed Hilbert R-tree for 'items', which are expected to have been sorted
+// using hilbertSort and to have had their feature offsets assigned.
+func packedRTree(items []*fgbItem, node_size int) []*rtreeNode {
+
+	bounds := levelBounds(len(items), node_size)
+	num_nodes := bounds[0][1]
+
+	nodes := make([]*rtreeNode, num_nodes)
+
+	for idx, i := range items {
+		nodes[num_nodes-len(items)+idx] = &rtreeNode{
+			bound:  i.bound,
+			offset: i.feature_offset,
+		}
+	}
+
+	for level := 0; level < len(bounds)-1; level++ {
+
+		pos := bounds[level][0]
+		end := bounds[level][1]
+		parent := bounds[level+1][0]
+
+		for pos < end {
+
+			n := &rtreeNode{
+				bound:  nodes[pos].bound,
+				offset: uint64(pos),
+			}
+
+			for j := 0; j < node_size && pos < end; j++ {
+				n.bound = n.bound.Union(nodes[pos].bound)
+				pos += 1
+			}
+
+			nodes[parent] = n
+			parent += 1
+		}
+	}
+
+	return nodes
+}
+
+// encodeRTree returns the binary representation of 'nodes'.
+func encodeRTree(nodes []*rtreeNode) []byte {
+
+	buf := make([]byte, len(nodes)*rtree_node_size)
+
+	for idx, n := range nodes {
+
+		b := buf[idx*rtree_node_size:]
+
+		binary.LittleEndian.PutUint64(b[0:], math.Float64bits(n.bound.Min.X()))
+		binary.LittleEndian.PutUint64(b[8:], math.Float64bits(n.bound.Min.Y()))
+		binary.LittleEndian.PutUint64(b[16:], math.Float64bits(n.bound.Max.X()))
+		binary.LittleEndian.PutUint64(b[24:], math.Float64bits(n.bound.Max.Y()))
+		binary.LittleEndian.PutUint64(b[32:], n.offset)
+	}
+
+	return buf
+}
+
+// hilbert returns the Hilbert curve index of the 16-bit coordinates 'x' and 'y'. This is the branch-free
+// algorithm used by the reference FlatGeobuf implementations.
+func hilbert(x uint32, y uint32) uint32 {
+
+	a := x ^ y
+	b := 0xFFFF ^ a
+	c := 0xFFFF ^ (x | y)
+	d := x & (y ^ 0xFFFF)
+
+	A := a | (b >> 1)
+	B := (a >> 1) ^ a
+	C := ((c >> 1) ^ (b & (d >> 1))) ^ c
+	D := ((a & (c >> 1)) ^ (d >> 1)) ^ d
+
+	a, b, c, d = A, B, C, D
+	A = (a & (a >> 2)) ^ (b & (b >> 2))
+	B = (a & (b >> 2)) ^ (b & ((a ^ b) >> 2))
+	C ^= (a & (c >> 2)) ^ (b & (d >> 2))
+	D ^= (b & (c >> 2)) ^ ((a ^ b) & (d >> 2))
+
+	a, b, c, d = A, B, C, D
+	A = (a & (a >> 4)) ^ (b & (b >> 4))
+	B = (a & (b >> 4)) ^ (b & ((a ^ b) >> 4))
+	C ^= (a & (c >> 4)) ^ (b & (d >> 4))
+	D ^= (b & (c >> 4)) ^ ((a ^ b) & (d >> 4))
+
+	a, b, c, d = A, B, C, D
+	C ^= (a & (c >> 8)) ^ (b & (d >> 8))
+	D ^= (b & (c >> 8)) ^ ((a ^ b) & (d >> 8))
+
+	a = C ^ (C >> 1)
+	b = D ^ (D >> 1)
+
+	i0 := x ^ y
+	i1 := b | (0xFFFF ^ (i0 | a))
+
+	i0 = (i0 | (i0 << 8)) & 0x00FF00FF
+	i0 = (i0 | (i0 << 4)) & 0x0F0F0F0F
+	i0 = (i0 | (i0 << 2)) & 0x33333333
+	i0 = (i0 | (i0 << 1)) & 0x55555555
+
+	i1 = (i1 | (i1 << 8)) & 0x00FF00FF
+	i1 = (i1 | (i1 << 4)) & 0x0F0F0F0F
+	i1 = (i1 | (i1 << 2)) & 0x33333333
+	i1 = (i1 | (i1 << 1)) & 0x55555555
+
+	return (i1 << 1) | i0
+}
@@ -0,0 +1,354 @@
+package geotag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BlobStore is a Store that stores the current revision of each Geotag as a "{ID}.json" document in a GoCloud bucket
+// and every revision as a "history/{ID}/{REVISION}.json" document. The most recent revision number, which is still
+// needed once a Geotag has been deleted, is stored in a "history/{ID}/latest" document.
+type BlobStore struct {
+	bucket *blob.Bucket
+	mu     *sync.Mutex
+}
+
+// NewBlobStore returns a new BlobStore for the GoCloud bucket URI 'uri'.
+func NewBlobStore(ctx context.Context, uri string) (Store, error) {
+
+	bucket, err := blob.OpenBucket(ctx, uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open bucket, %w", err)
+	}
+
+	s := &BlobStore{
+		bucket: bucket,
+		mu:     new(sync.Mutex),
+	}
+
+	return s, nil
+}
+
+// Put writes 'g' to the bucket as both the current and a new historical revision.
+func (s *BlobStore) Put(ctx context.Context, g *Geotag) error {
+
+	err := g.Validate()
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.Get(ctx, g.ID)
+
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+
+	latest, err := s.latestRevision(ctx, g.ID)
+
+	if err != nil {
+		return err
+	}
+
+	g.Deleted = false
+	revise(g, latest, current)
+
+	err = s.write(ctx, historyKey(g.ID, g.Revision), g)
+
+	if err != nil {
+		return err
+	}
+
+	err = s.writeLatestRevision(ctx, g.ID, g.Revision)
+
+	if err != nil {
+		return err
+	}
+
+	return s.write(ctx, key(g.ID), g)
+}
+
+// Get reads the current revision of the Geotag for 'id' from the bucket.
+func (s *BlobStore) Get(ctx context.Context, id string) (*Geotag, error) {
+
+	if !ValidID(id) {
+		return nil, ErrNotFound
+	}
+
+	return s.read(ctx, key(id))
+}
+
+// List reads the current revision of every Geotag in the bucket.
+func (s *BlobStore) List(ctx context.Context) ([]*Geotag, error) {
+
+	ids, err := s.IDs(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	geotags := make([]*Geotag, 0, len(ids))
+
+	for _, id := range ids {
+
+		g, err := s.read(ctx, key(id))
+
+		if err != nil {
+			return nil, err
+		}
+
+		geotags = append(geotags, g)
+	}
+
+	return geotags, nil
+}
+
+// IDs returns the ID of every Geotag in the bucket, derived from the keys of their current revisions.
+func (s *BlobStore) IDs(ctx context.Context) ([]string, error) {
+
+	ids := make([]string, 0)
+
+	opts := &blob.ListOptions{
+		Delimiter: "/",
+	}
+
+	iter := s.bucket.List(opts)
+
+	for {
+
+		obj, err := iter.Next(ctx)
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list geotags, %w", err)
+		}
+
+		if obj.IsDir || filepath.Ext(obj.Key) != ".json" {
+			continue
+		}
+
+		ids = append(ids, strings.TrimSuffix(obj.Key, ".json"))
+	}
+
+	return ids, nil
+}
+
+// Delete removes the current revision of the Geotag for 'id' from the bucket and records a deleted revision,
+// attributed to 'contributor', in its history.
+func (s *BlobStore) Delete(ctx context.Context, id string, contributor string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, err := s.Get(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	latest, err := s.latestRevision(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	g := &Geotag{
+		ID:          id,
+		Contributor: contributor,
+		Deleted:     true,
+	}
+
+	revise(g, latest, current)
+
+	err = s.write(ctx, historyKey(id, g.Revision), g)
+
+	if err != nil {
+		return err
+	}
+
+	err = s.writeLatestRevision(ctx, id, g.Revision)
+
+	if err != nil {
+		return err
+	}
+
+	err = s.bucket.Delete(ctx, key(id))
+
+	if err != nil {
+		return fmt.Errorf("Failed to delete geotag %s, %w", id, err)
+	}
+
+	return nil
+}
+
+// History reads every revision of the Geotag for 'id' from the bucket.
+func (s *BlobStore) History(ctx context.Context, id string) ([]*Geotag, error) {
+
+	if !ValidID(id) {
+		return nil, ErrNotFound
+	}
+
+	revisions := make([]*Geotag, 0)
+
+	opts := &blob.ListOptions{
+		Prefix: historyPrefix(id),
+	}
+
+	iter := s.bucket.List(opts)
+
+	for {
+
+		obj, err := iter.Next(ctx)
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list revisions for %s, %w", id, err)
+		}
+
+		if filepath.Ext(obj.Key) != ".json" {
+			continue
+		}
+
+		g, err := s.read(ctx, obj.Key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, g)
+	}
+
+	if len(revisions) == 0 {
+		return nil, ErrNotFound
+	}
+
+	// Revision keys are zero-padded so the bucket lists them in order
+
+	return revisions, nil
+}
+
+// Close closes the underlying bucket.
+func (s *BlobStore) Close() error {
+	return s.bucket.Close()
+}
+
+// latestRevision returns the most recent revision number for 'id', or 0 if there are no revisions.
+func (s *BlobStore) latestRevision(ctx context.Context, id string) (int, error) {
+
+	k := latestKey(id)
+
+	body, err := s.bucket.ReadAll(ctx, k)
+
+	if err == nil {
+
+		latest, err := strconv.Atoi(strings.TrimSpace(string(body)))
+
+		if err != nil {
+			return 0, fmt.Errorf("Invalid revision in %s, %w", k, err)
+		}
+
+		return latest, nil
+	}
+
+	if gcerrors.Code(err) == gcerrors.NotFound {
+		return 0, nil
+	}
+
+	return 0, fmt.Errorf("Failed to read %s, %w", k, err)
+}
+
+func (s *BlobStore) writeLatestRevision(ctx context.Context, id string, revision int) error {
+
+	k := latestKey(id)
+
+	opts := &blob.WriterOptions{
+		ContentType: "text/plain",
+	}
+
+	err := s.bucket.WriteAll(ctx, k, []byte(strconv.Itoa(revision)), opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write %s, %w", k, err)
+	}
+
+	return nil
+}
+
+func (s *BlobStore) read(ctx context.Context, k string) (*Geotag, error) {
+
+	body, err := s.bucket.ReadAll(ctx, k)
+
+	if err != nil {
+
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("Failed to read %s, %w", k, err)
+	}
+
+	var g *Geotag
+
+	err = json.Unmarshal(body, &g)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal %s, %w", k, err)
+	}
+
+	return g, nil
+}
+
+func (s *BlobStore) write(ctx context.Context, k string, g *Geotag) error {
+
+	body, err := json.Marshal(g)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal geotag, %w", err)
+	}
+
+	opts := &blob.WriterOptions{
+		ContentType: "application/json",
+	}
+
+	err = s.bucket.WriteAll(ctx, k, body, opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write %s, %w", k, err)
+	}
+
+	return nil
+}
+
+func key(id string) string {
+	return id + ".json"
+}
+
+func historyPrefix(id string) string {
+	return "history/" + id + "/"
+}
+
+func latestKey(id string) string {
+	return historyPrefix(id) + "latest"
+}
+
+func historyKey(id string, revision int) string {
+	return historyPrefix(id) + fmt.Sprintf("%08d", revision) + ".json"
+}
@@ -0,0 +1,28 @@
+package geotag
+
+import (
+	"context"
+	_ "gocloud.dev/blob/memblob"
+	"testing"
+)
+
+func TestBlobStore(t *testing.T) {
+
+	ctx := context.Background()
+
+	store, err := NewBlobStore(ctx, "mem://")
+
+	if err != nil {
+		t.Fatalf("Failed to create store, %v", err)
+	}
+
+	defer store.Close()
+
+	testStore(t, store)
+
+	latest, err := store.(*BlobStore).latestRevision(ctx, "2005691196")
+
+	if err != nil || latest != 5 {
+		t.Fatalf("Unexpected latest revision %d, %v", latest, err)
+	}
+}
@@ -0,0 +1,109 @@
+package geotag
+
+import (
+	"context"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/features"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"io"
+)
+
+// The prefix for the properties describing a geotag in exported GeoJSON features.
+const PROPERTY_PREFIX string = "geotag:"
+
+// Point returns the location of what 'g' depicts: its target, or the middle of its target field of view, or its
+// camera if it has no target.
+func (g *Geotag) Point() (orb.Point, bool) {
+
+	if g.Target != nil {
+
+		switch geom := g.Target.Geometry().(type) {
+		case orb.Point:
+			return geom, true
+		case orb.LineString:
+
+			if len(geom) > 1 {
+
+				a := geom[0]
+				b := geom[len(geom)-1]
+
+				return orb.Point{(a.Lon() + b.Lon()) / 2.0, (a.Lat() + b.Lat()) / 2.0}, true
+			}
+		}
+	}
+
+	if g.Camera != nil {
+
+		pt, ok := g.Camera.Geometry().(orb.Point)
+
+		if ok {
+			return pt, true
+		}
+	}
+
+	return orb.Point{}, false
+}
+
+// Feature returns a GeoJSON Feature for 'g', located at its Point, whose properties are compatible with the output
+// of the featurecollection tool: "item.id" is the ID of the record that was geotagged and "latlong" is a
+// [LATITUDE, LONGITUDE] pair. The camera, target, contributor, revision and timestamps of 'g' are included as
+// properties prefixed with PROPERTY_PREFIX.
+func (g *Geotag) Feature() (*geojson.Feature, error) {
+
+	pt, ok := g.Point()
+
+	if !ok {
+		return nil, fmt.Errorf("Geotag %s does not have a location", g.ID)
+	}
+
+	f := geojson.NewFeature(pt)
+
+	f.Properties = geojson.Properties{
+		"item": map[string]interface{}{
+			"id": g.ID,
+		},
+		"latlong":                       []float64{pt.Lat(), pt.Lon()},
+		PROPERTY_PREFIX + "camera":      g.Camera,
+		PROPERTY_PREFIX + "contributor": g.Contributor,
+		PROPERTY_PREFIX + "revision":    g.Revision,
+		PROPERTY_PREFIX + "created":     g.Created,
+		PROPERTY_PREFIX + "updated":     g.Updated,
+	}
+
+	if g.Target != nil {
+		f.Properties[PROPERTY_PREFIX+"target"] = g.Target
+	}
+
+	return f, nil
+}
+
+// WriteFeatureCollection writes the current revision of every Geotag in 'store' to 'wr' as a GeoJSON
+// FeatureCollection (see Feature).
+func WriteFeatureCollection(ctx context.Context, store Store, wr io.Writer) error {
+
+	geotags, err := store.List(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	enc := features.NewGeoJSONEncoder(wr)
+
+	for _, g := range geotags {
+
+		f, err := g.Feature()
+
+		if err != nil {
+			return err
+		}
+
+		err = enc.Encode(f)
+
+		if err != nil {
+			return fmt.Errorf("Failed to write feature for %s, %w", g.ID, err)
+		}
+	}
+
+	return enc.Close()
+}
@@ -0,0 +1,98 @@
+// package geotag provides methods for recording, and storing, where the photographs in Library of Congress records
+// were taken from (the camera) and what they depict (the target).
+package geotag
+
+import (
+	"errors"
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"regexp"
+)
+
+// ErrNotFound is returned by Store implementations when a geotag does not exist.
+var ErrNotFound = errors.New("Geotag not found")
+
+var re_id = regexp.MustCompile(`^[A-Za-z0-9_\-\.]+$`)
+
+// Geotag is the camera and target locations for a Library of Congress record.
+type Geotag struct {
+	// The 'item.id' property of the record being geotagged.
+	ID string `json:"id"`
+	// The location of the camera. This must be a Point geometry.
+	Camera *geojson.Geometry `json:"camera"`
+	// The location of the subject of the photograph. This must be a Point geometry or a LineString geometry
+	// describing the camera's field of view (as produced by Leaflet.GeotagPhoto).
+	Target *geojson.Geometry `json:"target,omitempty"`
+	// The name, or other identifier, of the person who contributed this revision of the geotag.
+	Contributor string `json:"contributor,omitempty"`
+	// The revision number of the geotag, assigned by the Store. The first revision is 1.
+	Revision int `json:"revision"`
+	// True if this revision records the geotag being deleted. Deleted revisions only appear in a geotag's history.
+	Deleted bool `json:"deleted,omitempty"`
+	// The Unix timestamp when the geotag was created.
+	Created int64 `json:"created"`
+	// The Unix timestamp when the geotag was last updated.
+	Updated int64 `json:"updated"`
+}
+
+// ValidID returns true if 'id' is a valid (and safe to use as a filename) record ID.
+func ValidID(id string) bool {
+	return re_id.MatchString(id) && id != "." && id != ".."
+}
+
+// Validate returns an error if 'g' is missing an ID or a camera location or its geometries are not valid.
+func (g *Geotag) Validate() error {
+
+	if !ValidID(g.ID) {
+		return fmt.Errorf("Invalid ID '%s'", g.ID)
+	}
+
+	if g.Camera == nil {
+		return fmt.Errorf("Missing camera")
+	}
+
+	pt, ok := g.Camera.Geometry().(orb.Point)
+
+	if !ok {
+		return fmt.Errorf("Camera must be a Point geometry")
+	}
+
+	if !validPoint(pt) {
+		return fmt.Errorf("Invalid camera coordinates")
+	}
+
+	if g.Target == nil {
+		return nil
+	}
+
+	switch geom := g.Target.Geometry().(type) {
+	case orb.Point:
+
+		if !validPoint(geom) {
+			return fmt.Errorf("Invalid target coordinates")
+		}
+
+	case orb.LineString:
+
+		if len(geom) < 2 {
+			return fmt.Errorf("Target field of view must have at least two points")
+		}
+
+		for _, pt := range geom {
+
+			if !validPoint(pt) {
+				return fmt.Errorf("Invalid target coordinates")
+			}
+		}
+
+	default:
+		return fmt.Errorf("Target must be a Point or LineString geometry")
+	}
+
+	return nil
+}
+
+func validPoint(pt orb.Point) bool {
+	return pt.Lat() >= -90.0 && pt.Lat() <= 90.0 && pt.Lon() >= -180.0 && pt.Lon() <= 180.0
+}
@@ -0,0 +1,356 @@
+package geotag
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"net/url"
+)
+
+// SQLITE_SCHEMA is the set of SQL statements used to create the SQLiteStore tables.
+var SQLITE_SCHEMA = []string{
+	`CREATE TABLE IF NOT EXISTS geotags (
+		id TEXT PRIMARY KEY,
+		revision INTEGER NOT NULL,
+		contributor TEXT,
+		created INTEGER NOT NULL,
+		updated INTEGER NOT NULL,
+		body TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS geotag_revisions (
+		id TEXT NOT NULL,
+		revision INTEGER NOT NULL,
+		contributor TEXT,
+		deleted INTEGER NOT NULL DEFAULT 0,
+		updated INTEGER NOT NULL,
+		body TEXT NOT NULL,
+		PRIMARY KEY (id, revision)
+	)`,
+	`CREATE INDEX IF NOT EXISTS geotag_revisions_by_contributor ON geotag_revisions (contributor)`,
+}
+
+// SQLiteStore is a Store that stores Geotags in a SQLite database, with the current revision of each Geotag in a
+// "geotags" table and every revision in a "geotag_revisions" table.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore returns a new SQLiteStore for the database at 'path', creating it if necessary.
+func NewSQLiteStore(ctx context.Context, path string) (Store, error) {
+
+	if path == "" {
+		return nil, fmt.Errorf("Missing database path")
+	}
+
+	// The path is escaped so that characters like "?", "#" or "%" are not mistaken for parts of the URI
+
+	u := &url.URL{Path: path}
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000", u.EscapedPath()))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s, %w", path, err)
+	}
+
+	// SQLite only supports a single writer so serialize access to the database
+
+	db.SetMaxOpenConns(1)
+
+	for _, q := range SQLITE_SCHEMA {
+
+		_, err := db.ExecContext(ctx, q)
+
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("Failed to create schema, %w", err)
+		}
+	}
+
+	s := &SQLiteStore{
+		db: db,
+	}
+
+	return s, nil
+}
+
+// Put writes 'g' to the database as both the current and a new historical revision.
+func (s *SQLiteStore) Put(ctx context.Context, g *Geotag) error {
+
+	err := g.Validate()
+
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction, %w", err)
+	}
+
+	defer tx.Rollback()
+
+	current, latest, err := s.state(ctx, tx, g.ID)
+
+	if err != nil {
+		return err
+	}
+
+	g.Deleted = false
+	revise(g, latest, current)
+
+	body, err := json.Marshal(g)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal geotag, %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO geotag_revisions (id, revision, contributor, deleted, updated, body) VALUES (?, ?, ?, 0, ?, ?)",
+		g.ID, g.Revision, g.Contributor, g.Updated, string(body))
+
+	if err != nil {
+		return fmt.Errorf("Failed to store revision for %s, %w", g.ID, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT OR REPLACE INTO geotags (id, revision, contributor, created, updated, body) VALUES (?, ?, ?, ?, ?, ?)",
+		g.ID, g.Revision, g.Contributor, g.Created, g.Updated, string(body))
+
+	if err != nil {
+		return fmt.Errorf("Failed to store geotag %s, %w", g.ID, err)
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return fmt.Errorf("Failed to commit transaction, %w", err)
+	}
+
+	return nil
+}
+
+// Get returns the current revision of the Geotag for 'id' from the database.
+func (s *SQLiteStore) Get(ctx context.Context, id string) (*Geotag, error) {
+
+	var body string
+
+	err := s.db.QueryRowContext(ctx, "SELECT body FROM geotags WHERE id = ?", id).Scan(&body)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve geotag %s, %w", id, err)
+	}
+
+	return unmarshal(body)
+}
+
+// List returns the current revision of every Geotag in the database, ordered by ID.
+func (s *SQLiteStore) List(ctx context.Context) ([]*Geotag, error) {
+	return s.query(ctx, "SELECT body FROM geotags ORDER BY id")
+}
+
+// IDs returns the ID of every Geotag in the database, ordered by ID.
+func (s *SQLiteStore) IDs(ctx context.Context) ([]string, error) {
+
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM geotags ORDER BY id")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query geotags, %w", err)
+	}
+
+	defer rows.Close()
+
+	ids := make([]string, 0)
+
+	for rows.Next() {
+
+		var id string
+
+		err := rows.Scan(&id)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan row, %w", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate rows, %w", err)
+	}
+
+	return ids, nil
+}
+
+// Delete removes the current revision of the Geotag for 'id' from the database and records a deleted revision,
+// attributed to 'contributor', in its history.
+func (s *SQLiteStore) Delete(ctx context.Context, id string, contributor string) error {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return fmt.Errorf("Failed to begin transaction, %w", err)
+	}
+
+	defer tx.Rollback()
+
+	current, latest, err := s.state(ctx, tx, id)
+
+	if err != nil {
+		return err
+	}
+
+	if current == nil {
+		return ErrNotFound
+	}
+
+	g := &Geotag{
+		ID:          id,
+		Contributor: contributor,
+		Deleted:     true,
+	}
+
+	revise(g, latest, current)
+
+	body, err := json.Marshal(g)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal geotag, %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO geotag_revisions (id, revision, contributor, deleted, updated, body) VALUES (?, ?, ?, 1, ?, ?)",
+		id, g.Revision, contributor, g.Updated, string(body))
+
+	if err != nil {
+		return fmt.Errorf("Failed to store revision for %s, %w", id, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM geotags WHERE id = ?", id)
+
+	if err != nil {
+		return fmt.Errorf("Failed to delete geotag %s, %w", id, err)
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return fmt.Errorf("Failed to commit transaction, %w", err)
+	}
+
+	return nil
+}
+
+// History returns every revision of the Geotag for 'id' from the database, oldest first.
+func (s *SQLiteStore) History(ctx context.Context, id string) ([]*Geotag, error) {
+
+	revisions, err := s.query(ctx, "SELECT body FROM geotag_revisions WHERE id = ? ORDER BY revision", id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(revisions) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return revisions, nil
+}
+
+// Close closes the database.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// state returns the current revision of the Geotag for 'id', or nil, and the number of its most recent revision
+// of any kind, or 0.
+func (s *SQLiteStore) state(ctx context.Context, tx *sql.Tx, id string) (*Geotag, int, error) {
+
+	var current *Geotag
+	var body string
+
+	err := tx.QueryRowContext(ctx, "SELECT body FROM geotags WHERE id = ?", id).Scan(&body)
+
+	switch {
+	case err == sql.ErrNoRows:
+		// pass
+	case err != nil:
+		return nil, 0, fmt.Errorf("Failed to retrieve geotag %s, %w", id, err)
+	default:
+
+		g, err := unmarshal(body)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		current = g
+	}
+
+	var latest sql.NullInt64
+
+	err = tx.QueryRowContext(ctx, "SELECT MAX(revision) FROM geotag_revisions WHERE id = ?", id).Scan(&latest)
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to retrieve latest revision for %s, %w", id, err)
+	}
+
+	return current, int(latest.Int64), nil
+}
+
+func (s *SQLiteStore) query(ctx context.Context, q string, args ...interface{}) ([]*Geotag, error) {
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query geotags, %w", err)
+	}
+
+	defer rows.Close()
+
+	geotags := make([]*Geotag, 0)
+
+	for rows.Next() {
+
+		var body string
+
+		err := rows.Scan(&body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan row, %w", err)
+		}
+
+		g, err := unmarshal(body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		geotags = append(geotags, g)
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to iterate rows, %w", err)
+	}
+
+	return geotags, nil
+}
+
+func unmarshal(body string) (*Geotag, error) {
+
+	var g *Geotag
+
+	err := json.Unmarshal([]byte(body), &g)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal geotag, %w", err)
+	}
+
+	return g, nil
+}
@@ -0,0 +1,22 @@
+package geotag
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteStore(t *testing.T) {
+
+	ctx := context.Background()
+
+	store, err := NewSQLiteStore(ctx, filepath.Join(t.TempDir(), "geotags.db"))
+
+	if err != nil {
+		t.Fatalf("Failed to create store, %v", err)
+	}
+
+	defer store.Close()
+
+	testStore(t, store)
+}
@@ -0,0 +1,61 @@
+package geotag
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Store is an interface for persisting Geotag records, keyed by their ID, along with every revision made to them.
+type Store interface {
+	// Put creates, or updates, a Geotag assigning it the next revision number and its Created and Updated timestamps.
+	Put(context.Context, *Geotag) error
+	// Get returns the current revision of the Geotag for an ID or ErrNotFound.
+	Get(context.Context, string) (*Geotag, error)
+	// List returns the current revision of all the Geotags in the store.
+	List(context.Context) ([]*Geotag, error)
+	// IDs returns the IDs of all the Geotags in the store, without reading the Geotags themselves.
+	IDs(context.Context) ([]string, error)
+	// Delete removes the Geotag for an ID, recording the deletion (and the contributor who deleted it) in its history,
+	// or returns ErrNotFound.
+	Delete(context.Context, string, string) error
+	// History returns every revision of the Geotag for an ID, oldest first, or ErrNotFound.
+	History(context.Context, string) ([]*Geotag, error)
+	// Close releases any resources used by the store.
+	Close() error
+}
+
+// NewStore returns a new Store instance for 'uri'. URIs with a sqlite:// scheme (for example
+// sqlite:///usr/local/data/geotags.db) return a SQLiteStore. Any other URI is treated as a GoCloud bucket URI
+// (for example file:///usr/local/data/geotags) and returns a BlobStore.
+func NewStore(ctx context.Context, uri string) (Store, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse store URI, %w", err)
+	}
+
+	switch u.Scheme {
+	case "sqlite":
+		return NewSQLiteStore(ctx, u.Host+u.Path)
+	default:
+		return NewBlobStore(ctx, uri)
+	}
+}
+
+// revise assigns the revision number following 'latest' (the most recent revision of any kind, or 0) to 'g' and
+// sets its Updated timestamp. Created is inherited from 'current' (the current revision, if there is one).
+func revise(g *Geotag, latest int, current *Geotag) {
+
+	now := time.Now().Unix()
+
+	g.Revision = latest + 1
+	g.Created = now
+	g.Updated = now
+
+	if current != nil {
+		g.Created = current.Created
+	}
+}
@@ -0,0 +1,208 @@
+package geotag
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"reflect"
+	"testing"
+)
+
+// testStore checks that 'store', which must be empty, assigns revisions, records deletions and reports its
+// contents the way every Store implementation is expected to.
+func testStore(t *testing.T, store Store) {
+
+	ctx := context.Background()
+
+	put := func(id string, contributor string, target *geojson.Geometry) *Geotag {
+
+		g := &Geotag{
+			ID:          id,
+			Camera:      geojson.NewGeometry(orb.Point{-77.0365, 38.8977}),
+			Target:      target,
+			Contributor: contributor,
+		}
+
+		err := store.Put(ctx, g)
+
+		if err != nil {
+			t.Fatalf("Failed to put geotag %s, %v", id, err)
+		}
+
+		return g
+	}
+
+	_, err := store.Get(ctx, "2005691196")
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected missing geotag to return ErrNotFound, got %v", err)
+	}
+
+	_, err = store.History(ctx, "2005691196")
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected missing history to return ErrNotFound, got %v", err)
+	}
+
+	err = store.Delete(ctx, "2005691196", "a")
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected deleting a missing geotag to return ErrNotFound, got %v", err)
+	}
+
+	err = store.Put(ctx, &Geotag{ID: "../2005691196", Camera: geojson.NewGeometry(orb.Point{-77.0365, 38.8977})})
+
+	if err == nil {
+		t.Fatalf("Expected invalid geotag to be rejected")
+	}
+
+	first := put("2005691196", "a", nil)
+
+	if first.Revision != 1 || first.Created == 0 || first.Updated != first.Created {
+		t.Fatalf("Unexpected first revision %v", first)
+	}
+
+	put("2005691196", "b", geojson.NewGeometry(orb.Point{-77.0353, 38.8895}))
+
+	err = store.Delete(ctx, "2005691196", "c")
+
+	if err != nil {
+		t.Fatalf("Failed to delete geotag, %v", err)
+	}
+
+	_, err = store.Get(ctx, "2005691196")
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected deleted geotag to be missing, got %v", err)
+	}
+
+	err = store.Delete(ctx, "2005691196", "c")
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected deleting a deleted geotag to return ErrNotFound, got %v", err)
+	}
+
+	ids, err := store.IDs(ctx)
+
+	if err != nil || len(ids) != 0 {
+		t.Fatalf("Expected deleted geotag to be excluded from IDs, %v, %v", ids, err)
+	}
+
+	// Revision numbers continue after a deletion
+
+	put("2005691196", "d", nil)
+
+	fov := geojson.NewGeometry(orb.LineString{{-77.04, 38.89}, {-77.03, 38.89}})
+	put("2005691196", "e", fov)
+
+	put("2005689966", "f", nil)
+
+	history, err := store.History(ctx, "2005691196")
+
+	if err != nil {
+		t.Fatalf("Failed to read history, %v", err)
+	}
+
+	expected := []string{"a", "b", "c", "d", "e"}
+
+	if len(history) != len(expected) {
+		t.Fatalf("Expected %d revisions, got %d", len(expected), len(history))
+	}
+
+	for idx, g := range history {
+
+		if g.Revision != idx+1 || g.Contributor != expected[idx] || g.Deleted != (expected[idx] == "c") {
+			t.Fatalf("Unexpected revision %d, %v", idx, g)
+		}
+	}
+
+	if history[1].Target == nil || history[3].Target != nil {
+		t.Fatalf("Unexpected targets in history")
+	}
+
+	current, err := store.Get(ctx, "2005691196")
+
+	if err != nil {
+		t.Fatalf("Failed to get geotag, %v", err)
+	}
+
+	if current.Revision != 5 || current.Contributor != "e" || current.Deleted || current.Created != first.Created {
+		t.Fatalf("Unexpected current revision %v", current)
+	}
+
+	ids, err = store.IDs(ctx)
+
+	if err != nil || !reflect.DeepEqual(ids, []string{"2005689966", "2005691196"}) {
+		t.Fatalf("Unexpected IDs %v, %v", ids, err)
+	}
+
+	geotags, err := store.List(ctx)
+
+	if err != nil || len(geotags) != 2 || geotags[0].ID != "2005689966" || geotags[1].Revision != 5 {
+		t.Fatalf("Unexpected list of geotags, %v", err)
+	}
+
+	// Exported features are located at the middle of the target field of view, or the camera
+
+	var buf bytes.Buffer
+
+	err = WriteFeatureCollection(ctx, store, &buf)
+
+	if err != nil {
+		t.Fatalf("Failed to write feature collection, %v", err)
+	}
+
+	fc, err := geojson.UnmarshalFeatureCollection(buf.Bytes())
+
+	if err != nil {
+		t.Fatalf("Failed to parse feature collection, %v", err)
+	}
+
+	if len(fc.Features) != 2 {
+		t.Fatalf("Expected 2 features, got %d", len(fc.Features))
+	}
+
+	f := fc.Features[1]
+
+	if !f.Geometry.(orb.Point).Equal(orb.Point{-77.035, 38.89}) {
+		t.Fatalf("Unexpected location %v", f.Geometry)
+	}
+
+	if f.Properties.MustString(PROPERTY_PREFIX+"contributor") != "e" || f.Properties.MustInt(PROPERTY_PREFIX+"revision") != 5 {
+		t.Fatalf("Unexpected properties %v", f.Properties)
+	}
+
+	if f.Properties.MustInt(PROPERTY_PREFIX+"created") != int(first.Created) {
+		t.Fatalf("Unexpected created timestamp %v", f.Properties[PROPERTY_PREFIX+"created"])
+	}
+
+	item, ok := f.Properties["item"].(map[string]interface{})
+
+	if !ok || item["id"] != "2005691196" {
+		t.Fatalf("Unexpected item %v", f.Properties["item"])
+	}
+
+	if !reflect.DeepEqual(f.Properties["latlong"], []interface{}{38.89, -77.035}) {
+		t.Fatalf("Unexpected latlong %v", f.Properties["latlong"])
+	}
+
+	_, ok = f.Properties[PROPERTY_PREFIX+"target"]
+
+	if !ok {
+		t.Fatalf("Missing target property")
+	}
+
+	f = fc.Features[0]
+
+	if !f.Geometry.(orb.Point).Equal(orb.Point{-77.0365, 38.8977}) {
+		t.Fatalf("Expected geotag without a target to be located at its camera, %v", f.Geometry)
+	}
+
+	_, ok = f.Properties[PROPERTY_PREFIX+"target"]
+
+	if ok {
+		t.Fatalf("Unexpected target property")
+	}
+}
@@ -0,0 +1,147 @@
+package www
+
+import (
+	"github.com/aaronland/go-libraryofcongress-datajam/geotag"
+	"github.com/aaronland/go-libraryofcongress-datajam/spatial"
+	"github.com/tidwall/gjson"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Summary is the subset of a Library of Congress record displayed by the geotagging UI.
+type Summary struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Date        string   `json:"date,omitempty"`
+	URL         string   `json:"url,omitempty"`
+	Location    []string `json:"location,omitempty"`
+	Description []string `json:"description,omitempty"`
+	Images      []string `json:"images,omitempty"`
+}
+
+// Records is an ordered set of records to geotag. It is safe for concurrent use.
+type Records struct {
+	mu        *sync.RWMutex
+	summaries []*Summary
+	by_id     map[string]*Summary
+}
+
+// NewRecords returns a new, empty, Records instance.
+func NewRecords() *Records {
+
+	r := &Records{
+		mu:        new(sync.RWMutex),
+		summaries: make([]*Summary, 0),
+		by_id:     make(map[string]*Summary),
+	}
+
+	return r
+}
+
+// Add adds the JSON record 'body' to 'r' if it has a valid 'item.id' property and no usable coordinates, as derived by spatial.Locate. It returns
+// true if the record was added.
+func (r *Records) Add(body []byte) bool {
+
+	_, err := spatial.Locate(body)
+
+	if err == nil {
+		return false
+	}
+
+	id := gjson.GetBytes(body, "item.id").String()
+
+	if !geotag.ValidID(id) {
+		return false
+	}
+
+	s := &Summary{
+		ID:          id,
+		Title:       gjson.GetBytes(body, "title").String(),
+		Date:        gjson.GetBytes(body, "date").String(),
+		URL:         gjson.GetBytes(body, "url").String(),
+		Location:    stringValues(body, "location"),
+		Description: stringValues(body, "description"),
+		Images:      make([]string, 0),
+	}
+
+	for _, im := range stringValues(body, "image_url") {
+
+		// Strip the "#h={HEIGHT}&w={WIDTH}" fragment
+
+		im = strings.SplitN(im, "#", 2)[0]
+		s.Images = append(s.Images, im)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, exists := r.by_id[id]
+
+	if exists {
+		return false
+	}
+
+	r.by_id[id] = s
+	r.summaries = append(r.summaries, s)
+
+	return true
+}
+
+// Sort sorts the records in 'r' by ID so that they are listed in a stable order.
+func (r *Records) Sort() {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sort.Slice(r.summaries, func(i, j int) bool {
+		return r.summaries[i].ID < r.summaries[j].ID
+	})
+}
+
+// Count returns the number of records in 'r'.
+func (r *Records) Count() int {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.summaries)
+}
+
+// Get returns the record with ID 'id' and a boolean indicating whether it exists.
+func (r *Records) Get(id string) (*Summary, bool) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.by_id[id]
+	return s, ok
+}
+
+// All returns every record in 'r', in order.
+func (r *Records) All() []*Summary {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	all := make([]*Summary, len(r.summaries))
+	copy(all, r.summaries)
+
+	return all
+}
+
+func stringValues(body []byte, path string) []string {
+
+	values := make([]string, 0)
+
+	for _, r := range gjson.GetBytes(body, path).Array() {
+
+		v := strings.TrimSpace(r.String())
+
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,82 @@
+package www
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordsAdd(t *testing.T) {
+
+	r := NewRecords()
+
+	tests := []struct {
+		body  string
+		added bool
+	}{
+		{`{"item": {"id": "2005691196"}, "title": "Capitol", "image_url": ["https://tile.loc.gov/a.jpg#h=100&w=150", " "], "location": ["washington (d.c.)", ""]}`, true},
+		{`{"item": {"id": "2005691196"}, "title": "Duplicate"}`, false},
+		{`{"item": {"id": "2005691197"}, "latlong": "38.8895,-77.0353"}`, false},
+		{`{"item": {"id": "2005691198", "place": [{"title": "Nowhere"}]}}`, true},
+		{`{"item": {"id": "../2005691199"}}`, false},
+		{`{"title": "Missing ID"}`, false},
+		{`{"item": {"id": "2005691200"}, "coordinates": "38.8895,-77.0353"}`, false},
+	}
+
+	for _, test := range tests {
+
+		added := r.Add([]byte(test.body))
+
+		if added != test.added {
+			t.Fatalf("Expected Add to return %t for %s", test.added, test.body)
+		}
+	}
+
+	if r.Count() != 2 {
+		t.Fatalf("Expected 2 records, got %d", r.Count())
+	}
+
+	s, ok := r.Get("2005691196")
+
+	if !ok {
+		t.Fatalf("Expected record 2005691196")
+	}
+
+	expected := &Summary{
+		ID:          "2005691196",
+		Title:       "Capitol",
+		Location:    []string{"washington (d.c.)"},
+		Description: []string{},
+		Images:      []string{"https://tile.loc.gov/a.jpg"},
+	}
+
+	if !reflect.DeepEqual(s, expected) {
+		t.Fatalf("Unexpected summary %+v", s)
+	}
+
+	_, ok = r.Get("2005691197")
+
+	if ok {
+		t.Fatalf("Expected record with coordinates to be skipped")
+	}
+}
+
+func TestRecordsSort(t *testing.T) {
+
+	r := NewRecords()
+
+	for _, id := range []string{"c", "a", "b"} {
+		r.Add([]byte(`{"item": {"id": "` + id + `"}}`))
+	}
+
+	r.Sort()
+
+	ids := make([]string, 0)
+
+	for _, s := range r.All() {
+		ids = append(ids, s.ID)
+	}
+
+	if !reflect.DeepEqual(ids, []string{"a", "b", "c"}) {
+		t.Fatalf("Unexpected order %v", ids)
+	}
+}
@@ -0,0 +1,660 @@
+// A minimal, dependency-free, slippy map for recording the camera and target locations of Library of
+// Congress records. It works without a network connection: if no tile URL is configured a graticule is
+// drawn instead of a basemap.
+//
+// Leaflet and Leaflet.GeotagPhoto are not vendored (they could not be fetched when this was written) so the
+// field of view is drawn here instead. Like Leaflet.GeotagPhoto it is saved as a LineString whose two points
+// are the edges of the view at the target's distance from the camera.
+
+(function() {
+
+    var TILE_SIZE = 256;
+    var MIN_ZOOM = 1;
+    var MAX_ZOOM = 19;
+
+    // The zoom level at which fields of view are calculated, so they do not depend on the map's zoom
+    var FOV_ZOOM = 20;
+    var DEFAULT_ANGLE = 45;
+    var MAX_ANGLE = 170;
+
+    var state = {
+	config: null,
+	lon: 0,
+	lat: 0,
+	zoom: 2,
+	records: [],
+	total: 0,
+	offset: 0,
+	index: 0,
+	record: null,
+	camera: null,
+	target: null,
+	angle: DEFAULT_ANGLE
+    };
+
+    var el = function(id) {
+	return document.getElementById(id);
+    };
+
+    var map = el("map");
+    var tiles = el("tiles");
+    var overlay = el("overlay");
+
+    // Web Mercator projection
+
+    var project = function(lon, lat, zoom) {
+	var size = TILE_SIZE * Math.pow(2, zoom);
+	var sin = Math.sin(lat * Math.PI / 180);
+	sin = Math.min(Math.max(sin, -0.9999), 0.9999);
+	var x = (lon + 180) / 360 * size;
+	var y = (0.5 - Math.log((1 + sin) / (1 - sin)) / (4 * Math.PI)) * size;
+	return [x, y];
+    };
+
+    var unproject = function(x, y, zoom) {
+	var size = TILE_SIZE * Math.pow(2, zoom);
+	var lon = x / size * 360 - 180;
+	var n = Math.PI - 2 * Math.PI * y / size;
+	var lat = 180 / Math.PI * Math.atan(0.5 * (Math.exp(n) - Math.exp(-n)));
+	return [lon, lat];
+    };
+
+    // The pixel coordinates of the top-left corner of the map
+
+    var origin = function() {
+	var c = project(state.lon, state.lat, state.zoom);
+	return [c[0] - map.clientWidth / 2, c[1] - map.clientHeight / 2];
+    };
+
+    var toScreen = function(pt) {
+	var p = project(pt[0], pt[1], state.zoom);
+	var o = origin();
+	return [p[0] - o[0], p[1] - o[1]];
+    };
+
+    var fromScreen = function(x, y) {
+	var o = origin();
+	var pt = unproject(o[0] + x, o[1] + y, state.zoom);
+	pt[1] = Math.min(Math.max(pt[1], -85), 85);
+	return pt;
+    };
+
+    var svg = function(name, attrs) {
+	var node = document.createElementNS("http://www.w3.org/2000/svg", name);
+	for (var k in attrs) {
+	    node.setAttribute(k, attrs[k]);
+	}
+	return node;
+    };
+
+    var renderTiles = function() {
+
+	tiles.innerHTML = "";
+
+	if (!state.config || !state.config.tile_url) {
+	    return;
+	}
+
+	var o = origin();
+	var count = Math.pow(2, state.zoom);
+
+	var min_x = Math.floor(o[0] / TILE_SIZE);
+	var max_x = Math.floor((o[0] + map.clientWidth) / TILE_SIZE);
+	var min_y = Math.max(0, Math.floor(o[1] / TILE_SIZE));
+	var max_y = Math.min(count - 1, Math.floor((o[1] + map.clientHeight) / TILE_SIZE));
+
+	for (var x = min_x; x <= max_x; x++) {
+
+	    for (var y = min_y; y <= max_y; y++) {
+
+		var wrapped_x = ((x % count) + count) % count;
+
+		var url = state.config.tile_url
+		    .replace("{z}", state.zoom)
+		    .replace("{x}", wrapped_x)
+		    .replace("{y}", y);
+
+		var img = document.createElement("img");
+		img.src = url;
+		img.alt = "";
+		img.style.left = (x * TILE_SIZE - o[0]) + "px";
+		img.style.top = (y * TILE_SIZE - o[1]) + "px";
+		img.onerror = function() {
+		    this.style.visibility = "hidden";
+		};
+
+		tiles.appendChild(img);
+	    }
+	}
+    };
+
+    var renderGraticule = function() {
+
+	var steps = [90, 45, 30, 10, 5, 2, 1, 0.5, 0.25, 0.1, 0.05, 0.02, 0.01, 0.005, 0.002, 0.001];
+	var nw = fromScreen(0, 0);
+	var se = fromScreen(map.clientWidth, map.clientHeight);
+
+	var step = steps[steps.length - 1];
+
+	for (var i = 0; i < steps.length; i++) {
+	    if ((se[0] - nw[0]) / steps[i] >= 4) {
+		step = steps[i];
+		break;
+	    }
+	}
+
+	var decimals = Math.max(0, Math.ceil(-Math.log10(step)));
+
+	for (var lon = Math.ceil(nw[0] / step) * step; lon <= se[0]; lon += step) {
+	    var x = toScreen([lon, 0])[0];
+	    overlay.appendChild(svg("line", { "class": "graticule", x1: x, y1: 0, x2: x, y2: map.clientHeight }));
+	    var label = svg("text", { "class": "label", x: x + 2, y: 12 });
+	    label.textContent = lon.toFixed(decimals);
+	    overlay.appendChild(label);
+	}
+
+	for (var lat = Math.ceil(se[1] / step) * step; lat <= nw[1]; lat += step) {
+	    var y = toScreen([0, lat])[1];
+	    overlay.appendChild(svg("line", { "class": "graticule", x1: 0, y1: y, x2: map.clientWidth, y2: y }));
+	    var label = svg("text", { "class": "label", x: 2, y: y - 2 });
+	    label.textContent = lat.toFixed(decimals);
+	    overlay.appendChild(label);
+	}
+    };
+
+    // Field of view
+
+    // fieldOfView returns the two edges of the camera's field of view, at the target's distance from the
+    // camera, or null if there isn't one
+
+    var fieldOfView = function() {
+
+	if (!state.camera || !state.target || state.angle <= 0) {
+	    return null;
+	}
+
+	var c = project(state.camera[0], state.camera[1], FOV_ZOOM);
+	var t = project(state.target[0], state.target[1], FOV_ZOOM);
+
+	var dx = t[0] - c[0];
+	var dy = t[1] - c[1];
+
+	if (dx == 0 && dy == 0) {
+	    return null;
+	}
+
+	var half = Math.tan(state.angle / 2 * Math.PI / 180);
+
+	var left = unproject(t[0] + dy * half, t[1] - dx * half, FOV_ZOOM);
+	var right = unproject(t[0] - dy * half, t[1] + dx * half, FOV_ZOOM);
+
+	return [left, right];
+    };
+
+    // angleOf returns the angle, in degrees, of the field of view whose edges are 'a' and 'b' as seen from
+    // 'camera'
+
+    var angleOf = function(camera, a, b) {
+
+	var c = project(camera[0], camera[1], FOV_ZOOM);
+	var pa = project(a[0], a[1], FOV_ZOOM);
+	var pb = project(b[0], b[1], FOV_ZOOM);
+
+	var angle_a = Math.atan2(pa[1] - c[1], pa[0] - c[0]);
+	var angle_b = Math.atan2(pb[1] - c[1], pb[0] - c[0]);
+
+	var angle = Math.abs(angle_a - angle_b) * 180 / Math.PI;
+
+	if (angle > 180) {
+	    angle = 360 - angle;
+	}
+
+	return Math.round(angle);
+    };
+
+    var renderOverlay = function() {
+
+	overlay.innerHTML = "";
+
+	if (!state.config || !state.config.tile_url) {
+	    renderGraticule();
+	}
+
+	var fov = fieldOfView();
+
+	if (fov) {
+	    var points = [state.camera, fov[0], fov[1]].map(function(pt) {
+		return toScreen(pt).join(",");
+	    });
+	    overlay.appendChild(svg("polygon", { "class": "fov", points: points.join(" ") }));
+	}
+
+	if (state.camera && state.target) {
+	    var a = toScreen(state.camera);
+	    var b = toScreen(state.target);
+	    overlay.appendChild(svg("line", { "class": "sightline", x1: a[0], y1: a[1], x2: b[0], y2: b[1] }));
+	}
+
+	if (state.target) {
+	    var t = toScreen(state.target);
+	    overlay.appendChild(svg("circle", { "class": "target", cx: t[0], cy: t[1], r: 7 }));
+	}
+
+	if (state.camera) {
+	    var c = toScreen(state.camera);
+	    overlay.appendChild(svg("circle", { "class": "camera", cx: c[0], cy: c[1], r: 8 }));
+	}
+    };
+
+    var render = function() {
+	renderTiles();
+	renderOverlay();
+    };
+
+    // Map interactions
+
+    var drag = null;
+
+    map.addEventListener("mousedown", function(e) {
+	drag = { x: e.clientX, y: e.clientY, center: project(state.lon, state.lat, state.zoom), moved: false };
+    });
+
+    window.addEventListener("mousemove", function(e) {
+
+	var rect = map.getBoundingClientRect();
+	var pt = fromScreen(e.clientX - rect.left, e.clientY - rect.top);
+	el("cursor").textContent = pt[1].toFixed(5) + ", " + pt[0].toFixed(5);
+
+	if (!drag) {
+	    return;
+	}
+
+	var dx = e.clientX - drag.x;
+	var dy = e.clientY - drag.y;
+
+	if (Math.abs(dx) + Math.abs(dy) > 3) {
+	    drag.moved = true;
+	}
+
+	var center = unproject(drag.center[0] - dx, drag.center[1] - dy, state.zoom);
+	state.lon = center[0];
+	state.lat = Math.min(Math.max(center[1], -85), 85);
+	render();
+    });
+
+    window.addEventListener("mouseup", function(e) {
+
+	if (!drag) {
+	    return;
+	}
+
+	var moved = drag.moved;
+	drag = null;
+
+	if (moved) {
+	    return;
+	}
+
+	var rect = map.getBoundingClientRect();
+
+	if (e.clientX < rect.left || e.clientX > rect.right || e.clientY < rect.top || e.clientY > rect.bottom) {
+	    return;
+	}
+
+	var pt = fromScreen(e.clientX - rect.left, e.clientY - rect.top);
+	var mode = document.querySelector("input[name=mode]:checked").value;
+
+	state[mode] = pt;
+
+	// Switch to placing the target once the camera has been placed
+
+	if (mode == "camera" && !state.target) {
+	    document.querySelector("input[name=mode][value=target]").checked = true;
+	}
+
+	syncInputs();
+	renderOverlay();
+    });
+
+    map.addEventListener("wheel", function(e) {
+
+	e.preventDefault();
+
+	var zoom = state.zoom + (e.deltaY < 0 ? 1 : -1);
+	zoom = Math.min(Math.max(zoom, MIN_ZOOM), MAX_ZOOM);
+
+	if (zoom == state.zoom) {
+	    return;
+	}
+
+	// Keep the point under the cursor fixed
+
+	var rect = map.getBoundingClientRect();
+	var x = e.clientX - rect.left;
+	var y = e.clientY - rect.top;
+	var pt = fromScreen(x, y);
+
+	state.zoom = zoom;
+
+	var p = project(pt[0], pt[1], zoom);
+	var center = unproject(p[0] - x + map.clientWidth / 2, p[1] - y + map.clientHeight / 2, zoom);
+
+	state.lon = center[0];
+	state.lat = Math.min(Math.max(center[1], -85), 85);
+	render();
+
+    }, { passive: false });
+
+    window.addEventListener("resize", render);
+
+    // Coordinate inputs
+
+    var formatPoint = function(pt) {
+	return pt ? pt[1].toFixed(6) + ", " + pt[0].toFixed(6) : "";
+    };
+
+    var parsePoint = function(str) {
+
+	var parts = str.split(",");
+
+	if (parts.length != 2) {
+	    return null;
+	}
+
+	var lat = parseFloat(parts[0]);
+	var lon = parseFloat(parts[1]);
+
+	if (isNaN(lat) || isNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180) {
+	    return null;
+	}
+
+	return [lon, lat];
+    };
+
+    var syncInputs = function() {
+	el("camera").value = formatPoint(state.camera);
+	el("target").value = formatPoint(state.target);
+	el("angle").value = state.angle;
+    };
+
+    el("angle").addEventListener("change", function() {
+
+	var angle = parseFloat(el("angle").value);
+
+	if (isNaN(angle) || angle < 0 || angle > MAX_ANGLE) {
+	    setStatus("Invalid field of view, it must be between 0 and " + MAX_ANGLE + " degrees");
+	    return;
+	}
+
+	state.angle = angle;
+	renderOverlay();
+    });
+
+    ["camera", "target"].forEach(function(name) {
+
+	el(name).addEventListener("change", function() {
+
+	    var str = el(name).value.trim();
+
+	    if (str == "") {
+		state[name] = null;
+	    } else {
+
+		var pt = parsePoint(str);
+
+		if (!pt) {
+		    setStatus("Invalid " + name + " coordinates");
+		    return;
+		}
+
+		state[name] = pt;
+		state.lon = pt[0];
+		state.lat = pt[1];
+	    }
+
+	    render();
+	});
+    });
+
+    // Records
+
+    var setStatus = function(msg) {
+	el("status").textContent = msg;
+    };
+
+    var getJSON = function(url) {
+	return fetch(url).then(function(rsp) {
+	    if (!rsp.ok) {
+		throw new Error(rsp.status + " " + rsp.statusText);
+	    }
+	    return rsp.json();
+	});
+    };
+
+    var loadPage = function(offset) {
+
+	var untagged = el("untagged").checked;
+	var url = "api/records?offset=" + offset + "&untagged=" + untagged;
+
+	return getJSON(url).then(function(rsp) {
+	    state.records = rsp.records;
+	    state.total = rsp.total;
+	    state.offset = rsp.offset;
+	});
+    };
+
+    var show = function(index) {
+
+	var abs = state.offset + index;
+
+	if (abs < 0 || (abs >= state.total && state.total > 0)) {
+	    return;
+	}
+
+	var page = Promise.resolve();
+
+	if (index < 0 || index >= state.records.length) {
+	    page = loadPage(Math.max(0, abs - (index < 0 ? state.records.length - 1 : 0)));
+	}
+
+	page.then(function() {
+
+	    state.index = abs - state.offset;
+
+	    if (state.records.length == 0) {
+		el("title").textContent = "There are no records to geotag";
+		el("position").textContent = "";
+		return;
+	    }
+
+	    var summary = state.records[state.index];
+	    return getJSON("api/records/" + encodeURIComponent(summary.id)).then(showRecord);
+
+	}).catch(function(err) {
+	    setStatus("Failed to load record: " + err);
+	});
+    };
+
+    var showRecord = function(rec) {
+
+	state.record = rec;
+	state.camera = null;
+	state.target = null;
+	state.angle = DEFAULT_ANGLE;
+
+	if (rec.geotag) {
+	    state.camera = rec.geotag.camera.coordinates;
+	    state.target = rec.geotag.target ? targetPoint(rec.geotag.target) : null;
+
+	    if (rec.geotag.target && rec.geotag.target.type == "LineString") {
+		var coords = rec.geotag.target.coordinates;
+		state.angle = angleOf(state.camera, coords[0], coords[coords.length - 1]);
+	    } else if (rec.geotag.target) {
+		state.angle = 0;
+	    }
+
+	    state.lon = state.camera[0];
+	    state.lat = state.camera[1];
+	}
+
+	el("position").textContent = (state.offset + state.index + 1) + " of " + state.total;
+	el("title").textContent = rec.title || rec.id;
+	el("date").textContent = rec.date || "";
+	el("location").textContent = (rec.location || []).join(", ");
+	el("description").textContent = (rec.description || []).join(" ");
+	el("url").href = rec.url || "#";
+
+	var image = el("image");
+	var images = rec.images || [];
+
+	if (images.length) {
+	    image.src = images[images.length - 1];
+	    image.style.display = "block";
+	} else {
+	    image.removeAttribute("src");
+	    image.style.display = "none";
+	}
+
+	document.querySelector("input[name=mode][value=camera]").checked = true;
+	setStatus(rec.geotagged ? "This record has already been geotagged" : "");
+
+	syncInputs();
+	render();
+    };
+
+    // Targets may be points or the line strings describing a field of view, in which case the middle of the
+    // line is used
+
+    var targetPoint = function(geom) {
+
+	if (geom.type == "Point") {
+	    return geom.coordinates;
+	}
+
+	var coords = geom.coordinates;
+	var a = coords[0];
+	var b = coords[coords.length - 1];
+
+	return [(a[0] + b[0]) / 2, (a[1] + b[1]) / 2];
+    };
+
+    el("prev").addEventListener("click", function() {
+	show(state.index - 1);
+    });
+
+    el("next").addEventListener("click", function() {
+	show(state.index + 1);
+    });
+
+    el("untagged").addEventListener("change", function() {
+	loadPage(0).then(function() {
+	    show(0);
+	});
+    });
+
+    el("clear").addEventListener("click", function() {
+	state.camera = null;
+	state.target = null;
+	syncInputs();
+	renderOverlay();
+    });
+
+    el("save").addEventListener("click", function() {
+
+	if (!state.record) {
+	    return;
+	}
+
+	if (!state.camera) {
+	    setStatus("Click the map to set the camera location first");
+	    return;
+	}
+
+	var body = {
+	    camera: { type: "Point", coordinates: state.camera },
+	    contributor: el("contributor").value.trim()
+	};
+
+	var fov = fieldOfView();
+
+	if (fov) {
+	    body.target = { type: "LineString", coordinates: fov };
+	} else if (state.target) {
+	    body.target = { type: "Point", coordinates: state.target };
+	}
+
+	fetch("api/geotags/" + encodeURIComponent(state.record.id), {
+	    method: "POST",
+	    headers: { "Content-Type": "application/json" },
+	    body: JSON.stringify(body)
+	}).then(function(rsp) {
+
+	    if (!rsp.ok) {
+		return rsp.text().then(function(txt) {
+		    throw new Error(txt);
+		});
+	    }
+
+	    return rsp.json().then(function(g) {
+		state.record.geotagged = true;
+		setStatus("Saved revision " + g.revision);
+	    });
+
+	}).catch(function(err) {
+	    setStatus("Failed to save geotag: " + err.message);
+	});
+    });
+
+    el("delete").addEventListener("click", function() {
+
+	if (!state.record || !state.record.geotagged) {
+	    return;
+	}
+
+	var url = "api/geotags/" + encodeURIComponent(state.record.id) + "?contributor=" + encodeURIComponent(el("contributor").value.trim());
+
+	fetch(url, { method: "DELETE" }).then(function(rsp) {
+
+	    if (!rsp.ok) {
+		throw new Error(rsp.status + " " + rsp.statusText);
+	    }
+
+	    state.record.geotagged = false;
+	    state.camera = null;
+	    state.target = null;
+
+	    syncInputs();
+	    renderOverlay();
+	    setStatus("Deleted");
+
+	}).catch(function(err) {
+	    setStatus("Failed to delete geotag: " + err.message);
+	});
+    });
+
+    // Remember the contributor's name between sessions
+
+    el("contributor").value = window.localStorage.getItem("contributor") || "";
+
+    el("contributor").addEventListener("change", function() {
+	window.localStorage.setItem("contributor", el("contributor").value.trim());
+    });
+
+    getJSON("api/config").then(function(config) {
+
+	state.config = config;
+	state.lon = config.longitude;
+	state.lat = config.latitude;
+	state.zoom = Math.min(Math.max(config.zoom, MIN_ZOOM), MAX_ZOOM);
+
+	render();
+
+	return loadPage(0).then(function() {
+	    show(0);
+	});
+
+    }).catch(function(err) {
+	setStatus("Failed to load: " + err);
+    });
+
+})();
@@ -0,0 +1,429 @@
+// package www provides HTTP handlers for a web application used to geotag Library of Congress records.
+package www
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/geotag"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed static
+var static_fs embed.FS
+
+// The maximum size, in bytes, of a POSTed geotag.
+const MAX_BODY_SIZE int64 = 1024 * 1024
+
+// The default number of records returned by the records API.
+const DEFAULT_LIMIT int = 50
+
+// HandlerOptions defines options for creating the geotagging application handler.
+type HandlerOptions struct {
+	// The records to geotag.
+	Records *Records
+	// The store where geotags are saved.
+	Store geotag.Store
+	// An optional {z}/{x}/{y} tile URL template for the basemap. If empty no basemap is displayed.
+	TileURL string
+	// The initial longitude of the map.
+	Longitude float64
+	// The initial latitude of the map.
+	Latitude float64
+	// The initial zoom level of the map.
+	Zoom int
+}
+
+// handler serves the geotagging application. 'tagged' is the set of IDs with a geotag, loaded from the store when
+// the handler is created and updated as geotags are saved or deleted, so that listing records does not require
+// reading every geotag in the store.
+type handler struct {
+	options *HandlerOptions
+	mu      *sync.RWMutex
+	tagged  map[string]bool
+}
+
+// config is the map configuration passed to the UI.
+type config struct {
+	TileURL   string  `json:"tile_url"`
+	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude"`
+	Zoom      int     `json:"zoom"`
+}
+
+// recordResponse is a record and its geotag, if it has one.
+type recordResponse struct {
+	*Summary
+	Geotagged bool           `json:"geotagged"`
+	Geotag    *geotag.Geotag `json:"geotag,omitempty"`
+}
+
+type recordsResponse struct {
+	Total   int               `json:"total"`
+	Offset  int               `json:"offset"`
+	Records []*recordResponse `json:"records"`
+}
+
+// NewHandler returns a new http.Handler serving the geotagging UI at "/" and the following API endpoints:
+//
+//	GET /api/config - The map configuration.
+//	GET /api/records?offset={OFFSET}&limit={LIMIT}&untagged={BOOLEAN} - A list of records.
+//	GET /api/records/{ID} - A single record and its geotag.
+//	GET /api/geotags - All the geotags in the store.
+//	GET /api/geotags/{ID} - The geotag for a record.
+//	POST /api/geotags/{ID} - Save a {"camera": {GEOMETRY}, "target": {GEOMETRY}, "contributor": {NAME}} geotag for a record.
+//	DELETE /api/geotags/{ID}?contributor={NAME} - Delete the geotag for a record.
+//	GET /api/geotags/{ID}/revisions - Every revision of the geotag for a record, oldest first.
+//
+// The IDs of records with a geotag are read from the store when the handler is created and are not reloaded so the
+// store should only be modified through the handler while it is running.
+func NewHandler(ctx context.Context, opts *HandlerOptions) (http.Handler, error) {
+
+	if opts.Records == nil || opts.Store == nil {
+		return nil, fmt.Errorf("Missing records or store")
+	}
+
+	static, err := fs.Sub(static_fs, "static")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load static files, %w", err)
+	}
+
+	ids, err := opts.Store.IDs(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list geotags, %w", err)
+	}
+
+	tagged := make(map[string]bool)
+
+	for _, id := range ids {
+		tagged[id] = true
+	}
+
+	h := &handler{
+		options: opts,
+		mu:      new(sync.RWMutex),
+		tagged:  tagged,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/config", h.config)
+	mux.HandleFunc("/api/records", h.records)
+	mux.HandleFunc("/api/records/", h.record)
+	mux.HandleFunc("/api/geotags", h.geotags)
+	mux.HandleFunc("/api/geotags/", h.geotag)
+	mux.Handle("/", http.FileServer(http.FS(static)))
+
+	return mux, nil
+}
+
+func (h *handler) config(rsp http.ResponseWriter, req *http.Request) {
+
+	c := &config{
+		TileURL:   h.options.TileURL,
+		Longitude: h.options.Longitude,
+		Latitude:  h.options.Latitude,
+		Zoom:      h.options.Zoom,
+	}
+
+	writeJSON(rsp, c)
+}
+
+func (h *handler) records(rsp http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodGet {
+		http.Error(rsp, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := req.URL.Query()
+
+	offset, err := intParam(q.Get("offset"), 0)
+
+	if err != nil || offset < 0 {
+		http.Error(rsp, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := intParam(q.Get("limit"), DEFAULT_LIMIT)
+
+	if err != nil || limit < 1 {
+		http.Error(rsp, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	untagged := q.Get("untagged") == "true" || q.Get("untagged") == "1"
+
+	candidates := make([]*recordResponse, 0)
+
+	h.mu.RLock()
+
+	for _, s := range h.options.Records.All() {
+
+		if untagged && h.tagged[s.ID] {
+			continue
+		}
+
+		candidates = append(candidates, &recordResponse{Summary: s, Geotagged: h.tagged[s.ID]})
+	}
+
+	h.mu.RUnlock()
+
+	r := &recordsResponse{
+		Total:   len(candidates),
+		Offset:  offset,
+		Records: make([]*recordResponse, 0),
+	}
+
+	if offset < len(candidates) {
+
+		end := offset + limit
+
+		if end > len(candidates) {
+			end = len(candidates)
+		}
+
+		r.Records = candidates[offset:end]
+	}
+
+	writeJSON(rsp, r)
+}
+
+func (h *handler) record(rsp http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodGet {
+		http.Error(rsp, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(req.URL.Path, "/api/records/")
+
+	s, ok := h.options.Records.Get(id)
+
+	if !ok {
+		http.Error(rsp, "Not found", http.StatusNotFound)
+		return
+	}
+
+	g, err := h.options.Store.Get(req.Context(), id)
+
+	if err != nil && !errors.Is(err, geotag.ErrNotFound) {
+		log.Printf("Failed to retrieve geotag for %s, %v", id, err)
+		http.Error(rsp, "Failed to retrieve geotag", http.StatusInternalServerError)
+		return
+	}
+
+	r := &recordResponse{
+		Summary:   s,
+		Geotagged: g != nil,
+		Geotag:    g,
+	}
+
+	writeJSON(rsp, r)
+}
+
+func (h *handler) geotags(rsp http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodGet {
+		http.Error(rsp, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	geotags, err := h.options.Store.List(req.Context())
+
+	if err != nil {
+		log.Printf("Failed to list geotags, %v", err)
+		http.Error(rsp, "Failed to list geotags", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(rsp, geotags)
+}
+
+func (h *handler) geotag(rsp http.ResponseWriter, req *http.Request) {
+
+	ctx := req.Context()
+	id := strings.TrimPrefix(req.URL.Path, "/api/geotags/")
+
+	if strings.HasSuffix(id, "/revisions") {
+		h.revisions(rsp, req, strings.TrimSuffix(id, "/revisions"))
+		return
+	}
+
+	if !geotag.ValidID(id) {
+		http.Error(rsp, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+
+		g, err := h.options.Store.Get(ctx, id)
+
+		if errors.Is(err, geotag.ErrNotFound) {
+			http.Error(rsp, "Not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			log.Printf("Failed to retrieve geotag for %s, %v", id, err)
+			http.Error(rsp, "Failed to retrieve geotag", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(rsp, g)
+
+	case http.MethodPost:
+
+		_, ok := h.options.Records.Get(id)
+
+		if !ok {
+			http.Error(rsp, "Not found", http.StatusNotFound)
+			return
+		}
+
+		g, err := decodeGeotag(req.Body, id)
+
+		if err != nil {
+			http.Error(rsp, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err = h.options.Store.Put(ctx, g)
+
+		if err != nil {
+			log.Printf("Failed to store geotag for %s, %v", id, err)
+			http.Error(rsp, "Failed to store geotag", http.StatusInternalServerError)
+			return
+		}
+
+		h.setTagged(id, true)
+
+		writeJSON(rsp, g)
+
+	case http.MethodDelete:
+
+		err := h.options.Store.Delete(ctx, id, req.URL.Query().Get("contributor"))
+
+		if errors.Is(err, geotag.ErrNotFound) {
+			h.setTagged(id, false)
+			http.Error(rsp, "Not found", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			log.Printf("Failed to delete geotag for %s, %v", id, err)
+			http.Error(rsp, "Failed to delete geotag", http.StatusInternalServerError)
+			return
+		}
+
+		h.setTagged(id, false)
+
+		rsp.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(rsp, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *handler) revisions(rsp http.ResponseWriter, req *http.Request, id string) {
+
+	if req.Method != http.MethodGet {
+		http.Error(rsp, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !geotag.ValidID(id) {
+		http.Error(rsp, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	revisions, err := h.options.Store.History(req.Context(), id)
+
+	if errors.Is(err, geotag.ErrNotFound) {
+		http.Error(rsp, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Failed to retrieve revisions for %s, %v", id, err)
+		http.Error(rsp, "Failed to retrieve revisions", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(rsp, revisions)
+}
+
+// setTagged records whether the record 'id' has a geotag.
+func (h *handler) setTagged(id string, tagged bool) {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if tagged {
+		h.tagged[id] = true
+	} else {
+		delete(h.tagged, id)
+	}
+}
+
+func decodeGeotag(r io.Reader, id string) (*geotag.Geotag, error) {
+
+	body, err := io.ReadAll(io.LimitReader(r, MAX_BODY_SIZE))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read body, %w", err)
+	}
+
+	var g *geotag.Geotag
+
+	err = json.Unmarshal(body, &g)
+
+	if err != nil || g == nil {
+		return nil, fmt.Errorf("Invalid geotag")
+	}
+
+	// Revisions, timestamps and deletions are managed by the store
+
+	g.ID = id
+	g.Revision = 0
+	g.Deleted = false
+
+	err = g.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+func intParam(str string, default_value int) (int, error) {
+
+	if str == "" {
+		return default_value, nil
+	}
+
+	return strconv.Atoi(str)
+}
+
+func writeJSON(rsp http.ResponseWriter, v interface{}) {
+
+	rsp.Header().Set("Content-Type", "application/json")
+
+	enc := json.NewEncoder(rsp)
+	err := enc.Encode(v)
+
+	if err != nil {
+		log.Printf("Failed to encode response, %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+package www
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aaronland/go-libraryofcongress-datajam/geotag"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	_ "gocloud.dev/blob/memblob"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, geotag.Store) {
+
+	ctx := context.Background()
+
+	store, err := geotag.NewBlobStore(ctx, "mem://")
+
+	if err != nil {
+		t.Fatalf("Failed to create store, %v", err)
+	}
+
+	t.Cleanup(func() { store.Close() })
+
+	records := NewRecords()
+
+	for _, id := range []string{"2005691198", "2005691196", "2005691197"} {
+
+		if !records.Add([]byte(`{"item": {"id": "` + id + `"}, "title": "Record ` + id + `"}`)) {
+			t.Fatalf("Failed to add record %s", id)
+		}
+	}
+
+	records.Sort()
+
+	// A geotag that exists before the handler is created should be loaded from the store
+
+	err = store.Put(ctx, &geotag.Geotag{ID: "2005691197", Camera: geojson.NewGeometry(orb.Point{-77.0365, 38.8977})})
+
+	if err != nil {
+		t.Fatalf("Failed to put geotag, %v", err)
+	}
+
+	h, err := NewHandler(ctx, &HandlerOptions{Records: records, Store: store})
+
+	if err != nil {
+		t.Fatalf("Failed to create handler, %v", err)
+	}
+
+	s := httptest.NewServer(h)
+	t.Cleanup(s.Close)
+
+	return s, store
+}
+
+func getRecords(t *testing.T, s *httptest.Server, query string) *recordsResponse {
+
+	rsp, err := http.Get(s.URL + "/api/records?" + query)
+
+	if err != nil {
+		t.Fatalf("Failed to get records, %v", err)
+	}
+
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status for records?%s, %d", query, rsp.StatusCode)
+	}
+
+	var r *recordsResponse
+
+	err = json.NewDecoder(rsp.Body).Decode(&r)
+
+	if err != nil {
+		t.Fatalf("Failed to decode records, %v", err)
+	}
+
+	return r
+}
+
+func recordIDs(r *recordsResponse) []string {
+
+	ids := make([]string, 0)
+
+	for _, rec := range r.Records {
+		ids = append(ids, rec.ID)
+	}
+
+	return ids
+}
+
+func TestRecordsHandler(t *testing.T) {
+
+	s, _ := newTestServer(t)
+
+	tests := map[string][]string{
+		"":                         {"2005691196", "2005691197", "2005691198"},
+		"untagged=true":            {"2005691196", "2005691198"},
+		"untagged=1&limit=1":       {"2005691196"},
+		"untagged=1&offset=1":      {"2005691198"},
+		"untagged=false&offset=5":  {},
+		"untagged=true&offset=2":   {},
+		"offset=1&limit=1":         {"2005691197"},
+		"untagged=0&limit=1000000": {"2005691196", "2005691197", "2005691198"},
+	}
+
+	for query, expected := range tests {
+
+		r := getRecords(t, s, query)
+
+		if !reflect.DeepEqual(recordIDs(r), expected) {
+			t.Fatalf("Unexpected records for '%s', %v", query, recordIDs(r))
+		}
+	}
+
+	r := getRecords(t, s, "untagged=true")
+
+	if r.Total != 2 {
+		t.Fatalf("Expected 2 untagged records, got %d", r.Total)
+	}
+
+	for _, rec := range getRecords(t, s, "").Records {
+
+		if rec.Geotagged != (rec.ID == "2005691197") {
+			t.Fatalf("Unexpected geotagged flag for %s", rec.ID)
+		}
+	}
+
+	for _, query := range []string{"offset=-1", "offset=a", "limit=0", "limit=a"} {
+
+		rsp, err := http.Get(s.URL + "/api/records?" + query)
+
+		if err != nil {
+			t.Fatalf("Failed to get records, %v", err)
+		}
+
+		rsp.Body.Close()
+
+		if rsp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Expected bad request for '%s', got %d", query, rsp.StatusCode)
+		}
+	}
+}
+
+func TestGeotagHandler(t *testing.T) {
+
+	ctx := context.Background()
+	s, store := newTestServer(t)
+
+	post := func(id string, body string) *http.Response {
+
+		rsp, err := http.Post(s.URL+"/api/geotags/"+id, "application/json", strings.NewReader(body))
+
+		if err != nil {
+			t.Fatalf("Failed to post geotag, %v", err)
+		}
+
+		rsp.Body.Close()
+		return rsp
+	}
+
+	body := `{"id": "ignored", "revision": 10, "deleted": true, "contributor": "a",
+"camera": {"type": "Point", "coordinates": [-77.0365, 38.8977]},
+"target": {"type": "LineString", "coordinates": [[-77.0091, 38.8899], [-77.0089, 38.8889]]}}`
+
+	rsp := post("2005691196", body)
+
+	if rsp.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected status posting geotag, %d", rsp.StatusCode)
+	}
+
+	g, err := store.Get(ctx, "2005691196")
+
+	if err != nil {
+		t.Fatalf("Failed to get stored geotag, %v", err)
+	}
+
+	if g.ID != "2005691196" || g.Revision != 1 || g.Deleted || g.Contributor != "a" {
+		t.Fatalf("Unexpected stored geotag %+v", g)
+	}
+
+	camera, ok := g.Camera.Geometry().(orb.Point)
+
+	if !ok || !camera.Equal(orb.Point{-77.0365, 38.8977}) {
+		t.Fatalf("Unexpected camera %v", g.Camera.Geometry())
+	}
+
+	target, ok := g.Target.Geometry().(orb.LineString)
+
+	if !ok || !target.Equal(orb.LineString{{-77.0091, 38.8899}, {-77.0089, 38.8889}}) {
+		t.Fatalf("Unexpected target %v", g.Target.Geometry())
+	}
+
+	r := getRecords(t, s, "untagged=true")
+
+	if !reflect.DeepEqual(recordIDs(r), []string{"2005691198"}) {
+		t.Fatalf("Expected posted record to no longer be untagged, %v", recordIDs(r))
+	}
+
+	invalid := map[string]string{
+		"2005691196": `{"camera": {"type": "LineString", "coordinates": [[0, 0], [1, 1]]}}`,
+		"2005691198": `{"camera": {"type": "Point", "coordinates": [-77.0365, 98.8977]}}`,
+	}
+
+	for id, body := range invalid {
+
+		rsp := post(id, body)
+
+		if rsp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Expected bad request for %s, got %d", body, rsp.StatusCode)
+		}
+	}
+
+	rsp = post("2005691198", `not json`)
+
+	if rsp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected bad request for invalid JSON, got %d", rsp.StatusCode)
+	}
+
+	rsp = post("2005691199", `{"camera": {"type": "Point", "coordinates": [-77.0365, 38.8977]}}`)
+
+	if rsp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected not found for an unknown record, got %d", rsp.StatusCode)
+	}
+
+	_, err = store.Get(ctx, "2005691198")
+
+	if err == nil {
+		t.Fatalf("Expected rejected geotags not to be stored")
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, s.URL+"/api/geotags/2005691196?contributor=b", nil)
+
+	if err != nil {
+		t.Fatalf("Failed to create request, %v", err)
+	}
+
+	rsp, err = http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatalf("Failed to delete geotag, %v", err)
+	}
+
+	rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Unexpected status deleting geotag, %d", rsp.StatusCode)
+	}
+
+	r = getRecords(t, s, "untagged=true")
+
+	if !reflect.DeepEqual(recordIDs(r), []string{"2005691196", "2005691198"}) {
+		t.Fatalf("Expected deleted record to be untagged, %v", recordIDs(r))
+	}
+}
@@ -7,9 +7,13 @@ require (
 	github.com/aaronland/go-jsonl v0.0.18
 	github.com/aaronland/go-picturebook v0.6.2
 	github.com/aws/aws-sdk-go v1.44.121
+	github.com/dsnet/compress v0.0.1
+	github.com/google/flatbuffers v1.12.1
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/paulmach/orb v0.7.1
 	github.com/sfomuseum/go-csvdict v1.0.0
 	github.com/tidwall/gjson v1.14.3
+	github.com/tidwall/pretty v1.2.1
 	gocloud.dev v0.27.0
 )
 
@@ -39,6 +43,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/sso v1.11.13 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.16.10 // indirect
 	github.com/aws/smithy-go v1.12.0 // indirect
+	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
 	github.com/google/uuid v1.3.0 // indirect
@@ -48,11 +53,11 @@ require (
 	github.com/jung-kurt/gofpdf v1.16.2 // indirect
 	github.com/microcosm-cc/exifutil v0.0.0-20140910154058-36de169162e2 // indirect
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646 // indirect
+	github.com/paulmach/protoscan v0.2.1 // indirect
 	github.com/rainycape/unidecode v0.0.0-20150907023854-cb7f23ec59be // indirect
 	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd // indirect
 	github.com/sfomuseum/go-font-ocra v0.0.1 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
-	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/whosonfirst/go-bindata-assetfs v1.0.1 // indirect
 	go.opencensus.io v0.23.0 // indirect
 	golang.org/x/net v0.0.0-20220802222814-0bcc04d9c69b // indirect
@@ -3,6 +3,7 @@ package datajam
 import (
 	"context"
 	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/cache"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -10,10 +11,17 @@ import (
 	"gocloud.dev/blob/s3blob"
 	_ "log"
 	"net/url"
+	"strconv"
+	"strings"
 )
 
 const IS_LIBRARYOFCONGRESS_S3 string = "github.com/aaronland/go-libraryofcongress-datajam#is_libraryofcongress_s3"
 
+// OpenBucket opens the bucket defined by 'uri'. The "loc://" and "libraryofcongress://" schemes resolve a dataset in
+// the default registry (see DefaultRegistry): "loc://{NAME}/{PATH}" opens the S3 bucket for the dataset {NAME},
+// anonymously, limited to the dataset's prefix joined with {PATH}. If {NAME} is empty the registry's default dataset
+// is used. "s3://" URIs for buckets belonging to a registered dataset are also opened anonymously. If 'uri' contains
+// a "cache-dir" query parameter objects read from the bucket are cached in that directory (see cacheOptions for details).
 func OpenBucket(ctx context.Context, uri string) (context.Context, *blob.Bucket, error) {
 
 	u, err := url.Parse(uri)
@@ -22,30 +30,61 @@ func OpenBucket(ctx context.Context, uri string) (context.Context, *blob.Bucket,
 		return nil, nil, err
 	}
 
-	is_libraryofcongress_s3 := false
+	cache_opts, err := cacheOptions(u)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uri = u.String()
+
+	var dataset *Dataset
+	prefix := ""
 
 	switch u.Scheme {
 	case "s3":
 
-		if u.Host == AWS_S3_BUCKET {
-			is_libraryofcongress_s3 = true
+		registry, err := DefaultRegistry()
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to load dataset registry, %w", err)
+		}
+
+		d, ok := registry.GetByBucket(u.Host)
+
+		if ok {
+			dataset = d
 		}
 
 	case "loc", "libraryofcongress":
 
-		uri = fmt.Sprintf("s3://%s?region=%s", AWS_S3_BUCKET, AWS_S3_REGION)
-		is_libraryofcongress_s3 = true
+		registry, err := DefaultRegistry()
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to load dataset registry, %w", err)
+		}
+
+		d, err := registry.Get(u.Host)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to resolve dataset '%s', %w", u.Host, err)
+		}
+
+		dataset = d
+		prefix = datasetPrefix(d, u.Path)
 
 	default:
 		// pass
 	}
 
+	is_libraryofcongress_s3 := dataset != nil
+
 	var bucket *blob.Bucket
 
 	if is_libraryofcongress_s3 {
 
 		sess, err := session.NewSession(&aws.Config{
-			Region:      aws.String(AWS_S3_REGION),
+			Region:      aws.String(dataset.Region),
 			Credentials: credentials.AnonymousCredentials,
 		})
 
@@ -55,7 +94,7 @@ func OpenBucket(ctx context.Context, uri string) (context.Context, *blob.Bucket,
 
 		// SKIPMETADATA GOES HERE
 
-		b, err := s3blob.OpenBucket(ctx, sess, AWS_S3_BUCKET, nil)
+		b, err := s3blob.OpenBucket(ctx, sess, dataset.Bucket, nil)
 
 		if err != nil {
 			return nil, nil, fmt.Errorf("Failed to open bucket, %w", err)
@@ -63,6 +102,10 @@ func OpenBucket(ctx context.Context, uri string) (context.Context, *blob.Bucket,
 
 		bucket = b
 
+		if prefix != "" {
+			bucket = blob.PrefixedBucket(bucket, prefix)
+		}
+
 	} else {
 
 		b, err := blob.OpenBucket(ctx, uri)
@@ -74,6 +117,97 @@ func OpenBucket(ctx context.Context, uri string) (context.Context, *blob.Bucket,
 		bucket = b
 	}
 
+	if cache_opts != nil {
+
+		b, err := cache.NewCachingBucket(ctx, bucket, cache_opts)
+
+		if err != nil {
+			bucket.Close()
+			return nil, nil, fmt.Errorf("Failed to create caching bucket, %w", err)
+		}
+
+		bucket = b
+	}
+
 	ctx = context.WithValue(ctx, IS_LIBRARYOFCONGRESS_S3, is_libraryofcongress_s3)
+	ctx = context.WithValue(ctx, DATASET, dataset)
+
 	return ctx, bucket, nil
 }
+
+// datasetPrefix returns the prefix within the S3 bucket for 'd' joined with 'path' (the path of a "loc://" URI).
+// Non-empty prefixes always end in "/".
+func datasetPrefix(d *Dataset, path string) string {
+
+	parts := make([]string, 0)
+
+	for _, p := range []string{d.Prefix, path} {
+
+		p = strings.Trim(p, "/")
+
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+
+	return strings.Join(parts, "/") + "/"
+}
+
+// cacheOptions derives caching bucket options from the "cache-dir", "cache-max-bytes" and "cache-validate" query
+// parameters in 'u', removing them from 'u' so they are not passed to the underlying bucket. It returns nil if
+// there is no "cache-dir" parameter.
+func cacheOptions(u *url.URL) (*cache.CachingBucketOptions, error) {
+
+	q := u.Query()
+
+	root := q.Get("cache-dir")
+	str_max := q.Get("cache-max-bytes")
+	str_validate := q.Get("cache-validate")
+
+	if root == "" {
+
+		if str_max != "" || str_validate != "" {
+			return nil, fmt.Errorf("Cache parameters require a cache-dir parameter")
+		}
+
+		return nil, nil
+	}
+
+	opts := &cache.CachingBucketOptions{
+		Root:     root,
+		Validate: true,
+	}
+
+	if str_max != "" {
+
+		max, err := strconv.ParseInt(str_max, 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cache-max-bytes parameter, %w", err)
+		}
+
+		opts.MaxBytes = max
+	}
+
+	if str_validate != "" {
+
+		validate, err := strconv.ParseBool(str_validate)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cache-validate parameter, %w", err)
+		}
+
+		opts.Validate = validate
+	}
+
+	q.Del("cache-dir")
+	q.Del("cache-max-bytes")
+	q.Del("cache-validate")
+
+	u.RawQuery = q.Encode()
+	return opts, nil
+}
@@ -0,0 +1,148 @@
+// package metadata provides methods for converting Library of Congress `metadata.json` files in to line-separated JSON.
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"io"
+	"strings"
+)
+
+// The default name of the property used to store a record's original key in a `metadata.json` file.
+const DEFAULT_KEY_PROPERTY string = "metadata_key"
+
+// WalkOptions defines options for walking a `metadata.json` file.
+type WalkOptions struct {
+	// The name of the property used to store each record's original key. If empty the key is not injected.
+	// If a record already has a property with the same name it is left untouched.
+	KeyProperty string
+}
+
+// WalkCallbackFunc is a function invoked for each record in a `metadata.json` file with the record's
+// original key and its compact JSON encoding (without a trailing newline).
+type WalkCallbackFunc func(context.Context, string, []byte) error
+
+// Walk parses 'r' one top-level key at a time, invoking 'cb' for each record as it is decoded. Only a
+// single record is held in memory at any given moment and records are delivered in the order they occur
+// in 'r' so that the output of successive runs is identical. If 'ctx' is cancelled Walk stops and returns
+// ctx.Err().
+func Walk(ctx context.Context, r io.Reader, opts *WalkOptions, cb WalkCallbackFunc) error {
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	tok, err := dec.Token()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read opening token, %w", err)
+	}
+
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return fmt.Errorf("Expected top-level JSON object but found %v", tok)
+	}
+
+	for dec.More() {
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			// pass
+		}
+
+		tok, err := dec.Token()
+
+		if err != nil {
+			return fmt.Errorf("Failed to read key, %w", err)
+		}
+
+		key, ok := tok.(string)
+
+		if !ok {
+			return fmt.Errorf("Expected string key but found %v", tok)
+		}
+
+		var raw json.RawMessage
+
+		err = dec.Decode(&raw)
+
+		if err != nil {
+			return fmt.Errorf("Failed to decode record for key %s, %w", key, err)
+		}
+
+		body, err := compactRecord(key, raw, opts.KeyProperty)
+
+		if err != nil {
+			return err
+		}
+
+		err = cb(ctx, key, body)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = dec.Token()
+
+	if err != nil {
+		return fmt.Errorf("Failed to read closing token, %w", err)
+	}
+
+	return nil
+}
+
+func compactRecord(key string, raw json.RawMessage, key_property string) ([]byte, error) {
+
+	var buf bytes.Buffer
+
+	err := json.Compact(&buf, raw)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compact record for key %s, %w", key, err)
+	}
+
+	body := buf.Bytes()
+
+	if key_property == "" {
+		return body, nil
+	}
+
+	if len(body) < 2 || body[0] != '{' {
+		return nil, fmt.Errorf("Record for key %s is not a JSON object", key)
+	}
+
+	path := strings.NewReplacer(".", `\.`, "*", `\*`, "?", `\?`).Replace(key_property)
+
+	if gjson.GetBytes(body, path).Exists() {
+		return body, nil
+	}
+
+	enc_prop, err := json.Marshal(key_property)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode key property, %w", err)
+	}
+
+	enc_key, err := json.Marshal(key)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to encode key %s, %w", key, err)
+	}
+
+	out := make([]byte, 0, len(body)+len(enc_prop)+len(enc_key)+2)
+	out = append(out, '{')
+	out = append(out, enc_prop...)
+	out = append(out, ':')
+	out = append(out, enc_key...)
+
+	if len(body) > 2 {
+		out = append(out, ',')
+	}
+
+	out = append(out, body[1:]...)
+	return out, nil
+}
@@ -0,0 +1,148 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func walkRecords(t *testing.T, input string, opts *WalkOptions) ([]string, []string) {
+
+	t.Helper()
+
+	keys := make([]string, 0)
+	records := make([]string, 0)
+
+	cb := func(ctx context.Context, key string, body []byte) error {
+		keys = append(keys, key)
+		records = append(records, string(body))
+		return nil
+	}
+
+	err := Walk(context.Background(), strings.NewReader(input), opts, cb)
+
+	if err != nil {
+		t.Fatalf("Failed to walk records, %v", err)
+	}
+
+	return keys, records
+}
+
+func TestWalk(t *testing.T) {
+
+	// Keys are deliberately out of order and records are spread over multiple lines
+
+	input := `{
+	"z-3": {"id": "3", "title": "Three"},
+	"a-1": {
+		"id": "1",
+		"title": "One",
+		"subject": ["a", "b"]
+	},
+	"m-2": {"id": "2", "metadata_key": "original"},
+	"e-4": {},
+	"a.b": {"nested": {"metadata_key": "not top-level"}}
+}`
+
+	opts := &WalkOptions{
+		KeyProperty: DEFAULT_KEY_PROPERTY,
+	}
+
+	keys, records := walkRecords(t, input, opts)
+
+	expected_keys := []string{"z-3", "a-1", "m-2", "e-4", "a.b"}
+
+	expected_records := []string{
+		`{"metadata_key":"z-3","id":"3","title":"Three"}`,
+		`{"metadata_key":"a-1","id":"1","title":"One","subject":["a","b"]}`,
+		// Existing properties are not replaced
+		`{"id":"2","metadata_key":"original"}`,
+		`{"metadata_key":"e-4"}`,
+		`{"metadata_key":"a.b","nested":{"metadata_key":"not top-level"}}`,
+	}
+
+	if strings.Join(keys, ",") != strings.Join(expected_keys, ",") {
+		t.Fatalf("Unexpected keys %v", keys)
+	}
+
+	for idx, r := range records {
+
+		if r != expected_records[idx] {
+			t.Fatalf("Unexpected record for %s, got %s expected %s", keys[idx], r, expected_records[idx])
+		}
+	}
+
+	// Successive runs should produce identical output
+
+	for i := 0; i < 5; i++ {
+
+		_, again := walkRecords(t, input, opts)
+
+		if strings.Join(again, "\n") != strings.Join(records, "\n") {
+			t.Fatalf("Expected output to be identical between runs")
+		}
+	}
+}
+
+func TestWalkKeyProperty(t *testing.T) {
+
+	input := `{"k": {"id": "1", "a": {"b": "nested"}}}`
+
+	tests := map[string]string{
+		"":     `{"id":"1","a":{"b":"nested"}}`,
+		"id":   `{"id":"1","a":{"b":"nested"}}`,
+		"a.b":  `{"a.b":"k","id":"1","a":{"b":"nested"}}`,
+		`q"uo`: `{"q\"uo":"k","id":"1","a":{"b":"nested"}}`,
+	}
+
+	for prop, expected := range tests {
+
+		_, records := walkRecords(t, input, &WalkOptions{KeyProperty: prop})
+
+		if len(records) != 1 || records[0] != expected {
+			t.Fatalf("Unexpected records for key property '%s', %v", prop, records)
+		}
+	}
+}
+
+func TestWalkErrors(t *testing.T) {
+
+	tests := []string{
+		``,
+		`[]`,
+		`{"a": {"id": "1"}`,
+		`{"a": "not an object"}`,
+		`{"a": {"id": }}`,
+	}
+
+	for _, input := range tests {
+
+		cb := func(ctx context.Context, key string, body []byte) error {
+			return nil
+		}
+
+		err := Walk(context.Background(), strings.NewReader(input), &WalkOptions{KeyProperty: DEFAULT_KEY_PROPERTY}, cb)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to fail", input)
+		}
+	}
+}
+
+func TestWalkCallbackError(t *testing.T) {
+
+	cb_err := errors.New("Stop")
+	count := 0
+
+	cb := func(ctx context.Context, key string, body []byte) error {
+		count += 1
+		return cb_err
+	}
+
+	err := Walk(context.Background(), strings.NewReader(`{"a": {}, "b": {}}`), &WalkOptions{}, cb)
+
+	if !errors.Is(err, cb_err) || count != 1 {
+		t.Fatalf("Expected walk to stop after the first callback error, got %v after %d records", err, count)
+	}
+}
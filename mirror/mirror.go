@@ -0,0 +1,362 @@
+// package mirror provides methods for copying new or changed objects from one bucket to another.
+package mirror
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The metadata key used to record the ETag of the source object a target object was copied from.
+const METADATA_SOURCE_ETAG string = "datajam-source-etag"
+
+// The metadata key used to record the modification time of the source object a target object was copied from.
+const METADATA_SOURCE_MODTIME string = "datajam-source-modtime"
+
+// ACTION_COPY signals that an object was (or, during a dry run, would be) copied.
+const ACTION_COPY string = "copy"
+
+// ACTION_SKIP signals that an object was unchanged and not copied.
+const ACTION_SKIP string = "skip"
+
+// ACTION_ERROR signals that an object could not be copied.
+const ACTION_ERROR string = "error"
+
+// SyncOptions defines options for syncing two buckets.
+type SyncOptions struct {
+	// Zero or more prefixes to limit the objects synced. If empty every object in the source bucket is synced.
+	Prefixes []string
+	// The maximum number of objects to copy concurrently.
+	Workers int
+	// If true the objects that would be copied are reported but nothing is written to the target bucket.
+	DryRun bool
+	// An optional function invoked with the result for each object as it is completed.
+	Callback func(context.Context, *ObjectReport)
+}
+
+// Report describes the outcome of a sync.
+type Report struct {
+	Started  time.Time       `json:"started"`
+	Finished time.Time       `json:"finished"`
+	DryRun   bool            `json:"dry_run"`
+	Prefixes []string        `json:"prefixes,omitempty"`
+	Copied   int64           `json:"copied"`
+	Skipped  int64           `json:"skipped"`
+	Failed   int64           `json:"failed"`
+	Bytes    int64           `json:"bytes"`
+	Objects  []*ObjectReport `json:"objects"`
+}
+
+// ObjectReport describes the outcome of syncing an individual object.
+type ObjectReport struct {
+	Key    string `json:"key"`
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+	Size   int64  `json:"size"`
+	MD5    string `json:"md5,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Sync copies objects in 'source' to 'target' that do not exist in 'target' or whose size, ETag or modification time
+// have changed since they were last copied. Checksums are verified against the MD5 hash reported by 'source', when
+// available, and recorded in the returned Report. Errors copying individual objects are recorded in the Report rather
+// than returned; Sync only returns an error if 'source' can not be listed or 'ctx' is cancelled.
+func Sync(ctx context.Context, source *blob.Bucket, target *blob.Bucket, opts *SyncOptions) (*Report, error) {
+
+	report := &Report{
+		Started:  time.Now(),
+		DryRun:   opts.DryRun,
+		Prefixes: opts.Prefixes,
+		Objects:  make([]*ObjectReport, 0),
+	}
+
+	workers := opts.Workers
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	prefixes := opts.Prefixes
+
+	if len(prefixes) == 0 {
+		prefixes = []string{""}
+	}
+
+	mu := new(sync.Mutex)
+
+	record := func(obj_report *ObjectReport) {
+
+		mu.Lock()
+
+		report.Objects = append(report.Objects, obj_report)
+
+		switch obj_report.Action {
+		case ACTION_COPY:
+			report.Copied += 1
+			report.Bytes += obj_report.Size
+		case ACTION_SKIP:
+			report.Skipped += 1
+		default:
+			report.Failed += 1
+		}
+
+		mu.Unlock()
+
+		if opts.Callback != nil {
+			opts.Callback(ctx, obj_report)
+		}
+	}
+
+	objects_ch := make(chan *blob.ListObject)
+	wg := new(sync.WaitGroup)
+
+	for i := 0; i < workers; i++ {
+
+		wg.Add(1)
+
+		go func() {
+
+			defer wg.Done()
+
+			for obj := range objects_ch {
+				record(syncObject(ctx, source, target, obj, opts))
+			}
+		}()
+	}
+
+	var list_err error
+	seen := make(map[string]bool)
+
+	for _, prefix := range prefixes {
+
+		list_err = listObjects(ctx, source, prefix, seen, objects_ch)
+
+		if list_err != nil {
+			break
+		}
+	}
+
+	close(objects_ch)
+	wg.Wait()
+
+	sort.Slice(report.Objects, func(i, j int) bool {
+		return report.Objects[i].Key < report.Objects[j].Key
+	})
+
+	report.Finished = time.Now()
+
+	if list_err != nil {
+		return report, list_err
+	}
+
+	return report, ctx.Err()
+}
+
+func listObjects(ctx context.Context, source *blob.Bucket, prefix string, seen map[string]bool, objects_ch chan<- *blob.ListObject) error {
+
+	iter := source.List(&blob.ListOptions{
+		Prefix: prefix,
+	})
+
+	for {
+
+		obj, err := iter.Next(ctx)
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("Failed to list objects with prefix '%s', %w", prefix, err)
+		}
+
+		// Overlapping prefixes would otherwise copy the same object twice
+
+		if obj.IsDir || seen[obj.Key] || strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+
+		seen[obj.Key] = true
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case objects_ch <- obj:
+			// pass
+		}
+	}
+}
+
+func syncObject(ctx context.Context, source *blob.Bucket, target *blob.Bucket, obj *blob.ListObject, opts *SyncOptions) *ObjectReport {
+
+	obj_report := &ObjectReport{
+		Key:  obj.Key,
+		Size: obj.Size,
+	}
+
+	fail := func(err error) *ObjectReport {
+		obj_report.Action = ACTION_ERROR
+		obj_report.Error = err.Error()
+		return obj_report
+	}
+
+	if ctx.Err() != nil {
+		return fail(ctx.Err())
+	}
+
+	src_attrs, err := source.Attributes(ctx, obj.Key)
+
+	if err != nil {
+		return fail(fmt.Errorf("Failed to read source attributes, %w", err))
+	}
+
+	reason, err := changed(ctx, src_attrs, target, obj.Key)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	if reason == "" {
+		obj_report.Action = ACTION_SKIP
+		return obj_report
+	}
+
+	obj_report.Action = ACTION_COPY
+	obj_report.Reason = reason
+
+	if len(src_attrs.MD5) > 0 {
+		obj_report.MD5 = hex.EncodeToString(src_attrs.MD5)
+	}
+
+	if opts.DryRun {
+		return obj_report
+	}
+
+	err = copyObject(ctx, source, target, obj.Key, src_attrs, obj_report)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	return obj_report
+}
+
+// changed returns the reason 'key' needs to be copied to 'target', or "" if it is unchanged.
+func changed(ctx context.Context, src_attrs *blob.Attributes, target *blob.Bucket, key string) (string, error) {
+
+	tgt_attrs, err := target.Attributes(ctx, key)
+
+	if err != nil {
+
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			return "new", nil
+		}
+
+		return "", fmt.Errorf("Failed to read target attributes, %w", err)
+	}
+
+	if tgt_attrs.Size != src_attrs.Size {
+		return "size", nil
+	}
+
+	if len(src_attrs.MD5) > 0 && len(tgt_attrs.MD5) > 0 {
+
+		if hex.EncodeToString(src_attrs.MD5) != hex.EncodeToString(tgt_attrs.MD5) {
+			return "checksum", nil
+		}
+
+		return "", nil
+	}
+
+	if src_attrs.ETag != "" {
+
+		if tgt_attrs.Metadata[METADATA_SOURCE_ETAG] != src_attrs.ETag {
+			return "etag", nil
+		}
+
+		return "", nil
+	}
+
+	if src_attrs.ModTime.Format(time.RFC3339Nano) != tgt_attrs.Metadata[METADATA_SOURCE_MODTIME] {
+		return "modtime", nil
+	}
+
+	return "", nil
+}
+
+// copyObject streams 'key' from 'source' to 'target' verifying its MD5 checksum, if 'source' reports one, and
+// recording its checksums in 'obj_report'.
+func copyObject(ctx context.Context, source *blob.Bucket, target *blob.Bucket, key string, src_attrs *blob.Attributes, obj_report *ObjectReport) error {
+
+	r, err := source.NewReader(ctx, key, nil)
+
+	if err != nil {
+		return fmt.Errorf("Failed to open source object, %w", err)
+	}
+
+	defer r.Close()
+
+	wr_opts := &blob.WriterOptions{
+		ContentType: src_attrs.ContentType,
+		ContentMD5:  src_attrs.MD5,
+		Metadata: map[string]string{
+			METADATA_SOURCE_ETAG:    src_attrs.ETag,
+			METADATA_SOURCE_MODTIME: src_attrs.ModTime.Format(time.RFC3339Nano),
+		},
+	}
+
+	wr_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wr, err := target.NewWriter(wr_ctx, key, wr_opts)
+
+	if err != nil {
+		return fmt.Errorf("Failed to open target object, %w", err)
+	}
+
+	md5_h := md5.New()
+	sha256_h := sha256.New()
+
+	n, err := io.Copy(io.MultiWriter(wr, md5_h, sha256_h), r)
+
+	if err != nil {
+
+		// Cancelling the context before closing the writer discards the partial object
+		cancel()
+		wr.Close()
+
+		return fmt.Errorf("Failed to copy object, %w", err)
+	}
+
+	md5_hex := hex.EncodeToString(md5_h.Sum(nil))
+
+	if len(src_attrs.MD5) > 0 && md5_hex != hex.EncodeToString(src_attrs.MD5) {
+
+		cancel()
+		wr.Close()
+
+		return fmt.Errorf("Checksum mismatch, expected MD5 %x but got %s", src_attrs.MD5, md5_hex)
+	}
+
+	err = wr.Close()
+
+	if err != nil {
+		return fmt.Errorf("Failed to write target object, %w", err)
+	}
+
+	obj_report.Size = n
+	obj_report.MD5 = md5_hex
+	obj_report.SHA256 = hex.EncodeToString(sha256_h.Sum(nil))
+
+	return nil
+}
@@ -0,0 +1,247 @@
+package mirror
+
+import (
+	"context"
+	"crypto/md5"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+	"gocloud.dev/gcerrors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeObject(t *testing.T, bucket *blob.Bucket, key string, body string, metadata map[string]string) {
+
+	t.Helper()
+
+	err := bucket.WriteAll(context.Background(), key, []byte(body), &blob.WriterOptions{Metadata: metadata})
+
+	if err != nil {
+		t.Fatalf("Failed to write %s, %v", key, err)
+	}
+}
+
+func TestChanged(t *testing.T) {
+
+	ctx := context.Background()
+
+	modtime := time.Date(1901, 12, 25, 0, 0, 0, 0, time.UTC)
+	other_modtime := modtime.Add(time.Hour)
+
+	checksum := func(body string) []byte {
+		sum := md5.Sum([]byte(body))
+		return sum[:]
+	}
+
+	copied_metadata := map[string]string{
+		METADATA_SOURCE_ETAG:    "etag-1",
+		METADATA_SOURCE_MODTIME: modtime.Format(time.RFC3339Nano),
+	}
+
+	// Each test changes the source attributes of a target object written with 'copied_metadata'. The size is
+	// compared first, then the MD5 checksum if both sides have one, then the ETag recorded when the object was
+	// copied and finally its modification time.
+
+	tests := map[string]struct {
+		target   string
+		source   *blob.Attributes
+		expected string
+	}{
+		"unchanged": {
+			target:   "abcd",
+			source:   &blob.Attributes{Size: 4, MD5: checksum("abcd"), ETag: "etag-1", ModTime: modtime},
+			expected: "",
+		},
+		"size before checksum": {
+			target:   "abcd",
+			source:   &blob.Attributes{Size: 5, MD5: checksum("abcde"), ETag: "etag-2", ModTime: other_modtime},
+			expected: "size",
+		},
+		"checksum before etag": {
+			target:   "abcd",
+			source:   &blob.Attributes{Size: 4, MD5: checksum("wxyz"), ETag: "etag-2", ModTime: other_modtime},
+			expected: "checksum",
+		},
+		"matching checksum ignores etag and modtime": {
+			target:   "abcd",
+			source:   &blob.Attributes{Size: 4, MD5: checksum("abcd"), ETag: "etag-2", ModTime: other_modtime},
+			expected: "",
+		},
+		"etag before modtime": {
+			target:   "abcd",
+			source:   &blob.Attributes{Size: 4, ETag: "etag-2", ModTime: other_modtime},
+			expected: "etag",
+		},
+		"matching etag ignores modtime": {
+			target:   "abcd",
+			source:   &blob.Attributes{Size: 4, ETag: "etag-1", ModTime: other_modtime},
+			expected: "",
+		},
+		"modtime": {
+			target:   "abcd",
+			source:   &blob.Attributes{Size: 4, ModTime: other_modtime},
+			expected: "modtime",
+		},
+		"matching modtime": {
+			target:   "abcd",
+			source:   &blob.Attributes{Size: 4, ModTime: modtime},
+			expected: "",
+		},
+	}
+
+	target := memblob.OpenBucket(nil)
+	defer target.Close()
+
+	for name, test := range tests {
+
+		writeObject(t, target, "object", test.target, copied_metadata)
+
+		reason, err := changed(ctx, test.source, target, "object")
+
+		if err != nil {
+			t.Fatalf("Failed to compare %s, %v", name, err)
+		}
+
+		if reason != test.expected {
+			t.Fatalf("Unexpected reason for %s: '%s', expected '%s'", name, reason, test.expected)
+		}
+	}
+
+	reason, err := changed(ctx, tests["unchanged"].source, target, "missing")
+
+	if err != nil || reason != "new" {
+		t.Fatalf("Expected missing object to be new, got '%s', %v", reason, err)
+	}
+}
+
+func TestCopyObjectChecksumMismatch(t *testing.T) {
+
+	ctx := context.Background()
+
+	source := memblob.OpenBucket(nil)
+	defer source.Close()
+
+	target := memblob.OpenBucket(nil)
+	defer target.Close()
+
+	writeObject(t, source, "new.jsonl", "changed contents", nil)
+	writeObject(t, source, "existing.jsonl", "changed contents", nil)
+	writeObject(t, target, "existing.jsonl", "original contents", nil)
+
+	for _, key := range []string{"new.jsonl", "existing.jsonl"} {
+
+		src_attrs, err := source.Attributes(ctx, key)
+
+		if err != nil {
+			t.Fatalf("Failed to read attributes for %s, %v", key, err)
+		}
+
+		// Simulate the source reporting a checksum that does not match the bytes it returns
+
+		sum := md5.Sum([]byte("other contents"))
+		src_attrs.MD5 = sum[:]
+
+		obj_report := &ObjectReport{Key: key}
+
+		err = copyObject(ctx, source, target, key, src_attrs, obj_report)
+
+		if err == nil || !strings.Contains(err.Error(), "Checksum mismatch") {
+			t.Fatalf("Expected checksum mismatch copying %s, got %v", key, err)
+		}
+
+		if obj_report.MD5 != "" || obj_report.SHA256 != "" {
+			t.Fatalf("Expected failed copy not to record checksums")
+		}
+	}
+
+	// The partial object is discarded and an existing object is left untouched
+
+	_, err := target.Attributes(ctx, "new.jsonl")
+
+	if gcerrors.Code(err) != gcerrors.NotFound {
+		t.Fatalf("Expected partial object to be discarded, got %v", err)
+	}
+
+	body, err := target.ReadAll(ctx, "existing.jsonl")
+
+	if err != nil || string(body) != "original contents" {
+		t.Fatalf("Expected existing object to be unchanged, got '%s', %v", body, err)
+	}
+}
+
+func TestSync(t *testing.T) {
+
+	ctx := context.Background()
+
+	source := memblob.OpenBucket(nil)
+	defer source.Close()
+
+	target := memblob.OpenBucket(nil)
+	defer target.Close()
+
+	writeObject(t, source, "a/1.jsonl", "one", nil)
+	writeObject(t, source, "a/2.jsonl", "two", nil)
+	writeObject(t, source, "b/3.jsonl", "three", nil)
+
+	// Overlapping prefixes do not copy objects twice
+
+	opts := &SyncOptions{
+		Prefixes: []string{"a/", "a/1", "b/"},
+		Workers:  4,
+		DryRun:   true,
+	}
+
+	report, err := Sync(ctx, source, target, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to sync, %v", err)
+	}
+
+	if report.Copied != 3 || report.Bytes != 11 || len(report.Objects) != 3 {
+		t.Fatalf("Unexpected dry run report, %d copied", report.Copied)
+	}
+
+	_, err = target.Attributes(ctx, "a/1.jsonl")
+
+	if gcerrors.Code(err) != gcerrors.NotFound {
+		t.Fatalf("Expected dry run not to write anything, got %v", err)
+	}
+
+	opts.DryRun = false
+
+	report, err = Sync(ctx, source, target, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to sync, %v", err)
+	}
+
+	if report.Copied != 3 || report.Failed != 0 || report.Objects[0].Key != "a/1.jsonl" || report.Objects[0].Reason != "new" || report.Objects[0].SHA256 == "" {
+		t.Fatalf("Unexpected report %v", report.Objects[0])
+	}
+
+	body, err := target.ReadAll(ctx, "b/3.jsonl")
+
+	if err != nil || string(body) != "three" {
+		t.Fatalf("Unexpected target object '%s', %v", body, err)
+	}
+
+	writeObject(t, source, "a/2.jsonl", "TWO", nil)
+	writeObject(t, source, "b/3.jsonl", "three!", nil)
+
+	report, err = Sync(ctx, source, target, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to sync, %v", err)
+	}
+
+	reasons := make([]string, len(report.Objects))
+
+	for idx, obj := range report.Objects {
+		reasons[idx] = obj.Action + ":" + obj.Reason
+	}
+
+	if strings.Join(reasons, ",") != "skip:,copy:checksum,copy:size" || report.Skipped != 1 || report.Copied != 2 {
+		t.Fatalf("Unexpected results %v", reasons)
+	}
+}
@@ -0,0 +1,176 @@
+// package oembed provides methods for deriving oEmbed records from Library of Congress records.
+package oembed
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/record"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The name of the oEmbed provider for Library of Congress records.
+const PROVIDER_NAME string = "Library of Congress"
+
+// The URL of the oEmbed provider for Library of Congress records.
+const PROVIDER_URL string = "https://www.loc.gov/"
+
+// ErrNoImages is returned by OEmbedRecordsFromRecord for records that do not have any images.
+var ErrNoImages = errors.New("Record has no images")
+
+// Photo is a struct representing an oEmbed "photo" record.
+type Photo struct {
+	Version         string `json:"version"`
+	Type            string `json:"type"`
+	Width           int    `json:"width"`
+	Height          int    `json:"height"`
+	Title           string `json:"title"`
+	URL             string `json:"url"`
+	AuthorName      string `json:"author_name,omitempty"`
+	AuthorURL       string `json:"author_url,omitempty"`
+	ProviderName    string `json:"provider_name"`
+	ProviderURL     string `json:"provider_url"`
+	ThumbnailURL    string `json:"thumbnail_url,omitempty"`
+	ThumbnailWidth  int    `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight int    `json:"thumbnail_height,omitempty"`
+	License         string `json:"license,omitempty"`
+	ObjectURI       string `json:"object_uri,omitempty"`
+}
+
+type image struct {
+	URL    string
+	Width  int
+	Height int
+}
+
+// OEmbedRecordsFromRecord returns one oEmbed "photo" record for each image associated with 'rec'. Images are derived
+// from the 'image_url' property. ErrNoImages is returned if 'rec' has no images whose dimensions are known.
+func OEmbedRecordsFromRecord(rec *record.Record) ([]*Photo, error) {
+
+	images := imagesFromRecord(rec)
+
+	if len(images) == 0 {
+		return nil, ErrNoImages
+	}
+
+	title := rec.Title.String()
+	author := ""
+	license := ""
+
+	if rec.Item != nil {
+
+		if rec.Item.Title != "" {
+			title = rec.Item.Title.String()
+		}
+
+		author = rec.Item.Contributors.Join("; ")
+		license = rec.Item.RightsInformation.String()
+	}
+
+	if author == "" {
+		author = rec.Contributor.Join("; ")
+	}
+
+	// The smallest image is used as the thumbnail for all the records
+
+	thumb := images[0]
+
+	for _, im := range images {
+
+		if im.Width < thumb.Width {
+			thumb = im
+		}
+	}
+
+	photos := make([]*Photo, len(images))
+
+	for idx, im := range images {
+
+		ph := &Photo{
+			Version:         "1.0",
+			Type:            "photo",
+			Width:           im.Width,
+			Height:          im.Height,
+			Title:           title,
+			URL:             im.URL,
+			AuthorName:      author,
+			ProviderName:    PROVIDER_NAME,
+			ProviderURL:     PROVIDER_URL,
+			ThumbnailURL:    thumb.URL,
+			ThumbnailWidth:  thumb.Width,
+			ThumbnailHeight: thumb.Height,
+			License:         license,
+			ObjectURI:       rec.URL.String(),
+		}
+
+		photos[idx] = ph
+	}
+
+	return photos, nil
+}
+
+// imagesFromRecord returns the unique list of images associated with 'rec'. LoC image URLs encode dimensions in
+// the URL fragment (for example "...1s05884r.jpg#h=329&w=640") which are removed from the final URL. Images
+// without dimensions are skipped since oEmbed "photo" records must have a width and a height.
+//
+// The 'item.service_medium' property is not used. It is a copy of one of the 'image_url' URLs without the
+// dimensions fragment so, on its own, it can never produce a valid record and, when it does match an 'image_url'
+// entry, that entry has already been included.
+func imagesFromRecord(rec *record.Record) []*image {
+
+	images := make([]*image, 0)
+	seen := make(map[string]bool)
+
+	for _, str_url := range rec.ImageURL {
+
+		im, err := parseImageURL(str_url)
+
+		if err != nil {
+			continue
+		}
+
+		if im.Width <= 0 || im.Height <= 0 {
+			continue
+		}
+
+		if seen[im.URL] {
+			continue
+		}
+
+		seen[im.URL] = true
+		images = append(images, im)
+	}
+
+	return images
+}
+
+func parseImageURL(str_url string) (*image, error) {
+
+	u, err := url.Parse(strings.TrimSpace(str_url))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse image URL, %w", err)
+	}
+
+	if u.Scheme == "" {
+		u.Scheme = "https"
+	}
+
+	im := &image{}
+
+	if u.Fragment != "" {
+
+		q, err := url.ParseQuery(u.Fragment)
+
+		if err == nil {
+			im.Width, _ = strconv.Atoi(q.Get("w"))
+			im.Height, _ = strconv.Atoi(q.Get("h"))
+		}
+
+		u.Fragment = ""
+	}
+
+	im.URL = u.String()
+	return im, nil
+}
@@ -0,0 +1,162 @@
+package oembed
+
+import (
+	"errors"
+	"github.com/aaronland/go-libraryofcongress-datajam/record"
+	"testing"
+)
+
+func TestParseImageURL(t *testing.T) {
+
+	tests := []struct {
+		url    string
+		image  image
+		is_err bool
+	}{
+		{"https://tile.loc.gov/image-services/1s05884r.jpg#h=329&w=640", image{"https://tile.loc.gov/image-services/1s05884r.jpg", 640, 329}, false},
+		{"  https://tile.loc.gov/1s05884r.jpg#w=150&h=100  ", image{"https://tile.loc.gov/1s05884r.jpg", 150, 100}, false},
+		{"//tile.loc.gov/1s05884r.jpg#h=329&w=640", image{"https://tile.loc.gov/1s05884r.jpg", 640, 329}, false},
+		{"http://tile.loc.gov/1s05884r.jpg?q=1#h=329&w=640", image{"http://tile.loc.gov/1s05884r.jpg?q=1", 640, 329}, false},
+		{"https://tile.loc.gov/1s05884r.jpg", image{"https://tile.loc.gov/1s05884r.jpg", 0, 0}, false},
+		{"https://tile.loc.gov/1s05884r.jpg#page=1", image{"https://tile.loc.gov/1s05884r.jpg", 0, 0}, false},
+		{"https://tile.loc.gov/1s05884r.jpg#h=tall&w=640", image{"https://tile.loc.gov/1s05884r.jpg", 640, 0}, false},
+		{"https://tile.loc.gov/1s05884r.jpg#h=%zz", image{}, true},
+		{"://tile.loc.gov", image{}, true},
+	}
+
+	for _, test := range tests {
+
+		im, err := parseImageURL(test.url)
+
+		if test.is_err {
+
+			if err == nil {
+				t.Fatalf("Expected '%s' to fail", test.url)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to parse '%s', %v", test.url, err)
+		}
+
+		if *im != test.image {
+			t.Fatalf("Unexpected image for '%s', %v", test.url, *im)
+		}
+	}
+}
+
+func TestOEmbedRecordsFromRecord(t *testing.T) {
+
+	body := []byte(`{
+"title": "Record title",
+"url": "https://www.loc.gov/item/2005691196/",
+"contributor": ["fallback"],
+"image_url": [
+	"https://tile.loc.gov/1s05884_150px.jpg#h=117&w=150",
+	"https://tile.loc.gov/1s05884r.jpg#h=329&w=640",
+	"https://tile.loc.gov/1s05884r.jpg#h=329&w=640",
+	"https://tile.loc.gov/1s05884v.jpg",
+	"https://tile.loc.gov/1s05884u.tif#h=1646&w=3200"
+],
+"item": {
+	"title": "Item title",
+	"contributors": ["Keystone View Company", "Underwood & Underwood"],
+	"rights_information": "No known restrictions",
+	"service_medium": "https://tile.loc.gov/1s05884_150px.jpg"
+}
+}`)
+
+	rec, err := record.Unmarshal(body)
+
+	if err != nil {
+		t.Fatalf("Failed to unmarshal record, %v", err)
+	}
+
+	photos, err := OEmbedRecordsFromRecord(rec)
+
+	if err != nil {
+		t.Fatalf("Failed to derive oEmbed records, %v", err)
+	}
+
+	// Duplicate images and images without dimensions are skipped
+
+	expected := []image{
+		{"https://tile.loc.gov/1s05884_150px.jpg", 150, 117},
+		{"https://tile.loc.gov/1s05884r.jpg", 640, 329},
+		{"https://tile.loc.gov/1s05884u.tif", 3200, 1646},
+	}
+
+	if len(photos) != len(expected) {
+		t.Fatalf("Expected %d records, got %d", len(expected), len(photos))
+	}
+
+	for idx, ph := range photos {
+
+		if ph.URL != expected[idx].URL || ph.Width != expected[idx].Width || ph.Height != expected[idx].Height {
+			t.Fatalf("Unexpected image for record %d, %s (%dx%d)", idx, ph.URL, ph.Width, ph.Height)
+		}
+
+		if ph.Version != "1.0" || ph.Type != "photo" || ph.ProviderName != PROVIDER_NAME || ph.ProviderURL != PROVIDER_URL {
+			t.Fatalf("Unexpected oEmbed properties for record %d, %v", idx, ph)
+		}
+
+		if ph.Title != "Item title" || ph.AuthorName != "Keystone View Company; Underwood & Underwood" || ph.License != "No known restrictions" || ph.ObjectURI != "https://www.loc.gov/item/2005691196/" {
+			t.Fatalf("Unexpected record properties for record %d, %v", idx, ph)
+		}
+
+		// The smallest image is the thumbnail for every record
+
+		if ph.ThumbnailURL != expected[0].URL || ph.ThumbnailWidth != 150 || ph.ThumbnailHeight != 117 {
+			t.Fatalf("Unexpected thumbnail for record %d, %v", idx, ph)
+		}
+	}
+}
+
+func TestOEmbedRecordsFromRecordFallbacks(t *testing.T) {
+
+	body := []byte(`{
+"title": "Record title",
+"contributor": ["Keystone View Company"],
+"image_url": ["https://tile.loc.gov/1s05884r.jpg#h=329&w=640"]
+}`)
+
+	rec, err := record.Unmarshal(body)
+
+	if err != nil {
+		t.Fatalf("Failed to unmarshal record, %v", err)
+	}
+
+	photos, err := OEmbedRecordsFromRecord(rec)
+
+	if err != nil {
+		t.Fatalf("Failed to derive oEmbed records, %v", err)
+	}
+
+	if len(photos) != 1 || photos[0].Title != "Record title" || photos[0].AuthorName != "Keystone View Company" || photos[0].License != "" {
+		t.Fatalf("Unexpected records %v", photos[0])
+	}
+}
+
+func TestOEmbedRecordsFromRecordNoImages(t *testing.T) {
+
+	for _, body := range []string{
+		`{"title": "No images"}`,
+		`{"image_url": ["https://tile.loc.gov/1s05884r.jpg"]}`,
+		`{"item": {"service_medium": "https://tile.loc.gov/1s05884_150px.jpg"}}`,
+	} {
+
+		rec, err := record.Unmarshal([]byte(body))
+
+		if err != nil {
+			t.Fatalf("Failed to unmarshal record, %v", err)
+		}
+
+		_, err = OEmbedRecordsFromRecord(rec)
+
+		if !errors.Is(err, ErrNoImages) {
+			t.Fatalf("Expected ErrNoImages for %s, got %v", body, err)
+		}
+	}
+}
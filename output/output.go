@@ -0,0 +1,287 @@
+// package output provides methods for writing Library of Congress records, in the formats shared by the emit and
+// search tools, to an io.Writer.
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/dates"
+	"github.com/aaronland/go-libraryofcongress-datajam/oembed"
+	proj "github.com/aaronland/go-libraryofcongress-datajam/projection"
+	"github.com/aaronland/go-libraryofcongress-datajam/record"
+	"github.com/sfomuseum/go-csvdict"
+	"github.com/tidwall/pretty"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// WriterOptions defines options for creating a Writer.
+type WriterOptions struct {
+	// Emit records as a JSON list rather than line-separated JSON.
+	JSON bool
+	// Format (pretty-print) the JSON output for each record.
+	FormatJSON bool
+	// Emit oEmbed "photo" records, one for each image associated with a record, rather than records themselves.
+	// Records without any images of a known size are skipped.
+	OEmbed bool
+	// Append the properties derived by dates.AppendProperties to each record. This is ignored if OEmbed is true.
+	DeriveDates bool
+	// An optional projection applied to each (oEmbed) record.
+	Projection *proj.Projection
+	// Emit records as comma-separated rows, using the columns defined by Columns, rather than JSON. The JSON and
+	// Projection options must not be set and the FormatJSON option is ignored.
+	CSV bool
+	// Emit records as tab-separated rows. The same rules as the CSV option apply.
+	TSV bool
+	// A projection defining the columns of CSV (or TSV) rows. This is required if CSV or TSV is true and ignored
+	// otherwise.
+	Columns *proj.Projection
+	// The string used to join array values, and flattened object values, in CSV rows.
+	ArraySeparator string
+}
+
+// Writer writes Library of Congress records to an io.Writer. It is safe for concurrent use.
+type Writer struct {
+	wr      io.Writer
+	options *WriterOptions
+	mu      *sync.Mutex
+	csv_wr  *csvdict.Writer
+	count   uint32
+}
+
+// Validate returns an error if 'opts' combines CSV (or TSV) output with options it does not support.
+func (opts *WriterOptions) Validate() error {
+
+	if !opts.CSV && !opts.TSV {
+		return nil
+	}
+
+	if opts.CSV && opts.TSV {
+		return fmt.Errorf("CSV and TSV output are mutually exclusive")
+	}
+
+	if opts.JSON || opts.Projection != nil {
+		return fmt.Errorf("CSV and TSV output can not be combined with JSON output or a projection")
+	}
+
+	if opts.Columns == nil || len(opts.Columns.Columns()) == 0 {
+		return fmt.Errorf("CSV and TSV output require one or more columns")
+	}
+
+	return nil
+}
+
+// NewWriter returns a new Writer that writes to 'wr', starting with a CSV header or the opening bracket of a JSON
+// list if necessary. It returns an error if 'opts' is not valid.
+func NewWriter(wr io.Writer, opts *WriterOptions) (*Writer, error) {
+
+	err := opts.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Writer{
+		wr:      wr,
+		options: opts,
+		mu:      new(sync.Mutex),
+	}
+
+	if opts.CSV || opts.TSV {
+
+		csv_wr, err := csvdict.NewWriter(wr, opts.Columns.Columns())
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create CSV writer, %w", err)
+		}
+
+		if opts.TSV {
+			csv_wr.Writer.Comma = '\t'
+		}
+
+		err = csv_wr.WriteHeader()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to write header, %w", err)
+		}
+
+		w.csv_wr = csv_wr
+		return w, nil
+	}
+
+	if opts.JSON {
+
+		_, err := wr.Write([]byte("["))
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to write JSON list, %w", err)
+		}
+	}
+
+	return w, nil
+}
+
+// Write writes 'rec', or its oEmbed records, transformed according to the writer's options. Nothing is written
+// once 'ctx' has been cancelled.
+func (w *Writer) Write(ctx context.Context, rec *record.Record) error {
+
+	records := make([][]byte, 0)
+
+	if w.options.OEmbed {
+
+		oembed_records, err := oembed.OEmbedRecordsFromRecord(rec)
+
+		if errors.Is(err, oembed.ErrNoImages) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("Failed to derive oEmbed records for %s, %w", rec.ItemId(), err)
+		}
+
+		for _, o_rec := range oembed_records {
+
+			body, err := json.Marshal(o_rec)
+
+			if err != nil {
+				return fmt.Errorf("Failed to marshal oEmbed record for %s, %w", rec.ItemId(), err)
+			}
+
+			records = append(records, body)
+		}
+
+	} else {
+		records = append(records, rec.Body())
+	}
+
+	for idx, body := range records {
+
+		if w.options.DeriveDates && !w.options.OEmbed {
+
+			d_body, err := dates.AppendProperties(body)
+
+			if err != nil {
+				return fmt.Errorf("Failed to derive dates for %s, %w", rec.ItemId(), err)
+			}
+
+			body = d_body
+		}
+
+		if w.options.Projection != nil {
+
+			p_body, err := w.options.Projection.Project(body)
+
+			if err != nil {
+				return fmt.Errorf("Failed to project record %s, %w", rec.ItemId(), err)
+			}
+
+			body = p_body
+		}
+
+		if w.options.FormatJSON && w.csv_wr == nil {
+			body = pretty.Pretty(body)
+		}
+
+		records[idx] = body
+	}
+
+	// Neither CSV writers nor JSON lists are safe for concurrent use so records are written while holding 'mu'
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, body := range records {
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		var err error
+
+		if w.csv_wr != nil {
+			err = w.writeRow(body)
+		} else {
+			err = w.writeJSON(body)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		atomic.AddUint32(&w.count, 1)
+	}
+
+	return nil
+}
+
+// Count returns the number of records (or oEmbed records) written.
+func (w *Writer) Count() uint32 {
+	return atomic.LoadUint32(&w.count)
+}
+
+// Close flushes any buffered CSV rows or writes the closing bracket of a JSON list. It does not close the
+// underlying io.Writer.
+func (w *Writer) Close() error {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.csv_wr != nil {
+
+		w.csv_wr.Flush()
+
+		err := w.csv_wr.Error()
+
+		if err != nil {
+			return fmt.Errorf("Failed to flush CSV writer, %w", err)
+		}
+
+		return nil
+	}
+
+	if w.options.JSON {
+
+		_, err := w.wr.Write([]byte("]"))
+
+		if err != nil {
+			return fmt.Errorf("Failed to write JSON list, %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (w *Writer) writeRow(body []byte) error {
+
+	err := w.csv_wr.WriteRow(w.options.Columns.Row(body, w.options.ArraySeparator))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write row, %w", err)
+	}
+
+	return nil
+}
+
+func (w *Writer) writeJSON(body []byte) error {
+
+	var buf bytes.Buffer
+
+	if w.options.JSON && w.Count() > 0 {
+		buf.WriteString(",")
+	}
+
+	buf.Write(bytes.TrimSpace(body))
+	buf.WriteString("\n")
+
+	_, err := w.wr.Write(buf.Bytes())
+
+	if err != nil {
+		return fmt.Errorf("Failed to write record, %w", err)
+	}
+
+	return nil
+}
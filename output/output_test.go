@@ -0,0 +1,51 @@
+package output
+
+import (
+	proj "github.com/aaronland/go-libraryofcongress-datajam/projection"
+	"testing"
+)
+
+func TestWriterOptionsValidate(t *testing.T) {
+
+	var fields proj.FieldFlags
+
+	err := fields.Set("id=item.id,title")
+
+	if err != nil {
+		t.Fatalf("Failed to parse columns, %v", err)
+	}
+
+	columns, err := proj.NewProjection(fields)
+
+	if err != nil {
+		t.Fatalf("Failed to create columns, %v", err)
+	}
+
+	tests := []struct {
+		label string
+		opts  *WriterOptions
+		valid bool
+	}{
+		{"json", &WriterOptions{JSON: true}, true},
+		{"json with ignored columns", &WriterOptions{JSON: true, Columns: columns}, true},
+		{"csv", &WriterOptions{CSV: true, Columns: columns}, true},
+		{"tsv", &WriterOptions{TSV: true, Columns: columns, FormatJSON: true}, true},
+		{"csv and tsv", &WriterOptions{CSV: true, TSV: true, Columns: columns}, false},
+		{"csv and json", &WriterOptions{CSV: true, JSON: true, Columns: columns}, false},
+		{"tsv and projection", &WriterOptions{TSV: true, Projection: columns, Columns: columns}, false},
+		{"csv without columns", &WriterOptions{CSV: true}, false},
+	}
+
+	for _, test := range tests {
+
+		err := test.opts.Validate()
+
+		if test.valid && err != nil {
+			t.Fatalf("Expected %s options to be valid, %v", test.label, err)
+		}
+
+		if !test.valid && err == nil {
+			t.Fatalf("Expected %s options to be invalid", test.label)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package profile
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// The number of bits of each hash used to select an hllSketch register.
+const hll_precision uint = 12
+
+// hllSketch is a HyperLogLog sketch used to estimate the number of distinct values at a path
+// without having to keep every value in memory.
+type hllSketch struct {
+	registers []uint8
+}
+
+func newHLLSketch() *hllSketch {
+
+	s := &hllSketch{
+		registers: make([]uint8, 1<<hll_precision),
+	}
+
+	return s
+}
+
+// add adds a value, identified by its hashValue hash 'x', to the sketch.
+func (s *hllSketch) add(x uint64) {
+
+	idx := x >> (64 - hll_precision)
+	rank := uint8(bits.LeadingZeros64(x<<hll_precision)) + 1
+
+	max_rank := uint8(64-hll_precision) + 1
+
+	if rank > max_rank {
+		rank = max_rank
+	}
+
+	if rank > s.registers[idx] {
+		s.registers[idx] = rank
+	}
+}
+
+func (s *hllSketch) estimate() int64 {
+
+	m := float64(len(s.registers))
+	alpha := 0.7213 / (1.0 + 1.079/m)
+
+	sum := 0.0
+	zeros := 0
+
+	for _, r := range s.registers {
+
+		sum += math.Pow(2.0, -float64(r))
+
+		if r == 0 {
+			zeros += 1
+		}
+	}
+
+	e := alpha * m * m / sum
+
+	// Use linear counting for small cardinalities
+
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+
+	return int64(math.Round(e))
+}
+
+// hashValue returns the 64-bit hash of 'value' used to identify it in an hllSketch and when counting values.
+func hashValue(value string) uint64 {
+
+	h := fnv.New64a()
+	h.Write([]byte(value))
+
+	return mix(h.Sum64())
+}
+
+// mix is the finalizer from SplitMix64, used to spread the bits of FNV hashes which are not
+// uniform enough on their own for short, similar values.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
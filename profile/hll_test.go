@@ -0,0 +1,67 @@
+package profile
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHLLSketch(t *testing.T) {
+
+	s := newHLLSketch()
+
+	if s.estimate() != 0 {
+		t.Fatalf("Expected an empty sketch to estimate 0, got %d", s.estimate())
+	}
+
+	// The standard error for 4096 registers is about 1.6% so allow for three times that
+
+	added := 0
+
+	for _, count := range []int{1, 10, 100, 1000, 10000, 100000, 1000000} {
+
+		for ; added < count; added++ {
+			s.add(hashValue(fmt.Sprintf("https://www.loc.gov/item/%d/", added)))
+		}
+
+		e := s.estimate()
+		err := math.Abs(float64(e)-float64(count)) / float64(count)
+
+		if err > 0.05 {
+			t.Fatalf("Estimate %d for %d values has an error of %.2f%%", e, count, err*100)
+		}
+	}
+}
+
+func TestHLLSketchDuplicates(t *testing.T) {
+
+	s := newHLLSketch()
+
+	for i := 0; i < 100; i++ {
+
+		for j := 0; j < 1000; j++ {
+			s.add(hashValue(fmt.Sprintf("value %d", j)))
+		}
+	}
+
+	e := s.estimate()
+
+	if e < 950 || e > 1050 {
+		t.Fatalf("Expected an estimate of about 1000 for repeated values, got %d", e)
+	}
+}
+
+func TestHashValue(t *testing.T) {
+
+	if hashValue("a") != hashValue("a") {
+		t.Fatalf("Expected equal values to have the same hash")
+	}
+
+	// Values which only differ after MAX_VALUE_LENGTH characters must have different hashes
+
+	prefix := string(make([]rune, MAX_VALUE_LENGTH))
+
+	if hashValue(prefix+"a") == hashValue(prefix+"b") {
+		t.Fatalf("Expected different values to have different hashes")
+	}
+}
@@ -0,0 +1,333 @@
+// package profile provides methods for reporting the coverage, types and values of every property in a set of
+// Library of Congress records.
+package profile
+
+import (
+	"github.com/tidwall/gjson"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// The default number of most common values reported for each path.
+const DEFAULT_TOP int = 10
+
+// The default number of example record IDs reported for each path.
+const DEFAULT_EXAMPLES int = 3
+
+// The default maximum number of distinct values counted for each path.
+const DEFAULT_MAX_VALUES int = 10000
+
+// The default (gjson) path used to derive the ID of a record.
+const DEFAULT_ID_PATH string = "item.id"
+
+// The path segment used to signal the elements of an array, for example "subject.#".
+const ARRAY_ELEMENTS string = "#"
+
+// The maximum length of the values reported for a path. Longer values are truncated, but are still counted as
+// distinct values.
+const MAX_VALUE_LENGTH int = 100
+
+// ProfileOptions defines options for creating a new Profile.
+type ProfileOptions struct {
+	// The number of most common values to report for each path.
+	Top int
+	// The number of example record IDs to report for each path.
+	Examples int
+	// The maximum number of distinct values counted for each path. Once this limit is reached new values are
+	// no longer counted, top values are approximate and cardinality is estimated.
+	MaxValues int
+	// The (gjson) path used to derive the ID of a record.
+	IDPath string
+}
+
+// Profile records the coverage, types and values of every path in a set of JSON records. It is safe for concurrent use.
+type Profile struct {
+	options *ProfileOptions
+	mu      *sync.Mutex
+	records int64
+	paths   map[string]*pathStats
+}
+
+type pathStats struct {
+	records   int64
+	types     map[string]int64
+	values    map[uint64]*Value
+	truncated bool
+	sketch    *hllSketch
+	examples  []string
+}
+
+// Report is the output of a Profile.
+type Report struct {
+	Records int64         `json:"records"`
+	Paths   []*PathReport `json:"paths"`
+}
+
+// PathReport is the profile of a single (gjson) path.
+type PathReport struct {
+	Path string `json:"path"`
+	// The number of records containing the path.
+	Records int64 `json:"records"`
+	// The fraction of all records containing the path.
+	Coverage float64 `json:"coverage"`
+	// The number of values of each JSON type (string, number, boolean, null, object, array) found at the path.
+	Types map[string]int64 `json:"types"`
+	// The number of distinct scalar values found at the path.
+	Cardinality int64 `json:"cardinality"`
+	// True if Cardinality is an estimate rather than an exact count.
+	CardinalityEstimated bool `json:"cardinality_estimated,omitempty"`
+	// The most common scalar values found at the path.
+	TopValues []*Value `json:"top_values"`
+	// A sample of IDs of records containing the path.
+	Examples []string `json:"examples"`
+}
+
+// Value is a scalar value and the number of times it occurs.
+type Value struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// observation is a single value found at a path in a record.
+type observation struct {
+	path  string
+	type_ string
+	value string
+	// True if 'value' should be counted (scalar values only).
+	scalar bool
+}
+
+// NewProfile returns a new Profile instance.
+func NewProfile(opts *ProfileOptions) *Profile {
+
+	if opts.IDPath == "" {
+		opts.IDPath = DEFAULT_ID_PATH
+	}
+
+	if opts.MaxValues <= 0 {
+		opts.MaxValues = DEFAULT_MAX_VALUES
+	}
+
+	p := &Profile{
+		options: opts,
+		mu:      new(sync.Mutex),
+		paths:   make(map[string]*pathStats),
+	}
+
+	return p
+}
+
+// Add records the paths and values of the JSON record 'body' in 'p'.
+func (p *Profile) Add(body []byte) {
+
+	id := gjson.GetBytes(body, p.options.IDPath).String()
+
+	observations := make([]*observation, 0)
+	observations = walk(gjson.ParseBytes(body), "", observations)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.records += 1
+
+	seen := make(map[string]bool)
+
+	for _, o := range observations {
+
+		s, ok := p.paths[o.path]
+
+		if !ok {
+
+			s = &pathStats{
+				types:    make(map[string]int64),
+				values:   make(map[uint64]*Value),
+				sketch:   newHLLSketch(),
+				examples: make([]string, 0),
+			}
+
+			p.paths[o.path] = s
+		}
+
+		if !seen[o.path] {
+
+			seen[o.path] = true
+			s.records += 1
+
+			if id != "" && len(s.examples) < p.options.Examples {
+				s.examples = append(s.examples, id)
+			}
+		}
+
+		s.types[o.type_] += 1
+
+		if !o.scalar {
+			continue
+		}
+
+		// Values are identified by the hash of their full value; only the copy kept for reporting is truncated
+
+		h := hashValue(o.value)
+		s.sketch.add(h)
+
+		v, counted := s.values[h]
+
+		switch {
+		case counted:
+			v.Count += 1
+		case len(s.values) < p.options.MaxValues:
+			s.values[h] = &Value{Value: truncate(o.value), Count: 1}
+		default:
+			s.truncated = true
+		}
+	}
+}
+
+// walk appends an observation for 'rsp', and each of its descendants, to 'observations'.
+func walk(rsp gjson.Result, path string, observations []*observation) []*observation {
+
+	switch {
+	case rsp.IsObject():
+
+		if path != "" {
+			observations = append(observations, &observation{path: path, type_: "object"})
+		}
+
+		rsp.ForEach(func(k gjson.Result, v gjson.Result) bool {
+			observations = walk(v, join(path, escape(k.String())), observations)
+			return true
+		})
+
+	case rsp.IsArray():
+
+		observations = append(observations, &observation{path: path, type_: "array"})
+
+		for _, v := range rsp.Array() {
+			observations = walk(v, join(path, ARRAY_ELEMENTS), observations)
+		}
+
+	default:
+
+		o := &observation{
+			path:   path,
+			type_:  typeOf(rsp),
+			value:  rsp.String(),
+			scalar: rsp.Type != gjson.Null,
+		}
+
+		observations = append(observations, o)
+	}
+
+	return observations
+}
+
+// Report returns the profile of each path recorded by 'p', sorted by path.
+func (p *Profile) Report() *Report {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r := &Report{
+		Records: p.records,
+		Paths:   make([]*PathReport, 0, len(p.paths)),
+	}
+
+	for path, s := range p.paths {
+
+		pr := &PathReport{
+			Path:      path,
+			Records:   s.records,
+			Types:     s.types,
+			TopValues: topValues(s.values, p.options.Top),
+			Examples:  s.examples,
+		}
+
+		if p.records > 0 {
+			pr.Coverage = float64(s.records) / float64(p.records)
+		}
+
+		if s.truncated {
+			pr.Cardinality = s.sketch.estimate()
+			pr.CardinalityEstimated = true
+		} else {
+			pr.Cardinality = int64(len(s.values))
+		}
+
+		r.Paths = append(r.Paths, pr)
+	}
+
+	sort.Slice(r.Paths, func(i, j int) bool {
+		return r.Paths[i].Path < r.Paths[j].Path
+	})
+
+	return r
+}
+
+func topValues(values map[uint64]*Value, count int) []*Value {
+
+	top := make([]*Value, 0, len(values))
+
+	for _, v := range values {
+		top = append(top, &Value{Value: v.Value, Count: v.Count})
+	}
+
+	sort.Slice(top, func(i, j int) bool {
+
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+
+		return top[i].Value < top[j].Value
+	})
+
+	if count < 0 {
+		count = 0
+	}
+
+	if len(top) > count {
+		top = top[:count]
+	}
+
+	return top
+}
+
+// truncate returns 'value' truncated to MAX_VALUE_LENGTH characters.
+func truncate(value string) string {
+
+	if utf8.RuneCountInString(value) <= MAX_VALUE_LENGTH {
+		return value
+	}
+
+	return string([]rune(value)[:MAX_VALUE_LENGTH]) + "…"
+}
+
+func typeOf(rsp gjson.Result) string {
+
+	switch rsp.Type {
+	case gjson.String:
+		return "string"
+	case gjson.Number:
+		return "number"
+	case gjson.True, gjson.False:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+func join(path string, key string) string {
+
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// escape escapes the characters in 'key' that have special meaning in gjson paths.
+func escape(key string) string {
+
+	r := strings.NewReplacer(".", `\.`, "*", `\*`, "?", `\?`)
+	return r.Replace(key)
+}
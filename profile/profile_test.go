@@ -0,0 +1,74 @@
+package profile
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestProfileLongValues(t *testing.T) {
+
+	p := NewProfile(&ProfileOptions{Top: 5})
+
+	// Values which share their first MAX_VALUE_LENGTH characters are still distinct
+
+	prefix := strings.Repeat("x", MAX_VALUE_LENGTH)
+
+	for i := 0; i < 3; i++ {
+
+		for j := 0; j <= i; j++ {
+			p.Add([]byte(fmt.Sprintf(`{"item":{"id":"%d-%d"},"description":"%s%d"}`, i, j, prefix, i)))
+		}
+	}
+
+	var pr *PathReport
+
+	for _, candidate := range p.Report().Paths {
+
+		if candidate.Path == "description" {
+			pr = candidate
+		}
+	}
+
+	if pr == nil {
+		t.Fatalf("Missing description path")
+	}
+
+	if pr.Cardinality != 3 || pr.CardinalityEstimated {
+		t.Fatalf("Expected a cardinality of 3, got %d", pr.Cardinality)
+	}
+
+	if len(pr.TopValues) != 3 {
+		t.Fatalf("Expected 3 top values, got %d", len(pr.TopValues))
+	}
+
+	for idx, v := range pr.TopValues {
+
+		if v.Count != int64(3-idx) {
+			t.Fatalf("Unexpected count %d for top value %d", v.Count, idx)
+		}
+
+		if v.Value != prefix+"…" {
+			t.Fatalf("Expected top value %d to be truncated, got '%s'", idx, v.Value)
+		}
+	}
+}
+
+func TestProfileMaxValues(t *testing.T) {
+
+	p := NewProfile(&ProfileOptions{Top: 1, MaxValues: 100})
+
+	for i := 0; i < 5000; i++ {
+		p.Add([]byte(fmt.Sprintf(`{"title":"title %d"}`, i)))
+	}
+
+	pr := p.Report().Paths[0]
+
+	if !pr.CardinalityEstimated {
+		t.Fatalf("Expected cardinality to be estimated")
+	}
+
+	if pr.Cardinality < 4750 || pr.Cardinality > 5250 {
+		t.Fatalf("Unexpected cardinality estimate %d", pr.Cardinality)
+	}
+}
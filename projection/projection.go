@@ -0,0 +1,303 @@
+// package projection provides methods for deriving slimmed-down JSON records containing a subset of properties.
+package projection
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"regexp"
+	"strings"
+)
+
+// The separator string used to distinguish {ALIAS}={PATH} strings.
+const SEP string = "="
+
+var re_alias = regexp.MustCompile(`^[A-Za-z0-9_\-:]+$`)
+
+// Field is a (gjson) path to a property in a record and the name of the key to store its value in.
+type Field struct {
+	Path  string
+	Alias string
+}
+
+// ParseField parses a {PATH} or {ALIAS}={PATH} string. If no alias is specified the path is used as the alias.
+// Aliases may only contain letters, numbers, "_", "-" and ":" characters so paths which contain "=" (for example
+// "item.contributors.#(==\"x\")") are not mistaken for an alias.
+func ParseField(str string) (*Field, error) {
+
+	str = strings.TrimSpace(str)
+
+	if str == "" {
+		return nil, fmt.Errorf("Empty field")
+	}
+
+	f := &Field{
+		Path:  str,
+		Alias: str,
+	}
+
+	parts := strings.SplitN(str, SEP, 2)
+
+	if len(parts) == 2 && re_alias.MatchString(parts[0]) {
+
+		if parts[1] == "" {
+			return nil, fmt.Errorf("Field '%s' is missing a path", str)
+		}
+
+		f.Alias = parts[0]
+		f.Path = parts[1]
+	}
+
+	return f, nil
+}
+
+// FieldFlags holds one or more Field instances that are created using {PATH} or {ALIAS}={PATH} strings. Multiple
+// fields may be passed in a single, comma-separated, string. Commas inside brackets, braces, parentheses or quotes
+// (for example "{title,date}" or "item.subjects.#(%\"a,b\")") are part of a path rather than separators.
+type FieldFlags []*Field
+
+// Return the string value of the set of Field instances.
+func (m *FieldFlags) String() string {
+
+	fields := make([]string, len(*m))
+
+	for idx, f := range *m {
+		fields[idx] = f.String()
+	}
+
+	return strings.Join(fields, ",")
+}
+
+// Parse one or more comma-separated {PATH} or {ALIAS}={PATH} strings and store them as Field instances.
+func (m *FieldFlags) Set(value string) error {
+
+	for _, str := range splitFields(value) {
+
+		f, err := ParseField(str)
+
+		if err != nil {
+			return err
+		}
+
+		*m = append(*m, f)
+	}
+
+	return nil
+}
+
+// splitFields splits 'value' on commas that are not inside brackets, braces, parentheses or double quotes.
+// Backslash-escaped characters are never treated as separators.
+func splitFields(value string) []string {
+
+	fields := make([]string, 0)
+
+	depth := 0
+	quoted := false
+	escaped := false
+	start := 0
+
+	for i, r := range value {
+
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+			// pass
+		case r == '{' || r == '(' || r == '[':
+			depth += 1
+		case r == '}' || r == ')' || r == ']':
+
+			if depth > 0 {
+				depth -= 1
+			}
+
+		case r == ',' && depth == 0:
+			fields = append(fields, value[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(fields, value[start:])
+}
+
+// String returns the {ALIAS}={PATH} representation of 'f'.
+func (f *Field) String() string {
+
+	if f.Alias == f.Path {
+		return f.Path
+	}
+
+	return f.Alias + SEP + f.Path
+}
+
+// Projection derives JSON objects containing the values of a list of fields.
+type Projection struct {
+	Fields []*Field
+	// If true fields with no value are omitted rather than being assigned a null value.
+	OmitEmpty bool
+}
+
+// NewProjection returns a new Projection for 'fields' ensuring that each alias is unique.
+func NewProjection(fields []*Field) (*Projection, error) {
+
+	seen := make(map[string]bool)
+
+	for _, f := range fields {
+
+		if seen[f.Alias] {
+			return nil, fmt.Errorf("Duplicate field name '%s'", f.Alias)
+		}
+
+		seen[f.Alias] = true
+	}
+
+	p := &Projection{
+		Fields: fields,
+	}
+
+	return p, nil
+}
+
+// Project returns a JSON object derived from 'body' whose keys are the aliases of the fields in 'p', in order,
+// and whose values are the (raw) values found at each field's path.
+func (p *Projection) Project(body []byte) ([]byte, error) {
+
+	var buf bytes.Buffer
+	buf.WriteString("{")
+
+	count := 0
+
+	for _, f := range p.Fields {
+
+		rsp := gjson.GetBytes(body, f.Path)
+
+		if !rsp.Exists() && p.OmitEmpty {
+			continue
+		}
+
+		enc_k, err := json.Marshal(f.Alias)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode field name '%s', %w", f.Alias, err)
+		}
+
+		if count > 0 {
+			buf.WriteString(",")
+		}
+
+		buf.Write(enc_k)
+		buf.WriteString(":")
+
+		if !rsp.Exists() {
+			buf.WriteString("null")
+		} else {
+
+			// Ensure that values from formatted records do not span multiple lines
+
+			err := json.Compact(&buf, []byte(rsp.Raw))
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to encode value for field '%s', %w", f.Alias, err)
+			}
+		}
+
+		count += 1
+	}
+
+	buf.WriteString("}")
+
+	return buf.Bytes(), nil
+}
+
+// Row returns the values of the fields in 'p', derived from 'body', as strings keyed by each field's alias
+// suitable for writing with a `csvdict.Writer`. See CellValue for details.
+func (p *Projection) Row(body []byte, sep string) map[string]string {
+
+	row := make(map[string]string)
+
+	for _, f := range p.Fields {
+		rsp := gjson.GetBytes(body, f.Path)
+		row[f.Alias] = CellValue(rsp, sep)
+	}
+
+	return row
+}
+
+// Columns returns the aliases of the fields in 'p', in order.
+func (p *Projection) Columns() []string {
+
+	columns := make([]string, len(p.Fields))
+
+	for idx, f := range p.Fields {
+		columns[idx] = f.Alias
+	}
+
+	return columns
+}
+
+// CellValue returns a string representation of 'rsp' suitable for a single (CSV) cell. Null and missing values are
+// returned as empty strings. The values of arrays are joined using 'sep', skipping empty values. Objects are flattened
+// in to a list of {KEY}={VALUE} strings, with nested keys joined by ".", which are also joined using 'sep'.
+func CellValue(rsp gjson.Result, sep string) string {
+
+	switch {
+	case !rsp.Exists() || rsp.Type == gjson.Null:
+		return ""
+	case rsp.IsArray():
+
+		values := make([]string, 0)
+
+		for _, r := range rsp.Array() {
+
+			v := CellValue(r, sep)
+
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+
+		return strings.Join(values, sep)
+
+	case rsp.IsObject():
+
+		pairs := make([]string, 0)
+		flattenObject(rsp, "", sep, &pairs)
+
+		return strings.Join(pairs, sep)
+
+	case rsp.Type == gjson.String:
+		return rsp.Str
+	default:
+		return rsp.Raw
+	}
+}
+
+func flattenObject(rsp gjson.Result, prefix string, sep string, pairs *[]string) {
+
+	rsp.ForEach(func(k gjson.Result, v gjson.Result) bool {
+
+		key := k.String()
+
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		if v.IsObject() {
+			flattenObject(v, key, sep, pairs)
+			return true
+		}
+
+		value := CellValue(v, sep)
+
+		if value != "" {
+			*pairs = append(*pairs, key+"="+value)
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,219 @@
+package projection
+
+import (
+	"github.com/tidwall/gjson"
+	"reflect"
+	"testing"
+)
+
+const testRecord string = `{
+  "title": "Capitol dome",
+  "date": "1865",
+  "subject": ["domes", "capitols", ""],
+  "item": {
+    "id": "2005691196",
+    "contributors": ["brady, mathew b.", "gardner, alexander, 1821-1882"],
+    "place": [{"title": "washington", "latitude": 38.89}, {"title": "d.c."}]
+  },
+  "resources": [{"files": 2, "image": "a.jpg", "tags": {"size": "large", "empty": null}}]
+}`
+
+func TestSplitFields(t *testing.T) {
+
+	tests := map[string][]string{
+		"title":                               {"title"},
+		"title,date":                          {"title", "date"},
+		"id=item.id,title":                    {"id=item.id", "title"},
+		"{title,date},id":                     {"{title,date}", "id"},
+		"summary={title,id:item.id},date":     {"summary={title,id:item.id}", "date"},
+		`item.contributors.#(%"*, 1821*"),id`: {`item.contributors.#(%"*, 1821*")`, "id"},
+		`subject|@join:{"sep":","},title`:     {`subject|@join:{"sep":","}`, "title"},
+		`[title,[date,id]],url`:               {`[title,[date,id]]`, "url"},
+		`item.contributors.#(=="a\,b"),title`: {`item.contributors.#(=="a\,b")`, "title"},
+		`a\,b,c`:                              {`a\,b`, "c"},
+		`"a,b",c`:                             {`"a,b"`, "c"},
+		"a),b":                                {"a)", "b"},
+		"a,,b":                                {"a", "", "b"},
+		"title,":                              {"title", ""},
+	}
+
+	for value, expected := range tests {
+
+		fields := splitFields(value)
+
+		if !reflect.DeepEqual(fields, expected) {
+			t.Fatalf("Unexpected fields for '%s': %q, expected %q", value, fields, expected)
+		}
+	}
+}
+
+func TestParseField(t *testing.T) {
+
+	tests := map[string]Field{
+		"title":                            {Path: "title", Alias: "title"},
+		" title ":                          {Path: "title", Alias: "title"},
+		"id=item.id":                       {Path: "item.id", Alias: "id"},
+		"loc:id=item.id":                   {Path: "item.id", Alias: "loc:id"},
+		"first_subject=subject.0":          {Path: "subject.0", Alias: "first_subject"},
+		`item.contributors.#(=="x")`:       {Path: `item.contributors.#(=="x")`, Alias: `item.contributors.#(=="x")`},
+		`brady=item.contributors.#(=="x")`: {Path: `item.contributors.#(=="x")`, Alias: "brady"},
+		"summary={title,date}":             {Path: "{title,date}", Alias: "summary"},
+		"=item.id":                         {Path: "=item.id", Alias: "=item.id"},
+	}
+
+	for str, expected := range tests {
+
+		f, err := ParseField(str)
+
+		if err != nil {
+			t.Fatalf("Failed to parse '%s', %v", str, err)
+		}
+
+		if *f != expected {
+			t.Fatalf("Unexpected field for '%s': %v, expected %v", str, f, expected)
+		}
+	}
+
+	for _, str := range []string{"", " ", "id="} {
+
+		_, err := ParseField(str)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to be invalid", str)
+		}
+	}
+}
+
+func TestFieldFlags(t *testing.T) {
+
+	var fields FieldFlags
+
+	err := fields.Set("id=item.id,{title,date}")
+
+	if err != nil {
+		t.Fatalf("Failed to set fields, %v", err)
+	}
+
+	err = fields.Set("subject|@reverse")
+
+	if err != nil {
+		t.Fatalf("Failed to set fields, %v", err)
+	}
+
+	if fields.String() != "id=item.id,{title,date},subject|@reverse" {
+		t.Fatalf("Unexpected fields %s", fields.String())
+	}
+
+	err = fields.Set("title,id=")
+
+	if err == nil {
+		t.Fatalf("Expected field without a path to be invalid")
+	}
+
+	_, err = NewProjection([]*Field{{Path: "item.id", Alias: "id"}, {Path: "id", Alias: "id"}})
+
+	if err == nil {
+		t.Fatalf("Expected duplicate aliases to be invalid")
+	}
+}
+
+func TestProject(t *testing.T) {
+
+	var fields FieldFlags
+
+	err := fields.Set(`id=item.id,summary={title,date},subjects=subject|@reverse,contributors=item.contributors.#(%"*1821*")#,places=item.place.#.title,count=subject.#,missing`)
+
+	if err != nil {
+		t.Fatalf("Failed to set fields, %v", err)
+	}
+
+	p, err := NewProjection(fields)
+
+	if err != nil {
+		t.Fatalf("Failed to create projection, %v", err)
+	}
+
+	if !reflect.DeepEqual(p.Columns(), []string{"id", "summary", "subjects", "contributors", "places", "count", "missing"}) {
+		t.Fatalf("Unexpected columns %v", p.Columns())
+	}
+
+	body, err := p.Project([]byte(testRecord))
+
+	if err != nil {
+		t.Fatalf("Failed to project record, %v", err)
+	}
+
+	expected := `{"id":"2005691196","summary":{"title":"Capitol dome","date":"1865"},"subjects":["","capitols","domes"],"contributors":["gardner, alexander, 1821-1882"],"places":["washington","d.c."],"count":3,"missing":null}`
+
+	if string(body) != expected {
+		t.Fatalf("Unexpected projection %s", body)
+	}
+
+	p.OmitEmpty = true
+
+	body, err = p.Project([]byte(testRecord))
+
+	if err != nil {
+		t.Fatalf("Failed to project record, %v", err)
+	}
+
+	if gjson.GetBytes(body, "missing").Exists() || !gjson.ValidBytes(body) {
+		t.Fatalf("Expected empty field to be omitted, %s", body)
+	}
+}
+
+func TestCellValue(t *testing.T) {
+
+	tests := map[string]string{
+		"title":                          "Capitol dome",
+		"missing":                        "",
+		"subject":                        "domes|capitols",
+		"subject.#":                      "3",
+		"item.contributors":              "brady, mathew b.|gardner, alexander, 1821-1882",
+		"item.place":                     "title=washington|latitude=38.89|title=d.c.",
+		"item.place.0":                   "title=washington|latitude=38.89",
+		"resources.0.tags":               "size=large",
+		"resources":                      "files=2|image=a.jpg|tags.size=large",
+		"{title,subjects:subject}":       "title=Capitol dome|subjects=domes|capitols",
+		"subject|@reverse":               "capitols|domes",
+		`item.contributors.#(%"brady*")`: "brady, mathew b.",
+		"[title,[date,item.id]]":         "Capitol dome|1865|2005691196",
+	}
+
+	for path, expected := range tests {
+
+		v := CellValue(gjson.Get(testRecord, path), "|")
+
+		if v != expected {
+			t.Fatalf("Unexpected cell value for '%s': '%s', expected '%s'", path, v, expected)
+		}
+	}
+
+	parsed := map[string]string{
+		`null`:                   "",
+		`false`:                  "false",
+		`""`:                     "",
+		`[["a", ""], null, "b"]`: "a|b",
+		`{"nested": {"deeper": {"value": true}}}`: "nested.deeper.value=true",
+		`{"a": {}, "b": [], "c": ""}`:             "",
+	}
+
+	for raw, expected := range parsed {
+
+		v := CellValue(gjson.Parse(raw), "|")
+
+		if v != expected {
+			t.Fatalf("Unexpected cell value for %s: '%s', expected '%s'", raw, v, expected)
+		}
+	}
+
+	var fields FieldFlags
+	fields.Set("id=item.id,subject,missing")
+
+	p, _ := NewProjection(fields)
+	row := p.Row([]byte(testRecord), "; ")
+
+	if !reflect.DeepEqual(row, map[string]string{"id": "2005691196", "subject": "domes; capitols", "missing": ""}) {
+		t.Fatalf("Unexpected row %v", row)
+	}
+}
@@ -0,0 +1,203 @@
+// package record provides typed structs for Library of Congress records and methods for decoding them.
+package record
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrInvalidRecord is the error (wrapped by) returned by Unmarshal when a record can not be decoded.
+var ErrInvalidRecord = errors.New("Failed to unmarshal record")
+
+// Record is a struct representing a single Library of Congress record.
+type Record struct {
+	AccessRestricted bool            `json:"access_restricted"`
+	Aka              Strings         `json:"aka,omitempty"`
+	Campaigns        Strings         `json:"campaigns,omitempty"`
+	Contributor      Strings         `json:"contributor,omitempty"`
+	Coordinates      Strings         `json:"coordinates,omitempty"`
+	Date             String          `json:"date,omitempty"`
+	Description      Strings         `json:"description,omitempty"`
+	Digitized        bool            `json:"digitized"`
+	ExtractTimestamp String          `json:"extract_timestamp,omitempty"`
+	Group            Strings         `json:"group,omitempty"`
+	HasSegments      bool            `json:"hassegments"`
+	Id               String          `json:"id,omitempty"`
+	ImageURL         Strings         `json:"image_url,omitempty"`
+	Index            int64           `json:"index,omitempty"`
+	Item             *Item           `json:"item,omitempty"`
+	Language         Strings         `json:"language,omitempty"`
+	LatLong          Float64s        `json:"latlong,omitempty"`
+	Location         Strings         `json:"location,omitempty"`
+	LocationStr      String          `json:"location_str,omitempty"`
+	Locations        json.RawMessage `json:"locations,omitempty"`
+	LonLat           Float64s        `json:"lonlat,omitempty"`
+	MimeType         Strings         `json:"mime_type,omitempty"`
+	OnlineFormat     Strings         `json:"online_format,omitempty"`
+	OriginalFormat   Strings         `json:"original_format,omitempty"`
+	OtherTitle       Strings         `json:"other_title,omitempty"`
+	PartOf           Strings         `json:"partof,omitempty"`
+	Related          *Related        `json:"related,omitempty"`
+	Reproductions    String          `json:"reproductions,omitempty"`
+	Resources        []*Resource     `json:"resources,omitempty"`
+	ShelfId          String          `json:"shelf_id,omitempty"`
+	Site             Strings         `json:"site,omitempty"`
+	Subject          Strings         `json:"subject,omitempty"`
+	Timestamp        String          `json:"timestamp,omitempty"`
+	Title            String          `json:"title,omitempty"`
+	Unrestricted     bool            `json:"unrestricted"`
+	URL              String          `json:"url,omitempty"`
+	body             []byte
+}
+
+// Item is a struct representing the 'item' property of a Library of Congress record.
+type Item struct {
+	AccessAdvisory       String    `json:"access_advisory,omitempty"`
+	CallNumber           String    `json:"call_number,omitempty"`
+	ContributorNames     Strings   `json:"contributor_names,omitempty"`
+	Contributors         Strings   `json:"contributors,omitempty"`
+	ControlNumber        String    `json:"control_number,omitempty"`
+	Created              String    `json:"created,omitempty"`
+	CreatedPublished     String    `json:"created_published,omitempty"`
+	CreatedPublishedDate String    `json:"created_published_date,omitempty"`
+	Creator              String    `json:"creator,omitempty"`
+	Creators             Strings   `json:"creators,omitempty"`
+	Date                 String    `json:"date,omitempty"`
+	DigitalId            Strings   `json:"digital_id,omitempty"`
+	DisplayOffsite       bool      `json:"display_offsite"`
+	Format               Strings   `json:"format,omitempty"`
+	Formats              []*Format `json:"formats,omitempty"`
+	Genre                Strings   `json:"genre,omitempty"`
+	Id                   String    `json:"id,omitempty"`
+	Language             Strings   `json:"language,omitempty"`
+	Link                 String    `json:"link,omitempty"`
+	Location             Strings   `json:"location,omitempty"`
+	Marc                 String    `json:"marc,omitempty"`
+	Medium               Strings   `json:"medium,omitempty"`
+	MediumBrief          String    `json:"medium_brief,omitempty"`
+	Mediums              Strings   `json:"mediums,omitempty"`
+	Modified             String    `json:"modified,omitempty"`
+	Notes                Strings   `json:"notes,omitempty"`
+	PartOf               String    `json:"part_of,omitempty"`
+	Place                []*Place  `json:"place,omitempty"`
+	Repository           String    `json:"repository,omitempty"`
+	ReproductionNumber   String    `json:"reproduction_number,omitempty"`
+	ResourceLinks        Strings   `json:"resource_links,omitempty"`
+	Restriction          String    `json:"restriction,omitempty"`
+	RightsAdvisory       String    `json:"rights_advisory,omitempty"`
+	RightsInformation    String    `json:"rights_information,omitempty"`
+	ServiceLow           String    `json:"service_low,omitempty"`
+	ServiceMedium        String    `json:"service_medium,omitempty"`
+	SortDate             String    `json:"sort_date,omitempty"`
+	SourceCreated        String    `json:"source_created,omitempty"`
+	SourceModified       String    `json:"source_modified,omitempty"`
+	StmtOfResponsibility String    `json:"stmt_of_responsibility,omitempty"`
+	SubjectHeadings      Strings   `json:"subject_headings,omitempty"`
+	Subjects             Strings   `json:"subjects,omitempty"`
+	Summary              String    `json:"summary,omitempty"`
+	ThumbGallery         String    `json:"thumb_gallery,omitempty"`
+	Title                String    `json:"title,omitempty"`
+}
+
+// Place is a struct representing an element in the 'item.place' property of a Library of Congress record.
+type Place struct {
+	Latitude  String `json:"latitude,omitempty"`
+	Link      String `json:"link,omitempty"`
+	Longitude String `json:"longitude,omitempty"`
+	Title     String `json:"title,omitempty"`
+}
+
+// Format is a struct representing an element in the 'item.formats' property of a Library of Congress record.
+type Format struct {
+	Link  String `json:"link,omitempty"`
+	Title String `json:"title,omitempty"`
+}
+
+// Related is a struct representing the 'related' property of a Library of Congress record.
+type Related struct {
+	GroupRecord String `json:"group_record,omitempty"`
+	Neighbors   String `json:"neighbors,omitempty"`
+}
+
+// Resource is a struct representing an element in the 'resources' property of a Library of Congress record.
+type Resource struct {
+	Caption String `json:"caption,omitempty"`
+	Files   int64  `json:"files,omitempty"`
+	Image   String `json:"image,omitempty"`
+	URL     String `json:"url,omitempty"`
+}
+
+// Unmarshal decodes 'body' in to a new Record instance. The original bytes are retained and
+// can be retrieved using the record's Body method. Properties whose values do not match the type of
+// their field (for example an object where a string is expected) are left empty; an error is only
+// returned if 'body' is not a valid JSON object.
+func Unmarshal(body []byte) (*Record, error) {
+
+	var r *Record
+
+	err := json.Unmarshal(body, &r)
+
+	if err != nil {
+
+		// json.Unmarshal skips fields with mismatched types and carries on decoding the rest of the
+		// record so these errors are not fatal
+
+		var type_err *json.UnmarshalTypeError
+
+		if !errors.As(err, &type_err) || type_err.Field == "" || r == nil {
+			return nil, fmt.Errorf("%w, %v", ErrInvalidRecord, err)
+		}
+	}
+
+	if r == nil {
+		return nil, fmt.Errorf("%w, record is empty", ErrInvalidRecord)
+	}
+
+	r.body = body
+	return r, nil
+}
+
+// Body returns the original JSON encoded bytes that 'r' was decoded from.
+func (r *Record) Body() []byte {
+	return r.body
+}
+
+// ItemId returns the value of the 'item.id' property or an empty string if it is not present.
+func (r *Record) ItemId() string {
+
+	if r.Item == nil {
+		return ""
+	}
+
+	return r.Item.Id.String()
+}
+
+// Thumbnail returns the (first) 'item.thumb_gallery' image URL or an empty string if it is not present.
+func (r *Record) Thumbnail() string {
+
+	if r.Item == nil {
+		return ""
+	}
+
+	return r.Item.ThumbGallery.String()
+}
+
+// LatLon returns the latitude and longitude derived from the 'latlong' property and a boolean
+// indicating whether the property contained a valid pair of coordinates.
+func (r *Record) LatLon() (float64, float64, bool) {
+
+	if len(r.LatLong) < 2 {
+		return 0.0, 0.0, false
+	}
+
+	for _, v := range r.LatLong[:2] {
+
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0.0, 0.0, false
+		}
+	}
+
+	return r.LatLong[0], r.LatLong[1], true
+}
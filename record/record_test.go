@@ -0,0 +1,145 @@
+package record
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUnmarshal(t *testing.T) {
+
+	// Mismatched types (an object title, a string index, a list of booleans for a bool) are not fatal
+
+	body := []byte(`{
+"id": 2005691196,
+"title": {"value": "Not a string"},
+"index": "first",
+"digitized": ["yes"],
+"subject": "single subject",
+"latlong": "38.8977,-77.0365",
+"item": {"id": ["2005691196"], "title": "Item title"}
+}`)
+
+	r, err := Unmarshal(body)
+
+	if err != nil {
+		t.Fatalf("Failed to unmarshal record, %v", err)
+	}
+
+	if string(r.Body()) != string(body) {
+		t.Fatalf("Expected original body to be retained")
+	}
+
+	if r.Id != "2005691196" || r.Title != "" || r.Index != 0 || r.Digitized {
+		t.Fatalf("Unexpected record %v", r)
+	}
+
+	if len(r.Subject) != 1 || r.Subject[0] != "single subject" {
+		t.Fatalf("Unexpected subjects %v", r.Subject)
+	}
+
+	lat, lon, ok := r.LatLon()
+
+	if !ok || lat != 38.8977 || lon != -77.0365 {
+		t.Fatalf("Unexpected coordinates %v, %v", lat, lon)
+	}
+
+	if r.ItemId() != "2005691196" || r.Item.Title != "Item title" {
+		t.Fatalf("Unexpected item %v", r.Item)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+
+	tests := []string{
+		``,
+		`null`,
+		`[]`,
+		`"record"`,
+		`{"id": "1"`,
+		`{"id": }`,
+	}
+
+	for _, body := range tests {
+
+		_, err := Unmarshal([]byte(body))
+
+		if !errors.Is(err, ErrInvalidRecord) {
+			t.Fatalf("Expected ErrInvalidRecord for '%s', got %v", body, err)
+		}
+	}
+}
+
+func TestRecordMissingItem(t *testing.T) {
+
+	r, err := Unmarshal([]byte(`{"title": "No item"}`))
+
+	if err != nil {
+		t.Fatalf("Failed to unmarshal record, %v", err)
+	}
+
+	if r.ItemId() != "" || r.Thumbnail() != "" {
+		t.Fatalf("Expected empty item ID and thumbnail")
+	}
+
+	_, _, ok := r.LatLon()
+
+	if ok {
+		t.Fatalf("Expected record without coordinates")
+	}
+}
+
+func TestRecordLatLon(t *testing.T) {
+
+	tests := map[string]bool{
+		`{"latlong": "38.8977,-77.0365"}`:           true,
+		`{"latlong": [38.8977, -77.0365, 10]}`:      true,
+		`{"latlong": ["x", 38.8977, -77.0365]}`:     false,
+		`{"latlong": [38.8977, null]}`:              false,
+		`{"latlong": "NaN,-77.0365"}`:               false,
+		`{"latlong": "38.8977"}`:                    false,
+		`{"latlong": {"lat": 38.8977, "lon": -77}}`: false,
+	}
+
+	for body, expected := range tests {
+
+		r, err := Unmarshal([]byte(body))
+
+		if err != nil {
+			t.Fatalf("Failed to unmarshal record, %v", err)
+		}
+
+		lat, lon, ok := r.LatLon()
+
+		if ok != expected {
+			t.Fatalf("Expected LatLon to return %t for %s", expected, body)
+		}
+
+		if ok && (lat != 38.8977 || lon != -77.0365) {
+			t.Fatalf("Unexpected coordinates for %s, %v, %v", body, lat, lon)
+		}
+	}
+}
+
+func TestRecordThumbnail(t *testing.T) {
+
+	tests := map[string]string{
+		`{"item": {"thumb_gallery": "https://example.com/a.jpg"}}`:                                "https://example.com/a.jpg",
+		`{"item": {"thumb_gallery": ["https://example.com/a.jpg", "https://example.com/b.jpg"]}}`: "https://example.com/a.jpg",
+		`{"item": {"thumb_gallery": ["", "https://example.com/b.jpg"]}}`:                          "https://example.com/b.jpg",
+		`{"item": {"thumb_gallery": {"url": "https://example.com/a.jpg"}}}`:                       "",
+		`{"item": {"id": "2005691196"}}`:                                                          "",
+	}
+
+	for body, expected := range tests {
+
+		r, err := Unmarshal([]byte(body))
+
+		if err != nil {
+			t.Fatalf("Failed to unmarshal record, %v", err)
+		}
+
+		if r.Thumbnail() != expected {
+			t.Fatalf("Unexpected thumbnail for %s: '%s', expected '%s'", body, r.Thumbnail(), expected)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// String is a string value that will be decoded from a JSON string, number, boolean or list of strings.
+// Library of Congress records are not always consistent about whether a property is a single value or
+// a list of values so in the case of a list the first non-empty value is used.
+type String string
+
+// String returns the string value of 's'.
+func (s String) String() string {
+	return string(s)
+}
+
+// UnmarshalJSON decodes 'b' in to 's' tolerating strings, numbers, booleans, nulls and lists. Values that can not
+// be represented as a string, like objects, are decoded as an empty string rather than returning an error.
+func (s *String) UnmarshalJSON(b []byte) error {
+
+	b = bytes.TrimSpace(b)
+
+	if len(b) == 0 || bytes.Equal(b, []byte("null")) {
+		*s = ""
+		return nil
+	}
+
+	switch b[0] {
+	case '"':
+
+		var str string
+
+		err := json.Unmarshal(b, &str)
+
+		if err != nil {
+			*s = ""
+			return nil
+		}
+
+		*s = String(str)
+		return nil
+
+	case '[':
+
+		var list Strings
+
+		err := json.Unmarshal(b, &list)
+
+		if err != nil {
+			*s = ""
+			return nil
+		}
+
+		*s = String(list.First())
+		return nil
+
+	case '{':
+		*s = ""
+		return nil
+
+	default:
+		*s = String(b)
+		return nil
+	}
+}
+
+// Strings is a list of strings that will be decoded from a JSON list or a single JSON scalar value.
+type Strings []string
+
+// First returns the first non-empty value in 's' or an empty string.
+func (s Strings) First() string {
+
+	for _, v := range s {
+
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// Join returns the values in 's' concatenated with 'sep'.
+func (s Strings) Join(sep string) string {
+	return strings.Join(s, sep)
+}
+
+// UnmarshalJSON decodes 'b' in to 's' tolerating both lists and scalar values. Objects, and values that can not be
+// decoded, are skipped rather than returning an error.
+func (s *Strings) UnmarshalJSON(b []byte) error {
+
+	b = bytes.TrimSpace(b)
+
+	if len(b) == 0 || bytes.Equal(b, []byte("null")) {
+		*s = nil
+		return nil
+	}
+
+	if b[0] != '[' {
+
+		var v String
+
+		err := json.Unmarshal(b, &v)
+
+		if err != nil || v == "" {
+			*s = Strings{}
+			return nil
+		}
+
+		*s = Strings{string(v)}
+		return nil
+	}
+
+	var raw []json.RawMessage
+
+	err := json.Unmarshal(b, &raw)
+
+	if err != nil {
+		*s = Strings{}
+		return nil
+	}
+
+	list := make(Strings, 0, len(raw))
+
+	for _, r := range raw {
+
+		r = bytes.TrimSpace(r)
+
+		// Nested lists are flattened; objects are skipped.
+
+		if len(r) > 0 && r[0] == '[' {
+
+			var nested Strings
+
+			err := json.Unmarshal(r, &nested)
+
+			if err != nil {
+				continue
+			}
+
+			list = append(list, nested...)
+			continue
+		}
+
+		if len(r) > 0 && r[0] == '{' {
+			continue
+		}
+
+		var v String
+
+		err := json.Unmarshal(r, &v)
+
+		if err != nil {
+			continue
+		}
+
+		list = append(list, string(v))
+	}
+
+	*s = list
+	return nil
+}
+
+// Float64s is a list of floating point numbers that will be decoded from a JSON list of numbers or
+// numeric strings, a single number or a single comma-separated string.
+type Float64s []float64
+
+// UnmarshalJSON decodes 'b' in to 'f' tolerating numbers, numeric strings and lists of either. Values that can not
+// be parsed as numbers, like "n/a", are decoded as NaN rather than returning an error so that every other value
+// keeps its position (for example the latitude and longitude in ["n/a", 38.8977, -77.0365] are not mistaken for
+// the first pair).
+func (f *Float64s) UnmarshalJSON(b []byte) error {
+
+	b = bytes.TrimSpace(b)
+
+	if len(b) == 0 || bytes.Equal(b, []byte("null")) || b[0] == '{' {
+		*f = Float64s{}
+		return nil
+	}
+
+	var raw []json.RawMessage
+
+	if b[0] == '[' {
+
+		err := json.Unmarshal(b, &raw)
+
+		if err != nil {
+			*f = Float64s{}
+			return nil
+		}
+
+	} else {
+		raw = []json.RawMessage{b}
+	}
+
+	values := make(Float64s, 0, len(raw))
+
+	for _, r := range raw {
+
+		r = bytes.TrimSpace(r)
+
+		// Lists and objects can not be a number but still occupy a position
+
+		if len(r) == 0 || r[0] == '[' || r[0] == '{' {
+			values = append(values, math.NaN())
+			continue
+		}
+
+		var str String
+
+		err := json.Unmarshal(r, &str)
+
+		if err != nil {
+			values = append(values, math.NaN())
+			continue
+		}
+
+		count := len(values)
+
+		for _, part := range strings.Split(str.String(), ",") {
+
+			part = strings.TrimSpace(part)
+
+			if part == "" {
+				continue
+			}
+
+			v, err := strconv.ParseFloat(part, 64)
+
+			if err != nil {
+				v = math.NaN()
+			}
+
+			values = append(values, v)
+		}
+
+		// Empty values in a list, like null or "", also occupy a position
+
+		if b[0] == '[' && len(values) == count {
+			values = append(values, math.NaN())
+		}
+	}
+
+	*f = values
+	return nil
+}
@@ -0,0 +1,131 @@
+package record
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+
+	tests := map[string]string{
+		`"Washington, D.C."`:          "Washington, D.C.",
+		`""`:                          "",
+		`"été"`:                       "été",
+		`1900`:                        "1900",
+		`-77.0365`:                    "-77.0365",
+		`1.5e3`:                       "1.5e3",
+		`true`:                        "true",
+		`false`:                       "false",
+		`null`:                        "",
+		`["", "first", "second"]`:     "first",
+		`[]`:                          "",
+		`[null, 1900]`:                "1900",
+		`[{"title": "skipped"}, "x"]`: "x",
+		`[["nested"], "x"]`:           "nested",
+		`{"title": "object"}`:         "",
+	}
+
+	for input, expected := range tests {
+
+		var s String
+
+		err := json.Unmarshal([]byte(input), &s)
+
+		if err != nil {
+			t.Fatalf("Failed to unmarshal %s, %v", input, err)
+		}
+
+		if s.String() != expected {
+			t.Fatalf("Unexpected value for %s, got '%s' expected '%s'", input, s, expected)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+
+	tests := map[string][]string{
+		`"a"`:                      {"a"},
+		`""`:                       {},
+		`1900`:                     {"1900"},
+		`true`:                     {"true"},
+		`null`:                     {},
+		`[]`:                       {},
+		`["a", "b"]`:               {"a", "b"},
+		`["a", 1, false]`:          {"a", "1", "false"},
+		`["a", {"b": 1}, "c"]`:     {"a", "c"},
+		`["a", ["b", ["c"]], "d"]`: {"a", "b", "c", "d"},
+		`{"a": "b"}`:               {},
+		`[null, "a"]`:              {"", "a"},
+	}
+
+	for input, expected := range tests {
+
+		var s Strings
+
+		err := json.Unmarshal([]byte(input), &s)
+
+		if err != nil {
+			t.Fatalf("Failed to unmarshal %s, %v", input, err)
+		}
+
+		if fmt.Sprintf("%q", []string(s)) != fmt.Sprintf("%q", expected) {
+			t.Fatalf("Unexpected value for %s, got %q expected %q", input, s, expected)
+		}
+	}
+}
+
+func TestStringsFirstJoin(t *testing.T) {
+
+	s := Strings{"", "a", "b"}
+
+	if s.First() != "a" {
+		t.Fatalf("Unexpected first value '%s'", s.First())
+	}
+
+	if s.Join("; ") != "; a; b" {
+		t.Fatalf("Unexpected joined value '%s'", s.Join("; "))
+	}
+
+	if (Strings{}).First() != "" || (Strings{""}).First() != "" {
+		t.Fatalf("Expected empty first value")
+	}
+}
+
+func TestFloat64s(t *testing.T) {
+
+	tests := map[string][]float64{
+		`38.8977`:                    {38.8977},
+		`"38.8977"`:                  {38.8977},
+		`"38.8977, -77.0365"`:        {38.8977, -77.0365},
+		`"38.8977,-77.0365,"`:        {38.8977, -77.0365},
+		`[38.8977, -77.0365]`:        {38.8977, -77.0365},
+		`["38.8977", "-77.0365"]`:    {38.8977, -77.0365},
+		`[38.8977, "n/a", -77.0365]`: {38.8977, math.NaN(), -77.0365},
+		`["x", 38.8977, -77.0365]`:   {math.NaN(), 38.8977, -77.0365},
+		`[null, [1], "", 2]`:         {math.NaN(), math.NaN(), math.NaN(), 2},
+		`"n/a, -77.0365"`:            {math.NaN(), -77.0365},
+		`"n/a"`:                      {math.NaN()},
+		`true`:                       {math.NaN()},
+		`null`:                       {},
+		`[]`:                         {},
+		`{"lat": 38.8977}`:           {},
+		`[{"lat": 38.8977}, 1]`:      {math.NaN(), 1},
+	}
+
+	for input, expected := range tests {
+
+		var f Float64s
+
+		err := json.Unmarshal([]byte(input), &f)
+
+		if err != nil {
+			t.Fatalf("Failed to unmarshal %s, %v", input, err)
+		}
+
+		if fmt.Sprintf("%v", []float64(f)) != fmt.Sprintf("%v", expected) {
+			t.Fatalf("Unexpected value for %s, got %v expected %v", input, f, expected)
+		}
+	}
+}
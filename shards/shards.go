@@ -0,0 +1,417 @@
+// package shards provides methods for writing line-separated JSON records to multiple, optionally compressed, files in a bucket.
+package shards
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/compression"
+	"github.com/tidwall/gjson"
+	"gocloud.dev/blob"
+	"hash"
+	"hash/fnv"
+	"io"
+	"path"
+	"sync"
+	"time"
+)
+
+// SHARD_BY_COUNT signals that a new shard should be started after a fixed number of records.
+const SHARD_BY_COUNT string = "count"
+
+// SHARD_BY_SIZE signals that a new shard should be started after a fixed number of (uncompressed) bytes.
+const SHARD_BY_SIZE string = "size"
+
+// SHARD_BY_HASH signals that records should be assigned to a fixed number of shards using a hash of a property value.
+const SHARD_BY_HASH string = "hash"
+
+// The default filename for shard manifests.
+const MANIFEST_FILENAME string = "manifest.json"
+
+// The default property used to assign records to shards when sharding by hash.
+const DEFAULT_HASH_PATH string = "item.id"
+
+// The maximum number of shards when sharding by hash. Every shard is open, and holding buffers, at the same time.
+const MAX_HASH_SHARDS int = 1000
+
+// ShardWriterOptions defines options for creating a new ShardWriter instance.
+type ShardWriterOptions struct {
+	// The bucket where shards and the manifest will be written.
+	Bucket *blob.Bucket
+	// The prefix used to name each shard. Shards are named "{PREFIX}-{NUMBER}.jsonl{COMPRESSION_EXTENSION}".
+	Prefix string
+	// The compression scheme to use for each shard. Valid options are: "" (none), "gzip" and "bzip2".
+	Compression string
+	// The sharding strategy. Valid options are: "count", "size" and "hash".
+	Strategy string
+	// The maximum number of records per shard when sharding by count.
+	MaxRecords int64
+	// The maximum number of uncompressed bytes per shard when sharding by size.
+	MaxBytes int64
+	// The number of shards when sharding by hash, up to MAX_HASH_SHARDS. Every shard stays open until the writer is
+	// closed so memory use grows with the number of shards: each one holds its own compression state (about 1MB
+	// for gzip or bzip2) as well as anything buffered by the bucket writer (for example 5MB for S3).
+	Shards int
+	// A valid tidwall/gjson path whose value is used to assign records to shards when sharding by hash.
+	HashPath string
+}
+
+// Manifest is a struct describing the shards produced by a ShardWriter.
+type Manifest struct {
+	Created     string           `json:"created"`
+	Strategy    string           `json:"strategy"`
+	Compression string           `json:"compression,omitempty"`
+	Records     int64            `json:"records"`
+	Shards      []*ManifestShard `json:"shards"`
+	// The reason the shards are incomplete, if the writer was closed with Abort.
+	Error string `json:"error,omitempty"`
+}
+
+// ManifestShard is a struct describing an individual shard.
+type ManifestShard struct {
+	// The path of the shard relative to the bucket root.
+	Path string `json:"path"`
+	// The number of records in the shard.
+	Records int64 `json:"records"`
+	// The number of uncompressed bytes in the shard.
+	Bytes int64 `json:"bytes"`
+	// The number of bytes written to the bucket, after compression.
+	StoredBytes int64 `json:"stored_bytes"`
+	// The SHA-256 checksum of the bytes written to the bucket.
+	SHA256 string `json:"sha256"`
+}
+
+// ShardWriter writes line-separated JSON records to multiple files in a bucket.
+type ShardWriter struct {
+	options  *ShardWriterOptions
+	mu       *sync.Mutex
+	current  *shard
+	shards   map[int]*shard
+	manifest []*ManifestShard
+	count    int64
+}
+
+type shard struct {
+	path   string
+	bucket *blob.Writer
+	cwr    io.WriteCloser
+	hash   hash.Hash
+	stored *countingWriter
+	bytes  int64
+	count  int64
+}
+
+type countingWriter struct {
+	count int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.count += int64(len(p))
+	return len(p), nil
+}
+
+// IsManifest returns a boolean value indicating whether 'uri', a bucket key, is a shard manifest file.
+func IsManifest(uri string) bool {
+	return path.Base(uri) == MANIFEST_FILENAME
+}
+
+// NewShardWriter returns a new ShardWriter instance configured by 'opts'.
+func NewShardWriter(ctx context.Context, opts *ShardWriterOptions) (*ShardWriter, error) {
+
+	if opts.Bucket == nil {
+		return nil, fmt.Errorf("Missing bucket")
+	}
+
+	if opts.Prefix == "" {
+		return nil, fmt.Errorf("Missing prefix")
+	}
+
+	switch opts.Compression {
+	case compression.NONE, compression.GZIP, compression.BZIP2:
+		// pass
+	default:
+		return nil, fmt.Errorf("Invalid compression '%s'", opts.Compression)
+	}
+
+	switch opts.Strategy {
+	case SHARD_BY_COUNT:
+
+		if opts.MaxRecords < 1 {
+			return nil, fmt.Errorf("Maximum number of records must be greater than zero")
+		}
+
+	case SHARD_BY_SIZE:
+
+		if opts.MaxBytes < 1 {
+			return nil, fmt.Errorf("Maximum number of bytes must be greater than zero")
+		}
+
+	case SHARD_BY_HASH:
+
+		if opts.Shards < 1 {
+			return nil, fmt.Errorf("Number of shards must be greater than zero")
+		}
+
+		if opts.Shards > MAX_HASH_SHARDS {
+			return nil, fmt.Errorf("Number of shards must not be greater than %d", MAX_HASH_SHARDS)
+		}
+
+		if opts.HashPath == "" {
+			opts.HashPath = DEFAULT_HASH_PATH
+		}
+
+	default:
+		return nil, fmt.Errorf("Invalid sharding strategy '%s'", opts.Strategy)
+	}
+
+	w := &ShardWriter{
+		options:  opts,
+		mu:       new(sync.Mutex),
+		shards:   make(map[int]*shard),
+		manifest: make([]*ManifestShard, 0),
+	}
+
+	return w, nil
+}
+
+// Write writes 'body', a single JSON record, to the appropriate shard. It is safe to call Write from multiple goroutines.
+func (w *ShardWriter) Write(ctx context.Context, body []byte) error {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var sh *shard
+
+	switch w.options.Strategy {
+	case SHARD_BY_HASH:
+
+		value := gjson.GetBytes(body, w.options.HashPath).String()
+
+		h := fnv.New32a()
+		h.Write([]byte(value))
+
+		idx := int(h.Sum32() % uint32(w.options.Shards))
+
+		s, ok := w.shards[idx]
+
+		if !ok {
+
+			new_s, err := w.newShard(ctx, idx)
+
+			if err != nil {
+				return err
+			}
+
+			w.shards[idx] = new_s
+			s = new_s
+		}
+
+		sh = s
+
+	default:
+
+		if w.current != nil && w.isFull(w.current) {
+
+			err := w.closeShard(w.current)
+
+			if err != nil {
+				return err
+			}
+
+			w.current = nil
+		}
+
+		if w.current == nil {
+
+			s, err := w.newShard(ctx, len(w.manifest))
+
+			if err != nil {
+				return err
+			}
+
+			w.current = s
+		}
+
+		sh = w.current
+	}
+
+	body = bytes.TrimSpace(body)
+
+	_, err := sh.cwr.Write(body)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write to %s, %w", sh.path, err)
+	}
+
+	_, err = sh.cwr.Write([]byte("\n"))
+
+	if err != nil {
+		return fmt.Errorf("Failed to write to %s, %w", sh.path, err)
+	}
+
+	sh.bytes += int64(len(body) + 1)
+	sh.count += 1
+	w.count += 1
+
+	return nil
+}
+
+// Close closes all open shards and writes a manifest file, named MANIFEST_FILENAME, alongside them.
+func (w *ShardWriter) Close(ctx context.Context) (*Manifest, error) {
+	return w.close(ctx, nil)
+}
+
+// Abort closes all open shards and writes a manifest file, named MANIFEST_FILENAME, alongside them whose "error"
+// property is 'reason'. It is used to signal that the shards written so far do not contain every record.
+func (w *ShardWriter) Abort(ctx context.Context, reason error) (*Manifest, error) {
+	return w.close(ctx, reason)
+}
+
+func (w *ShardWriter) close(ctx context.Context, reason error) (*Manifest, error) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.current != nil {
+
+		err := w.closeShard(w.current)
+
+		if err != nil {
+			return nil, err
+		}
+
+		w.current = nil
+	}
+
+	for idx := 0; idx < w.options.Shards; idx++ {
+
+		sh, ok := w.shards[idx]
+
+		if !ok {
+			continue
+		}
+
+		err := w.closeShard(sh)
+
+		if err != nil {
+			return nil, err
+		}
+
+		delete(w.shards, idx)
+	}
+
+	m := &Manifest{
+		Created:     time.Now().UTC().Format(time.RFC3339),
+		Strategy:    w.options.Strategy,
+		Compression: w.options.Compression,
+		Records:     w.count,
+		Shards:      w.manifest,
+	}
+
+	if reason != nil {
+		m.Error = reason.Error()
+	}
+
+	enc_m, err := json.MarshalIndent(m, "", "  ")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal manifest, %w", err)
+	}
+
+	manifest_path := w.manifestPath()
+
+	err = w.options.Bucket.WriteAll(ctx, manifest_path, enc_m, nil)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to write %s, %w", manifest_path, err)
+	}
+
+	return m, nil
+}
+
+func (w *ShardWriter) isFull(sh *shard) bool {
+
+	switch w.options.Strategy {
+	case SHARD_BY_COUNT:
+		return sh.count >= w.options.MaxRecords
+	case SHARD_BY_SIZE:
+		return sh.bytes >= w.options.MaxBytes
+	default:
+		return false
+	}
+}
+
+func (w *ShardWriter) manifestPath() string {
+
+	// Bucket keys are always separated by forward slashes, regardless of the operating system
+
+	dir := path.Dir(w.options.Prefix)
+
+	if dir == "." {
+		return MANIFEST_FILENAME
+	}
+
+	return path.Join(dir, MANIFEST_FILENAME)
+}
+
+func (w *ShardWriter) newShard(ctx context.Context, idx int) (*shard, error) {
+
+	shard_path := fmt.Sprintf("%s-%05d.jsonl%s", w.options.Prefix, idx+1, compression.Extension(w.options.Compression))
+
+	bucket_wr, err := w.options.Bucket.NewWriter(ctx, shard_path, nil)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create writer for %s, %w", shard_path, err)
+	}
+
+	h := sha256.New()
+	stored := &countingWriter{}
+
+	mw := io.MultiWriter(bucket_wr, h, stored)
+
+	cwr, err := compression.NewWriter(shard_path, mw)
+
+	if err != nil {
+		bucket_wr.Close()
+		return nil, err
+	}
+
+	sh := &shard{
+		path:   shard_path,
+		bucket: bucket_wr,
+		cwr:    cwr,
+		hash:   h,
+		stored: stored,
+	}
+
+	return sh, nil
+}
+
+func (w *ShardWriter) closeShard(sh *shard) error {
+
+	err := sh.cwr.Close()
+
+	if err != nil {
+		return fmt.Errorf("Failed to close compressor for %s, %w", sh.path, err)
+	}
+
+	err = sh.bucket.Close()
+
+	if err != nil {
+		return fmt.Errorf("Failed to close %s, %w", sh.path, err)
+	}
+
+	m := &ManifestShard{
+		Path:        sh.path,
+		Records:     sh.count,
+		Bytes:       sh.bytes,
+		StoredBytes: sh.stored.count,
+		SHA256:      hex.EncodeToString(sh.hash.Sum(nil)),
+	}
+
+	w.manifest = append(w.manifest, m)
+	return nil
+}
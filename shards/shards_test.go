@@ -0,0 +1,374 @@
+package shards
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/compression"
+	"github.com/tidwall/gjson"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+	"io"
+	"strings"
+	"testing"
+)
+
+func testRecords(count int) [][]byte {
+
+	records := make([][]byte, count)
+
+	for i := 0; i < count; i++ {
+		records[i] = []byte(fmt.Sprintf(`{"item":{"id":"%04d"}}`, i))
+	}
+
+	return records
+}
+
+// writeShards writes 'records' using a ShardWriter configured by 'opts' and returns its manifest.
+func writeShards(t *testing.T, opts *ShardWriterOptions, records [][]byte) *Manifest {
+
+	t.Helper()
+
+	ctx := context.Background()
+
+	wr, err := NewShardWriter(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create shard writer, %v", err)
+	}
+
+	for _, body := range records {
+
+		err := wr.Write(ctx, body)
+
+		if err != nil {
+			t.Fatalf("Failed to write record, %v", err)
+		}
+	}
+
+	m, err := wr.Close(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to close shard writer, %v", err)
+	}
+
+	return m
+}
+
+// checkManifest verifies that the shards in 'm' exist in 'bucket' with the sizes and checksums it describes, that
+// they contain 'expected' records between them and that the stored manifest, at 'manifest_path', matches 'm'. It
+// returns the records in each shard.
+func checkManifest(t *testing.T, bucket *blob.Bucket, m *Manifest, manifest_path string, expected int) [][]string {
+
+	t.Helper()
+
+	ctx := context.Background()
+
+	contents := make([][]string, len(m.Shards))
+	total := int64(0)
+
+	for idx, sh := range m.Shards {
+
+		stored, err := bucket.ReadAll(ctx, sh.Path)
+
+		if err != nil {
+			t.Fatalf("Failed to read %s, %v", sh.Path, err)
+		}
+
+		sum := sha256.Sum256(stored)
+
+		if sh.SHA256 != hex.EncodeToString(sum[:]) || sh.StoredBytes != int64(len(stored)) {
+			t.Fatalf("Stored bytes of %s do not match manifest", sh.Path)
+		}
+
+		r, err := compression.NewReader(sh.Path, bytes.NewReader(stored))
+
+		if err != nil {
+			t.Fatalf("Failed to create reader for %s, %v", sh.Path, err)
+		}
+
+		body, err := io.ReadAll(r)
+
+		if err != nil {
+			t.Fatalf("Failed to decompress %s, %v", sh.Path, err)
+		}
+
+		lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+
+		if sh.Bytes != int64(len(body)) || sh.Records != int64(len(lines)) {
+			t.Fatalf("Unexpected size of %s, %d bytes and %d records", sh.Path, len(body), len(lines))
+		}
+
+		contents[idx] = lines
+		total += sh.Records
+	}
+
+	if m.Records != int64(expected) || total != m.Records {
+		t.Fatalf("Expected %d records, manifest reports %d and shards contain %d", expected, m.Records, total)
+	}
+
+	enc_m, err := bucket.ReadAll(ctx, manifest_path)
+
+	if err != nil {
+		t.Fatalf("Failed to read manifest, %v", err)
+	}
+
+	var stored_m *Manifest
+
+	err = json.Unmarshal(enc_m, &stored_m)
+
+	if err != nil {
+		t.Fatalf("Failed to unmarshal manifest, %v", err)
+	}
+
+	if stored_m.Records != m.Records || len(stored_m.Shards) != len(m.Shards) || stored_m.Error != m.Error || stored_m.Strategy != m.Strategy {
+		t.Fatalf("Stored manifest does not match")
+	}
+
+	return contents
+}
+
+func TestShardByCount(t *testing.T) {
+
+	for _, c := range []string{compression.NONE, compression.GZIP, compression.BZIP2} {
+
+		bucket := memblob.OpenBucket(nil)
+		defer bucket.Close()
+
+		opts := &ShardWriterOptions{
+			Bucket:      bucket,
+			Prefix:      "data/records",
+			Compression: c,
+			Strategy:    SHARD_BY_COUNT,
+			MaxRecords:  2,
+		}
+
+		records := testRecords(5)
+		m := writeShards(t, opts, records)
+
+		if len(m.Shards) != 3 || m.Compression != c {
+			t.Fatalf("Expected 3 %s shards, got %d", c, len(m.Shards))
+		}
+
+		contents := checkManifest(t, bucket, m, "data/manifest.json", len(records))
+
+		for idx, sh := range m.Shards {
+
+			expected_path := fmt.Sprintf("data/records-%05d.jsonl%s", idx+1, compression.Extension(c))
+
+			if sh.Path != expected_path {
+				t.Fatalf("Unexpected shard path %s, expected %s", sh.Path, expected_path)
+			}
+		}
+
+		// Records are written, in order, without any surrounding whitespace
+
+		if strings.Join(contents[2], ",") != string(records[4]) || contents[0][1] != string(records[1]) {
+			t.Fatalf("Unexpected shard contents %v", contents)
+		}
+	}
+}
+
+func TestShardBySize(t *testing.T) {
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	records := testRecords(7)
+
+	// Each record is 23 bytes, including its newline, so a shard is full after its second record
+
+	opts := &ShardWriterOptions{
+		Bucket:   bucket,
+		Prefix:   "records",
+		Strategy: SHARD_BY_SIZE,
+		MaxBytes: 30,
+	}
+
+	m := writeShards(t, opts, records)
+	contents := checkManifest(t, bucket, m, MANIFEST_FILENAME, len(records))
+
+	if len(m.Shards) != 4 {
+		t.Fatalf("Expected 4 shards, got %d", len(m.Shards))
+	}
+
+	for idx, lines := range contents {
+
+		expected := 2
+
+		if idx == 3 {
+			expected = 1
+		}
+
+		if len(lines) != expected || m.Shards[idx].Bytes != int64(23*expected) {
+			t.Fatalf("Unexpected contents of shard %d, %v", idx, lines)
+		}
+	}
+}
+
+func TestShardByHash(t *testing.T) {
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	records := testRecords(100)
+
+	// Records with the same ID are always written to the same shard
+	records = append(records, records[:10]...)
+
+	opts := &ShardWriterOptions{
+		Bucket:   bucket,
+		Prefix:   "hashed/records",
+		Strategy: SHARD_BY_HASH,
+		Shards:   4,
+	}
+
+	m := writeShards(t, opts, records)
+
+	if opts.HashPath != DEFAULT_HASH_PATH {
+		t.Fatalf("Expected default hash path, got '%s'", opts.HashPath)
+	}
+
+	if len(m.Shards) != 4 {
+		t.Fatalf("Expected 4 shards, got %d", len(m.Shards))
+	}
+
+	contents := checkManifest(t, bucket, m, "hashed/manifest.json", len(records))
+
+	seen := make(map[string]string)
+
+	for idx, lines := range contents {
+
+		expected_path := fmt.Sprintf("hashed/records-%05d.jsonl", idx+1)
+
+		if m.Shards[idx].Path != expected_path {
+			t.Fatalf("Unexpected shard path %s, expected %s", m.Shards[idx].Path, expected_path)
+		}
+
+		for _, l := range lines {
+
+			id := gjson.Get(l, "item.id").String()
+			other, ok := seen[id]
+
+			if ok && other != expected_path {
+				t.Fatalf("Record %s written to %s and %s", id, other, expected_path)
+			}
+
+			seen[id] = expected_path
+		}
+	}
+
+	if len(seen) != 100 {
+		t.Fatalf("Expected 100 distinct records, got %d", len(seen))
+	}
+
+	// The number of shards is capped at MAX_HASH_SHARDS
+
+	for shards, ok := range map[int]bool{0: false, 1: true, MAX_HASH_SHARDS: true, MAX_HASH_SHARDS + 1: false} {
+
+		opts := &ShardWriterOptions{
+			Bucket:   bucket,
+			Prefix:   "capped/records",
+			Strategy: SHARD_BY_HASH,
+			Shards:   shards,
+		}
+
+		_, err := NewShardWriter(context.Background(), opts)
+
+		if (err == nil) != ok {
+			t.Fatalf("Unexpected result creating writer with %d shards, %v", shards, err)
+		}
+	}
+}
+
+func TestShardWriterAbort(t *testing.T) {
+
+	ctx := context.Background()
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	opts := &ShardWriterOptions{
+		Bucket:      bucket,
+		Prefix:      "partial/records",
+		Compression: compression.GZIP,
+		Strategy:    SHARD_BY_COUNT,
+		MaxRecords:  2,
+	}
+
+	wr, err := NewShardWriter(ctx, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create shard writer, %v", err)
+	}
+
+	for _, body := range testRecords(3) {
+
+		err := wr.Write(ctx, body)
+
+		if err != nil {
+			t.Fatalf("Failed to write record, %v", err)
+		}
+	}
+
+	m, err := wr.Abort(ctx, errors.New("Walk cancelled"))
+
+	if err != nil {
+		t.Fatalf("Failed to abort shard writer, %v", err)
+	}
+
+	if m.Error != "Walk cancelled" || len(m.Shards) != 2 {
+		t.Fatalf("Unexpected manifest for aborted writer, %v", m)
+	}
+
+	// The shards written before the writer was aborted are complete and readable
+
+	checkManifest(t, bucket, m, "partial/manifest.json", 3)
+}
+
+func TestNewShardWriterErrors(t *testing.T) {
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	invalid := []*ShardWriterOptions{
+		{Prefix: "records", Strategy: SHARD_BY_COUNT, MaxRecords: 1},
+		{Bucket: bucket, Strategy: SHARD_BY_COUNT, MaxRecords: 1},
+		{Bucket: bucket, Prefix: "records", Strategy: SHARD_BY_COUNT, MaxRecords: 1, Compression: "zip"},
+		{Bucket: bucket, Prefix: "records", Strategy: SHARD_BY_COUNT},
+		{Bucket: bucket, Prefix: "records", Strategy: SHARD_BY_SIZE},
+		{Bucket: bucket, Prefix: "records", Strategy: "random", MaxRecords: 1},
+	}
+
+	for _, opts := range invalid {
+
+		_, err := NewShardWriter(context.Background(), opts)
+
+		if err == nil {
+			t.Fatalf("Expected %v to be invalid", opts)
+		}
+	}
+}
+
+func TestIsManifest(t *testing.T) {
+
+	tests := map[string]bool{
+		"manifest.json":                  true,
+		"data/manifest.json":             true,
+		"data/nested/manifest.json":      true,
+		"data/records-00001.jsonl":       false,
+		"data/manifest.json.gz":          false,
+		"data/manifest.json/records.txt": false,
+	}
+
+	for uri, expected := range tests {
+
+		if IsManifest(uri) != expected {
+			t.Fatalf("Expected IsManifest(%s) to be %t", uri, expected)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package spatial
+
+import (
+	"github.com/paulmach/orb"
+	"strings"
+)
+
+// gazetteer maps (lower-cased) place names, as they appear in the 'location' property of Library of Congress
+// records, to coarse bounding boxes. The boxes are deliberately generous: they are only used to decide whether
+// a pair of coordinates is plausible for a record, and whether swapping its latitude and longitude would make it
+// more plausible, not to geocode anything. Names which are ambiguous (for example "georgia" or "washington") are omitted.
+var gazetteer = map[string]orb.Bound{
+
+	// Countries and regions
+
+	"united states":  newBound(-179.2, 18.9, -66.9, 71.4),
+	"canada":         newBound(-141.1, 41.6, -52.6, 83.2),
+	"mexico":         newBound(-118.4, 14.5, -86.7, 32.7),
+	"cuba":           newBound(-85.0, 19.8, -74.1, 23.3),
+	"puerto rico":    newBound(-67.3, 17.9, -65.2, 18.6),
+	"england":        newBound(-5.8, 49.9, 1.8, 55.9),
+	"scotland":       newBound(-7.6, 54.6, -0.7, 60.9),
+	"great britain":  newBound(-8.7, 49.8, 1.8, 60.9),
+	"united kingdom": newBound(-8.7, 49.8, 1.8, 60.9),
+	"ireland":        newBound(-10.5, 51.4, -6.0, 55.4),
+	"france":         newBound(-5.2, 41.3, 9.6, 51.1),
+	"germany":        newBound(5.8, 47.2, 15.1, 55.1),
+	"italy":          newBound(6.6, 36.6, 18.6, 47.1),
+	"spain":          newBound(-9.4, 35.9, 3.4, 43.8),
+	"serbia":         newBound(18.8, 42.2, 23.0, 46.2),
+	"greece":         newBound(19.3, 34.8, 28.3, 41.8),
+	"israel":         newBound(34.2, 29.4, 35.9, 33.4),
+	"lebanon":        newBound(35.1, 33.0, 36.7, 34.7),
+	"egypt":          newBound(24.6, 21.9, 36.9, 31.7),
+	"india":          newBound(68.1, 6.7, 97.4, 35.5),
+	"china":          newBound(73.5, 18.1, 134.8, 53.6),
+	"japan":          newBound(122.9, 24.0, 145.9, 45.6),
+
+	// Canadian provinces
+
+	"ontario":     newBound(-95.2, 41.6, -74.3, 56.9),
+	"quebec":      newBound(-79.8, 45.0, -57.1, 62.6),
+	"nova scotia": newBound(-66.4, 43.4, -59.7, 47.1),
+
+	// US states and territories
+
+	"alabama":              newBound(-88.5, 30.1, -84.9, 35.0),
+	"alaska":               newBound(-179.2, 51.2, -129.9, 71.4),
+	"arizona":              newBound(-114.9, 31.3, -109.0, 37.0),
+	"arkansas":             newBound(-94.7, 33.0, -89.6, 36.5),
+	"california":           newBound(-124.5, 32.5, -114.1, 42.0),
+	"colorado":             newBound(-109.1, 36.9, -102.0, 41.0),
+	"connecticut":          newBound(-73.8, 40.9, -71.8, 42.1),
+	"delaware":             newBound(-75.8, 38.4, -75.0, 39.9),
+	"district of columbia": newBound(-77.2, 38.8, -76.9, 39.0),
+	"washington d.c.":      newBound(-77.2, 38.8, -76.9, 39.0),
+	"florida":              newBound(-87.7, 24.4, -80.0, 31.0),
+	"hawaii":               newBound(-160.3, 18.9, -154.8, 22.3),
+	"idaho":                newBound(-117.3, 41.9, -111.0, 49.0),
+	"illinois":             newBound(-91.6, 36.9, -87.0, 42.6),
+	"indiana":              newBound(-88.1, 37.7, -84.7, 41.8),
+	"iowa":                 newBound(-96.7, 40.3, -90.1, 43.6),
+	"kansas":               newBound(-102.1, 36.9, -94.5, 40.1),
+	"kentucky":             newBound(-89.6, 36.4, -81.9, 39.2),
+	"louisiana":            newBound(-94.1, 28.9, -88.8, 33.1),
+	"maine":                newBound(-71.1, 43.0, -66.9, 47.5),
+	"maryland":             newBound(-79.5, 37.9, -75.0, 39.8),
+	"massachusetts":        newBound(-73.6, 41.2, -69.9, 42.9),
+	"michigan":             newBound(-90.5, 41.7, -82.1, 48.3),
+	"minnesota":            newBound(-97.3, 43.4, -89.5, 49.4),
+	"mississippi":          newBound(-91.7, 30.1, -88.1, 35.0),
+	"missouri":             newBound(-95.8, 35.9, -89.1, 40.7),
+	"montana":              newBound(-116.1, 44.3, -104.0, 49.0),
+	"nebraska":             newBound(-104.1, 39.9, -95.3, 43.1),
+	"nevada":               newBound(-120.1, 35.0, -114.0, 42.0),
+	"new hampshire":        newBound(-72.6, 42.6, -70.6, 45.4),
+	"new jersey":           newBound(-75.6, 38.9, -73.9, 41.4),
+	"new mexico":           newBound(-109.1, 31.3, -103.0, 37.0),
+	"new york":             newBound(-79.8, 40.4, -71.8, 45.1),
+	"north carolina":       newBound(-84.4, 33.8, -75.4, 36.6),
+	"north dakota":         newBound(-104.1, 45.9, -96.5, 49.0),
+	"ohio":                 newBound(-84.9, 38.4, -80.5, 42.4),
+	"oklahoma":             newBound(-103.1, 33.6, -94.4, 37.1),
+	"oregon":               newBound(-124.7, 41.9, -116.4, 46.3),
+	"pennsylvania":         newBound(-80.6, 39.7, -74.7, 42.3),
+	"rhode island":         newBound(-71.9, 41.1, -71.1, 42.1),
+	"south carolina":       newBound(-83.4, 32.0, -78.5, 35.3),
+	"south dakota":         newBound(-104.1, 42.4, -96.4, 46.0),
+	"tennessee":            newBound(-90.4, 34.9, -81.6, 36.7),
+	"texas":                newBound(-106.7, 25.8, -93.5, 36.6),
+	"utah":                 newBound(-114.1, 36.9, -109.0, 42.0),
+	"vermont":              newBound(-73.5, 42.7, -71.4, 45.1),
+	"virginia":             newBound(-83.7, 36.5, -75.2, 39.5),
+	"west virginia":        newBound(-82.7, 37.2, -77.7, 40.7),
+	"wisconsin":            newBound(-92.9, 42.4, -86.2, 47.4),
+	"wyoming":              newBound(-111.1, 40.9, -104.0, 45.1),
+}
+
+func newBound(min_lon float64, min_lat float64, max_lon float64, max_lat float64) orb.Bound {
+	return orb.Bound{
+		Min: orb.Point{min_lon, min_lat},
+		Max: orb.Point{max_lon, max_lat},
+	}
+}
+
+// lookupPlaces returns the names, and bounding boxes, of the values in 'names' that are known to the gazetteer.
+func lookupPlaces(names []string) ([]string, []orb.Bound) {
+
+	known := make([]string, 0)
+	bounds := make([]orb.Bound, 0)
+
+	seen := make(map[string]bool)
+
+	for _, n := range names {
+
+		n = strings.ToLower(strings.TrimSpace(n))
+
+		if seen[n] {
+			continue
+		}
+
+		seen[n] = true
+
+		b, ok := gazetteer[n]
+
+		if !ok {
+			continue
+		}
+
+		known = append(known, n)
+		bounds = append(bounds, b)
+	}
+
+	return known, bounds
+}
@@ -0,0 +1,254 @@
+package spatial
+
+import (
+	"errors"
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/tidwall/gjson"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SOURCE_LATLONG signals that a location was derived from the 'latlong' property of a record.
+	SOURCE_LATLONG string = "latlong"
+	// SOURCE_LONLAT signals that a location was derived from the 'lonlat' property of a record.
+	SOURCE_LONLAT string = "lonlat"
+	// SOURCE_COORDINATES signals that a location was derived from the 'coordinates' property of a record.
+	SOURCE_COORDINATES string = "coordinates"
+	// SOURCE_PLACE signals that a location was derived from the 'item.place' property of a record.
+	SOURCE_PLACE string = "item.place"
+)
+
+// ErrNoCoordinates is returned by Locate for records that do not have any coordinate properties.
+var ErrNoCoordinates = errors.New("Record has no coordinates")
+
+// Location is the point derived from a Library of Congress record, the property it was derived from and any
+// problems that were found (and corrected) along the way.
+type Location struct {
+	Point    orb.Point
+	Source   string
+	Warnings []string
+}
+
+// candidate is a pair of coordinates read from one of the coordinate properties of a record.
+type candidate struct {
+	source string
+	lat    float64
+	lon    float64
+}
+
+// Locate derives a point from the JSON record 'body' consulting, in order, its 'latlong', 'lonlat', 'coordinates'
+// and 'item.place[].latitude/longitude' properties. The first pair of coordinates which is (or, once latitude and
+// longitude are swapped, becomes) valid is used. If the record's 'location' names are known places and the point
+// falls outside all of them, but would fall inside one if its latitude and longitude were swapped, the point is
+// swapped. Any corrections, or other suspicious details, are recorded as warnings. If the record has no coordinate
+// properties ErrNoCoordinates is returned; if none of them are usable the error lists the problems with each one.
+func Locate(body []byte) (*Location, error) {
+
+	candidates, problems := readCandidates(body)
+
+	if len(candidates) == 0 && len(problems) == 0 {
+		return nil, ErrNoCoordinates
+	}
+
+	var loc *Location
+
+	for _, c := range candidates {
+
+		switch {
+		case c.lat == 0.0 && c.lon == 0.0:
+			problems = append(problems, fmt.Sprintf("%s: coordinates are 0,0", c.source))
+		case validLatitude(c.lat) && validLongitude(c.lon):
+			loc = &Location{
+				Point:    orb.Point{c.lon, c.lat},
+				Source:   c.source,
+				Warnings: make([]string, 0),
+			}
+		case validLatitude(c.lon) && validLongitude(c.lat):
+			loc = &Location{
+				Point:    orb.Point{c.lat, c.lon},
+				Source:   c.source,
+				Warnings: []string{fmt.Sprintf("latitude %v is out of range, latitude and longitude swapped", c.lat)},
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("%s: coordinates %v,%v are out of range", c.source, c.lat, c.lon))
+		}
+
+		if loc != nil {
+			break
+		}
+	}
+
+	if loc == nil {
+		return nil, fmt.Errorf("No usable coordinates, %s", strings.Join(problems, "; "))
+	}
+
+	if loc.Source == SOURCE_LATLONG {
+
+		for _, c := range candidates {
+
+			if c.source == SOURCE_LONLAT && (!nearlyEqual(c.lat, loc.Point.Lat()) || !nearlyEqual(c.lon, loc.Point.Lon())) {
+				loc.Warnings = append(loc.Warnings, fmt.Sprintf("lonlat %v,%v does not match latlong", c.lon, c.lat))
+				break
+			}
+		}
+	}
+
+	checkPlaces(body, loc)
+
+	return loc, nil
+}
+
+// checkPlaces compares the point in 'loc' with the extent of the 'location' names, in 'body', that are known to
+// the gazetteer swapping its latitude and longitude if that is the only way to make them agree.
+func checkPlaces(body []byte, loc *Location) {
+
+	names := make([]string, 0)
+
+	for _, r := range gjson.GetBytes(body, "location").Array() {
+		names = append(names, r.String())
+	}
+
+	known, bounds := lookupPlaces(names)
+
+	if len(bounds) == 0 {
+		return
+	}
+
+	for _, b := range bounds {
+
+		if b.Contains(loc.Point) {
+			return
+		}
+	}
+
+	swapped := orb.Point{loc.Point.Lat(), loc.Point.Lon()}
+
+	if validLatitude(swapped.Lat()) && validLongitude(swapped.Lon()) {
+
+		for idx, b := range bounds {
+
+			if b.Contains(swapped) {
+				loc.Point = swapped
+				loc.Warnings = append(loc.Warnings, fmt.Sprintf("latitude and longitude swapped to fall inside '%s'", known[idx]))
+				return
+			}
+		}
+	}
+
+	loc.Warnings = append(loc.Warnings, fmt.Sprintf("coordinates are outside %s", quoteJoin(known)))
+}
+
+// readCandidates returns the pairs of coordinates found in 'body', in order of preference, and a list of problems
+// with coordinate properties that could not be parsed.
+func readCandidates(body []byte) ([]*candidate, []string) {
+
+	candidates := make([]*candidate, 0)
+	problems := make([]string, 0)
+
+	rsp := gjson.GetBytes(body, "latlong")
+
+	if present(rsp) {
+
+		lat, lon, ok := pair(rsp)
+
+		if ok {
+			candidates = append(candidates, &candidate{SOURCE_LATLONG, lat, lon})
+		} else {
+			problems = append(problems, fmt.Sprintf("%s: unable to parse %s", SOURCE_LATLONG, rsp.Raw))
+		}
+	}
+
+	rsp = gjson.GetBytes(body, "lonlat")
+
+	if present(rsp) {
+
+		lon, lat, ok := pair(rsp)
+
+		if ok {
+			candidates = append(candidates, &candidate{SOURCE_LONLAT, lat, lon})
+		} else {
+			problems = append(problems, fmt.Sprintf("%s: unable to parse %s", SOURCE_LONLAT, rsp.Raw))
+		}
+	}
+
+	rsp = gjson.GetBytes(body, "coordinates")
+
+	if present(rsp) {
+
+		values := rsp.Array()
+
+		if rsp.Type == gjson.String {
+			values = []gjson.Result{rsp}
+		}
+
+		for _, r := range values {
+
+			if !present(r) {
+				continue
+			}
+
+			lat, lon, ok := pair(r)
+
+			if ok {
+				candidates = append(candidates, &candidate{SOURCE_COORDINATES, lat, lon})
+			} else {
+				problems = append(problems, fmt.Sprintf("%s: unable to parse %s", SOURCE_COORDINATES, r.Raw))
+			}
+		}
+	}
+
+	for _, r := range gjson.GetBytes(body, "item.place").Array() {
+
+		str_lat := strings.TrimSpace(r.Get("latitude").String())
+		str_lon := strings.TrimSpace(r.Get("longitude").String())
+
+		if str_lat == "" && str_lon == "" {
+			continue
+		}
+
+		lat, err_lat := strconv.ParseFloat(str_lat, 64)
+		lon, err_lon := strconv.ParseFloat(str_lon, 64)
+
+		if err_lat != nil || err_lon != nil {
+			problems = append(problems, fmt.Sprintf("%s: unable to parse '%s','%s'", SOURCE_PLACE, str_lat, str_lon))
+			continue
+		}
+
+		candidates = append(candidates, &candidate{SOURCE_PLACE, lat, lon})
+	}
+
+	return candidates, problems
+}
+
+// present returns true if 'rsp' exists and is not null, an empty string or an empty array.
+func present(rsp gjson.Result) bool {
+
+	switch {
+	case !rsp.Exists() || rsp.Type == gjson.Null:
+		return false
+	case rsp.Type == gjson.String:
+		return strings.TrimSpace(rsp.Str) != ""
+	case rsp.IsArray():
+		return len(rsp.Array()) > 0
+	default:
+		return true
+	}
+}
+
+func nearlyEqual(a float64, b float64) bool {
+	d := a - b
+	return d < 0.000001 && d > -0.000001
+}
+
+func quoteJoin(values []string) string {
+
+	quoted := make([]string, len(values))
+
+	for idx, v := range values {
+		quoted[idx] = "'" + v + "'"
+	}
+
+	return strings.Join(quoted, ", ")
+}
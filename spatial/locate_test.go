@@ -0,0 +1,184 @@
+package spatial
+
+import (
+	"errors"
+	"github.com/paulmach/orb"
+	"strings"
+	"testing"
+)
+
+func TestLocate(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		body     string
+		point    orb.Point
+		source   string
+		warnings []string
+	}{
+		{
+			name:   "latlong string",
+			body:   `{"latlong": "38.8895,-77.0353"}`,
+			point:  orb.Point{-77.0353, 38.8895},
+			source: SOURCE_LATLONG,
+		},
+		{
+			name:   "latlong array of strings",
+			body:   `{"latlong": ["38.8895", "-77.0353"]}`,
+			point:  orb.Point{-77.0353, 38.8895},
+			source: SOURCE_LATLONG,
+		},
+		{
+			name:   "lonlat",
+			body:   `{"lonlat": [-77.0353, 38.8895]}`,
+			point:  orb.Point{-77.0353, 38.8895},
+			source: SOURCE_LONLAT,
+		},
+		{
+			name:   "coordinates array",
+			body:   `{"coordinates": ["", "38.8895, -77.0353"]}`,
+			point:  orb.Point{-77.0353, 38.8895},
+			source: SOURCE_COORDINATES,
+		},
+		{
+			name:   "coordinates string",
+			body:   `{"coordinates": "38.8895,-77.0353"}`,
+			point:  orb.Point{-77.0353, 38.8895},
+			source: SOURCE_COORDINATES,
+		},
+		{
+			name:   "item.place",
+			body:   `{"item": {"place": [{"title": "Washington"}, {"latitude": " 38.8895", "longitude": "-77.0353 "}]}}`,
+			point:  orb.Point{-77.0353, 38.8895},
+			source: SOURCE_PLACE,
+		},
+		{
+			name:   "latlong is preferred",
+			body:   `{"latlong": "38.8895,-77.0353", "lonlat": "-77.0353,38.8895", "coordinates": "40.7128,-74.0060"}`,
+			point:  orb.Point{-77.0353, 38.8895},
+			source: SOURCE_LATLONG,
+		},
+		{
+			name:     "lonlat does not match latlong",
+			body:     `{"latlong": "38.8895,-77.0353", "lonlat": "-74.0060,40.7128"}`,
+			point:    orb.Point{-77.0353, 38.8895},
+			source:   SOURCE_LATLONG,
+			warnings: []string{"lonlat -74.006,40.7128 does not match latlong"},
+		},
+		{
+			name:     "latitude out of range",
+			body:     `{"latlong": "100.5,13.75"}`,
+			point:    orb.Point{100.5, 13.75},
+			source:   SOURCE_LATLONG,
+			warnings: []string{"latitude 100.5 is out of range"},
+		},
+		{
+			name:   "out of range falls through to the next property",
+			body:   `{"latlong": "100,200", "item": {"place": [{"latitude": "0", "longitude": "0"}, {"latitude": "38.8895", "longitude": "-77.0353"}]}}`,
+			point:  orb.Point{-77.0353, 38.8895},
+			source: SOURCE_PLACE,
+		},
+		{
+			name:     "swapped to fall inside a known place",
+			body:     `{"latlong": "-77.0353,38.8895", "location": ["District of Columbia"]}`,
+			point:    orb.Point{-77.0353, 38.8895},
+			source:   SOURCE_LATLONG,
+			warnings: []string{"latitude and longitude swapped to fall inside 'district of columbia'"},
+		},
+		{
+			name:   "inside one of several known places",
+			body:   `{"latlong": "38.8895,-77.0353", "location": ["england", "united states", "united states", "nowhere"]}`,
+			point:  orb.Point{-77.0353, 38.8895},
+			source: SOURCE_LATLONG,
+		},
+		{
+			name:     "outside known places",
+			body:     `{"latlong": "38.8895,-77.0353", "location": ["England", "france"]}`,
+			point:    orb.Point{-77.0353, 38.8895},
+			source:   SOURCE_LATLONG,
+			warnings: []string{"coordinates are outside 'england', 'france'"},
+		},
+		{
+			name:   "unknown places are ignored",
+			body:   `{"latlong": "-77.0353,38.8895", "location": ["atlantis"]}`,
+			point:  orb.Point{38.8895, -77.0353},
+			source: SOURCE_LATLONG,
+		},
+		// "washington" is ambiguous (the state or the city) so it is not in the gazetteer
+		{
+			name:   "washington state",
+			body:   `{"latlong": "47.0,-120.0", "location": ["washington"]}`,
+			point:  orb.Point{-120.0, 47.0},
+			source: SOURCE_LATLONG,
+		},
+		{
+			name:   "washington is not used to swap coordinates",
+			body:   `{"latlong": "-77.0353,38.8895", "location": ["Washington"]}`,
+			point:  orb.Point{38.8895, -77.0353},
+			source: SOURCE_LATLONG,
+		},
+	}
+
+	for _, test := range tests {
+
+		loc, err := Locate([]byte(test.body))
+
+		if err != nil {
+			t.Fatalf("Failed to locate %s, %v", test.name, err)
+		}
+
+		if loc.Point != test.point || loc.Source != test.source {
+			t.Fatalf("Unexpected location for %s: %v (%s), expected %v (%s)", test.name, loc.Point, loc.Source, test.point, test.source)
+		}
+
+		if len(loc.Warnings) != len(test.warnings) {
+			t.Fatalf("Unexpected warnings for %s: %v", test.name, loc.Warnings)
+		}
+
+		for idx, w := range test.warnings {
+
+			if !strings.HasPrefix(loc.Warnings[idx], w) {
+				t.Fatalf("Unexpected warning for %s: '%s', expected '%s'", test.name, loc.Warnings[idx], w)
+			}
+		}
+	}
+}
+
+func TestLocateErrors(t *testing.T) {
+
+	missing := []string{
+		`{}`,
+		`{"latlong": "", "lonlat": null, "coordinates": []}`,
+		`{"item": {"place": [{"latitude": "", "longitude": " "}]}}`,
+	}
+
+	for _, body := range missing {
+
+		_, err := Locate([]byte(body))
+
+		if !errors.Is(err, ErrNoCoordinates) {
+			t.Fatalf("Expected ErrNoCoordinates for %s, got %v", body, err)
+		}
+	}
+
+	invalid := map[string]string{
+		`{"latlong": "38.8895"}`:                                              "latlong: unable to parse",
+		`{"lonlat": "north,west"}`:                                            "lonlat: unable to parse",
+		`{"latlong": ["NaN", "-77.0353"]}`:                                    "latlong: unable to parse",
+		`{"lonlat": "-Inf,38.8895"}`:                                          "lonlat: unable to parse",
+		`{"coordinates": [{"lat": 38.8895}]}`:                                 "coordinates: unable to parse",
+		`{"item": {"place": [{"latitude": "38.8895", "longitude": "west"}]}}`: "item.place: unable to parse",
+		`{"latlong": "0,0"}`:                                                  "latlong: coordinates are 0,0",
+		`{"latlong": "100,200"}`:                                              "latlong: coordinates 100,200 are out of range",
+		`{"latlong": "-91,181", "lonlat": "190,95"}`:                          "lonlat: coordinates 95,190 are out of range",
+	}
+
+	for body, problem := range invalid {
+
+		_, err := Locate([]byte(body))
+
+		if err == nil || errors.Is(err, ErrNoCoordinates) || !strings.Contains(err.Error(), problem) {
+			t.Fatalf("Expected '%s' error for %s, got %v", problem, body, err)
+		}
+	}
+}
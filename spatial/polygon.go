@@ -0,0 +1,110 @@
+package spatial
+
+import (
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/planar"
+	"github.com/tidwall/gjson"
+	"os"
+)
+
+// polygons is a shape defined by one or more polygons.
+type polygons struct {
+	path     string
+	polygons orb.MultiPolygon
+}
+
+// readPolygons reads the Polygon and MultiPolygon geometries from the GeoJSON Feature, FeatureCollection or Geometry
+// in the file 'path'.
+func readPolygons(path string) (*polygons, error) {
+
+	body, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s, %w", path, err)
+	}
+
+	geoms := make([]orb.Geometry, 0)
+
+	switch gjson.GetBytes(body, "type").String() {
+	case "FeatureCollection":
+
+		fc, err := geojson.UnmarshalFeatureCollection(body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal %s, %w", path, err)
+		}
+
+		for _, f := range fc.Features {
+			geoms = append(geoms, f.Geometry)
+		}
+
+	case "Feature":
+
+		f, err := geojson.UnmarshalFeature(body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal %s, %w", path, err)
+		}
+
+		geoms = append(geoms, f.Geometry)
+
+	default:
+
+		g, err := geojson.UnmarshalGeometry(body)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal %s, %w", path, err)
+		}
+
+		geoms = append(geoms, g.Geometry())
+	}
+
+	p := &polygons{
+		path:     path,
+		polygons: make(orb.MultiPolygon, 0),
+	}
+
+	for _, g := range geoms {
+
+		switch geom := g.(type) {
+		case orb.Polygon:
+			p.add(geom)
+		case orb.MultiPolygon:
+
+			for _, poly := range geom {
+				p.add(poly)
+			}
+
+		default:
+			return nil, fmt.Errorf("Unsupported geometry type in %s, only Polygon and MultiPolygon geometries are supported", path)
+		}
+	}
+
+	if len(p.polygons) == 0 {
+		return nil, fmt.Errorf("%s does not contain any polygons", path)
+	}
+
+	return p, nil
+}
+
+// add appends 'poly' to 'p' unless it has no exterior ring.
+func (p *polygons) add(poly orb.Polygon) {
+
+	if len(poly) == 0 || len(poly[0]) == 0 {
+		return
+	}
+
+	p.polygons = append(p.polygons, poly)
+}
+
+// contains returns true if 'pt' is inside, or on the boundary of, one of the polygons in 'p' and not inside any of
+// its holes.
+func (p *polygons) contains(pt orb.Point) bool {
+	return planar.MultiPolygonContains(p.polygons, pt)
+}
+
+func (p *polygons) String() string {
+	return fmt.Sprintf("polygon(%s)", p.path)
+}
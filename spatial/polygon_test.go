@@ -0,0 +1,97 @@
+package spatial
+
+import (
+	"github.com/paulmach/orb"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writePolygons(t *testing.T, body string) string {
+
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "polygons.geojson")
+
+	err := os.WriteFile(path, []byte(body), 0644)
+
+	if err != nil {
+		t.Fatalf("Failed to write %s, %v", path, err)
+	}
+
+	return path
+}
+
+func TestPolygons(t *testing.T) {
+
+	// A square with a square hole
+	square := `{"type": "Polygon", "coordinates": [[[0,0],[10,0],[10,10],[0,10],[0,0]],[[4,4],[6,4],[6,6],[4,6],[4,4]]]}`
+
+	// An L-shaped polygon and a square island inside the hole of the square
+	multi := `{"type": "MultiPolygon", "coordinates": [[[[20,0],[30,0],[30,2],[22,2],[22,10],[20,10],[20,0]]],[[[4.5,4.5],[5.5,4.5],[5.5,5.5],[4.5,5.5],[4.5,4.5]]]]}`
+
+	tests := map[string]map[orb.Point]bool{
+		square: {
+			{2.0, 2.0}:  true,
+			{9.0, 5.0}:  true,
+			{5.0, 5.0}:  false,
+			{5.0, 3.9}:  true,
+			{11.0, 5.0}: false,
+			{-1.0, 5.0}: false,
+			{10.0, 5.0}: true,
+			{0.0, 0.0}:  true,
+		},
+		`{"type": "Feature", "properties": {}, "geometry": ` + multi + `}`: {
+			{21.0, 9.0}: true,
+			{29.0, 1.0}: true,
+			{25.0, 5.0}: false,
+			{5.0, 5.0}:  true,
+			{2.0, 2.0}:  false,
+		},
+		`{"type": "FeatureCollection", "features": [{"type": "Feature", "properties": {}, "geometry": ` + square + `}, {"type": "Feature", "properties": {}, "geometry": ` + multi + `}]}`: {
+			{2.0, 2.0}:  true,
+			{5.0, 5.0}:  true,
+			{4.2, 4.2}:  false,
+			{21.0, 9.0}: true,
+			{25.0, 5.0}: false,
+		},
+	}
+
+	for body, points := range tests {
+
+		p, err := readPolygons(writePolygons(t, body))
+
+		if err != nil {
+			t.Fatalf("Failed to read polygons, %v", err)
+		}
+
+		for pt, expected := range points {
+
+			if p.contains(pt) != expected {
+				t.Fatalf("Expected %s contains %v to be %t", body, pt, expected)
+			}
+		}
+	}
+
+	invalid := []string{
+		`{"type": "LineString", "coordinates": [[0,0],[10,10]]}`,
+		`{"type": "FeatureCollection", "features": []}`,
+		`{"type": "Polygon", "coordinates": []}`,
+		`not json`,
+	}
+
+	for _, body := range invalid {
+
+		_, err := readPolygons(writePolygons(t, body))
+
+		if err == nil {
+			t.Fatalf("Expected %s to be invalid", body)
+		}
+	}
+
+	_, err := readPolygons(filepath.Join(t.TempDir(), "missing.geojson"))
+
+	if err == nil {
+		t.Fatalf("Expected missing file to fail")
+	}
+}
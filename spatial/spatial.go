@@ -0,0 +1,275 @@
+// package spatial provides query expressions for filtering Library of Congress records by location.
+package spatial
+
+import (
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/expr"
+	"github.com/paulmach/orb"
+	"github.com/tidwall/gjson"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FilterOptions defines options for creating a spatial filter. Each non-empty option adds a constraint
+// and records must satisfy all of them.
+type FilterOptions struct {
+	// A "{MINLON},{MINLAT},{MAXLON},{MAXLAT}" bounding box. If {MINLON} is greater than {MAXLON} the box is
+	// assumed to cross the antimeridian.
+	BoundingBox string
+	// A "{LAT},{LON},{RADIUS}" string where {RADIUS} is a distance in meters.
+	PointRadius string
+	// The path to a GeoJSON file containing one or more Polygon or MultiPolygon geometries.
+	PolygonPath string
+	// If true records without a usable location satisfy the filter.
+	IncludeMissing bool
+}
+
+// Filter is an `expr.Expression` that is satisfied by records whose location is contained by a shape.
+type Filter struct {
+	// If true records without a usable location satisfy the filter.
+	IncludeMissing bool
+	shape          shape
+}
+
+// shape is something which may or may not contain a point.
+type shape interface {
+	contains(orb.Point) bool
+	String() string
+}
+
+// NewFilter returns an `expr.Expression` for the options in 'opts' or nil if no options are set.
+func NewFilter(opts *FilterOptions) (expr.Expression, error) {
+
+	filters := make([]expr.Expression, 0)
+
+	if opts.BoundingBox != "" {
+
+		b, err := parseBoundingBox(opts.BoundingBox)
+
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, &Filter{IncludeMissing: opts.IncludeMissing, shape: b})
+	}
+
+	if opts.PointRadius != "" {
+
+		r, err := parsePointRadius(opts.PointRadius)
+
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, &Filter{IncludeMissing: opts.IncludeMissing, shape: r})
+	}
+
+	if opts.PolygonPath != "" {
+
+		p, err := readPolygons(opts.PolygonPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, &Filter{IncludeMissing: opts.IncludeMissing, shape: p})
+	}
+
+	return expr.All(filters...), nil
+}
+
+// Matches returns true if the location of the JSON record 'body', as derived by Locate, is contained by 'f'.
+// Records without a usable location only match if 'f.IncludeMissing' is true.
+func (f *Filter) Matches(body []byte) bool {
+
+	loc, err := Locate(body)
+
+	if err != nil {
+		return f.IncludeMissing
+	}
+
+	return f.shape.contains(loc.Point)
+}
+
+func (f *Filter) String() string {
+	return f.shape.String()
+}
+
+// pair returns the first two numbers in 'rsp' which is either an array of numbers (or numeric strings) or a
+// comma-separated string.
+func pair(rsp gjson.Result) (float64, float64, bool) {
+
+	var str_values []string
+
+	switch {
+	case rsp.IsArray():
+
+		for _, r := range rsp.Array() {
+			str_values = append(str_values, r.String())
+		}
+
+	case rsp.Type == gjson.String:
+		str_values = strings.Split(rsp.Str, ",")
+	default:
+		return 0.0, 0.0, false
+	}
+
+	if len(str_values) < 2 {
+		return 0.0, 0.0, false
+	}
+
+	a, err := strconv.ParseFloat(strings.TrimSpace(str_values[0]), 64)
+
+	if err != nil {
+		return 0.0, 0.0, false
+	}
+
+	b, err := strconv.ParseFloat(strings.TrimSpace(str_values[1]), 64)
+
+	if err != nil {
+		return 0.0, 0.0, false
+	}
+
+	// ParseFloat accepts "NaN" and "Inf" which are not coordinates
+
+	for _, v := range []float64{a, b} {
+
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0.0, 0.0, false
+		}
+	}
+
+	return a, b, true
+}
+
+// boundingBox is a shape defined by minimum and maximum longitudes and latitudes.
+type boundingBox struct {
+	bound orb.Bound
+}
+
+// parseBoundingBox parses a "{MINLON},{MINLAT},{MAXLON},{MAXLAT}" string.
+func parseBoundingBox(str string) (*boundingBox, error) {
+
+	values, err := parseFloats(str, 4)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid bounding box '%s', %w", str, err)
+	}
+
+	min_lon, min_lat, max_lon, max_lat := values[0], values[1], values[2], values[3]
+
+	if !validLongitude(min_lon) || !validLongitude(max_lon) || !validLatitude(min_lat) || !validLatitude(max_lat) || min_lat > max_lat {
+		return nil, fmt.Errorf("Invalid bounding box '%s'", str)
+	}
+
+	b := &boundingBox{
+		bound: orb.Bound{
+			Min: orb.Point{min_lon, min_lat},
+			Max: orb.Point{max_lon, max_lat},
+		},
+	}
+
+	return b, nil
+}
+
+func (b *boundingBox) contains(pt orb.Point) bool {
+
+	if pt.Lat() < b.bound.Min.Lat() || pt.Lat() > b.bound.Max.Lat() {
+		return false
+	}
+
+	if b.bound.Min.Lon() <= b.bound.Max.Lon() {
+		return pt.Lon() >= b.bound.Min.Lon() && pt.Lon() <= b.bound.Max.Lon()
+	}
+
+	// The box crosses the antimeridian
+
+	return pt.Lon() >= b.bound.Min.Lon() || pt.Lon() <= b.bound.Max.Lon()
+}
+
+func (b *boundingBox) String() string {
+	return fmt.Sprintf("bbox(%v,%v,%v,%v)", b.bound.Min.Lon(), b.bound.Min.Lat(), b.bound.Max.Lon(), b.bound.Max.Lat())
+}
+
+// pointRadius is a shape defined by a point and a distance, in meters, from that point.
+type pointRadius struct {
+	center orb.Point
+	radius float64
+}
+
+// parsePointRadius parses a "{LAT},{LON},{RADIUS}" string where {RADIUS} is a distance in meters.
+func parsePointRadius(str string) (*pointRadius, error) {
+
+	values, err := parseFloats(str, 3)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid point and radius '%s', %w", str, err)
+	}
+
+	lat, lon, radius := values[0], values[1], values[2]
+
+	if !validLatitude(lat) || !validLongitude(lon) || radius < 0 {
+		return nil, fmt.Errorf("Invalid point and radius '%s'", str)
+	}
+
+	r := &pointRadius{
+		center: orb.Point{lon, lat},
+		radius: radius,
+	}
+
+	return r, nil
+}
+
+func (r *pointRadius) contains(pt orb.Point) bool {
+	return Distance(r.center, pt) <= r.radius
+}
+
+func (r *pointRadius) String() string {
+	return fmt.Sprintf("near(%v,%v,%v)", r.center.Lat(), r.center.Lon(), r.radius)
+}
+
+// Distance returns the great-circle (haversine) distance, in meters, between 'a' and 'b'.
+func Distance(a orb.Point, b orb.Point) float64 {
+
+	lat1 := a.Lat() * math.Pi / 180.0
+	lat2 := b.Lat() * math.Pi / 180.0
+	d_lat := lat2 - lat1
+	d_lon := (b.Lon() - a.Lon()) * math.Pi / 180.0
+
+	h := math.Pow(math.Sin(d_lat/2.0), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(d_lon/2.0), 2)
+
+	return 2.0 * orb.EarthRadius * math.Asin(math.Min(1.0, math.Sqrt(h)))
+}
+
+func parseFloats(str string, count int) ([]float64, error) {
+
+	parts := strings.Split(str, ",")
+
+	if len(parts) != count {
+		return nil, fmt.Errorf("Expected %d comma-separated numbers", count)
+	}
+
+	values := make([]float64, count)
+
+	for idx, p := range parts {
+
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+
+		if err != nil {
+			return nil, err
+		}
+
+		values[idx] = v
+	}
+
+	return values, nil
+}
+
+func validLatitude(lat float64) bool {
+	return lat >= -90.0 && lat <= 90.0
+}
+
+func validLongitude(lon float64) bool {
+	return lon >= -180.0 && lon <= 180.0
+}
@@ -0,0 +1,188 @@
+package spatial
+
+import (
+	"github.com/paulmach/orb"
+	"testing"
+)
+
+func TestBoundingBox(t *testing.T) {
+
+	tests := map[string]map[orb.Point]bool{
+		"-80,35,-70,40": {
+			{-77.0, 38.9}:  true,
+			{-80.0, 35.0}:  true,
+			{-70.0, 40.0}:  true,
+			{-80.1, 38.9}:  false,
+			{-77.0, 40.1}:  false,
+			{100.0, 38.9}:  false,
+			{-175.0, 38.9}: false,
+		},
+		// Crosses the antimeridian
+		"170,-20,-170,20": {
+			{175.0, 0.0}:   true,
+			{-175.0, 0.0}:  true,
+			{180.0, 0.0}:   true,
+			{-180.0, 0.0}:  true,
+			{170.0, -20.0}: true,
+			{-170.0, 20.0}: true,
+			{0.0, 0.0}:     false,
+			{169.9, 0.0}:   false,
+			{-169.9, 0.0}:  false,
+			{175.0, 20.1}:  false,
+		},
+		" -180 , -90 , 180 , 90 ": {
+			{0.0, 0.0}:     true,
+			{-180.0, 90.0}: true,
+		},
+	}
+
+	for str, points := range tests {
+
+		b, err := parseBoundingBox(str)
+
+		if err != nil {
+			t.Fatalf("Failed to parse bounding box '%s', %v", str, err)
+		}
+
+		for pt, expected := range points {
+
+			if b.contains(pt) != expected {
+				t.Fatalf("Expected %s contains %v to be %t", b, pt, expected)
+			}
+		}
+	}
+
+	invalid := []string{
+		"",
+		"1,2,3",
+		"1,2,3,4,5",
+		"a,b,c,d",
+		"-190,0,10,10",
+		"0,0,10,91",
+		"0,10,10,0",
+	}
+
+	for _, str := range invalid {
+
+		_, err := parseBoundingBox(str)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to be an invalid bounding box", str)
+		}
+	}
+}
+
+func TestPointRadius(t *testing.T) {
+
+	// The length of one degree of latitude, in meters
+	degree := 111319.49
+
+	tests := map[string]map[orb.Point]bool{
+		"38.0,-77.0,111320": {
+			{-77.0, 39.0}:  true,
+			{-77.0, 37.0}:  true,
+			{-77.0, 39.01}: false,
+			{-78.0, 38.0}:  true,
+			{-75.7, 38.0}:  false,
+		},
+		"38.0,-77.0,111319": {
+			{-77.0, 39.0}: false,
+			{-77.0, 38.5}: true,
+		},
+		"38.0,-77.0,0": {
+			{-77.0, 38.0}:      true,
+			{-77.0, 38.000001}: false,
+		},
+		// Distances are measured across the antimeridian and over the poles
+		"0.0,179.9999,100": {
+			{-179.9999, 0.0}: true,
+			{-179.99, 0.0}:   false,
+		},
+		"89.9999,0,100": {
+			{180.0, 89.9999}: true,
+			{90.0, 89.9999}:  true,
+			{0.0, 89.998}:    false,
+		},
+	}
+
+	for str, points := range tests {
+
+		r, err := parsePointRadius(str)
+
+		if err != nil {
+			t.Fatalf("Failed to parse point and radius '%s', %v", str, err)
+		}
+
+		for pt, expected := range points {
+
+			if r.contains(pt) != expected {
+				t.Fatalf("Expected %s contains %v to be %t (distance %f)", r, pt, expected, Distance(r.center, pt))
+			}
+		}
+	}
+
+	d := Distance(orb.Point{-77.0, 38.0}, orb.Point{-77.0, 39.0})
+
+	if d < degree-0.01 || d > degree+0.01 {
+		t.Fatalf("Unexpected distance %f", d)
+	}
+
+	invalid := []string{
+		"38.0,-77.0",
+		"91.0,-77.0,100",
+		"38.0,-181.0,100",
+		"38.0,-77.0,-1",
+		"38.0,-77.0,far",
+	}
+
+	for _, str := range invalid {
+
+		_, err := parsePointRadius(str)
+
+		if err == nil {
+			t.Fatalf("Expected '%s' to be an invalid point and radius", str)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+
+	opts := &FilterOptions{
+		BoundingBox: "-80,35,-70,40",
+		PointRadius: "38.8895,-77.0353,1000",
+	}
+
+	f, err := NewFilter(opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create filter, %v", err)
+	}
+
+	tests := map[string]bool{
+		`{"latlong": "38.8895,-77.0353"}`:       true,
+		`{"latlong": [38.89, -77.03]}`:          true,
+		`{"lonlat": [-77.03, 38.89]}`:           true,
+		`{"latlong": "38.95,-77.0353"}`:         false,
+		`{"latlong": "40.7128,-74.0060"}`:       false,
+		`{"item": {"title": "No coordinates"}}`: false,
+	}
+
+	for body, expected := range tests {
+
+		if f.Matches([]byte(body)) != expected {
+			t.Fatalf("Expected %s to match %t", body, expected)
+		}
+	}
+
+	opts.IncludeMissing = true
+
+	f, err = NewFilter(opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create filter, %v", err)
+	}
+
+	if !f.Matches([]byte(`{"item": {"title": "No coordinates"}}`)) || f.Matches([]byte(`{"latlong": "40.7128,-74.0060"}`)) {
+		t.Fatalf("Expected records without coordinates, and only those records, to match")
+	}
+}
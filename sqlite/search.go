@@ -0,0 +1,151 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/expr"
+	"strings"
+)
+
+// SearchOptions defines options for searching an Index. Each non-empty option adds a constraint and records must
+// satisfy all of them.
+type SearchOptions struct {
+	// An FTS5 query matched against the title, notes, description and subjects of records. If set results are
+	// ordered by relevance, otherwise by ID.
+	Text string
+	// Only include records with this (exact) subject.
+	Subject string
+	// Only include records with this (exact) contributor.
+	Contributor string
+	// Only include records with this (exact) location.
+	Location string
+	// Only include records with a place with this (exact) title.
+	Place string
+	// Only include records without coordinates.
+	MissingCoordinates bool
+	// An optional expression that records must also match.
+	Expression expr.Expression
+	// The maximum number of records to return. Zero means there is no limit.
+	Limit int
+}
+
+// SearchCallbackFunc is a custom function invoked with the JSON body of each record returned by Search.
+type SearchCallbackFunc func(context.Context, []byte) error
+
+// Search invokes 'cb' with the body of each record in 'idx' matching 'opts'.
+func (idx *Index) Search(ctx context.Context, opts *SearchOptions, cb SearchCallbackFunc) error {
+
+	q, args := searchQuery(opts)
+
+	rows, err := idx.db.QueryContext(ctx, q, args...)
+
+	if err != nil {
+		return fmt.Errorf("Failed to query index, %w", err)
+	}
+
+	defer rows.Close()
+
+	count := 0
+
+	for rows.Next() {
+
+		var body string
+
+		err := rows.Scan(&body)
+
+		if err != nil {
+			return fmt.Errorf("Failed to scan row, %w", err)
+		}
+
+		if opts.Expression != nil && !opts.Expression.Matches([]byte(body)) {
+			continue
+		}
+
+		err = cb(ctx, []byte(body))
+
+		if err != nil {
+			return err
+		}
+
+		count += 1
+
+		if opts.Limit > 0 && count >= opts.Limit {
+			break
+		}
+	}
+
+	err = rows.Err()
+
+	if err != nil {
+		return fmt.Errorf("Failed to iterate rows, %w", err)
+	}
+
+	return nil
+}
+
+// Get returns the body of the record with ID 'id' in 'idx' or an error wrapping sql.ErrNoRows if it does not exist.
+func (idx *Index) Get(ctx context.Context, id string) ([]byte, error) {
+
+	var body string
+
+	err := idx.db.QueryRowContext(ctx, "SELECT body FROM records WHERE id = ?", id).Scan(&body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to retrieve record %s, %w", id, err)
+	}
+
+	return []byte(body), nil
+}
+
+func searchQuery(opts *SearchOptions) (string, []interface{}) {
+
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	q := "SELECT r.body FROM records r"
+	order := "r.id"
+
+	if opts.Text != "" {
+		q = "SELECT r.body FROM records_fts f JOIN records r ON r.rowid = f.rowid"
+		conditions = append(conditions, "records_fts MATCH ?")
+		args = append(args, opts.Text)
+		order = "f.rank"
+	}
+
+	for _, c := range []struct {
+		table  string
+		column string
+		value  string
+	}{
+		{"subjects", "subject", opts.Subject},
+		{"contributors", "contributor", opts.Contributor},
+		{"locations", "location", opts.Location},
+		{"places", "title", opts.Place},
+	} {
+
+		if c.value == "" {
+			continue
+		}
+
+		conditions = append(conditions, fmt.Sprintf("EXISTS (SELECT 1 FROM %s t WHERE t.record_id = r.id AND t.%s = ?)", c.table, c.column))
+		args = append(args, c.value)
+	}
+
+	if opts.MissingCoordinates {
+		conditions = append(conditions, "(r.latitude IS NULL OR r.longitude IS NULL)")
+	}
+
+	if len(conditions) > 0 {
+		q = q + " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	q = q + " ORDER BY " + order
+
+	// Limits are only applied in SQL if there is no expression to filter results with
+
+	if opts.Limit > 0 && opts.Expression == nil {
+		q = fmt.Sprintf("%s LIMIT %d", q, opts.Limit)
+	}
+
+	return q, args
+}
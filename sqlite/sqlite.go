@@ -0,0 +1,434 @@
+// package sqlite provides methods for indexing Library of Congress records in a SQLite database, with normalized
+// tables for subjects, contributors, locations, images and places and an FTS5 full-text index, and for searching them.
+//
+// The FTS5 extension is only available if the code is compiled with the `sqlite_fts5` build tag, for example
+// `go build -tags sqlite_fts5 ...`.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam/dates"
+	"github.com/aaronland/go-libraryofcongress-datajam/spatial"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/tidwall/gjson"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The default number of records added to the index in a single transaction.
+const DEFAULT_BATCH_SIZE int = 1000
+
+// SCHEMA is the set of SQL statements used to create the index tables.
+var SCHEMA = []string{
+	`CREATE TABLE IF NOT EXISTS records (
+		id TEXT PRIMARY KEY,
+		url TEXT,
+		title TEXT,
+		date TEXT,
+		inception TEXT,
+		cessation TEXT,
+		latitude REAL,
+		longitude REAL,
+		body TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS subjects (record_id TEXT NOT NULL, subject TEXT NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS subjects_by_subject ON subjects (subject, record_id)`,
+	`CREATE INDEX IF NOT EXISTS subjects_by_record ON subjects (record_id)`,
+	`CREATE TABLE IF NOT EXISTS contributors (record_id TEXT NOT NULL, contributor TEXT NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS contributors_by_contributor ON contributors (contributor, record_id)`,
+	`CREATE INDEX IF NOT EXISTS contributors_by_record ON contributors (record_id)`,
+	`CREATE TABLE IF NOT EXISTS locations (record_id TEXT NOT NULL, location TEXT NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS locations_by_location ON locations (location, record_id)`,
+	`CREATE INDEX IF NOT EXISTS locations_by_record ON locations (record_id)`,
+	`CREATE TABLE IF NOT EXISTS images (record_id TEXT NOT NULL, url TEXT NOT NULL, width INTEGER, height INTEGER)`,
+	`CREATE INDEX IF NOT EXISTS images_by_record ON images (record_id)`,
+	`CREATE TABLE IF NOT EXISTS places (record_id TEXT NOT NULL, title TEXT NOT NULL, latitude REAL, longitude REAL, link TEXT)`,
+	`CREATE INDEX IF NOT EXISTS places_by_title ON places (title, record_id)`,
+	`CREATE INDEX IF NOT EXISTS places_by_record ON places (record_id)`,
+	// The rowid of each row in records_fts is the rowid of the corresponding row in records
+	`CREATE VIRTUAL TABLE IF NOT EXISTS records_fts USING fts5(title, notes, description, subjects)`,
+}
+
+// ErrMissingID is the error returned by Index.Add for records that do not have an ID.
+var ErrMissingID = errors.New("Record is missing an ID")
+
+// The (gjson) paths, in order of preference, used to derive the ID of a record.
+var ID_PATHS = []string{
+	"item.id",
+	"id",
+}
+
+// Index is a SQLite database of Library of Congress records. It is safe for concurrent use.
+type Index struct {
+	// The number of records added to the index in a single transaction.
+	BatchSize int
+	db        *sql.DB
+	mu        *sync.Mutex
+	tx        *sql.Tx
+	pending   int
+}
+
+// dsn returns the "file:" URI for the database at 'path' with the query parameters 'params'. The path is escaped so
+// that characters like "?", "#" or "%" are not mistaken for parts of the URI.
+func dsn(path string, params string) string {
+	u := &url.URL{Path: path}
+	return fmt.Sprintf("file:%s?%s", u.EscapedPath(), params)
+}
+
+// NewIndex opens, or creates, the SQLite database at 'path' and ensures that it contains the tables defined in SCHEMA.
+func NewIndex(ctx context.Context, path string) (*Index, error) {
+
+	db, err := sql.Open("sqlite3", dsn(path, "_journal_mode=WAL&_synchronous=OFF"))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s, %w", path, err)
+	}
+
+	for _, q := range SCHEMA {
+
+		_, err := db.ExecContext(ctx, q)
+
+		if err != nil {
+
+			db.Close()
+
+			if strings.Contains(err.Error(), "no such module: fts5") {
+				return nil, fmt.Errorf("Failed to create schema, %w (FTS5 support requires the sqlite_fts5 build tag)", err)
+			}
+
+			return nil, fmt.Errorf("Failed to create schema, %w", err)
+		}
+	}
+
+	idx := &Index{
+		BatchSize: DEFAULT_BATCH_SIZE,
+		db:        db,
+		mu:        new(sync.Mutex),
+	}
+
+	return idx, nil
+}
+
+// OpenIndex opens the existing SQLite database at 'path' for reading.
+func OpenIndex(ctx context.Context, path string) (*Index, error) {
+
+	_, err := os.Stat(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to stat %s, %w", path, err)
+	}
+
+	db, err := sql.Open("sqlite3", dsn(path, "mode=ro"))
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s, %w", path, err)
+	}
+
+	err = db.PingContext(ctx)
+
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to open %s, %w", path, err)
+	}
+
+	idx := &Index{
+		db: db,
+		mu: new(sync.Mutex),
+	}
+
+	return idx, nil
+}
+
+// Add adds, or replaces, the JSON record 'body' in the index. Records are committed in batches of BatchSize
+// records, and when Close is called.
+func (idx *Index) Add(ctx context.Context, body []byte) error {
+
+	id := recordID(body)
+
+	if id == "" {
+		return ErrMissingID
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.tx == nil {
+
+		// Transactions span multiple calls to Add so they are not bound to 'ctx'
+
+		tx, err := idx.db.Begin()
+
+		if err != nil {
+			return fmt.Errorf("Failed to begin transaction, %w", err)
+		}
+
+		idx.tx = tx
+	}
+
+	err := addRecord(ctx, idx.tx, id, body)
+
+	if err != nil {
+		return fmt.Errorf("Failed to index %s, %w", id, err)
+	}
+
+	idx.pending += 1
+
+	if idx.pending >= idx.BatchSize {
+		return idx.commit()
+	}
+
+	return nil
+}
+
+// Close commits any pending records and closes the database.
+func (idx *Index) Close() error {
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	err := idx.commit()
+
+	if err != nil {
+		idx.db.Close()
+		return err
+	}
+
+	return idx.db.Close()
+}
+
+func (idx *Index) commit() error {
+
+	if idx.tx == nil {
+		return nil
+	}
+
+	err := idx.tx.Commit()
+
+	idx.tx = nil
+	idx.pending = 0
+
+	if err != nil {
+		return fmt.Errorf("Failed to commit transaction, %w", err)
+	}
+
+	return nil
+}
+
+func addRecord(ctx context.Context, tx *sql.Tx, id string, body []byte) error {
+
+	for _, q := range []string{
+		"DELETE FROM subjects WHERE record_id = ?",
+		"DELETE FROM contributors WHERE record_id = ?",
+		"DELETE FROM locations WHERE record_id = ?",
+		"DELETE FROM images WHERE record_id = ?",
+		"DELETE FROM places WHERE record_id = ?",
+	} {
+
+		_, err := tx.ExecContext(ctx, q, id)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// Deleting from records_fts by anything other than rowid means scanning the entire table
+	// so look up the rowid of the record being replaced, if it exists.
+
+	var old_rowid int64
+
+	err := tx.QueryRowContext(ctx, "SELECT rowid FROM records WHERE id = ?", id).Scan(&old_rowid)
+
+	switch {
+	case err == sql.ErrNoRows:
+		// pass
+	case err != nil:
+		return err
+	default:
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM records_fts WHERE rowid = ?", old_rowid)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	title := gjson.GetBytes(body, "title").String()
+
+	var date, inception, cessation sql.NullString
+	var latitude, longitude sql.NullFloat64
+
+	d, ok := dates.FromJSON(body)
+
+	if ok {
+		date = sql.NullString{String: d.EDTF, Valid: true}
+		inception = sql.NullString{String: d.Inception, Valid: true}
+		cessation = sql.NullString{String: d.Cessation, Valid: true}
+	}
+
+	loc, err := spatial.Locate(body)
+
+	if err == nil {
+		latitude = sql.NullFloat64{Float64: loc.Point.Lat(), Valid: true}
+		longitude = sql.NullFloat64{Float64: loc.Point.Lon(), Valid: true}
+	}
+
+	rsp, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO records (id, url, title, date, inception, cessation, latitude, longitude, body) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		id, gjson.GetBytes(body, "url").String(), title, date, inception, cessation, latitude, longitude, string(body))
+
+	if err != nil {
+		return err
+	}
+
+	rowid, err := rsp.LastInsertId()
+
+	if err != nil {
+		return err
+	}
+
+	subjects := stringValues(body, "subject")
+
+	for _, q := range []struct {
+		sql    string
+		values []string
+	}{
+		{"INSERT INTO subjects (record_id, subject) VALUES (?, ?)", subjects},
+		{"INSERT INTO contributors (record_id, contributor) VALUES (?, ?)", stringValues(body, "contributor")},
+		{"INSERT INTO locations (record_id, location) VALUES (?, ?)", stringValues(body, "location")},
+	} {
+
+		for _, v := range q.values {
+
+			_, err := tx.ExecContext(ctx, q.sql, id, v)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, im_url := range stringValues(body, "image_url") {
+
+		var width, height sql.NullInt64
+
+		u, err := url.Parse(im_url)
+
+		if err == nil && u.Fragment != "" {
+
+			params, err := url.ParseQuery(u.Fragment)
+
+			if err == nil {
+				width = nullInt(params.Get("w"))
+				height = nullInt(params.Get("h"))
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO images (record_id, url, width, height) VALUES (?, ?, ?, ?)", id, im_url, width, height)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range gjson.GetBytes(body, "item.place").Array() {
+
+		place_title := strings.TrimSpace(p.Get("title").String())
+
+		if place_title == "" {
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx, "INSERT INTO places (record_id, title, latitude, longitude, link) VALUES (?, ?, ?, ?, ?)",
+			id, place_title, nullFloat(p.Get("latitude").String()), nullFloat(p.Get("longitude").String()), p.Get("link").String())
+
+		if err != nil {
+			return err
+		}
+	}
+
+	notes := stringValues(body, "item.notes")
+	description := stringValues(body, "description")
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO records_fts (rowid, title, notes, description, subjects) VALUES (?, ?, ?, ?, ?)",
+		rowid, title, strings.Join(notes, "\n"), strings.Join(description, "\n"), strings.Join(subjects, "\n"))
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func recordID(body []byte) string {
+
+	for _, path := range ID_PATHS {
+
+		id := gjson.GetBytes(body, path).String()
+
+		if id != "" {
+			return id
+		}
+	}
+
+	return ""
+}
+
+// stringValues returns the distinct, non-empty string values of 'path' in the JSON record 'body'.
+func stringValues(body []byte, path string) []string {
+
+	rsp := gjson.GetBytes(body, path)
+
+	candidates := []gjson.Result{rsp}
+
+	if rsp.IsArray() {
+		candidates = rsp.Array()
+	}
+
+	values := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, r := range candidates {
+
+		if r.Type != gjson.String {
+			continue
+		}
+
+		v := strings.TrimSpace(r.Str)
+
+		if v == "" || seen[v] {
+			continue
+		}
+
+		seen[v] = true
+		values = append(values, v)
+	}
+
+	return values
+}
+
+func nullInt(str string) sql.NullInt64 {
+
+	i, err := strconv.ParseInt(str, 10, 64)
+
+	if err != nil {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: i, Valid: true}
+}
+
+func nullFloat(str string) sql.NullFloat64 {
+
+	f, err := strconv.ParseFloat(str, 64)
+
+	if err != nil {
+		return sql.NullFloat64{}
+	}
+
+	return sql.NullFloat64{Float64: f, Valid: true}
+}
@@ -0,0 +1,233 @@
+//go:build sqlite_fts5
+// +build sqlite_fts5
+
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func countRows(t *testing.T, idx *Index, q string, args ...interface{}) int {
+
+	t.Helper()
+
+	var count int
+
+	err := idx.db.QueryRowContext(context.Background(), q, args...).Scan(&count)
+
+	if err != nil {
+		t.Fatalf("Failed to query '%s', %v", q, err)
+	}
+
+	return count
+}
+
+func searchIDs(t *testing.T, idx *Index, opts *SearchOptions) int {
+
+	t.Helper()
+
+	count := 0
+
+	cb := func(ctx context.Context, body []byte) error {
+		count += 1
+		return nil
+	}
+
+	err := idx.Search(context.Background(), opts, cb)
+
+	if err != nil {
+		t.Fatalf("Failed to search index, %v", err)
+	}
+
+	return count
+}
+
+func TestIndexReplacesRecords(t *testing.T) {
+
+	ctx := context.Background()
+
+	original := []byte(`{"item": {"id": "2005691196", "notes": ["Stereograph"]}, "title": "Capitol dome", "subject": ["domes", "capitols"]}`)
+	updated := []byte(`{"item": {"id": "2005691196"}, "title": "Library reading room", "subject": ["libraries"]}`)
+	other := []byte(`{"item": {"id": "2005689966"}, "title": "Capitol grounds", "subject": ["capitols"]}`)
+
+	// Replacements within the same transaction and across transactions
+
+	for _, batch_size := range []int{DEFAULT_BATCH_SIZE, 1} {
+
+		path := filepath.Join(t.TempDir(), "records.db")
+
+		idx, err := NewIndex(ctx, path)
+
+		if err != nil {
+			t.Fatalf("Failed to create index, %v", err)
+		}
+
+		idx.BatchSize = batch_size
+
+		for _, body := range [][]byte{original, other, updated, updated} {
+
+			err := idx.Add(ctx, body)
+
+			if err != nil {
+				t.Fatalf("Failed to add record, %v", err)
+			}
+		}
+
+		err = idx.Close()
+
+		if err != nil {
+			t.Fatalf("Failed to close index, %v", err)
+		}
+
+		idx, err = OpenIndex(ctx, path)
+
+		if err != nil {
+			t.Fatalf("Failed to open index, %v", err)
+		}
+
+		defer idx.Close()
+
+		if countRows(t, idx, "SELECT COUNT(*) FROM records") != 2 || countRows(t, idx, "SELECT COUNT(*) FROM records_fts") != 2 {
+			t.Fatalf("Expected re-indexed record to replace its rows (batch size %d)", batch_size)
+		}
+
+		// Every full-text row belongs to a record
+
+		if countRows(t, idx, "SELECT COUNT(*) FROM records_fts f JOIN records r ON r.rowid = f.rowid") != 2 {
+			t.Fatalf("Expected every full-text row to match a record (batch size %d)", batch_size)
+		}
+
+		if countRows(t, idx, "SELECT COUNT(*) FROM subjects WHERE record_id = ?", "2005691196") != 1 {
+			t.Fatalf("Expected re-indexed record to replace its subjects (batch size %d)", batch_size)
+		}
+
+		if searchIDs(t, idx, &SearchOptions{Text: "dome"}) != 0 || searchIDs(t, idx, &SearchOptions{Text: "stereograph"}) != 0 {
+			t.Fatalf("Expected replaced text not to match (batch size %d)", batch_size)
+		}
+
+		if searchIDs(t, idx, &SearchOptions{Text: "reading"}) != 1 || searchIDs(t, idx, &SearchOptions{Text: "capitol"}) != 1 {
+			t.Fatalf("Unexpected full-text results (batch size %d)", batch_size)
+		}
+
+		if searchIDs(t, idx, &SearchOptions{Subject: "capitols"}) != 1 || searchIDs(t, idx, &SearchOptions{Subject: "libraries"}) != 1 {
+			t.Fatalf("Unexpected subject results (batch size %d)", batch_size)
+		}
+	}
+}
+
+func TestIndexMissingID(t *testing.T) {
+
+	ctx := context.Background()
+
+	idx, err := NewIndex(ctx, filepath.Join(t.TempDir(), "records.db"))
+
+	if err != nil {
+		t.Fatalf("Failed to create index, %v", err)
+	}
+
+	defer idx.Close()
+
+	for _, body := range []string{`{"title": "No ID"}`, `{"id": "", "item": {"id": ""}}`, `{"item": {"title": "No ID"}}`} {
+
+		err := idx.Add(ctx, []byte(body))
+
+		if !errors.Is(err, ErrMissingID) {
+			t.Fatalf("Expected ErrMissingID for %s, got %v", body, err)
+		}
+	}
+
+	// The top-level "id" property is used if there is no "item.id" property
+
+	err = idx.Add(ctx, []byte(`{"id": "http://www.loc.gov/item/2005691196/", "title": "Top-level ID"}`))
+
+	if err != nil {
+		t.Fatalf("Failed to add record, %v", err)
+	}
+
+	err = idx.commit()
+
+	if err != nil {
+		t.Fatalf("Failed to commit records, %v", err)
+	}
+
+	if countRows(t, idx, "SELECT COUNT(*) FROM records") != 1 || countRows(t, idx, "SELECT COUNT(*) FROM records_fts") != 1 {
+		t.Fatalf("Expected records without an ID to be skipped")
+	}
+
+	_, err = idx.Get(ctx, "http://www.loc.gov/item/2005691196/")
+
+	if err != nil {
+		t.Fatalf("Failed to get record, %v", err)
+	}
+}
+
+func TestIndexPath(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := map[string]string{
+		"/tmp/records.db":         "file:/tmp/records.db?mode=ro",
+		"/tmp/records?v=1#a%b.db": "file:/tmp/records%3Fv=1%23a%25b.db?mode=ro",
+		"records db/index.db":     "file:records%20db/index.db?mode=ro",
+	}
+
+	for path, expected := range tests {
+
+		if dsn(path, "mode=ro") != expected {
+			t.Fatalf("Unexpected DSN for '%s': %s, expected %s", path, dsn(path, "mode=ro"), expected)
+		}
+	}
+
+	root := t.TempDir()
+	path := filepath.Join(root, "records?v=1#a.db")
+
+	idx, err := NewIndex(ctx, path)
+
+	if err != nil {
+		t.Fatalf("Failed to create index, %v", err)
+	}
+
+	err = idx.Add(ctx, []byte(`{"item": {"id": "2005691196"}, "title": "Capitol dome"}`))
+
+	if err != nil {
+		t.Fatalf("Failed to add record, %v", err)
+	}
+
+	err = idx.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to close index, %v", err)
+	}
+
+	// The database is created at 'path' rather than at the part of 'path' before the "?"
+
+	_, err = os.Stat(path)
+
+	if err != nil {
+		t.Fatalf("Expected database at %s, %v", path, err)
+	}
+
+	_, err = os.Stat(filepath.Join(root, "records"))
+
+	if !os.IsNotExist(err) {
+		t.Fatalf("Unexpected database at truncated path")
+	}
+
+	idx, err = OpenIndex(ctx, path)
+
+	if err != nil {
+		t.Fatalf("Failed to open index, %v", err)
+	}
+
+	defer idx.Close()
+
+	_, err = idx.Get(ctx, "2005691196")
+
+	if err != nil {
+		t.Fatalf("Failed to get record, %v", err)
+	}
+}
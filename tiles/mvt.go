@@ -0,0 +1,65 @@
+package tiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+)
+
+// encodeTile returns the MVT encoding of the tile 't' containing a single layer, named 'name', with 'points'.
+func encodeTile(t maptile.Tile, name string, extent uint32, points []*point) ([]byte, error) {
+
+	fc := geojson.NewFeatureCollection()
+
+	for _, pt := range points {
+
+		props, err := mvtProperties(pt.properties)
+
+		if err != nil {
+			return nil, err
+		}
+
+		f := geojson.NewFeature(pt.coord)
+		f.Properties = props
+
+		fc.Append(f)
+	}
+
+	layer := mvt.NewLayer(name, fc)
+	layer.Version = 2
+	layer.Extent = extent
+
+	layer.ProjectToTile(t)
+
+	return mvt.Marshal(mvt.Layers{layer})
+}
+
+// mvtProperties returns a copy of 'properties' that can be encoded as MVT values. Null values are removed and
+// anything other than a string, number or boolean is encoded as a JSON string.
+func mvtProperties(properties map[string]interface{}) (geojson.Properties, error) {
+
+	props := make(geojson.Properties, len(properties))
+
+	for k, v := range properties {
+
+		switch v.(type) {
+		case nil:
+			continue
+		case string, bool, int, float64:
+			props[k] = v
+		default:
+
+			enc_v, err := json.Marshal(v)
+
+			if err != nil {
+				return nil, fmt.Errorf("Failed to encode property '%s', %w", k, err)
+			}
+
+			props[k] = string(enc_v)
+		}
+	}
+
+	return props, nil
+}
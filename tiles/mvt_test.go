@@ -0,0 +1,72 @@
+package tiles
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/maptile"
+	"math"
+	"testing"
+)
+
+func TestEncodeTile(t *testing.T) {
+
+	pt := orb.Point{-77.0365, 38.8977}
+	tile := maptile.At(pt, 12)
+
+	points := []*point{
+		{
+			coord: pt,
+			properties: map[string]interface{}{
+				"id":      "2005691196",
+				"count":   3.0,
+				"flag":    true,
+				"missing": nil,
+				"tags":    []interface{}{"a", "b"},
+			},
+		},
+	}
+
+	body, err := encodeTile(tile, "records", 4096, points)
+
+	if err != nil {
+		t.Fatalf("Failed to encode tile, %v", err)
+	}
+
+	layers, err := mvt.Unmarshal(body)
+
+	if err != nil {
+		t.Fatalf("Failed to decode tile, %v", err)
+	}
+
+	if len(layers) != 1 || layers[0].Name != "records" || layers[0].Version != 2 || layers[0].Extent != 4096 {
+		t.Fatalf("Unexpected layers %v", layers)
+	}
+
+	features := layers[0].Features
+
+	if len(features) != 1 {
+		t.Fatalf("Expected 1 feature, got %d", len(features))
+	}
+
+	props := features[0].Properties
+
+	if props["id"] != "2005691196" || props["count"] != 3.0 || props["flag"] != true || props["tags"] != `["a","b"]` {
+		t.Fatalf("Unexpected properties %v", props)
+	}
+
+	_, exists := props["missing"]
+
+	if exists {
+		t.Fatalf("Expected null property to be omitted")
+	}
+
+	// Projecting the tile coordinates back should return (approximately) the original point
+
+	layers.ProjectToWGS84(tile)
+
+	decoded := layers[0].Features[0].Geometry.(orb.Point)
+
+	if math.Abs(decoded.Lon()-pt.Lon()) > 0.001 || math.Abs(decoded.Lat()-pt.Lat()) > 0.001 {
+		t.Fatalf("Unexpected coordinates %v, expected %v", decoded, pt)
+	}
+}
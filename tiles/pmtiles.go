@@ -0,0 +1,401 @@
+package tiles
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+)
+
+// The size of a PMTiles (version 3) header.
+const pmtiles_header_size int = 127
+
+// The maximum size of a PMTiles header and root directory, which clients fetch in a single request.
+const pmtiles_root_size int = 16384
+
+// PMTiles compression and tile types.
+const (
+	pmtiles_compression_gzip uint8 = 2
+	pmtiles_tile_type_mvt    uint8 = 1
+)
+
+// pmtilesEntry is a PMTiles directory entry. For tiles 'offset' is relative to the start of the tile data section
+// and for leaf directories, whose 'run_length' is 0, it is relative to the start of the leaf directories section.
+type pmtilesEntry struct {
+	tile_id    uint64
+	offset     uint64
+	length     uint64
+	run_length uint64
+}
+
+// PMTilesOptions defines options for creating a PMTilesWriter.
+type PMTilesOptions struct {
+	MinZoom int
+	MaxZoom int
+	Bound   orb.Bound
+	// Metadata to encode as JSON in the archive, for example the output of Tileset.Metadata.
+	Metadata interface{}
+}
+
+// PMTilesWriter writes vector tiles to a PMTiles (version 3) archive. Because the directories describing the tiles
+// precede the tiles themselves nothing is written until Close is called; in the meantime (gzip-compressed) tiles
+// are written to a temporary file.
+type PMTilesWriter struct {
+	wr        io.Writer
+	options   *PMTilesOptions
+	mu        *sync.Mutex
+	tmp       *os.File
+	offset    uint64
+	entries   []*pmtilesEntry
+	clustered bool
+}
+
+// NewPMTilesWriter returns a new PMTilesWriter that writes to 'wr'.
+func NewPMTilesWriter(wr io.Writer, opts *PMTilesOptions) (*PMTilesWriter, error) {
+
+	tmp, err := os.CreateTemp("", "tiles-*.data")
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create temporary file, %w", err)
+	}
+
+	pw := &PMTilesWriter{
+		wr:        wr,
+		options:   opts,
+		mu:        new(sync.Mutex),
+		tmp:       tmp,
+		entries:   make([]*pmtilesEntry, 0),
+		clustered: true,
+	}
+
+	return pw, nil
+}
+
+// WriteTile adds the MVT-encoded tile 't' to the archive. Tiles should be written in ascending order of their tile
+// IDs (see TileID), which is the order Tileset.Generate produces them in, so that the archive is "clustered".
+func (pw *PMTilesWriter) WriteTile(t maptile.Tile, body []byte) error {
+
+	compressed, err := gzipBytes(body)
+
+	if err != nil {
+		return fmt.Errorf("Failed to compress tile %d/%d/%d, %w", t.Z, t.X, t.Y, err)
+	}
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	_, err = pw.tmp.Write(compressed)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write tile to temporary file, %w", err)
+	}
+
+	e := &pmtilesEntry{
+		tile_id:    TileID(t),
+		offset:     pw.offset,
+		length:     uint64(len(compressed)),
+		run_length: 1,
+	}
+
+	count := len(pw.entries)
+
+	if count > 0 && pw.entries[count-1].tile_id >= e.tile_id {
+		pw.clustered = false
+	}
+
+	pw.entries = append(pw.entries, e)
+	pw.offset += e.length
+
+	return nil
+}
+
+// Close writes the PMTiles header, directories, metadata and tiles and removes the writer's temporary file.
+func (pw *PMTilesWriter) Close() error {
+
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	defer func() {
+		pw.tmp.Close()
+		os.Remove(pw.tmp.Name())
+	}()
+
+	sort.Slice(pw.entries, func(i int, j int) bool {
+		return pw.entries[i].tile_id < pw.entries[j].tile_id
+	})
+
+	root, leaves, err := buildDirectories(pw.entries)
+
+	if err != nil {
+		return err
+	}
+
+	enc_meta, err := json.Marshal(pw.options.Metadata)
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal metadata, %w", err)
+	}
+
+	metadata, err := gzipBytes(enc_meta)
+
+	if err != nil {
+		return fmt.Errorf("Failed to compress metadata, %w", err)
+	}
+
+	root_offset := uint64(pmtiles_header_size)
+	metadata_offset := root_offset + uint64(len(root))
+	leaves_offset := metadata_offset + uint64(len(metadata))
+	data_offset := leaves_offset + uint64(len(leaves))
+
+	b := pw.options.Bound
+	center := b.Center()
+
+	h := make([]byte, pmtiles_header_size)
+
+	copy(h[0:7], "PMTiles")
+	h[7] = 3
+
+	binary.LittleEndian.PutUint64(h[8:], root_offset)
+	binary.LittleEndian.PutUint64(h[16:], uint64(len(root)))
+	binary.LittleEndian.PutUint64(h[24:], metadata_offset)
+	binary.LittleEndian.PutUint64(h[32:], uint64(len(metadata)))
+	binary.LittleEndian.PutUint64(h[40:], leaves_offset)
+	binary.LittleEndian.PutUint64(h[48:], uint64(len(leaves)))
+	binary.LittleEndian.PutUint64(h[56:], data_offset)
+	binary.LittleEndian.PutUint64(h[64:], pw.offset)
+	binary.LittleEndian.PutUint64(h[72:], uint64(len(pw.entries)))
+	binary.LittleEndian.PutUint64(h[80:], uint64(len(pw.entries)))
+	binary.LittleEndian.PutUint64(h[88:], uint64(len(pw.entries)))
+
+	if pw.clustered {
+		h[96] = 1
+	}
+
+	h[97] = pmtiles_compression_gzip
+	h[98] = pmtiles_compression_gzip
+	h[99] = pmtiles_tile_type_mvt
+	h[100] = uint8(pw.options.MinZoom)
+	h[101] = uint8(pw.options.MaxZoom)
+
+	binary.LittleEndian.PutUint32(h[102:], uint32(e7(b.Min.Lon())))
+	binary.LittleEndian.PutUint32(h[106:], uint32(e7(b.Min.Lat())))
+	binary.LittleEndian.PutUint32(h[110:], uint32(e7(b.Max.Lon())))
+	binary.LittleEndian.PutUint32(h[114:], uint32(e7(b.Max.Lat())))
+
+	h[118] = uint8(pw.options.MinZoom)
+
+	binary.LittleEndian.PutUint32(h[119:], uint32(e7(center.Lon())))
+	binary.LittleEndian.PutUint32(h[123:], uint32(e7(center.Lat())))
+
+	for _, section := range [][]byte{h, root, metadata, leaves} {
+
+		_, err := pw.wr.Write(section)
+
+		if err != nil {
+			return fmt.Errorf("Failed to write PMTiles archive, %w", err)
+		}
+	}
+
+	_, err = pw.tmp.Seek(0, io.SeekStart)
+
+	if err != nil {
+		return fmt.Errorf("Failed to rewind temporary file, %w", err)
+	}
+
+	_, err = io.Copy(pw.wr, pw.tmp)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write PMTiles tile data, %w", err)
+	}
+
+	return nil
+}
+
+// buildDirectories returns the (gzip-compressed) root directory and leaf directories for 'entries'. If all the
+// entries fit in the root directory there are no leaf directories, otherwise entries are split in to leaf
+// directories, which are made larger until the root directory pointing to them is small enough.
+func buildDirectories(entries []*pmtilesEntry) ([]byte, []byte, error) {
+
+	max_root := pmtiles_root_size - pmtiles_header_size
+
+	root, err := encodeDirectory(entries)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(root) <= max_root {
+		return root, nil, nil
+	}
+
+	leaf_size := len(entries) / 3500
+
+	if leaf_size < 4096 {
+		leaf_size = 4096
+	}
+
+	for {
+
+		root_entries := make([]*pmtilesEntry, 0)
+		leaves := make([]byte, 0)
+
+		for idx := 0; idx < len(entries); idx += leaf_size {
+
+			end := idx + leaf_size
+
+			if end > len(entries) {
+				end = len(entries)
+			}
+
+			leaf, err := encodeDirectory(entries[idx:end])
+
+			if err != nil {
+				return nil, nil, err
+			}
+
+			root_entries = append(root_entries, &pmtilesEntry{
+				tile_id:    entries[idx].tile_id,
+				offset:     uint64(len(leaves)),
+				length:     uint64(len(leaf)),
+				run_length: 0,
+			})
+
+			leaves = append(leaves, leaf...)
+		}
+
+		root, err := encodeDirectory(root_entries)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(root) <= max_root {
+			return root, leaves, nil
+		}
+
+		leaf_size = leaf_size * 2
+	}
+}
+
+// encodeDirectory returns the gzip-compressed PMTiles encoding of 'entries': the number of entries followed by
+// columns of (varint) tile ID deltas, run lengths, lengths and offsets, where an offset of 0 signals that an
+// entry immediately follows the previous one and any other offset is stored plus one.
+func encodeDirectory(entries []*pmtilesEntry) ([]byte, error) {
+
+	buf := make([]byte, 0)
+	buf = binary.AppendUvarint(buf, uint64(len(entries)))
+
+	last_id := uint64(0)
+
+	for _, e := range entries {
+		buf = binary.AppendUvarint(buf, e.tile_id-last_id)
+		last_id = e.tile_id
+	}
+
+	for _, e := range entries {
+		buf = binary.AppendUvarint(buf, e.run_length)
+	}
+
+	for _, e := range entries {
+		buf = binary.AppendUvarint(buf, e.length)
+	}
+
+	for idx, e := range entries {
+
+		if idx > 0 && e.offset == entries[idx-1].offset+entries[idx-1].length {
+			buf = binary.AppendUvarint(buf, 0)
+		} else {
+			buf = binary.AppendUvarint(buf, e.offset+1)
+		}
+	}
+
+	compressed, err := gzipBytes(buf)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compress directory, %w", err)
+	}
+
+	return compressed, nil
+}
+
+// TileID returns the PMTiles tile ID for 't': the number of tiles in all the zoom levels before it plus the
+// position of 't' along a Hilbert curve at its zoom level.
+func TileID(t maptile.Tile) uint64 {
+
+	z := uint64(t.Z)
+
+	acc := uint64(0)
+
+	for i := uint64(0); i < z; i++ {
+		acc += (1 << i) * (1 << i)
+	}
+
+	n := uint64(1) << z
+
+	x := uint64(t.X)
+	y := uint64(t.Y)
+	d := uint64(0)
+
+	for s := n / 2; s > 0; s /= 2 {
+
+		rx := uint64(0)
+		ry := uint64(0)
+
+		if x&s > 0 {
+			rx = 1
+		}
+
+		if y&s > 0 {
+			ry = 1
+		}
+
+		d += s * s * ((3 * rx) ^ ry)
+
+		// Rotate the quadrant
+
+		if ry == 0 {
+
+			if rx == 1 {
+				x = s - 1 - x
+				y = s - 1 - y
+			}
+
+			x, y = y, x
+		}
+	}
+
+	return acc + d
+}
+
+func gzipBytes(body []byte) ([]byte, error) {
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+
+	_, err := gz.Write(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = gz.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// e7 returns 'v' as an integer with 7 decimal places of precision, as used by PMTiles headers.
+func e7(v float64) int32 {
+	return int32(math.Round(v * 10000000))
+}
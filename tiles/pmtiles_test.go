@@ -0,0 +1,539 @@
+package tiles
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// testHeader is a decoded PMTiles header.
+type testHeader struct {
+	root_offset     uint64
+	root_length     uint64
+	metadata_offset uint64
+	metadata_length uint64
+	leaves_offset   uint64
+	leaves_length   uint64
+	data_offset     uint64
+	data_length     uint64
+	addressed       uint64
+	entries         uint64
+	contents        uint64
+	clustered       bool
+	min_zoom        uint8
+	max_zoom        uint8
+	bound           orb.Bound
+}
+
+func decodeHeader(body []byte) (*testHeader, error) {
+
+	if len(body) < pmtiles_header_size {
+		return nil, fmt.Errorf("Archive is too short")
+	}
+
+	if string(body[0:7]) != "PMTiles" || body[7] != 3 {
+		return nil, fmt.Errorf("Invalid magic number or version")
+	}
+
+	if body[97] != pmtiles_compression_gzip || body[98] != pmtiles_compression_gzip || body[99] != pmtiles_tile_type_mvt {
+		return nil, fmt.Errorf("Unexpected compression or tile type")
+	}
+
+	u64 := func(offset int) uint64 {
+		return binary.LittleEndian.Uint64(body[offset:])
+	}
+
+	e7 := func(offset int) float64 {
+		return float64(int32(binary.LittleEndian.Uint32(body[offset:]))) / 10000000.0
+	}
+
+	h := &testHeader{
+		root_offset:     u64(8),
+		root_length:     u64(16),
+		metadata_offset: u64(24),
+		metadata_length: u64(32),
+		leaves_offset:   u64(40),
+		leaves_length:   u64(48),
+		data_offset:     u64(56),
+		data_length:     u64(64),
+		addressed:       u64(72),
+		entries:         u64(80),
+		contents:        u64(88),
+		clustered:       body[96] == 1,
+		min_zoom:        body[100],
+		max_zoom:        body[101],
+		bound: orb.Bound{
+			Min: orb.Point{e7(102), e7(106)},
+			Max: orb.Point{e7(110), e7(114)},
+		},
+	}
+
+	return h, nil
+}
+
+// decodeDirectory decodes the gzip-compressed PMTiles directory 'body'.
+func decodeDirectory(body []byte) ([]*pmtilesEntry, error) {
+
+	buf, err := gunzipBytes(body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rd := bytes.NewReader(buf)
+
+	count, err := binary.ReadUvarint(rd)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*pmtilesEntry, count)
+
+	last_id := uint64(0)
+
+	for i := range entries {
+
+		delta, err := binary.ReadUvarint(rd)
+
+		if err != nil {
+			return nil, err
+		}
+
+		last_id += delta
+		entries[i] = &pmtilesEntry{tile_id: last_id}
+	}
+
+	for _, e := range entries {
+
+		e.run_length, err = binary.ReadUvarint(rd)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, e := range entries {
+
+		e.length, err = binary.ReadUvarint(rd)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, e := range entries {
+
+		offset, err := binary.ReadUvarint(rd)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if offset == 0 {
+
+			if i == 0 {
+				return nil, fmt.Errorf("First entry has a relative offset")
+			}
+
+			e.offset = entries[i-1].offset + entries[i-1].length
+		} else {
+			e.offset = offset - 1
+		}
+	}
+
+	if rd.Len() != 0 {
+		return nil, fmt.Errorf("Directory has %d trailing bytes", rd.Len())
+	}
+
+	return entries, nil
+}
+
+// readEntries returns the tile entries for the root directory 'root', resolving any leaf directories in 'leaves'.
+func readEntries(root []byte, leaves []byte) ([]*pmtilesEntry, error) {
+
+	root_entries, err := decodeDirectory(root)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode root directory, %w", err)
+	}
+
+	entries := make([]*pmtilesEntry, 0)
+
+	for _, e := range root_entries {
+
+		if e.run_length > 0 {
+			entries = append(entries, e)
+			continue
+		}
+
+		if e.offset+e.length > uint64(len(leaves)) {
+			return nil, fmt.Errorf("Leaf directory for %d is out of range", e.tile_id)
+		}
+
+		leaf_entries, err := decodeDirectory(leaves[e.offset : e.offset+e.length])
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode leaf directory for %d, %w", e.tile_id, err)
+		}
+
+		if len(leaf_entries) == 0 || leaf_entries[0].tile_id != e.tile_id {
+			return nil, fmt.Errorf("Leaf directory for %d does not start with tile %d", e.tile_id, e.tile_id)
+		}
+
+		entries = append(entries, leaf_entries...)
+	}
+
+	return entries, nil
+}
+
+func gunzipBytes(body []byte) ([]byte, error) {
+
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer gz.Close()
+
+	return io.ReadAll(gz)
+}
+
+func TestTileID(t *testing.T) {
+
+	tests := map[maptile.Tile]uint64{
+		maptile.New(0, 0, 0): 0,
+		maptile.New(0, 0, 1): 1,
+		maptile.New(0, 1, 1): 2,
+		maptile.New(1, 1, 1): 3,
+		maptile.New(1, 0, 1): 4,
+		maptile.New(0, 0, 2): 5,
+		maptile.New(3, 0, 2): 20,
+	}
+
+	for tile, expected := range tests {
+
+		id := TileID(tile)
+
+		if id != expected {
+			t.Fatalf("Unexpected ID for tile %d/%d/%d: %d, expected %d", tile.Z, tile.X, tile.Y, id, expected)
+		}
+	}
+
+	// Every tile at a zoom level should have a distinct ID between the number of tiles in the zoom levels before
+	// it and the number of tiles up to and including it.
+
+	first := uint64(0)
+
+	for z := maptile.Zoom(0); z <= 7; z++ {
+
+		n := uint32(1) << z
+		count := uint64(n) * uint64(n)
+
+		seen := make(map[uint64]bool)
+
+		for x := uint32(0); x < n; x++ {
+
+			for y := uint32(0); y < n; y++ {
+
+				id := TileID(maptile.New(x, y, z))
+
+				if id < first || id >= first+count {
+					t.Fatalf("ID %d for tile %d/%d/%d is out of range", id, z, x, y)
+				}
+
+				if seen[id] {
+					t.Fatalf("Duplicate ID %d for tile %d/%d/%d", id, z, x, y)
+				}
+
+				seen[id] = true
+			}
+		}
+
+		first += count
+	}
+}
+
+func TestPMTilesWriter(t *testing.T) {
+
+	bound := orb.Bound{
+		Min: orb.Point{-77.1198, 38.7916},
+		Max: orb.Point{-76.9094, 38.9955},
+	}
+
+	metadata := map[string]interface{}{
+		"name":   "test",
+		"format": "pbf",
+	}
+
+	opts := &PMTilesOptions{
+		MinZoom:  0,
+		MaxZoom:  2,
+		Bound:    bound,
+		Metadata: metadata,
+	}
+
+	var buf bytes.Buffer
+
+	pw, err := NewPMTilesWriter(&buf, opts)
+
+	if err != nil {
+		t.Fatalf("Failed to create PMTiles writer, %v", err)
+	}
+
+	tiles := []maptile.Tile{
+		maptile.New(0, 0, 0),
+		maptile.New(0, 0, 1),
+		maptile.New(1, 1, 1),
+		maptile.New(1, 0, 1),
+		maptile.New(2, 1, 2),
+	}
+
+	bodies := make(map[uint64][]byte)
+
+	for idx, tile := range tiles {
+
+		body := []byte(fmt.Sprintf("tile %d/%d/%d", tile.Z, tile.X, tile.Y))
+		bodies[TileID(tile)] = body
+
+		// Write one tile out of order so that the archive is not clustered but its directory is still sorted
+
+		if idx == 2 {
+			continue
+		}
+
+		err := pw.WriteTile(tile, body)
+
+		if err != nil {
+			t.Fatalf("Failed to write tile, %v", err)
+		}
+	}
+
+	err = pw.WriteTile(tiles[2], bodies[TileID(tiles[2])])
+
+	if err != nil {
+		t.Fatalf("Failed to write tile, %v", err)
+	}
+
+	err = pw.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to close PMTiles writer, %v", err)
+	}
+
+	archive := buf.Bytes()
+
+	h, err := decodeHeader(archive)
+
+	if err != nil {
+		t.Fatalf("Failed to decode header, %v", err)
+	}
+
+	if h.root_offset != uint64(pmtiles_header_size) {
+		t.Fatalf("Unexpected root directory offset %d", h.root_offset)
+	}
+
+	if h.metadata_offset != h.root_offset+h.root_length || h.leaves_offset != h.metadata_offset+h.metadata_length || h.data_offset != h.leaves_offset+h.leaves_length {
+		t.Fatalf("Sections are not contiguous: %+v", h)
+	}
+
+	if h.data_offset+h.data_length != uint64(len(archive)) {
+		t.Fatalf("Tile data ends at %d but the archive is %d bytes", h.data_offset+h.data_length, len(archive))
+	}
+
+	if h.addressed != uint64(len(tiles)) || h.entries != uint64(len(tiles)) || h.contents != uint64(len(tiles)) {
+		t.Fatalf("Unexpected tile counts %d, %d, %d", h.addressed, h.entries, h.contents)
+	}
+
+	if h.clustered {
+		t.Fatalf("Expected archive to not be clustered")
+	}
+
+	if h.min_zoom != 0 || h.max_zoom != 2 {
+		t.Fatalf("Unexpected zoom levels %d-%d", h.min_zoom, h.max_zoom)
+	}
+
+	if !h.bound.Equal(bound) {
+		t.Fatalf("Unexpected bounds %v", h.bound)
+	}
+
+	enc_meta, err := gunzipBytes(archive[h.metadata_offset : h.metadata_offset+h.metadata_length])
+
+	if err != nil {
+		t.Fatalf("Failed to decompress metadata, %v", err)
+	}
+
+	var meta map[string]interface{}
+
+	err = json.Unmarshal(enc_meta, &meta)
+
+	if err != nil {
+		t.Fatalf("Failed to unmarshal metadata, %v", err)
+	}
+
+	if meta["name"] != "test" || meta["format"] != "pbf" {
+		t.Fatalf("Unexpected metadata %v", meta)
+	}
+
+	root := archive[h.root_offset : h.root_offset+h.root_length]
+	leaves := archive[h.leaves_offset : h.leaves_offset+h.leaves_length]
+
+	entries, err := readEntries(root, leaves)
+
+	if err != nil {
+		t.Fatalf("Failed to read directories, %v", err)
+	}
+
+	if len(entries) != len(tiles) {
+		t.Fatalf("Expected %d entries, got %d", len(tiles), len(entries))
+	}
+
+	for idx, e := range entries {
+
+		if idx > 0 && e.tile_id <= entries[idx-1].tile_id {
+			t.Fatalf("Entries are not sorted by tile ID")
+		}
+
+		if e.run_length != 1 {
+			t.Fatalf("Unexpected run length %d for tile %d", e.run_length, e.tile_id)
+		}
+
+		start := h.data_offset + e.offset
+		body, err := gunzipBytes(archive[start : start+e.length])
+
+		if err != nil {
+			t.Fatalf("Failed to decompress tile %d, %v", e.tile_id, err)
+		}
+
+		if string(body) != string(bodies[e.tile_id]) {
+			t.Fatalf("Unexpected body for tile %d: %s", e.tile_id, body)
+		}
+	}
+}
+
+func TestPMTilesWriterClustered(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	pw, err := NewPMTilesWriter(&buf, &PMTilesOptions{MaxZoom: 1})
+
+	if err != nil {
+		t.Fatalf("Failed to create PMTiles writer, %v", err)
+	}
+
+	for _, tile := range []maptile.Tile{maptile.New(0, 0, 0), maptile.New(0, 0, 1), maptile.New(0, 1, 1)} {
+
+		err := pw.WriteTile(tile, []byte("tile"))
+
+		if err != nil {
+			t.Fatalf("Failed to write tile, %v", err)
+		}
+	}
+
+	err = pw.Close()
+
+	if err != nil {
+		t.Fatalf("Failed to close PMTiles writer, %v", err)
+	}
+
+	h, err := decodeHeader(buf.Bytes())
+
+	if err != nil {
+		t.Fatalf("Failed to decode header, %v", err)
+	}
+
+	if !h.clustered {
+		t.Fatalf("Expected archive to be clustered")
+	}
+}
+
+func TestBuildDirectories(t *testing.T) {
+
+	// Random gaps between tile IDs and random lengths, which do not compress well, to force leaf directories
+
+	r := rand.New(rand.NewSource(1))
+
+	entries := make([]*pmtilesEntry, 100000)
+
+	tile_id := uint64(0)
+	offset := uint64(0)
+
+	for i := range entries {
+
+		tile_id += 1 + uint64(r.Intn(1000))
+		length := 1 + uint64(r.Intn(100000))
+
+		entries[i] = &pmtilesEntry{
+			tile_id:    tile_id,
+			offset:     offset,
+			length:     length,
+			run_length: 1,
+		}
+
+		offset += length
+	}
+
+	root, leaves, err := buildDirectories(entries)
+
+	if err != nil {
+		t.Fatalf("Failed to build directories, %v", err)
+	}
+
+	if len(root) > pmtiles_root_size-pmtiles_header_size {
+		t.Fatalf("Root directory is too large (%d bytes)", len(root))
+	}
+
+	if len(leaves) == 0 {
+		t.Fatalf("Expected leaf directories")
+	}
+
+	decoded, err := readEntries(root, leaves)
+
+	if err != nil {
+		t.Fatalf("Failed to read directories, %v", err)
+	}
+
+	if len(decoded) != len(entries) {
+		t.Fatalf("Expected %d entries, got %d", len(entries), len(decoded))
+	}
+
+	for i, e := range decoded {
+
+		if *e != *entries[i] {
+			t.Fatalf("Entry %d does not match: %+v, expected %+v", i, e, entries[i])
+		}
+	}
+
+	// A handful of entries should fit in the root directory
+
+	root, leaves, err = buildDirectories(entries[:10])
+
+	if err != nil {
+		t.Fatalf("Failed to build directories, %v", err)
+	}
+
+	if len(leaves) != 0 {
+		t.Fatalf("Expected no leaf directories")
+	}
+
+	decoded, err = readEntries(root, leaves)
+
+	if err != nil {
+		t.Fatalf("Failed to read directories, %v", err)
+	}
+
+	for i, e := range decoded {
+
+		if *e != *entries[i] {
+			t.Fatalf("Entry %d does not match: %+v, expected %+v", i, e, entries[i])
+		}
+	}
+}
@@ -0,0 +1,401 @@
+// package tiles provides methods for generating Mapbox Vector Tiles (MVT) from located records, with points
+// clustered at low zoom levels, and for writing them to PMTiles archives.
+package tiles
+
+import (
+	"context"
+	"fmt"
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"math"
+	"sort"
+	"sync"
+)
+
+// The default name of the layer in each tile.
+const DEFAULT_LAYER string = "records"
+
+// The default minimum zoom level to generate tiles for.
+const DEFAULT_MIN_ZOOM int = 0
+
+// The default maximum zoom level to generate tiles for.
+const DEFAULT_MAX_ZOOM int = 14
+
+// The default maximum zoom level at which points are clustered.
+const DEFAULT_CLUSTER_MAX_ZOOM int = 10
+
+// The default radius, in (256 pixel tile) pixels, within which points are clustered.
+const DEFAULT_CLUSTER_RADIUS float64 = 40.0
+
+// The default size of a tile in tile coordinates.
+const DEFAULT_EXTENT uint32 = 4096
+
+// The default number of tile coordinates beyond the edges of a tile within which points are also included.
+const DEFAULT_BUFFER uint32 = 64
+
+// The maximum zoom level supported.
+const MAX_ZOOM int = 24
+
+// The names of the properties assigned to cluster features.
+const (
+	CLUSTER_PROPERTY     string = "cluster"
+	POINT_COUNT_PROPERTY string = "point_count"
+)
+
+// TilesetOptions defines options for creating a Tileset.
+type TilesetOptions struct {
+	// The name of the layer in each tile.
+	Layer string
+	// The minimum zoom level to generate tiles for.
+	MinZoom int
+	// The maximum zoom level to generate tiles for.
+	MaxZoom int
+	// The maximum zoom level at which points are clustered. If less than MinZoom points are never clustered.
+	ClusterMaxZoom int
+	// The radius, in (256 pixel tile) pixels, within which points are clustered.
+	ClusterRadius float64
+	// The size of a tile in tile coordinates.
+	Extent uint32
+	// The number of tile coordinates beyond the edges of a tile within which points are also included.
+	Buffer uint32
+}
+
+// Tileset collects points, and their properties, and generates vector tiles for them.
+type Tileset struct {
+	options *TilesetOptions
+	mu      *sync.Mutex
+	points  []*point
+	bound   orb.Bound
+	fields  map[string]string
+}
+
+// TileCallbackFunc is a function invoked for each tile generated by a Tileset.
+type TileCallbackFunc func(context.Context, maptile.Tile, []byte) error
+
+type point struct {
+	coord      orb.Point
+	properties map[string]interface{}
+}
+
+// NewTileset returns a new Tileset for 'opts'.
+func NewTileset(opts *TilesetOptions) (*Tileset, error) {
+
+	if opts.MinZoom < 0 || opts.MaxZoom > MAX_ZOOM || opts.MinZoom > opts.MaxZoom {
+		return nil, fmt.Errorf("Invalid zoom range %d-%d, zoom levels must be between 0 and %d", opts.MinZoom, opts.MaxZoom, MAX_ZOOM)
+	}
+
+	if opts.Extent == 0 {
+		return nil, fmt.Errorf("Invalid extent")
+	}
+
+	if opts.ClusterRadius <= 0 && opts.ClusterMaxZoom >= opts.MinZoom {
+		return nil, fmt.Errorf("Invalid cluster radius")
+	}
+
+	if opts.Layer == "" {
+		opts.Layer = DEFAULT_LAYER
+	}
+
+	ts := &Tileset{
+		options: opts,
+		mu:      new(sync.Mutex),
+		points:  make([]*point, 0),
+		fields:  make(map[string]string),
+	}
+
+	return ts, nil
+}
+
+// Add adds a point, with (JSON-decoded) properties, to 'ts'. It is safe for concurrent use.
+func (ts *Tileset) Add(pt orb.Point, properties map[string]interface{}) {
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if len(ts.points) == 0 {
+		ts.bound = pt.Bound()
+	} else {
+		ts.bound = ts.bound.Extend(pt)
+	}
+
+	ts.points = append(ts.points, &point{coord: pt, properties: properties})
+
+	for k, v := range properties {
+
+		t := fieldType(v)
+
+		if t == "" {
+			continue
+		}
+
+		current, exists := ts.fields[k]
+
+		if exists && current != t {
+			t = "String"
+		}
+
+		ts.fields[k] = t
+	}
+}
+
+// Count returns the number of points in 'ts'.
+func (ts *Tileset) Count() int {
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return len(ts.points)
+}
+
+// Bound returns the bounding box of the points in 'ts'.
+func (ts *Tileset) Bound() orb.Bound {
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	return ts.bound
+}
+
+// Fields returns the names of the properties of the points in 'ts' and their types ("String", "Number" or
+// "Boolean") in the form used by the "vector_layers" element of TileJSON and PMTiles metadata.
+func (ts *Tileset) Fields() map[string]string {
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	fields := make(map[string]string)
+
+	for k, v := range ts.fields {
+		fields[k] = v
+	}
+
+	if ts.options.ClusterMaxZoom >= ts.options.MinZoom {
+		fields[CLUSTER_PROPERTY] = "Boolean"
+		fields[POINT_COUNT_PROPERTY] = "Number"
+	}
+
+	return fields
+}
+
+// Metadata returns a TileJSON-style description of 'ts'.
+func (ts *Tileset) Metadata(name string) map[string]interface{} {
+
+	b := ts.Bound()
+	center := b.Center()
+
+	layer := map[string]interface{}{
+		"id":      ts.options.Layer,
+		"fields":  ts.Fields(),
+		"minzoom": ts.options.MinZoom,
+		"maxzoom": ts.options.MaxZoom,
+	}
+
+	meta := map[string]interface{}{
+		"name":          name,
+		"format":        "pbf",
+		"type":          "overlay",
+		"minzoom":       ts.options.MinZoom,
+		"maxzoom":       ts.options.MaxZoom,
+		"bounds":        []float64{b.Min.Lon(), b.Min.Lat(), b.Max.Lon(), b.Max.Lat()},
+		"center":        []float64{center.Lon(), center.Lat(), float64(ts.options.MinZoom)},
+		"vector_layers": []interface{}{layer},
+		"generator":     "go-libraryofcongress-datajam",
+	}
+
+	return meta
+}
+
+// Generate generates the (non-empty) tiles, for every zoom level, for the points in 'ts' invoking 'cb' for each
+// one. Tiles are generated in ascending order of their PMTiles tile ID (see TileID). Points are clustered at zoom
+// levels up to and including TilesetOptions.ClusterMaxZoom.
+func (ts *Tileset) Generate(ctx context.Context, cb TileCallbackFunc) error {
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	for z := ts.options.MinZoom; z <= ts.options.MaxZoom; z++ {
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			// pass
+		}
+
+		points := ts.points
+
+		if z <= ts.options.ClusterMaxZoom {
+			points = ts.cluster(z)
+		}
+
+		features := ts.features(z, points)
+
+		tiles := make([]maptile.Tile, 0, len(features))
+
+		for t := range features {
+			tiles = append(tiles, t)
+		}
+
+		sort.Slice(tiles, func(i int, j int) bool {
+			return TileID(tiles[i]) < TileID(tiles[j])
+		})
+
+		for _, t := range tiles {
+
+			body, err := encodeTile(t, ts.options.Layer, ts.options.Extent, features[t])
+
+			if err != nil {
+				return fmt.Errorf("Failed to encode tile %d/%d/%d, %w", t.Z, t.X, t.Y, err)
+			}
+
+			err = cb(ctx, t, body)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// cluster returns the points in 'ts' grouped, at zoom level 'z', in to square cells whose size is the cluster
+// radius. Cells containing a single point return that point and cells containing more than one point return a
+// cluster point, at the average location of its members, with CLUSTER_PROPERTY and POINT_COUNT_PROPERTY properties.
+func (ts *Tileset) cluster(z int) []*point {
+
+	// The size of a cell, as a fraction of a tile at zoom 'z'
+	cell_size := ts.options.ClusterRadius / 256.0
+
+	type cell struct {
+		x int64
+		y int64
+	}
+
+	cells := make(map[cell][]*point)
+	order := make([]cell, 0)
+
+	for _, pt := range ts.points {
+
+		f := maptile.Fraction(pt.coord, maptile.Zoom(z))
+
+		c := cell{
+			x: int64(math.Floor(f.X() / cell_size)),
+			y: int64(math.Floor(f.Y() / cell_size)),
+		}
+
+		_, exists := cells[c]
+
+		if !exists {
+			order = append(order, c)
+		}
+
+		cells[c] = append(cells[c], pt)
+	}
+
+	clustered := make([]*point, 0, len(cells))
+
+	for _, c := range order {
+
+		members := cells[c]
+
+		if len(members) == 1 {
+			clustered = append(clustered, members[0])
+			continue
+		}
+
+		sum_lon := 0.0
+		sum_lat := 0.0
+
+		for _, m := range members {
+			sum_lon += m.coord.Lon()
+			sum_lat += m.coord.Lat()
+		}
+
+		count := float64(len(members))
+
+		cl := &point{
+			coord: orb.Point{sum_lon / count, sum_lat / count},
+			properties: map[string]interface{}{
+				CLUSTER_PROPERTY:     true,
+				POINT_COUNT_PROPERTY: len(members),
+			},
+		}
+
+		clustered = append(clustered, cl)
+	}
+
+	return clustered
+}
+
+// features returns 'points', at zoom level 'z', grouped by tile. Points within the buffer of a neighbouring tile
+// are included in that tile as well.
+func (ts *Tileset) features(z int, points []*point) map[maptile.Tile][]*point {
+
+	features := make(map[maptile.Tile][]*point)
+
+	max_tile := int64(1<<uint(z)) - 1
+	extent := float64(ts.options.Extent)
+	buffer := float64(ts.options.Buffer)
+
+	for _, pt := range points {
+
+		f := maptile.Fraction(pt.coord, maptile.Zoom(z))
+
+		tx := clampTile(int64(math.Floor(f.X())), max_tile)
+		ty := clampTile(int64(math.Floor(f.Y())), max_tile)
+
+		for dx := int64(-1); dx <= 1; dx++ {
+
+			for dy := int64(-1); dy <= 1; dy++ {
+
+				x := tx + dx
+				y := ty + dy
+
+				if x < 0 || y < 0 || x > max_tile || y > max_tile {
+					continue
+				}
+
+				local_x := (f.X() - float64(x)) * extent
+				local_y := (f.Y() - float64(y)) * extent
+
+				if local_x < -buffer || local_x > extent+buffer || local_y < -buffer || local_y > extent+buffer {
+					continue
+				}
+
+				t := maptile.New(uint32(x), uint32(y), maptile.Zoom(z))
+				features[t] = append(features[t], pt)
+			}
+		}
+	}
+
+	return features
+}
+
+func clampTile(v int64, max_tile int64) int64 {
+
+	if v < 0 {
+		return 0
+	}
+
+	if v > max_tile {
+		return max_tile
+	}
+
+	return v
+}
+
+// fieldType returns the TileJSON field type for the (JSON-decoded) value 'v' or an empty string for null values.
+func fieldType(v interface{}) string {
+
+	switch v.(type) {
+	case nil:
+		return ""
+	case bool:
+		return "Boolean"
+	case float64, int:
+		return "Number"
+	default:
+		return "String"
+	}
+}
@@ -0,0 +1,285 @@
+// package timeline provides methods for counting Library of Congress records by year and decade.
+package timeline
+
+import (
+	"github.com/aaronland/go-libraryofcongress-datajam/dates"
+	"github.com/tidwall/gjson"
+	"sort"
+	"sync"
+)
+
+// The name of the group that every record belongs to when records are not grouped.
+const GROUP_ALL string = "all"
+
+// The default number of sample item IDs recorded for each year and decade.
+const DEFAULT_SAMPLES int = 5
+
+// YEAR_PATHS are the (gjson) paths, in order of preference, used to derive the year of a record.
+var YEAR_PATHS = []string{
+	"date",
+	"item.sort_date",
+	"item.created_published_date",
+}
+
+// ID_PATHS are the (gjson) paths, in order of preference, used to derive the ID of a record.
+var ID_PATHS = []string{
+	"item.id",
+	"id",
+}
+
+// TimelineOptions defines options for creating a new Timeline.
+type TimelineOptions struct {
+	// An optional (gjson) path whose value(s) are used to group records, for example "group" or "partof".
+	// Records with multiple values are counted once in each group.
+	GroupBy string
+	// The maximum number of sample item IDs to record for each year and decade.
+	Samples int
+}
+
+// Timeline counts records by year and decade. It is safe for concurrent use.
+type Timeline struct {
+	options *TimelineOptions
+	mu      *sync.Mutex
+	records int64
+	undated int64
+	groups  map[string]*group
+}
+
+type group struct {
+	records int64
+	undated int64
+	years   map[int]*Period
+	decades map[int]*Period
+}
+
+// Summary is the output of a Timeline.
+type Summary struct {
+	GroupBy string          `json:"group_by,omitempty"`
+	Records int64           `json:"records"`
+	Undated int64           `json:"undated"`
+	Groups  []*GroupSummary `json:"groups"`
+}
+
+// GroupSummary is the per-year and per-decade counts for a group of records.
+type GroupSummary struct {
+	Group   string    `json:"group"`
+	Records int64     `json:"records"`
+	Undated int64     `json:"undated"`
+	Years   []*Period `json:"years"`
+	Decades []*Period `json:"decades"`
+}
+
+// Period is the number of records for a year or a decade (identified by its first year) and a sample of their IDs.
+// The sample is the lexically smallest IDs, sorted, so it is the same however records are ordered.
+type Period struct {
+	Start   int      `json:"start"`
+	Count   int64    `json:"count"`
+	Samples []string `json:"samples"`
+}
+
+// NewTimeline returns a new Timeline instance.
+func NewTimeline(opts *TimelineOptions) *Timeline {
+
+	if opts.Samples < 0 {
+		opts.Samples = 0
+	}
+
+	t := &Timeline{
+		options: opts,
+		mu:      new(sync.Mutex),
+		groups:  make(map[string]*group),
+	}
+
+	return t
+}
+
+// Add derives the year, ID and group(s) of the JSON record 'body' and adds it to 't'.
+func (t *Timeline) Add(body []byte) {
+
+	year := 0
+	has_year := false
+
+	d, ok := dates.FromJSONPaths(body, YEAR_PATHS...)
+
+	if ok {
+		year = d.Year()
+		has_year = true
+	}
+
+	id := ""
+
+	for _, path := range ID_PATHS {
+
+		rsp := gjson.GetBytes(body, path)
+
+		if rsp.Exists() && rsp.String() != "" {
+			id = rsp.String()
+			break
+		}
+	}
+
+	groups := []string{GROUP_ALL}
+
+	if t.options.GroupBy != "" {
+
+		groups = make([]string, 0)
+		seen := make(map[string]bool)
+
+		rsp := gjson.GetBytes(body, t.options.GroupBy)
+
+		candidates := []gjson.Result{rsp}
+
+		if rsp.IsArray() {
+			candidates = rsp.Array()
+		}
+
+		for _, r := range candidates {
+
+			name := r.String()
+
+			if !r.Exists() || name == "" || seen[name] {
+				continue
+			}
+
+			seen[name] = true
+			groups = append(groups, name)
+		}
+
+		if len(groups) == 0 {
+			groups = append(groups, "")
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.records += 1
+
+	if !has_year {
+		t.undated += 1
+	}
+
+	for _, name := range groups {
+
+		g, ok := t.groups[name]
+
+		if !ok {
+
+			g = &group{
+				years:   make(map[int]*Period),
+				decades: make(map[int]*Period),
+			}
+
+			t.groups[name] = g
+		}
+
+		g.records += 1
+
+		if !has_year {
+			g.undated += 1
+			continue
+		}
+
+		t.increment(g.years, year, id)
+		t.increment(g.decades, decade(year), id)
+	}
+}
+
+func (t *Timeline) increment(periods map[int]*Period, start int, id string) {
+
+	p, ok := periods[start]
+
+	if !ok {
+
+		p = &Period{
+			Start:   start,
+			Samples: make([]string, 0),
+		}
+
+		periods[start] = p
+	}
+
+	p.Count += 1
+
+	if id == "" || t.options.Samples == 0 {
+		return
+	}
+
+	// Keep the (lexically) smallest IDs, in order, so that samples do not depend on the order records are added in
+
+	idx := sort.SearchStrings(p.Samples, id)
+
+	if idx < len(p.Samples) && p.Samples[idx] == id {
+		return
+	}
+
+	if idx >= t.options.Samples {
+		return
+	}
+
+	if len(p.Samples) < t.options.Samples {
+		p.Samples = append(p.Samples, "")
+	}
+
+	copy(p.Samples[idx+1:], p.Samples[idx:])
+	p.Samples[idx] = id
+}
+
+// Summary returns the counts recorded by 't' with groups sorted by name and periods sorted chronologically.
+func (t *Timeline) Summary() *Summary {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := &Summary{
+		GroupBy: t.options.GroupBy,
+		Records: t.records,
+		Undated: t.undated,
+		Groups:  make([]*GroupSummary, 0),
+	}
+
+	for name, g := range t.groups {
+
+		gs := &GroupSummary{
+			Group:   name,
+			Records: g.records,
+			Undated: g.undated,
+			Years:   sortedPeriods(g.years),
+			Decades: sortedPeriods(g.decades),
+		}
+
+		s.Groups = append(s.Groups, gs)
+	}
+
+	sort.Slice(s.Groups, func(i, j int) bool {
+		return s.Groups[i].Group < s.Groups[j].Group
+	})
+
+	return s
+}
+
+func sortedPeriods(periods map[int]*Period) []*Period {
+
+	sorted := make([]*Period, 0, len(periods))
+
+	for _, p := range periods {
+		sorted = append(sorted, p)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	return sorted
+}
+
+func decade(year int) int {
+
+	d := year - (year % 10)
+
+	if year < 0 && year%10 != 0 {
+		d -= 10
+	}
+
+	return d
+}
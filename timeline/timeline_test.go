@@ -0,0 +1,190 @@
+package timeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// periodCounts returns the start and count of each period in 'periods' as "{START}:{COUNT}" strings.
+func periodCounts(periods []*Period) []string {
+
+	counts := make([]string, len(periods))
+
+	for idx, p := range periods {
+		counts[idx] = fmt.Sprintf("%d:%d", p.Start, p.Count)
+	}
+
+	return counts
+}
+
+func TestTimelineBuckets(t *testing.T) {
+
+	records := []string{
+		`{"item": {"id": "a"}, "date": "1861"}`,
+		`{"item": {"id": "b"}, "date": "1865-04-14"}`,
+		`{"item": {"id": "c"}, "date": "ca. 1869-1872"}`,
+		`{"item": {"id": "d"}, "date": "1870s"}`,
+		`{"item": {"id": "e"}, "date": ["undated", "1900"]}`,
+		`{"item": {"id": "f", "sort_date": "1861-07"}}`,
+		`{"item": {"id": "g", "created_published_date": "1899"}, "date": "n.d."}`,
+		`{"item": {"id": "h"}, "date": "n.d."}`,
+		`{"id": "i"}`,
+	}
+
+	tl := NewTimeline(&TimelineOptions{Samples: DEFAULT_SAMPLES})
+
+	for _, body := range records {
+		tl.Add([]byte(body))
+	}
+
+	s := tl.Summary()
+
+	if s.Records != 9 || s.Undated != 2 || len(s.Groups) != 1 || s.Groups[0].Group != GROUP_ALL {
+		t.Fatalf("Unexpected summary, %d records, %d undated, %d groups", s.Records, s.Undated, len(s.Groups))
+	}
+
+	g := s.Groups[0]
+
+	years := periodCounts(g.Years)
+	expected := []string{"1861:2", "1865:1", "1869:1", "1870:1", "1899:1", "1900:1"}
+
+	if !reflect.DeepEqual(years, expected) {
+		t.Fatalf("Unexpected years %v, expected %v", years, expected)
+	}
+
+	decades := periodCounts(g.Decades)
+	expected = []string{"1860:4", "1870:1", "1890:1", "1900:1"}
+
+	if !reflect.DeepEqual(decades, expected) {
+		t.Fatalf("Unexpected decades %v, expected %v", decades, expected)
+	}
+
+	if !reflect.DeepEqual(g.Decades[0].Samples, []string{"a", "b", "c", "f"}) {
+		t.Fatalf("Unexpected samples %v", g.Decades[0].Samples)
+	}
+}
+
+func TestTimelineGroups(t *testing.T) {
+
+	records := []string{
+		`{"item": {"id": "a"}, "date": "1861", "partof": ["civil war", "photographs", "civil war"]}`,
+		`{"item": {"id": "b"}, "date": "1862", "partof": "photographs"}`,
+		`{"item": {"id": "c"}, "date": "1901"}`,
+		`{"item": {"id": "d"}, "partof": ["", "photographs"]}`,
+	}
+
+	tl := NewTimeline(&TimelineOptions{GroupBy: "partof", Samples: 1})
+
+	for _, body := range records {
+		tl.Add([]byte(body))
+	}
+
+	s := tl.Summary()
+
+	if s.GroupBy != "partof" || s.Records != 4 || s.Undated != 1 {
+		t.Fatalf("Unexpected summary %v", s)
+	}
+
+	groups := make([]string, len(s.Groups))
+
+	for idx, g := range s.Groups {
+		groups[idx] = fmt.Sprintf("%s:%d:%d:%v", g.Group, g.Records, g.Undated, periodCounts(g.Decades))
+	}
+
+	// Records are counted once in each distinct group; records without a group are in the "" group
+
+	expected := []string{
+		":1:0:[1900:1]",
+		"civil war:1:0:[1860:1]",
+		"photographs:3:1:[1860:2]",
+	}
+
+	if !reflect.DeepEqual(groups, expected) {
+		t.Fatalf("Unexpected groups %v, expected %v", groups, expected)
+	}
+
+	if !reflect.DeepEqual(s.Groups[2].Decades[0].Samples, []string{"a"}) {
+		t.Fatalf("Unexpected samples %v", s.Groups[2].Decades[0].Samples)
+	}
+}
+
+func TestTimelineSamples(t *testing.T) {
+
+	ids := make([]string, 50)
+
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%04d", i*7%50)
+	}
+
+	r := rand.New(rand.NewSource(1))
+
+	var expected string
+
+	for i := 0; i < 5; i++ {
+
+		r.Shuffle(len(ids), func(i int, j int) {
+			ids[i], ids[j] = ids[j], ids[i]
+		})
+
+		tl := NewTimeline(&TimelineOptions{Samples: 3})
+
+		for _, id := range ids {
+
+			tl.Add([]byte(fmt.Sprintf(`{"item": {"id": "%s"}, "date": "1865"}`, id)))
+
+			// Duplicate IDs are only sampled once
+			tl.Add([]byte(fmt.Sprintf(`{"item": {"id": "%s"}, "date": "1865"}`, id)))
+		}
+
+		// Records without an ID are counted but not sampled
+		tl.Add([]byte(`{"date": "1865"}`))
+
+		year := tl.Summary().Groups[0].Years[0]
+
+		if year.Count != 101 || !reflect.DeepEqual(year.Samples, []string{"0000", "0001", "0002"}) {
+			t.Fatalf("Unexpected year %d, %v", year.Count, year.Samples)
+		}
+
+		enc, _ := json.Marshal(tl.Summary())
+
+		if i == 0 {
+			expected = string(enc)
+		} else if string(enc) != expected {
+			t.Fatalf("Summary depends on the order records are added in")
+		}
+	}
+
+	// Samples can be disabled
+
+	tl := NewTimeline(&TimelineOptions{Samples: -1})
+	tl.Add([]byte(`{"item": {"id": "a"}, "date": "1865"}`))
+
+	if len(tl.Summary().Groups[0].Years[0].Samples) != 0 {
+		t.Fatalf("Expected no samples")
+	}
+}
+
+func TestDecade(t *testing.T) {
+
+	tests := map[int]int{
+		1865: 1860,
+		1860: 1860,
+		1869: 1860,
+		2000: 2000,
+		5:    0,
+		0:    0,
+		-1:   -10,
+		-10:  -10,
+		-11:  -20,
+	}
+
+	for year, expected := range tests {
+
+		if decade(year) != expected {
+			t.Fatalf("Unexpected decade for %d: %d, expected %d", year, decade(year), expected)
+		}
+	}
+}
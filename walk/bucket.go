@@ -0,0 +1,228 @@
+package walk
+
+import (
+	"context"
+	jw "github.com/aaronland/go-jsonl/walk"
+	"gocloud.dev/blob"
+	"io"
+	"strings"
+	"sync"
+)
+
+// walkItem is a record, or an error, waiting to be passed to a callback function.
+type walkItem struct {
+	record *jw.WalkRecord
+	err    error
+	// The path and line number of the item if it is being tracked by a Checkpoint.
+	path    string
+	line    int
+	tracked bool
+}
+
+// WalkBucket reads every file in 'bucket' whose path begins with 'opts.URI' and invokes 'opts.Callback' for each
+// record (or error) encountered. Files are read, and callbacks invoked, by pools of 'opts.Workers' goroutines. If
+// a callback returns an error the walk is cancelled and that error is returned. WalkBucket does not return until
+// every record has been passed to a callback.
+func WalkBucket(ctx context.Context, opts *WalkOptions, bucket *blob.Bucket) error {
+
+	producer := func(ctx context.Context, paths_ch chan<- string, items_ch chan<- *walkItem) {
+
+		iter := bucket.List(&blob.ListOptions{
+			Prefix: opts.URI,
+		})
+
+		for {
+
+			obj, err := iter.Next(ctx)
+
+			if err == io.EOF {
+				return
+			}
+
+			if err != nil {
+
+				if ctx.Err() != nil {
+					return
+				}
+
+				e := &jw.WalkError{
+					Path: opts.URI,
+					Err:  err,
+				}
+
+				sendItem(ctx, items_ch, &walkItem{err: e})
+				return
+			}
+
+			if obj.IsDir || obj.Size == 0 {
+				continue
+			}
+
+			// trailing slashes confuse Go Cloud...
+
+			path := strings.TrimRight(obj.Key, "/")
+
+			if opts.Filter != nil && !opts.Filter(ctx, path) {
+				continue
+			}
+
+			if opts.Checkpoint != nil && opts.Checkpoint.IsComplete(path) {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case paths_ch <- path:
+				// pass
+			}
+		}
+	}
+
+	return walk(ctx, opts, bucket, producer)
+}
+
+// WalkLibraryofCongressRecord reads the file 'uri' in 'bucket' and invokes 'opts.Callback' for each record
+// (or error) encountered. It does not return until every record has been passed to a callback.
+func WalkLibraryofCongressRecord(ctx context.Context, opts *WalkOptions, bucket *blob.Bucket, uri string) error {
+
+	producer := func(ctx context.Context, paths_ch chan<- string, items_ch chan<- *walkItem) {
+
+		if opts.Checkpoint != nil && opts.Checkpoint.IsComplete(uri) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case paths_ch <- uri:
+			// pass
+		}
+	}
+
+	return walk(ctx, opts, bucket, producer)
+}
+
+type producerFunc func(context.Context, chan<- string, chan<- *walkItem)
+
+// walk runs the pipeline shared by WalkBucket and WalkLibraryofCongressRecord: 'producer' emits the paths to read,
+// a pool of readers parses those files in to records and a pool of workers passes each record to the callback.
+func walk(ctx context.Context, opts *WalkOptions, bucket *blob.Bucket, producer producerFunc) error {
+
+	walk_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := opts.Workers
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	paths_ch := make(chan string)
+	items_ch := make(chan *walkItem, workers)
+
+	var walk_err error
+	err_once := new(sync.Once)
+
+	fail := func(err error) {
+
+		err_once.Do(func() {
+			walk_err = err
+			cancel()
+		})
+	}
+
+	go func() {
+		defer close(paths_ch)
+		producer(walk_ctx, paths_ch, items_ch)
+	}()
+
+	readers_wg := new(sync.WaitGroup)
+
+	for i := 0; i < workers; i++ {
+
+		readers_wg.Add(1)
+
+		go func() {
+
+			defer readers_wg.Done()
+
+			for path := range paths_ch {
+				readPath(walk_ctx, opts, bucket, path, items_ch)
+			}
+		}()
+	}
+
+	go func() {
+		readers_wg.Wait()
+		close(items_ch)
+	}()
+
+	callbacks_wg := new(sync.WaitGroup)
+
+	for i := 0; i < workers; i++ {
+
+		callbacks_wg.Add(1)
+
+		go func() {
+
+			defer callbacks_wg.Done()
+
+			for item := range items_ch {
+
+				// Keep draining the channel once the walk has been cancelled so that
+				// readers are never left blocking on a send.
+
+				if walk_ctx.Err() != nil {
+					continue
+				}
+
+				err := opts.Callback(walk_ctx, item.record, item.err)
+
+				if err != nil {
+					fail(err)
+					continue
+				}
+
+				if item.tracked {
+
+					err := opts.Checkpoint.complete(walk_ctx, item.path, item.line)
+
+					if err != nil {
+						fail(err)
+					}
+				}
+			}
+		}()
+	}
+
+	callbacks_wg.Wait()
+
+	if opts.Checkpoint != nil {
+
+		// Use a fresh context so that progress is still recorded if 'ctx' has been cancelled
+
+		err := opts.Checkpoint.Save(context.Background())
+
+		if err != nil && walk_err == nil {
+			walk_err = err
+		}
+	}
+
+	if walk_err != nil {
+		return walk_err
+	}
+
+	return ctx.Err()
+}
+
+// sendItem sends 'item' to 'items_ch' unless 'ctx' has been cancelled, returning false in that case.
+func sendItem(ctx context.Context, items_ch chan<- *walkItem, item *walkItem) bool {
+
+	select {
+	case <-ctx.Done():
+		return false
+	case items_ch <- item:
+		return true
+	}
+}
@@ -0,0 +1,307 @@
+package walk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	jw "github.com/aaronland/go-jsonl/walk"
+	"github.com/aaronland/go-libraryofcongress-datajam/record"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testBucket returns a new in-memory bucket containing 'files' files, named "data/{N}.jsonl", each with 'lines'
+// records whose "id" property is "{FILE}-{LINE}".
+func testBucket(t *testing.T, files int, lines int) *blob.Bucket {
+
+	t.Helper()
+
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+
+	for f := 0; f < files; f++ {
+
+		var buf strings.Builder
+
+		for l := 1; l <= lines; l++ {
+			fmt.Fprintf(&buf, `{"id":"%d-%d"}`+"\n", f, l)
+		}
+
+		err := bucket.WriteAll(ctx, fmt.Sprintf("data/%03d.jsonl", f), []byte(buf.String()), nil)
+
+		if err != nil {
+			t.Fatalf("Failed to write test file, %v", err)
+		}
+	}
+
+	return bucket
+}
+
+// walkWithTimeout calls WalkBucket failing the test if it does not return within a minute.
+func walkWithTimeout(t *testing.T, ctx context.Context, opts *WalkOptions, bucket *blob.Bucket) error {
+
+	t.Helper()
+
+	done_ch := make(chan error, 1)
+
+	go func() {
+		done_ch <- WalkBucket(ctx, opts, bucket)
+	}()
+
+	select {
+	case err := <-done_ch:
+		return err
+	case <-time.After(time.Minute):
+		t.Fatalf("Walk did not return, deadlock?")
+	}
+
+	return nil
+}
+
+// checkGoroutines fails the test if the number of goroutines does not return to 'baseline' within a few seconds.
+func checkGoroutines(t *testing.T, baseline int) {
+
+	t.Helper()
+
+	for i := 0; i < 100; i++ {
+
+		if runtime.NumGoroutine() <= baseline {
+			return
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatalf("Expected %d goroutines, got %d", baseline, runtime.NumGoroutine())
+}
+
+func TestWalkBucket(t *testing.T) {
+
+	bucket := testBucket(t, 10, 100)
+	defer bucket.Close()
+
+	mu := new(sync.Mutex)
+	seen := make(map[string]bool)
+
+	cb := func(ctx context.Context, rec *jw.WalkRecord, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		id := string(rec.Body)
+
+		if seen[id] {
+			return fmt.Errorf("Record %s seen more than once", id)
+		}
+
+		seen[id] = true
+		return nil
+	}
+
+	opts := &WalkOptions{
+		URI:      "data/",
+		Workers:  4,
+		Callback: cb,
+	}
+
+	err := walkWithTimeout(t, context.Background(), opts, bucket)
+
+	if err != nil {
+		t.Fatalf("Failed to walk bucket, %v", err)
+	}
+
+	if len(seen) != 1000 {
+		t.Fatalf("Expected 1000 records, got %d", len(seen))
+	}
+}
+
+func TestWalkBucketOrder(t *testing.T) {
+
+	bucket := testBucket(t, 3, 500)
+	defer bucket.Close()
+
+	ids := make([]string, 0)
+
+	cb := func(ctx context.Context, rec *jw.WalkRecord, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		ids = append(ids, string(rec.Body))
+		return nil
+	}
+
+	opts := &WalkOptions{
+		URI:      "data/",
+		Workers:  1,
+		Callback: cb,
+	}
+
+	err := walkWithTimeout(t, context.Background(), opts, bucket)
+
+	if err != nil {
+		t.Fatalf("Failed to walk bucket, %v", err)
+	}
+
+	if len(ids) != 1500 {
+		t.Fatalf("Expected 1500 records, got %d", len(ids))
+	}
+
+	idx := 0
+
+	for f := 0; f < 3; f++ {
+
+		for l := 1; l <= 500; l++ {
+
+			expected := fmt.Sprintf(`{"id":"%d-%d"}`, f, l)
+
+			if ids[idx] != expected {
+				t.Fatalf("Expected record %d to be %s, got %s", idx, expected, ids[idx])
+			}
+
+			idx += 1
+		}
+	}
+}
+
+func TestWalkBucketCallbackError(t *testing.T) {
+
+	bucket := testBucket(t, 20, 1000)
+	defer bucket.Close()
+
+	baseline := runtime.NumGoroutine()
+
+	for _, workers := range []int{1, 2, 8} {
+
+		cb_err := errors.New("Callback failed")
+		count := int64(0)
+
+		cb := func(ctx context.Context, rec *jw.WalkRecord, err error) error {
+
+			if atomic.AddInt64(&count, 1) == 10 {
+				return cb_err
+			}
+
+			return nil
+		}
+
+		opts := &WalkOptions{
+			URI:      "data/",
+			Workers:  workers,
+			Callback: cb,
+		}
+
+		err := walkWithTimeout(t, context.Background(), opts, bucket)
+
+		if !errors.Is(err, cb_err) {
+			t.Fatalf("Expected callback error with %d workers, got %v", workers, err)
+		}
+
+		// Callbacks already in progress may finish but no new records should be passed to a callback
+
+		if atomic.LoadInt64(&count) >= 10+int64(workers) {
+			t.Fatalf("Expected walk to stop after callback error with %d workers, got %d callbacks", workers, count)
+		}
+
+		checkGoroutines(t, baseline)
+	}
+}
+
+func TestWalkBucketCancel(t *testing.T) {
+
+	bucket := testBucket(t, 20, 1000)
+	defer bucket.Close()
+
+	baseline := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	count := int64(0)
+
+	cb := func(ctx context.Context, rec *jw.WalkRecord, err error) error {
+
+		if atomic.AddInt64(&count, 1) == 10 {
+			cancel()
+		}
+
+		return nil
+	}
+
+	opts := &WalkOptions{
+		URI:      "data/",
+		Workers:  4,
+		Callback: cb,
+	}
+
+	err := walkWithTimeout(t, ctx, opts, bucket)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	if atomic.LoadInt64(&count) >= 20000 {
+		t.Fatalf("Expected walk to stop when cancelled")
+	}
+
+	checkGoroutines(t, baseline)
+}
+
+func TestWalkLibraryOfCongressRecordCallback(t *testing.T) {
+
+	ctx := context.Background()
+
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	err := bucket.WriteAll(ctx, "data.jsonl", []byte("{\"item\":{\"id\":\"1\"}}\n[]\n{\"item\":{\"id\":\"3\"}}\n"), nil)
+
+	if err != nil {
+		t.Fatalf("Failed to write test file, %v", err)
+	}
+
+	ids := make([]string, 0)
+	decode_errors := make([]int, 0)
+
+	cb := func(ctx context.Context, rec *record.Record, err error) error {
+
+		if err != nil {
+
+			if !IsDecodeError(err) {
+				return err
+			}
+
+			decode_errors = append(decode_errors, err.(*jw.WalkError).LineNumber)
+			return nil
+		}
+
+		ids = append(ids, rec.ItemId())
+		return nil
+	}
+
+	opts := &WalkOptions{
+		Workers:  1,
+		Callback: LibraryOfCongressRecordCallback(cb),
+	}
+
+	err = WalkLibraryofCongressRecord(ctx, opts, bucket, "data.jsonl")
+
+	if err != nil {
+		t.Fatalf("Failed to walk records, %v", err)
+	}
+
+	if strings.Join(ids, ",") != "1,3" || len(decode_errors) != 1 || decode_errors[0] != 2 {
+		t.Fatalf("Unexpected records %v and decode errors %v", ids, decode_errors)
+	}
+}
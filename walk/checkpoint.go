@@ -0,0 +1,334 @@
+package walk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aaronland/go-libraryofcongress-datajam"
+	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The default interval between writes of a checkpoint file during a walk.
+const DEFAULT_CHECKPOINT_INTERVAL time.Duration = 30 * time.Second
+
+// Checkpoint records the progress of one or more walks so that they may be resumed later. Progress is recorded
+// per file as the highest line number for which that line, and every line before it, has been successfully
+// processed by a callback along with any later lines that have also been processed (callbacks may complete
+// out of order) so that resumed walks neither skip nor repeat lines.
+type Checkpoint struct {
+	// The minimum interval between writes of the checkpoint file.
+	Interval time.Duration
+	bucket   *blob.Bucket
+	key      string
+	mu       *sync.Mutex
+	save_mu  *sync.Mutex
+	files    map[string]*checkpointFile
+	last     time.Time
+}
+
+// checkpointFile tracks the progress of an individual file.
+type checkpointFile struct {
+	Line     int  `json:"line"`
+	Complete bool `json:"complete"`
+	// The lines after Line that have been processed.
+	Done    []int `json:"done,omitempty"`
+	read    int
+	eof     bool
+	pending map[int]bool
+	done    map[int]bool
+}
+
+type checkpointDocument struct {
+	Updated string                     `json:"updated"`
+	Files   map[string]*checkpointFile `json:"files"`
+}
+
+// NewCheckpoint returns a new Checkpoint instance that reads and writes its state to 'uri' which is either a
+// local path or a GoCloud bucket URI with the name of the checkpoint file appended to its path (for example
+// "file:///tmp/walk.json" or "s3://bucket/walk.json?region=us-east-1"). If 'resume' is true any existing state
+// is loaded, otherwise the walk is started from scratch.
+func NewCheckpoint(ctx context.Context, uri string, resume bool) (*Checkpoint, error) {
+
+	u, err := url.Parse(uri)
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse checkpoint URI, %w", err)
+	}
+
+	if u.Scheme == "" {
+
+		abs_path, err := filepath.Abs(uri)
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to derive absolute path for checkpoint, %w", err)
+		}
+
+		u = &url.URL{
+			Scheme: "file",
+			Path:   filepath.ToSlash(abs_path),
+		}
+	}
+
+	key := path.Base(u.Path)
+	u.Path = path.Dir(u.Path)
+
+	if key == "" || key == "/" || key == "." {
+		return nil, fmt.Errorf("Checkpoint URI is missing a filename")
+	}
+
+	_, bucket, err := datajam.OpenBucket(ctx, u.String())
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open checkpoint bucket, %w", err)
+	}
+
+	cp := &Checkpoint{
+		Interval: DEFAULT_CHECKPOINT_INTERVAL,
+		bucket:   bucket,
+		key:      key,
+		mu:       new(sync.Mutex),
+		save_mu:  new(sync.Mutex),
+		files:    make(map[string]*checkpointFile),
+		last:     time.Now(),
+	}
+
+	if !resume {
+		return cp, nil
+	}
+
+	body, err := bucket.ReadAll(ctx, key)
+
+	if err != nil {
+
+		if gcerrors.Code(err) == gcerrors.NotFound {
+			return cp, nil
+		}
+
+		bucket.Close()
+		return nil, fmt.Errorf("Failed to read checkpoint %s, %w", key, err)
+	}
+
+	var doc *checkpointDocument
+
+	err = json.Unmarshal(body, &doc)
+
+	if err != nil {
+		bucket.Close()
+		return nil, fmt.Errorf("Failed to unmarshal checkpoint %s, %w", key, err)
+	}
+
+	if doc != nil && doc.Files != nil {
+
+		for p, f := range doc.Files {
+
+			f.read = f.Line
+			f.eof = f.Complete
+			f.done = make(map[int]bool)
+
+			for _, line := range f.Done {
+				f.done[line] = true
+			}
+
+			cp.files[p] = f
+		}
+	}
+
+	return cp, nil
+}
+
+// IsComplete returns true if every line in 'path' has been processed.
+func (cp *Checkpoint) IsComplete(path string) bool {
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	f, ok := cp.files[path]
+	return ok && f.Complete
+}
+
+// Save writes the current state of 'cp' to its checkpoint file.
+func (cp *Checkpoint) Save(ctx context.Context) error {
+
+	cp.save_mu.Lock()
+	defer cp.save_mu.Unlock()
+
+	cp.mu.Lock()
+
+	doc := &checkpointDocument{
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Files:   make(map[string]*checkpointFile),
+	}
+
+	for p, f := range cp.files {
+
+		done := make([]int, 0, len(f.done))
+
+		for line := range f.done {
+			done = append(done, line)
+		}
+
+		sort.Ints(done)
+
+		doc.Files[p] = &checkpointFile{
+			Line:     f.Line,
+			Complete: f.Complete,
+			Done:     done,
+		}
+	}
+
+	cp.last = time.Now()
+	cp.mu.Unlock()
+
+	enc_doc, err := json.MarshalIndent(doc, "", "  ")
+
+	if err != nil {
+		return fmt.Errorf("Failed to marshal checkpoint, %w", err)
+	}
+
+	err = cp.bucket.WriteAll(ctx, cp.key, enc_doc, nil)
+
+	if err != nil {
+		return fmt.Errorf("Failed to write checkpoint %s, %w", cp.key, err)
+	}
+
+	return nil
+}
+
+// Close closes the bucket underlying 'cp'. The checkpoint file is written at the end of every walk
+// so there is no need to call Save before calling Close.
+func (cp *Checkpoint) Close() error {
+	return cp.bucket.Close()
+}
+
+// resumeLine returns the last line in 'path' before which every line was processed in a previous walk, and the
+// set of later lines that were also processed, registering 'path' if necessary.
+func (cp *Checkpoint) resumeLine(path string) (int, map[int]bool) {
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	f, ok := cp.files[path]
+
+	if !ok {
+		f = &checkpointFile{}
+		cp.files[path] = f
+	}
+
+	if f.done == nil {
+		f.done = make(map[int]bool)
+	}
+
+	f.pending = make(map[int]bool)
+	f.read = f.Line
+	f.eof = false
+
+	done := make(map[int]bool, len(f.done))
+
+	for line := range f.done {
+		done[line] = true
+	}
+
+	return f.Line, done
+}
+
+// dispatch records that 'line' in 'path' has been read and is waiting to be passed to a callback.
+func (cp *Checkpoint) dispatch(path string, line int) {
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	f := cp.files[path]
+	f.pending[line] = true
+	f.read = line
+
+	f.update()
+}
+
+// skip records that 'line' in 'path' has been read but will not be passed to a callback.
+func (cp *Checkpoint) skip(path string, line int) {
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	f := cp.files[path]
+	f.read = line
+
+	f.update()
+}
+
+// finish records that every line in 'path' has been read.
+func (cp *Checkpoint) finish(path string) {
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	f := cp.files[path]
+	f.eof = true
+
+	f.update()
+}
+
+// complete records that 'line' in 'path' has been successfully processed by a callback and writes the
+// checkpoint file if more than 'cp.Interval' has passed since it was last written.
+func (cp *Checkpoint) complete(ctx context.Context, path string, line int) error {
+
+	cp.mu.Lock()
+
+	f, ok := cp.files[path]
+
+	if ok {
+		delete(f.pending, line)
+		f.done[line] = true
+		f.update()
+	}
+
+	should_save := time.Since(cp.last) >= cp.Interval
+
+	if should_save {
+		// Prevent other callbacks from triggering a save at the same time
+		cp.last = time.Now()
+	}
+
+	cp.mu.Unlock()
+
+	if !should_save {
+		return nil
+	}
+
+	return cp.Save(ctx)
+}
+
+func (f *checkpointFile) update() {
+
+	if len(f.pending) == 0 {
+		f.Line = f.read
+		f.Complete = f.eof
+	} else {
+
+		lowest := -1
+
+		for line := range f.pending {
+
+			if lowest == -1 || line < lowest {
+				lowest = line
+			}
+		}
+
+		f.Line = lowest - 1
+		f.Complete = false
+	}
+
+	for line := range f.done {
+
+		if line <= f.Line {
+			delete(f.done, line)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package walk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	jw "github.com/aaronland/go-jsonl/walk"
+	_ "gocloud.dev/blob/fileblob"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestCheckpointOutOfOrder(t *testing.T) {
+
+	ctx := context.Background()
+	uri := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	cp, err := NewCheckpoint(ctx, uri, false)
+
+	if err != nil {
+		t.Fatalf("Failed to create checkpoint, %v", err)
+	}
+
+	// Lines 1-6 are read, line 4 is filtered and lines 3, 6 and 1 are completed (in that order) leaving lines 2
+	// and 5 in progress
+
+	line, done := cp.resumeLine("a.jsonl")
+
+	if line != 0 || len(done) != 0 {
+		t.Fatalf("Unexpected resume line %d for new file", line)
+	}
+
+	for _, l := range []int{1, 2, 3} {
+		cp.dispatch("a.jsonl", l)
+	}
+
+	cp.skip("a.jsonl", 4)
+	cp.dispatch("a.jsonl", 5)
+	cp.dispatch("a.jsonl", 6)
+	cp.finish("a.jsonl")
+
+	for _, l := range []int{3, 6, 1} {
+
+		err := cp.complete(ctx, "a.jsonl", l)
+
+		if err != nil {
+			t.Fatalf("Failed to complete line %d, %v", l, err)
+		}
+	}
+
+	f := cp.files["a.jsonl"]
+
+	if f.Line != 1 || f.Complete {
+		t.Fatalf("Unexpected progress, line %d complete %t", f.Line, f.Complete)
+	}
+
+	err = cp.Save(ctx)
+
+	if err != nil {
+		t.Fatalf("Failed to save checkpoint, %v", err)
+	}
+
+	cp.Close()
+
+	cp, err = NewCheckpoint(ctx, uri, true)
+
+	if err != nil {
+		t.Fatalf("Failed to resume checkpoint, %v", err)
+	}
+
+	defer cp.Close()
+
+	if cp.IsComplete("a.jsonl") {
+		t.Fatalf("Expected file to be incomplete")
+	}
+
+	line, done = cp.resumeLine("a.jsonl")
+
+	if line != 1 || len(done) != 2 || !done[3] || !done[6] {
+		t.Fatalf("Unexpected resume line %d and done lines %v", line, done)
+	}
+
+	// Only lines 2 and 5 (and the filtered line 4) need to be read again
+
+	cp.dispatch("a.jsonl", 2)
+	cp.skip("a.jsonl", 3)
+	cp.skip("a.jsonl", 4)
+	cp.dispatch("a.jsonl", 5)
+	cp.skip("a.jsonl", 6)
+	cp.finish("a.jsonl")
+
+	for _, l := range []int{5, 2} {
+
+		err := cp.complete(ctx, "a.jsonl", l)
+
+		if err != nil {
+			t.Fatalf("Failed to complete line %d, %v", l, err)
+		}
+	}
+
+	if !cp.IsComplete("a.jsonl") || len(cp.files["a.jsonl"].done) != 0 {
+		t.Fatalf("Expected file to be complete")
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+
+	ctx := context.Background()
+	uri := filepath.Join(t.TempDir(), "checkpoint.json")
+
+	bucket := testBucket(t, 4, 500)
+	defer bucket.Close()
+
+	mu := new(sync.Mutex)
+	seen := make(map[string]int)
+
+	cb_err := errors.New("Interrupted")
+
+	// The first walk fails part way through, while other callbacks are still running, so lines are completed
+	// out of order. Every walk after that is interrupted after fewer and fewer records.
+
+	for i, limit := range []int{700, 400, 100, -1} {
+
+		cp, err := NewCheckpoint(ctx, uri, i > 0)
+
+		if err != nil {
+			t.Fatalf("Failed to create checkpoint, %v", err)
+		}
+
+		count := 0
+
+		cb := func(ctx context.Context, rec *jw.WalkRecord, err error) error {
+
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if limit != -1 && count >= limit {
+				return cb_err
+			}
+
+			count += 1
+			seen[string(rec.Body)] += 1
+			return nil
+		}
+
+		opts := &WalkOptions{
+			URI:        "data/",
+			Workers:    8,
+			Callback:   cb,
+			Checkpoint: cp,
+		}
+
+		err = walkWithTimeout(t, ctx, opts, bucket)
+
+		if limit == -1 && err != nil {
+			t.Fatalf("Failed to walk bucket, %v", err)
+		}
+
+		if limit != -1 && !errors.Is(err, cb_err) {
+			t.Fatalf("Expected walk %d to be interrupted, got %v", i, err)
+		}
+
+		cp.Close()
+	}
+
+	for f := 0; f < 4; f++ {
+
+		for l := 1; l <= 500; l++ {
+
+			id := fmt.Sprintf(`{"id":"%d-%d"}`, f, l)
+
+			if seen[id] != 1 {
+				t.Fatalf("Record %s was processed %d times", id, seen[id])
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package walk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/aaronland/go-json-query"
+	jw "github.com/aaronland/go-jsonl/walk"
+	"github.com/aaronland/go-libraryofcongress-datajam/compression"
+	"github.com/tidwall/pretty"
+	"gocloud.dev/blob"
+	"io"
+)
+
+// readPath reads the line-separated JSON records in 'path' and sends them to 'items_ch'. Errors are sent to
+// 'items_ch' as `jw.WalkError` instances. It returns when the file has been read or 'ctx' has been cancelled.
+func readPath(ctx context.Context, opts *WalkOptions, bucket *blob.Bucket, path string, items_ch chan<- *walkItem) {
+
+	fh, err := bucket.NewReader(ctx, path, nil)
+
+	if err != nil {
+
+		e := &jw.WalkError{
+			Path: path,
+			Err:  err,
+		}
+
+		sendItem(ctx, items_ch, &walkItem{err: e})
+		return
+	}
+
+	defer fh.Close()
+
+	c := compression.FromPath(path)
+
+	if c == compression.NONE {
+
+		c = opts.Compression
+
+		if opts.IsBzip {
+			c = compression.BZIP2
+		}
+	}
+
+	r, err := compression.NewReaderWithCompression(c, fh)
+
+	if err != nil {
+
+		e := &jw.WalkError{
+			Path: path,
+			Err:  err,
+		}
+
+		sendItem(ctx, items_ch, &walkItem{err: e})
+		return
+	}
+
+	defer r.Close()
+
+	reader := bufio.NewReader(r)
+	lineno := 0
+
+	cp := opts.Checkpoint
+	resume_line := 0
+	done := map[int]bool{}
+
+	if cp != nil {
+		resume_line, done = cp.resumeLine(path)
+	}
+
+	for {
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		lineno += 1
+
+		body, read_err := reader.ReadBytes('\n')
+
+		if read_err != nil && read_err != io.EOF {
+
+			e := &jw.WalkError{
+				Path:       path,
+				LineNumber: lineno,
+				Err:        read_err,
+			}
+
+			sendItem(ctx, items_ch, &walkItem{err: e})
+			return
+		}
+
+		body = bytes.TrimSpace(body)
+
+		if len(body) > 0 && lineno > resume_line && !done[lineno] {
+
+			item := parseLine(ctx, opts, path, lineno, body)
+
+			if cp != nil {
+
+				if item == nil {
+					cp.skip(path, lineno)
+				} else {
+					item.path = path
+					item.line = lineno
+					item.tracked = true
+					cp.dispatch(path, lineno)
+				}
+			}
+
+			if item != nil && !sendItem(ctx, items_ch, item) {
+				return
+			}
+
+		} else if cp != nil && lineno > resume_line {
+			cp.skip(path, lineno)
+		}
+
+		if read_err == io.EOF {
+
+			if cp != nil {
+				cp.finish(path)
+			}
+
+			return
+		}
+	}
+}
+
+// parseLine validates, filters and formats 'body' according to 'opts' returning a walkItem to pass to a callback
+// or nil if the record does not match 'opts.QuerySet'.
+func parseLine(ctx context.Context, opts *WalkOptions, path string, lineno int, body []byte) *walkItem {
+
+	if opts.ValidateJSON {
+
+		var stub interface{}
+
+		err := json.Unmarshal(body, &stub)
+
+		if err != nil {
+
+			e := &jw.WalkError{
+				Path:       path,
+				LineNumber: lineno,
+				Err:        err,
+			}
+
+			return &walkItem{err: e}
+		}
+	}
+
+	if opts.QuerySet != nil {
+
+		matches, err := query.Matches(ctx, opts.QuerySet, body)
+
+		if err != nil {
+
+			e := &jw.WalkError{
+				Path:       path,
+				LineNumber: lineno,
+				Err:        err,
+			}
+
+			return &walkItem{err: e}
+		}
+
+		if !matches {
+			return nil
+		}
+	}
+
+	if opts.Expression != nil && !opts.Expression.Matches(body) {
+		return nil
+	}
+
+	if opts.FormatJSON {
+		body = pretty.Pretty(body)
+	}
+
+	rec := &jw.WalkRecord{
+		Path:       path,
+		LineNumber: lineno,
+		Body:       body,
+	}
+
+	return &walkItem{record: rec}
+}
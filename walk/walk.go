@@ -1,115 +1,84 @@
+// package walk provides methods for walking line-separated JSON Library of Congress records stored in a bucket.
 package walk
 
 import (
 	"context"
+	"errors"
 	"github.com/aaronland/go-json-query"
 	jw "github.com/aaronland/go-jsonl/walk"
-	"gocloud.dev/blob"
+	"github.com/aaronland/go-libraryofcongress-datajam/expr"
+	"github.com/aaronland/go-libraryofcongress-datajam/record"
 	_ "log"
 )
 
+// WalkOptions defines options for walking records in a bucket.
 type WalkOptions struct {
-	URI          string
+	// The prefix of the files to walk in a bucket.
+	URI string
+	// The maximum number of files to read, and callbacks to invoke, concurrently.
 	Workers      int
 	ValidateJSON bool
 	FormatJSON   bool
 	QuerySet     *query.QuerySet
-	Callback     WalkRecordCallbackFunc
-	IsBzip       bool
-	Filter       jw.WalkFilterFunc
+	// An optional expression that records must match (in addition to QuerySet) to be passed to Callback.
+	Expression expr.Expression
+	Callback   WalkRecordCallbackFunc
+	// Force files to be treated as bzip2 compressed. Files ending in ".bz2" or ".gz" are always decompressed.
+	IsBzip bool
+	// The compression scheme (see the compression package) of files whose names do not end in ".bz2" or ".gz".
+	// This is ignored if IsBzip is true.
+	Compression string
+	Filter      jw.WalkFilterFunc
+	// An optional Checkpoint used to record progress and to skip files and lines processed by a previous walk.
+	Checkpoint *Checkpoint
 }
 
+// WalkRecordCallbackFunc is a callback function invoked for each record, or error, encountered during a walk.
+// Returning an error cancels the walk.
 type WalkRecordCallbackFunc func(context.Context, *jw.WalkRecord, error) error
 
-func WalkBucket(ctx context.Context, opts *WalkOptions, bucket *blob.Bucket) error {
+// WalkLibraryOfCongressRecordCallbackFunc is a callback function invoked with a decoded Library of Congress record.
+type WalkLibraryOfCongressRecordCallbackFunc func(context.Context, *record.Record, error) error
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+// IsDecodeError returns true if 'err' is an error, passed to a WalkLibraryOfCongressRecordCallbackFunc, signaling
+// that a record could not be decoded. Callbacks will typically log these errors and skip the record rather than
+// returning an error, which would cancel the walk.
+func IsDecodeError(err error) bool {
 
-	cb := opts.Callback
+	e, ok := err.(*jw.WalkError)
 
-	jw_record_ch := make(chan *jw.WalkRecord)
-	jw_error_ch := make(chan *jw.WalkError)
-
-	done_ch := make(chan bool)
-
-	jw_opts := &jw.WalkOptions{
-		URI:           opts.URI,
-		Workers:       opts.Workers,
-		RecordChannel: jw_record_ch,
-		ErrorChannel:  jw_error_ch,
-		DoneChannel:   done_ch,
-		FormatJSON:    opts.FormatJSON,
-		ValidateJSON:  opts.ValidateJSON,
-		QuerySet:      opts.QuerySet,
-		IsBzip:        opts.IsBzip,
-		Filter:        opts.Filter,
+	if !ok {
+		return false
 	}
 
-	go func() {
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case err := <-jw_error_ch:
-				cb(ctx, nil, err)
-			case rec := <-jw_record_ch:
-				cb(ctx, rec, nil)
-			default:
-				// pass
-			}
-		}
-	}()
-
-	return jw.WalkBucket(ctx, jw_opts, bucket)
+	return errors.Is(e.Err, record.ErrInvalidRecord)
 }
 
-func WalkLibraryofCongressRecord(ctx context.Context, opts *WalkOptions, bucket *blob.Bucket, uri string) error {
+// LibraryOfCongressRecordCallback returns a WalkRecordCallbackFunc that decodes each record's body in to a
+// `record.Record` instance before passing it to 'cb'. Decoding errors are passed to 'cb' as `jw.WalkError` instances.
+func LibraryOfCongressRecordCallback(cb WalkLibraryOfCongressRecordCallbackFunc) WalkRecordCallbackFunc {
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	fn := func(ctx context.Context, rec *jw.WalkRecord, err error) error {
 
-	fh, err := bucket.NewReader(ctx, uri, nil)
+		if err != nil {
+			return cb(ctx, nil, err)
+		}
 
-	if err != nil {
-		return err
-	}
+		r, err := record.Unmarshal(rec.Body)
 
-	defer fh.Close()
+		if err != nil {
 
-	cb := opts.Callback
+			e := &jw.WalkError{
+				Path:       rec.Path,
+				LineNumber: rec.LineNumber,
+				Err:        err,
+			}
 
-	jw_record_ch := make(chan *jw.WalkRecord)
-	jw_error_ch := make(chan *jw.WalkError)
+			return cb(ctx, nil, e)
+		}
 
-	jw_opts := &jw.WalkOptions{
-		URI:           opts.URI,
-		Workers:       opts.Workers,
-		RecordChannel: jw_record_ch,
-		ErrorChannel:  jw_error_ch,
-		FormatJSON:    opts.FormatJSON,
-		ValidateJSON:  opts.ValidateJSON,
-		QuerySet:      opts.QuerySet,
-		IsBzip:        opts.IsBzip,
+		return cb(ctx, r, nil)
 	}
 
-	go func() {
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case err := <-jw_error_ch:
-				cb(ctx, nil, err)
-			case rec := <-jw_record_ch:
-				cb(ctx, rec, nil)
-			default:
-				// pass
-			}
-		}
-	}()
-
-	jw.WalkReader(ctx, jw_opts, fh)
-	return nil
+	return fn
 }